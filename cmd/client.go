@@ -155,6 +155,43 @@ var ClientCmd = &cli.Command{
 				return nil
 			},
 		},
+		{
+			Name:    "usage",
+			Aliases: []string{"u"},
+			Usage:   "get the bytes allocated and received by a space, or by every space",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:    "space-did",
+					Aliases: []string{"sd"},
+					Usage:   "did for the space to get usage for (omit for the whole node)",
+					EnvVars: []string{"PIRI_CLIENT_SPACE_DID"},
+				},
+			}, ClientSetupFlags...),
+			Action: func(cCtx *cli.Context) error {
+				client, err := getClient(cCtx)
+				if err != nil {
+					return err
+				}
+				var space *did.DID
+				if cCtx.IsSet("space-did") {
+					spaceDid, err := did.Parse(cCtx.String("space-did"))
+					if err != nil {
+						return fmt.Errorf("parsing space did: %w", err)
+					}
+					space = &spaceDid
+				}
+				ok, err := client.Usage(space)
+				if err != nil {
+					return fmt.Errorf("getting usage: %w", err)
+				}
+				asJSON, err := json.MarshalIndent(ok, "", "  ")
+				if err != nil {
+					return fmt.Errorf("marshaling usage to json: %w", err)
+				}
+				fmt.Print(string(asJSON))
+				return nil
+			},
+		},
 	},
 }
 
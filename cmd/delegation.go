@@ -10,6 +10,9 @@ import (
 	"github.com/storacha/go-ucanto/did"
 	"github.com/storacha/go-ucanto/ucan"
 	"github.com/urfave/cli/v2"
+
+	blobcap "github.com/storacha/piri/pkg/capabilities/blob"
+	"github.com/storacha/piri/pkg/capabilities/usage"
 )
 
 var DelegationCmd = &cli.Command{
@@ -54,6 +57,11 @@ var DelegationCmd = &cli.Command{
 							id.DID().String(),
 							ucan.NoCaveats{},
 						),
+						ucan.NewCapability(
+							blobcap.RemoveAbility,
+							id.DID().String(),
+							ucan.NoCaveats{},
+						),
 						ucan.NewCapability(
 							pdp.InfoAbility,
 							id.DID().String(),
@@ -64,6 +72,11 @@ var DelegationCmd = &cli.Command{
 							id.DID().String(),
 							ucan.NoCaveats{},
 						),
+						ucan.NewCapability(
+							usage.GetAbility,
+							id.DID().String(),
+							ucan.NoCaveats{},
+						),
 					},
 					delegation.WithNoExpiration(),
 				)
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	crypto_ed25519 "crypto/ed25519"
 	"crypto/x509"
 	"encoding/json"
@@ -8,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/url"
 	"os"
 	"path"
@@ -15,6 +17,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ipfs/go-datastore/query"
 	leveldb "github.com/ipfs/go-ds-leveldb"
 	"github.com/ipni/go-libipni/maurl"
 	"github.com/multiformats/go-multiaddr"
@@ -24,13 +29,25 @@ import (
 	ed25519 "github.com/storacha/go-ucanto/principal/ed25519/signer"
 	ucanserver "github.com/storacha/go-ucanto/server"
 	"github.com/urfave/cli/v2"
+	"gorm.io/gorm"
 
 	"github.com/storacha/piri/cmd/enum"
+	"github.com/storacha/piri/pkg/aws"
+	"github.com/storacha/piri/pkg/database/gormdb"
 	"github.com/storacha/piri/pkg/presets"
 	"github.com/storacha/piri/pkg/principalresolver"
 	"github.com/storacha/piri/pkg/server"
+	"github.com/storacha/piri/pkg/service/publisher"
+	"github.com/storacha/piri/pkg/service/renewer"
+	"github.com/storacha/piri/pkg/service/replicator"
+	"github.com/storacha/piri/pkg/service/scrubber"
 	"github.com/storacha/piri/pkg/service/storage"
+	"github.com/storacha/piri/pkg/service/sweeper"
+	"github.com/storacha/piri/pkg/store/allocationstore"
 	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/claimstore"
+	"github.com/storacha/piri/pkg/store/keystore"
+	"github.com/storacha/piri/pkg/store/receiptstore"
 )
 
 var StartCmd = &cli.Command{
@@ -58,6 +75,47 @@ var StartCmd = &cli.Command{
 			Usage:   "Temporary directory data is uploaded to before being moved to data-dir.",
 			EnvVars: []string{"PIRI_TMP_DIR"},
 		},
+		&cli.StringSliceFlag{
+			Name:    "blob-volume",
+			Usage:   "Path of a volume (e.g. a disk mount point) to store blobs on. May be repeated; new blobs are placed on the volume with the most available space. Defaults to data-dir.",
+			EnvVars: []string{"PIRI_BLOB_VOLUMES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "drain-blob-volume",
+			Usage:   "Path of a blob volume to move all blobs off in the background. The volume must also be passed as a blob-volume. No new blobs are placed on it, including after a restart, and it may be removed once draining is complete.",
+			EnvVars: []string{"PIRI_DRAIN_BLOB_VOLUMES"},
+		},
+		&cli.BoolFlag{
+			Name:    "blob-pack",
+			Usage:   "Store blobs appended to large segment files in data-dir rather than a file per blob. Suited to storing very many small blobs. Cannot be combined with blob-volume.",
+			EnvVars: []string{"PIRI_BLOB_PACK"},
+		},
+		&cli.BoolFlag{
+			Name:    "blob-encryption",
+			Usage:   "Encrypt blobs at rest with a key held in data-dir, which is generated on first use. Blobs stored before enabling encryption are not readable once it is enabled.",
+			EnvVars: []string{"PIRI_BLOB_ENCRYPTION"},
+		},
+		&cli.StringFlag{
+			Name:    "blob-cold-bucket",
+			Usage:   "S3 bucket to copy blobs to. When set, local blob storage acts as a cache in front of the bucket. AWS credentials are read from the environment.",
+			EnvVars: []string{"PIRI_BLOB_COLD_BUCKET"},
+		},
+		&cli.StringFlag{
+			Name:    "blob-cold-endpoint",
+			Usage:   "Endpoint of an S3 compatible service hosting the blob-cold-bucket.",
+			EnvVars: []string{"PIRI_BLOB_COLD_ENDPOINT"},
+		},
+		&cli.StringFlag{
+			Name:    "blob-cold-region",
+			Usage:   "Region of the blob-cold-bucket.",
+			EnvVars: []string{"PIRI_BLOB_COLD_REGION"},
+		},
+		&cli.Uint64Flag{
+			Name:    "blob-cache-size",
+			Value:   100 * 1024 * 1024 * 1024,
+			Usage:   "Maximum number of bytes of the blob-cold-bucket to cache locally.",
+			EnvVars: []string{"PIRI_BLOB_CACHE_SIZE"},
+		},
 		&cli.StringFlag{
 			Name:    "public-url",
 			Aliases: []string{"u"},
@@ -70,6 +128,98 @@ var StartCmd = &cli.Command{
 			Usage:   "A delegation that allows the node to cache claims with the indexing service.",
 			EnvVars: []string{"PIRI_INDEXING_SERVICE_PROOF"},
 		},
+		&cli.StringFlag{
+			Name:    "store-database",
+			Usage:   "Keep allocations, claims and receipts in a SQL database instead of LevelDB. Either \"sqlite\" for a database in the data directory, or a PostgreSQL connection URL. Existing LevelDB stores are not migrated, so the node refuses to start if the data directory holds any with data.",
+			EnvVars: []string{"PIRI_STORE_DATABASE"},
+		},
+		&cli.DurationFlag{
+			Name:    "gc-interval",
+			Value:   time.Hour,
+			Usage:   "How often to remove expired allocations, and the blobs and claims no longer referenced by them.",
+			EnvVars: []string{"PIRI_GC_INTERVAL"},
+		},
+		&cli.DurationFlag{
+			Name:    "sweep-interval",
+			Value:   sweeper.DefaultInterval,
+			Usage:   "How often to sweep allocations that expired before their blob was received.",
+			EnvVars: []string{"PIRI_SWEEP_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:    "sweep-report-only",
+			Usage:   "Log allocations that expired before their blob was received without removing them.",
+			EnvVars: []string{"PIRI_SWEEP_REPORT_ONLY"},
+		},
+		&cli.UintFlag{
+			Name:    "replication-max-attempts",
+			Value:   replicator.DefaultMaxAttempts,
+			Usage:   "Number of times a replica transfer is attempted before a failure receipt is issued for it.",
+			EnvVars: []string{"PIRI_REPLICATION_MAX_ATTEMPTS"},
+		},
+		&cli.UintFlag{
+			Name:    "replication-concurrency",
+			Value:   replicator.DefaultMaxWorkers,
+			Usage:   "Number of replica transfers to run at the same time.",
+			EnvVars: []string{"PIRI_REPLICATION_CONCURRENCY"},
+		},
+		&cli.Uint64Flag{
+			Name:    "replication-bandwidth",
+			Usage:   "Maximum rate in bytes per second at which replicas are fetched from their sources. 0 is unlimited.",
+			EnvVars: []string{"PIRI_REPLICATION_BANDWIDTH"},
+		},
+		&cli.DurationFlag{
+			Name:    "ipni-batch-window",
+			Usage:   "Maximum time location commitments are held to be advertised to IPNI in a batch. 0 advertises each one immediately.",
+			EnvVars: []string{"PIRI_IPNI_BATCH_WINDOW"},
+		},
+		&cli.IntFlag{
+			Name:    "ipni-batch-size",
+			Value:   publisher.DefaultBatchSize,
+			Usage:   "Number of pending location commitments that causes a batch to be advertised to IPNI before the batch window has passed.",
+			EnvVars: []string{"PIRI_IPNI_BATCH_SIZE"},
+		},
+		&cli.DurationFlag{
+			Name:    "location-claim-expiration",
+			Usage:   "How long location claims are valid for. They are renewed while the blob is stored. 0 issues claims that never expire.",
+			EnvVars: []string{"PIRI_LOCATION_CLAIM_EXPIRATION"},
+		},
+		&cli.DurationFlag{
+			Name:    "location-claim-renew-before",
+			Usage:   fmt.Sprintf("How long before they expire location claims are renewed. Defaults to %s, or half the expiration if that is shorter.", renewer.DefaultRenewBefore),
+			EnvVars: []string{"PIRI_LOCATION_CLAIM_RENEW_BEFORE"},
+		},
+		&cli.DurationFlag{
+			Name:    "scrub-interval",
+			Value:   scrubber.DefaultInterval,
+			Usage:   "How often to re-hash every stored blob to detect corruption.",
+			EnvVars: []string{"PIRI_SCRUB_INTERVAL"},
+		},
+		&cli.Uint64Flag{
+			Name:    "scrub-rate",
+			Value:   scrubber.DefaultRate,
+			Usage:   "Maximum number of bytes per second read from disk while scrubbing (0 for unlimited).",
+			EnvVars: []string{"PIRI_SCRUB_RATE"},
+		},
+		&cli.Uint64Flag{
+			Name:    "space-quota",
+			Usage:   "Maximum number of bytes each space may allocate on this node (0 for unlimited).",
+			EnvVars: []string{"PIRI_SPACE_QUOTA"},
+		},
+		&cli.Uint64Flag{
+			Name:    "node-quota",
+			Usage:   "Maximum number of bytes that may be allocated on this node across every space (0 for unlimited).",
+			EnvVars: []string{"PIRI_NODE_QUOTA"},
+		},
+		&cli.Uint64Flag{
+			Name:    "capacity",
+			Usage:   "Maximum number of bytes stored on this node (0 to limit by free space only).",
+			EnvVars: []string{"PIRI_CAPACITY"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "capacity-dir",
+			Usage:   "Additional directory whose free space counts towards the capacity of this node, such as the PDP stash directory.",
+			EnvVars: []string{"PIRI_CAPACITY_DIR"},
+		},
 	},
 	Action: func(cCtx *cli.Context) error {
 		id, err := PrincipalSignerFromFile(cCtx.String("key-file"))
@@ -102,40 +252,210 @@ var StartCmd = &cli.Command{
 			tmpDir = dir
 		}
 
-		blobStore, err := blobstore.NewFsBlobstore(path.Join(dataDir, "blobs"), path.Join(tmpDir, "blobs"))
-		if err != nil {
-			return fmt.Errorf("creating blob storage: %w", err)
+		var blobStore blobstore.Blobstore
+		var multiBlobStore *blobstore.MultiFsBlobstore
+		if volumes := cCtx.StringSlice("blob-volume"); len(volumes) > 0 {
+			if cCtx.Bool("blob-pack") {
+				return errors.New("blob-pack cannot be combined with blob-volume")
+			}
+			multiBlobStore, err = blobstore.NewMultiFsBlobstore(volumes...)
+			if err != nil {
+				return fmt.Errorf("creating blob storage: %w", err)
+			}
+			blobStore = multiBlobStore
+		} else {
+			if len(cCtx.StringSlice("drain-blob-volume")) > 0 {
+				return errors.New("drain-blob-volume requires blob-volume to be set")
+			}
+			if cCtx.Bool("blob-pack") {
+				packDir, err := mkdirp(dataDir, "blobpack")
+				if err != nil {
+					return err
+				}
+				packIndexDir, err := mkdirp(dataDir, "blobpack-index")
+				if err != nil {
+					return err
+				}
+				packIndexDs, err := leveldb.NewDatastore(packIndexDir, nil)
+				if err != nil {
+					return err
+				}
+				defer packIndexDs.Close()
+				blobStore, err = blobstore.NewPackBlobstore(packDir, packIndexDs)
+				if err != nil {
+					return fmt.Errorf("creating blob storage: %w", err)
+				}
+			} else {
+				blobStore, err = blobstore.NewFsBlobstore(path.Join(dataDir, "blobs"), path.Join(tmpDir, "blobs"))
+				if err != nil {
+					return fmt.Errorf("creating blob storage: %w", err)
+				}
+			}
 		}
 
-		allocsDir, err := mkdirp(dataDir, "allocation")
+		var encryptionKey []byte
+		if cCtx.Bool("blob-encryption") {
+			keystoreDir, err := mkdirp(dataDir, "keystore")
+			if err != nil {
+				return err
+			}
+			keystoreDs, err := leveldb.NewDatastore(keystoreDir, nil)
+			if err != nil {
+				return err
+			}
+			defer keystoreDs.Close()
+			keyStore, err := keystore.NewKeyStore(keystoreDs)
+			if err != nil {
+				return err
+			}
+			encryptionKey, err = blobstore.LoadEncryptionKey(cCtx.Context, keyStore)
+			if err != nil {
+				return fmt.Errorf("loading blob encryption key: %w", err)
+			}
+			blobStore, err = blobstore.NewEncryptedBlobstore(blobStore, encryptionKey)
+			if err != nil {
+				return fmt.Errorf("creating encrypted blob storage: %w", err)
+			}
+		}
+
+		if bucket := cCtx.String("blob-cold-bucket"); bucket != "" {
+			awsCfg, err := config.LoadDefaultConfig(cCtx.Context)
+			if err != nil {
+				return fmt.Errorf("loading AWS config: %w", err)
+			}
+			coldStore := aws.NewS3BlobStore(awsCfg, bucket, nil, func(o *s3.Options) {
+				if region := cCtx.String("blob-cold-region"); region != "" {
+					o.Region = region
+				}
+				if endpoint := cCtx.String("blob-cold-endpoint"); endpoint != "" {
+					o.BaseEndpoint = &endpoint
+					o.UsePathStyle = true
+				}
+			})
+			var coldBlobStore blobstore.Blobstore = coldStore
+			if encryptionKey != nil {
+				coldBlobStore, err = blobstore.NewEncryptedBlobstore(coldStore, encryptionKey)
+				if err != nil {
+					return fmt.Errorf("creating encrypted cold blob storage: %w", err)
+				}
+			}
+			pendingDir, err := mkdirp(dataDir, "blob-uploads")
+			if err != nil {
+				return err
+			}
+			pendingDs, err := leveldb.NewDatastore(pendingDir, nil)
+			if err != nil {
+				return err
+			}
+			tieredStore, err := blobstore.NewTieredBlobstore(blobStore, coldBlobStore, pendingDs, cCtx.Uint64("blob-cache-size"))
+			if err != nil {
+				return fmt.Errorf("creating tiered blob storage: %w", err)
+			}
+			defer pendingDs.Close()
+			defer tieredStore.Close(cCtx.Context)
+			blobStore = tieredStore
+		}
+
+		var storeOpts []storage.Option
+		if dbSpec := cCtx.String("store-database"); dbSpec != "" {
+			err := checkNoLevelDBStores(cCtx.Context, dataDir)
+			if err != nil {
+				return err
+			}
+			db, err := openStoreDatabase(dbSpec, dataDir)
+			if err != nil {
+				return err
+			}
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			defer sqlDB.Close()
+			allocStore, err := allocationstore.NewSQLAllocationStore(db)
+			if err != nil {
+				return fmt.Errorf("creating allocation store: %w", err)
+			}
+			claimStore, err := claimstore.NewSQLClaimStore(db)
+			if err != nil {
+				return fmt.Errorf("creating claim store: %w", err)
+			}
+			receiptStore, err := receiptstore.NewSQLReceiptStore(db)
+			if err != nil {
+				return fmt.Errorf("creating receipt store: %w", err)
+			}
+			storeOpts = append(storeOpts,
+				storage.WithAllocationStore(allocStore),
+				storage.WithClaimStore(claimStore),
+				storage.WithReceiptStore(receiptStore),
+			)
+		} else {
+			allocsDir, err := mkdirp(dataDir, "allocation")
+			if err != nil {
+				return err
+			}
+			allocDs, err := leveldb.NewDatastore(allocsDir, nil)
+			if err != nil {
+				return err
+			}
+			claimsDir, err := mkdirp(dataDir, "claim")
+			if err != nil {
+				return err
+			}
+			claimDs, err := leveldb.NewDatastore(claimsDir, nil)
+			if err != nil {
+				return err
+			}
+			receiptDir, err := mkdirp(dataDir, "receipt")
+			if err != nil {
+				return err
+			}
+			receiptDs, err := leveldb.NewDatastore(receiptDir, nil)
+			if err != nil {
+				return err
+			}
+			storeOpts = append(storeOpts,
+				storage.WithAllocationDatastore(allocDs),
+				storage.WithClaimDatastore(claimDs),
+				storage.WithReceiptDatastore(receiptDs),
+			)
+		}
+		publisherDir, err := mkdirp(dataDir, "publisher")
 		if err != nil {
 			return err
 		}
-		allocDs, err := leveldb.NewDatastore(allocsDir, nil)
+		publisherDs, err := leveldb.NewDatastore(publisherDir, nil)
 		if err != nil {
 			return err
 		}
-		claimsDir, err := mkdirp(dataDir, "claim")
+		scrubDir, err := mkdirp(dataDir, "scrub")
 		if err != nil {
 			return err
 		}
-		claimDs, err := leveldb.NewDatastore(claimsDir, nil)
+		scrubDs, err := leveldb.NewDatastore(scrubDir, nil)
 		if err != nil {
 			return err
 		}
-		publisherDir, err := mkdirp(dataDir, "publisher")
+
+		replicatorDir, err := mkdirp(dataDir, "replicator")
 		if err != nil {
 			return err
 		}
-		publisherDs, err := leveldb.NewDatastore(publisherDir, nil)
+
+		outboxDir, err := mkdirp(dataDir, "outbox")
 		if err != nil {
 			return err
 		}
-		receiptDir, err := mkdirp(dataDir, "receipt")
+
+		publisherBatchDir, err := mkdirp(dataDir, "publisher-batch")
 		if err != nil {
 			return err
 		}
-		receiptDs, err := leveldb.NewDatastore(receiptDir, nil)
+
+		usageDir, err := mkdirp(dataDir, "usage")
+		if err != nil {
+			return err
+		}
+		usageDs, err := leveldb.NewDatastore(usageDir, nil)
 		if err != nil {
 			return err
 		}
@@ -275,16 +595,35 @@ var StartCmd = &cli.Command{
 		opts := []storage.Option{
 			storage.WithIdentity(id),
 			storage.WithBlobstore(blobStore),
-			storage.WithAllocationDatastore(allocDs),
-			storage.WithClaimDatastore(claimDs),
 			storage.WithPublisherDatastore(publisherDs),
 			storage.WithPublicURL(*pubURL),
 			storage.WithPublisherDirectAnnounce(ipniAnnounceURLs...),
 			storage.WithUploadServiceConfig(uploadServiceDID, uploadServiceURL),
 			storage.WithPublisherIndexingServiceConfig(indexingServiceDID, indexingServiceURL),
 			storage.WithPublisherIndexingServiceProof(indexingServiceProofs...),
-			storage.WithReceiptDatastore(receiptDs),
+			storage.WithCollectorInterval(cCtx.Duration("gc-interval")),
+			storage.WithSweeperInterval(cCtx.Duration("sweep-interval")),
+			storage.WithSweeperReportOnly(cCtx.Bool("sweep-report-only")),
+			storage.WithReplicatorDatabasePath(filepath.Join(replicatorDir, "jobqueue.db")),
+			storage.WithReplicatorMaxAttempts(cCtx.Uint("replication-max-attempts")),
+			storage.WithReplicatorConcurrency(cCtx.Uint("replication-concurrency")),
+			storage.WithReplicatorBandwidth(cCtx.Uint64("replication-bandwidth")),
+			storage.WithOutboxDatabasePath(filepath.Join(outboxDir, "outbox.db")),
+			storage.WithPublisherBatchDatabasePath(filepath.Join(publisherBatchDir, "batch.db")),
+			storage.WithPublisherBatchWindow(cCtx.Duration("ipni-batch-window")),
+			storage.WithPublisherBatchSize(cCtx.Int("ipni-batch-size")),
+			storage.WithLocationClaimExpiration(cCtx.Duration("location-claim-expiration")),
+			storage.WithLocationClaimRenewBefore(cCtx.Duration("location-claim-renew-before")),
+			storage.WithScrubDatastore(scrubDs),
+			storage.WithScrubberInterval(cCtx.Duration("scrub-interval")),
+			storage.WithScrubberRate(cCtx.Uint64("scrub-rate")),
+			storage.WithUsageDatastore(usageDs),
+			storage.WithSpaceQuota(cCtx.Uint64("space-quota")),
+			storage.WithNodeQuota(cCtx.Uint64("node-quota")),
+			storage.WithCapacityLimit(cCtx.Uint64("capacity")),
+			storage.WithCapacityDirs(cCtx.StringSlice("capacity-dir")...),
 		}
+		opts = append(opts, storeOpts...)
 		if pdpConfig != nil {
 			opts = append(opts, storage.WithPDPConfig(*pdpConfig))
 		}
@@ -302,6 +641,18 @@ var StartCmd = &cli.Command{
 
 		defer svc.Close(cCtx.Context)
 
+		for _, volume := range cCtx.StringSlice("drain-blob-volume") {
+			go func() {
+				log.Infof("Draining blob volume: %s", volume)
+				err := multiBlobStore.Drain(cCtx.Context, volume)
+				if err != nil {
+					log.Errorf("Draining blob volume %s: %s", volume, err)
+					return
+				}
+				log.Infof("Blob volume drained, it may now be removed: %s", volume)
+			}()
+		}
+
 		principalMapping := presets.PrincipalMapping
 		if os.Getenv("PIRI_PRINCIPAL_MAPPING") != "" {
 			var pm map[string]string
@@ -415,3 +766,63 @@ func readPrivateKeyFromPEM(f io.Reader) (principal.Signer, error) {
 	}
 	return ed25519.FromRaw(*privateKey)
 }
+
+// levelDBStores are the stores kept in LevelDB in the data directory unless a
+// store database is configured.
+var levelDBStores = []string{"allocation", "claim", "receipt"}
+
+// checkNoLevelDBStores returns an error if any of the LevelDB stores replaced
+// by a store database hold data, since the node would otherwise start without
+// the allocations, claims and receipts it already has.
+func checkNoLevelDBStores(ctx context.Context, dataDir string) error {
+	for _, name := range levelDBStores {
+		dir := filepath.Join(dataDir, name)
+		_, err := os.Stat(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("checking for existing %s store: %w", name, err)
+		}
+		ds, err := leveldb.NewDatastore(dir, nil)
+		if err != nil {
+			return fmt.Errorf("opening existing %s store: %w", name, err)
+		}
+		results, err := ds.Query(ctx, query.Query{KeysOnly: true, Limit: 1})
+		if err != nil {
+			ds.Close()
+			return fmt.Errorf("querying existing %s store: %w", name, err)
+		}
+		entries, err := results.Rest()
+		ds.Close()
+		if err != nil {
+			return fmt.Errorf("querying existing %s store: %w", name, err)
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("data directory contains a LevelDB %s store at %s that would not be used with a store database: remove it or start without --store-database", name, dir)
+		}
+	}
+	return nil
+}
+
+// openStoreDatabase opens the SQL database described by spec, which is either
+// "sqlite" for a database in the data directory, or a PostgreSQL connection
+// URL.
+func openStoreDatabase(spec string, dataDir string) (*gorm.DB, error) {
+	switch {
+	case spec == "sqlite":
+		db, err := gormdb.New(filepath.Join(dataDir, "stores.db"))
+		if err != nil {
+			return nil, fmt.Errorf("opening store database: %w", err)
+		}
+		return db, nil
+	case strings.HasPrefix(spec, "postgres://"), strings.HasPrefix(spec, "postgresql://"):
+		db, err := gormdb.NewPostgres(spec)
+		if err != nil {
+			return nil, fmt.Errorf("opening store database: %w", err)
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unsupported store database: %q, expected \"sqlite\" or a PostgreSQL URL", spec)
+	}
+}
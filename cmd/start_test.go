@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	leveldb "github.com/ipfs/go-ds-leveldb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckNoLevelDBStores(t *testing.T) {
+	t.Run("allows a data directory without stores", func(t *testing.T) {
+		require.NoError(t, checkNoLevelDBStores(context.Background(), t.TempDir()))
+	})
+
+	t.Run("allows empty stores", func(t *testing.T) {
+		dataDir := t.TempDir()
+		ds, err := leveldb.NewDatastore(filepath.Join(dataDir, "claim"), nil)
+		require.NoError(t, err)
+		require.NoError(t, ds.Close())
+
+		require.NoError(t, checkNoLevelDBStores(context.Background(), dataDir))
+	})
+
+	t.Run("refuses stores with data", func(t *testing.T) {
+		dataDir := t.TempDir()
+		ds, err := leveldb.NewDatastore(filepath.Join(dataDir, "allocation"), nil)
+		require.NoError(t, err)
+		require.NoError(t, ds.Put(context.Background(), datastore.NewKey("a"), []byte("b")))
+		require.NoError(t, ds.Close())
+
+		err = checkNoLevelDBStores(context.Background(), dataDir)
+		require.ErrorContains(t, err, "LevelDB allocation store")
+	})
+}
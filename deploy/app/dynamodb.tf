@@ -97,9 +97,37 @@ resource "aws_dynamodb_table" "allocation_store" {
     type = "S"
   }
 
+  attribute {
+    name = "space"
+    type = "S"
+  }
+
+  attribute {
+    name = "expiryKey"
+    type = "S"
+  }
+
+  attribute {
+    name = "expires"
+    type = "N"
+  }
+
   hash_key  = "hash"
   range_key = "cause"
 
+  global_secondary_index {
+    name            = "space"
+    hash_key        = "space"
+    projection_type = "ALL"
+  }
+
+  global_secondary_index {
+    name            = "expires"
+    hash_key        = "expiryKey"
+    range_key       = "expires"
+    projection_type = "ALL"
+  }
+
   tags = {
     Name = "${terraform.workspace}-${var.app}-allocation-store"
   }
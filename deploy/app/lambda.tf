@@ -153,13 +153,16 @@ data "aws_iam_policy_document" "lambda_dynamodb_put_get_document" {
     actions = [
       "dynamodb:GetItem",
       "dynamodb:PutItem",
-      "dynamodb:Query"
+      "dynamodb:DeleteItem",
+      "dynamodb:Query",
+      "dynamodb:Scan"
     ]
     resources = [
       aws_dynamodb_table.chunk_links.arn,
       aws_dynamodb_table.metadata.arn,
       aws_dynamodb_table.ran_link_index.arn,
-      aws_dynamodb_table.allocation_store.arn
+      aws_dynamodb_table.allocation_store.arn,
+      "${aws_dynamodb_table.allocation_store.arn}/index/*"
     ]
   }
 }
@@ -182,6 +185,7 @@ data "aws_iam_policy_document" "lambda_s3_put_get_document" {
       "s3:GetObject",
       "s3:PutObject",
       "s3:HeadObject",
+      "s3:DeleteObject",
     ]
     resources = [
       "${aws_s3_bucket.blob_store_bucket.arn}/*",
@@ -101,6 +101,20 @@ func (mr *MockPDPClientMockRecorder) DeleteProofSet(ctx, id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProofSet", reflect.TypeOf((*MockPDPClient)(nil).DeleteProofSet), ctx, id)
 }
 
+// DeleteRootFromProofSet mocks base method.
+func (m *MockPDPClient) DeleteRootFromProofSet(ctx context.Context, id, rootID uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRootFromProofSet", ctx, id, rootID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRootFromProofSet indicates an expected call of DeleteRootFromProofSet.
+func (mr *MockPDPClientMockRecorder) DeleteRootFromProofSet(ctx, id, rootID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRootFromProofSet", reflect.TypeOf((*MockPDPClient)(nil).DeleteRootFromProofSet), ctx, id, rootID)
+}
+
 // FindPiece mocks base method.
 func (m *MockPDPClient) FindPiece(ctx context.Context, piece curio.PieceHash) (curio.FoundPiece, error) {
 	m.ctrl.T.Helper()
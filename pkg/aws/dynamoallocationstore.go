@@ -8,8 +8,11 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/ipld/go-ipld-prime/codec/dagcbor"
 	multihash "github.com/multiformats/go-multihash"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/ucan"
 	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/store/allocationstore"
 	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
@@ -76,6 +79,9 @@ func (d *DynamoAllocationStore) Put(ctx context.Context, alloc allocation.Alloca
 	item, err := attributevalue.MarshalMap(allocationItem{
 		Hash:       digestutil.Format(alloc.Blob.Digest),
 		Cause:      alloc.Cause.String(),
+		Space:      alloc.Space.String(),
+		ExpiryKey:  expiryKey,
+		Expires:    alloc.Expires,
 		Allocation: data,
 	})
 	if err != nil {
@@ -90,10 +96,150 @@ func (d *DynamoAllocationStore) Put(ctx context.Context, alloc allocation.Alloca
 	return nil
 }
 
+// ListExpired implements allocationstore.AllocationStore. It queries the
+// "expires" global secondary index, so items written before the expiry key
+// attribute was recorded are not returned.
+func (d *DynamoAllocationStore) ListExpired(ctx context.Context, before uint64) ([]allocation.Allocation, error) {
+	keyEx := expression.Key(expiryKeyName).Equal(expression.Value(expiryKey)).
+		And(expression.Key("expires").LessThan(expression.Value(before)))
+	return d.queryExpiry(ctx, keyEx)
+}
+
+// ListUnexpired implements allocationstore.AllocationStore. It queries the
+// "expires" global secondary index, so items written before the expiry key
+// attribute was recorded are not returned.
+func (d *DynamoAllocationStore) ListUnexpired(ctx context.Context, after uint64) ([]allocation.Allocation, error) {
+	keyEx := expression.Key(expiryKeyName).Equal(expression.Value(expiryKey)).
+		And(expression.Key("expires").GreaterThanEqual(expression.Value(after)))
+	return d.queryExpiry(ctx, keyEx)
+}
+
+// queryExpiry retrieves the allocations matching the key condition on the
+// expiry index, ordered by when they expire.
+func (d *DynamoAllocationStore) queryExpiry(ctx context.Context, keyEx expression.KeyConditionBuilder) ([]allocation.Allocation, error) {
+	expr, err := expression.NewBuilder().WithKeyCondition(keyEx).Build()
+	if err != nil {
+		return nil, fmt.Errorf("building query: %w", err)
+	}
+
+	var allocations []allocation.Allocation
+	queryPaginator := dynamodb.NewQueryPaginator(d.dynamoDbClient, &dynamodb.QueryInput{
+		TableName:                 aws.String(d.tableName),
+		IndexName:                 aws.String(expiryIndexName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+	})
+	for queryPaginator.HasMorePages() {
+		response, err := queryPaginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("querying allocations: %w", err)
+		}
+		var allocationPage []allocationItem
+		err = attributevalue.UnmarshalListOfMaps(response.Items, &allocationPage)
+		if err != nil {
+			return nil, fmt.Errorf("parsing query responses: %w", err)
+		}
+
+		for _, item := range allocationPage {
+			a, err := allocation.Decode(item.Allocation, dagcbor.Decode)
+			if err != nil {
+				return nil, fmt.Errorf("decoding data: %w", err)
+			}
+			allocations = append(allocations, a)
+		}
+	}
+	return allocations, nil
+}
+
+// ListBySpace implements allocationstore.AllocationStore. It queries the
+// "space" global secondary index, so items written before the space attribute
+// was recorded are not returned.
+func (d *DynamoAllocationStore) ListBySpace(ctx context.Context, space did.DID) ([]allocation.Allocation, error) {
+	keyEx := expression.Key("space").Equal(expression.Value(space.String()))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyEx).Build()
+	if err != nil {
+		return nil, fmt.Errorf("building query: %w", err)
+	}
+
+	var allocations []allocation.Allocation
+	queryPaginator := dynamodb.NewQueryPaginator(d.dynamoDbClient, &dynamodb.QueryInput{
+		TableName:                 aws.String(d.tableName),
+		IndexName:                 aws.String(spaceIndexName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+	})
+	for queryPaginator.HasMorePages() {
+		response, err := queryPaginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("querying allocations: %w", err)
+		}
+		var allocationPage []allocationItem
+		err = attributevalue.UnmarshalListOfMaps(response.Items, &allocationPage)
+		if err != nil {
+			return nil, fmt.Errorf("parsing query responses: %w", err)
+		}
+
+		for _, item := range allocationPage {
+			a, err := allocation.Decode(item.Allocation, dagcbor.Decode)
+			if err != nil {
+				return nil, fmt.Errorf("decoding data: %w", err)
+			}
+			allocations = append(allocations, a)
+		}
+	}
+	return allocations, nil
+}
+
+// Delete implements allocationstore.AllocationStore.
+func (d *DynamoAllocationStore) Delete(ctx context.Context, mh multihash.Multihash, cause ucan.Link) error {
+	item := allocationItem{Hash: digestutil.Format(mh), Cause: cause.String()}
+	_, err := d.dynamoDbClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.tableName),
+		Key:       item.GetKey(),
+	})
+	if err != nil {
+		return fmt.Errorf("deleting item: %w", err)
+	}
+	return nil
+}
+
+// spaceIndexName is the name of the global secondary index keyed by space.
+const spaceIndexName = "space"
+
+const (
+	// expiryIndexName is the name of the global secondary index sorted by
+	// expiry.
+	expiryIndexName = "expires"
+	// expiryKeyName is the partition key attribute of the expiry index. Every
+	// allocation has the same value, so that they can be queried in a range of
+	// expiry.
+	expiryKeyName = "expiryKey"
+	expiryKey     = "allocation"
+)
+
 type allocationItem struct {
 	Hash       string `dynamodbav:"hash"`
 	Cause      string `dynamodbav:"cause"`
+	Space      string `dynamodbav:"space,omitempty"`
+	ExpiryKey  string `dynamodbav:"expiryKey,omitempty"`
+	Expires    uint64 `dynamodbav:"expires"`
 	Allocation []byte `dynamodbav:"allocation"`
 }
 
+// GetKey returns the composite primary key of the hash & cause in a format that
+// can be sent to DynamoDB.
+func (a allocationItem) GetKey() map[string]types.AttributeValue {
+	hash, err := attributevalue.Marshal(a.Hash)
+	if err != nil {
+		panic(err)
+	}
+	cause, err := attributevalue.Marshal(a.Cause)
+	if err != nil {
+		panic(err)
+	}
+	return map[string]types.AttributeValue{"hash": hash, "cause": cause}
+}
+
 var _ allocationstore.AllocationStore = (*DynamoAllocationStore)(nil)
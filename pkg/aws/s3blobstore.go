@@ -2,6 +2,7 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,9 +13,11 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	multihash "github.com/multiformats/go-multihash"
 	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/presigner"
+	"github.com/storacha/piri/pkg/store"
 	"github.com/storacha/piri/pkg/store/blobstore"
 )
 
@@ -28,6 +31,7 @@ type S3BlobStore struct {
 }
 
 var _ blobstore.Blobstore = (*S3BlobStore)(nil)
+var _ blobstore.Lister = (*S3BlobStore)(nil)
 
 // NewPatternKeyFormatter creates a key formatter which replaces instances of
 // "{blob}" in the provided pattern with the base58btc encoding of the multihash
@@ -89,9 +93,34 @@ func (s *S3BlobStore) PresignClient() presigner.RequestPresigner {
 	return &S3BlobPresigner{s, presignClient}
 }
 
-// Put implements blobstore.Blobstore.
-func (s *S3BlobStore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader) error {
-	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+// Put implements blobstore.Blobstore. The data is verified against the digest
+// before the upload completes, so inconsistent data is never committed.
+func (s *S3BlobStore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...blobstore.PutOption) error {
+	vr, err := blobstore.NewPutReader(body, digest, size, opts...)
+	if err != nil {
+		return err
+	}
+	if rs, ok := body.(io.ReadSeeker); ok {
+		// verify up front so the SDK can still seek the body to sign and retry
+		offset, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("seeking body: %w", err)
+		}
+		_, err = io.Copy(io.Discard, vr)
+		if err != nil {
+			return err
+		}
+		_, err = rs.Seek(offset, io.SeekStart)
+		if err != nil {
+			return fmt.Errorf("seeking body: %w", err)
+		}
+	} else {
+		// the verifying reader fails before returning the final bytes, aborting
+		// the upload if the data is inconsistent
+		body = vr
+	}
+
+	_, err = s.s3Client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:        aws.String(s.bucket),
 		Key:           aws.String(s.formatKey(digest)),
 		Body:          body,
@@ -109,7 +138,8 @@ func (s *S3BlobStore) Get(ctx context.Context, digest multihash.Multihash, opts
 	if config.Range().Offset != 0 || config.Range().Length != nil {
 		rangeString := fmt.Sprintf("bytes=%d-", config.Range().Offset)
 		if config.Range().Length != nil {
-			rangeString += strconv.FormatUint(*config.Range().Length, 10)
+			// the end of an HTTP byte range is inclusive
+			rangeString += strconv.FormatUint(config.Range().Offset+*config.Range().Length-1, 10)
 		}
 		rangeParam = &rangeString
 	}
@@ -119,11 +149,113 @@ func (s *S3BlobStore) Get(ctx context.Context, digest multihash.Multihash, opts
 		Range:  rangeParam,
 	})
 	if err != nil {
+		var noSuchKeyError *types.NoSuchKey
+		if errors.As(err, &noSuchKeyError) {
+			return nil, store.ErrNotFound
+		}
 		return nil, err
 	}
 	return &s3BlobObject{outPut}, nil
 }
 
+// Delete implements blobstore.Blobstore.
+func (s *S3BlobStore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.formatKey(digest)),
+	})
+	return err
+}
+
+// List implements blobstore.Lister. The key formatter must start keys with a
+// fixed prefix followed by the encoded digest, as [NewPatternKeyFormatter]
+// does. Objects with keys not produced by the key formatter are skipped.
+func (s *S3BlobStore) List(ctx context.Context, opts ...blobstore.ListOption) (blobstore.ListPage, error) {
+	cfg, err := blobstore.NewListConfig(opts)
+	if err != nil {
+		return blobstore.ListPage{}, err
+	}
+	prefix, err := s.keyPrefix()
+	if err != nil {
+		return blobstore.ListPage{}, err
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(int32(cfg.Limit())),
+	}
+	if cfg.Cursor() != "" {
+		input.StartAfter = aws.String(cfg.Cursor())
+	}
+	outPut, err := s.s3Client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return blobstore.ListPage{}, fmt.Errorf("listing objects: %w", err)
+	}
+
+	page := blobstore.ListPage{}
+	for _, obj := range outPut.Contents {
+		key := aws.ToString(obj.Key)
+		rest := strings.TrimPrefix(key, prefix)
+		end := strings.IndexFunc(rest, func(r rune) bool { return !strings.ContainsRune(base58Alphabet, r) })
+		if end >= 0 {
+			rest = rest[:end]
+		}
+		digest, err := digestutil.Parse(rest)
+		if err != nil || s.formatKey(digest) != key {
+			continue
+		}
+		page.Objects = append(page.Objects, blobstore.ObjectInfo{
+			Digest:  digest,
+			Size:    aws.ToInt64(obj.Size),
+			ModTime: aws.ToTime(obj.LastModified),
+		})
+	}
+	if aws.ToBool(outPut.IsTruncated) && len(outPut.Contents) > 0 {
+		// the cursor is the last key listed
+		page.Cursor = aws.ToString(outPut.Contents[len(outPut.Contents)-1].Key)
+	}
+	return page, nil
+}
+
+// Stat implements blobstore.Lister.
+func (s *S3BlobStore) Stat(ctx context.Context, digest multihash.Multihash) (blobstore.ObjectInfo, error) {
+	outPut, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.formatKey(digest)),
+	})
+	if err != nil {
+		var notFoundError *types.NotFound
+		if errors.As(err, &notFoundError) {
+			return blobstore.ObjectInfo{}, store.ErrNotFound
+		}
+		return blobstore.ObjectInfo{}, err
+	}
+	return blobstore.ObjectInfo{
+		Digest:  digest,
+		Size:    aws.ToInt64(outPut.ContentLength),
+		ModTime: aws.ToTime(outPut.LastModified),
+	}, nil
+}
+
+// base58Alphabet is the alphabet of base58btc encoded digests, including the
+// "z" multibase prefix.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// keyPrefix determines the fixed prefix the key formatter places before the
+// encoded digest.
+func (s *S3BlobStore) keyPrefix() (string, error) {
+	sample, err := multihash.Sum(nil, multihash.SHA2_256, -1)
+	if err != nil {
+		return "", err
+	}
+	i := strings.Index(s.formatKey(sample), digestutil.Format(sample))
+	if i < 0 {
+		return "", errors.New("key format does not contain the encoded digest")
+	}
+	return s.formatKey(sample)[:i], nil
+}
+
 type s3BlobObject struct {
 	outPut *s3.GetObjectOutput
 }
@@ -133,7 +265,16 @@ func (s *s3BlobObject) Body() io.Reader {
 	return s.outPut.Body
 }
 
-// Size implements blobstore.Object.
+// Size implements blobstore.Object. It is the total size of the object, even
+// when a range was requested.
 func (s *s3BlobObject) Size() int64 {
+	// Content-Range is "bytes <start>-<end>/<size>" for a ranged response
+	if cr := aws.ToString(s.outPut.ContentRange); cr != "" {
+		if i := strings.LastIndex(cr, "/"); i >= 0 {
+			if size, err := strconv.ParseInt(cr[i+1:], 10, 64); err == nil {
+				return size
+			}
+		}
+	}
 	return *s.outPut.ContentLength
 }
@@ -0,0 +1,284 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/blobstore"
+)
+
+func TestS3BlobStore(t *testing.T) {
+	t.Run("roundtrip", func(t *testing.T) {
+		s := newTestS3BlobStore(t, "")
+		data, digest := randomBlob(t)
+
+		err := s.Put(context.Background(), digest, uint64(len(data)), io.NopCloser(bytes.NewReader(data)))
+		require.NoError(t, err)
+
+		obj, err := s.Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+
+		info, err := s.Stat(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), info.Size)
+	})
+
+	t.Run("rejects inconsistent data", func(t *testing.T) {
+		s := newTestS3BlobStore(t, "")
+		data, digest := randomBlob(t)
+		baddata := testutil.RandomBytes(t, len(data))
+
+		// streamed
+		err := s.Put(context.Background(), digest, uint64(len(baddata)), io.NopCloser(bytes.NewReader(baddata)))
+		require.ErrorIs(t, err, blobstore.ErrDataInconsistent)
+		// seekable
+		err = s.Put(context.Background(), digest, uint64(len(baddata)), bytes.NewReader(baddata))
+		require.ErrorIs(t, err, blobstore.ErrDataInconsistent)
+
+		_, err = s.Get(context.Background(), digest)
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s := newTestS3BlobStore(t, "")
+		_, digest := randomBlob(t)
+
+		_, err := s.Get(context.Background(), digest)
+		require.ErrorIs(t, err, store.ErrNotFound)
+		_, err = s.Stat(context.Background(), digest)
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+
+	t.Run("lists with key pattern", func(t *testing.T) {
+		s := newTestS3BlobStore(t, "blobs/{blob}/{blob}.blob")
+
+		var expected []string
+		for range 5 {
+			data, digest := randomBlob(t)
+			require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+			expected = append(expected, digestutil.Format(digest))
+		}
+		slices.Sort(expected)
+
+		var actual []string
+		cursor := ""
+		for {
+			page, err := s.List(context.Background(), blobstore.WithCursor(cursor), blobstore.WithLimit(2))
+			require.NoError(t, err)
+			for _, obj := range page.Objects {
+				actual = append(actual, digestutil.Format(obj.Digest))
+			}
+			if page.Cursor == "" {
+				break
+			}
+			cursor = page.Cursor
+		}
+		require.Equal(t, expected, actual)
+	})
+
+	t.Run("ranged get", func(t *testing.T) {
+		s := newTestS3BlobStore(t, "")
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		length := uint64(8)
+		obj, err := s.Get(context.Background(), digest, blobstore.WithRange(blobstore.Range{Offset: 4, Length: &length}))
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), obj.Size())
+		require.Equal(t, data[4:12], testutil.Must(io.ReadAll(obj.Body()))(t))
+
+		obj, err = s.Get(context.Background(), digest, blobstore.WithRange(blobstore.Range{Offset: 20}))
+		require.NoError(t, err)
+		require.Equal(t, data[20:], testutil.Must(io.ReadAll(obj.Body()))(t))
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		s := testutil.Must(blobstore.NewEncryptedBlobstore(newTestS3BlobStore(t, ""), testutil.RandomBytes(t, blobstore.EncryptionKeySize)))(t)
+		data := testutil.RandomBytes(t, 200*1024)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		obj, err := s.Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+
+		length := uint64(1000)
+		obj, err = s.Get(context.Background(), digest, blobstore.WithRange(blobstore.Range{Offset: 70 * 1024, Length: &length}))
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), obj.Size())
+		require.Equal(t, data[70*1024:70*1024+1000], testutil.Must(io.ReadAll(obj.Body()))(t))
+
+		info, err := s.Stat(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), info.Size)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		s := newTestS3BlobStore(t, "")
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		require.NoError(t, s.Delete(context.Background(), digest))
+
+		_, err := s.Get(context.Background(), digest)
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+}
+
+func randomBlob(t *testing.T) ([]byte, multihash.Multihash) {
+	data := testutil.RandomBytes(t, 32)
+	digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+	return data, digest
+}
+
+func newTestS3BlobStore(t *testing.T, keyPattern string) *S3BlobStore {
+	srv := httptest.NewTLSServer(newFakeS3())
+	t.Cleanup(srv.Close)
+
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		HTTPClient:  srv.Client(),
+	}
+	var formatKey KeyFormatterFunc
+	if keyPattern != "" {
+		formatKey = NewPatternKeyFormatter(keyPattern)
+	}
+	return NewS3BlobStore(cfg, "bucket", formatKey, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(srv.URL)
+		o.UsePathStyle = true
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		o.RetryMaxAttempts = 1
+	})
+}
+
+type fakeS3Object struct {
+	data     []byte
+	modified time.Time
+}
+
+// fakeS3 is a minimal S3-compatible stand-in supporting the path-style object
+// operations used by [S3BlobStore].
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeS3Object
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string]fakeS3Object{}}
+}
+
+type listBucketResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	IsTruncated bool
+	KeyCount    int
+	Contents    []listBucketContents
+}
+
+type listBucketContents struct {
+	Key          string
+	Size         int64
+	LastModified string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// path is /{bucket}/{key}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) < 2 || parts[1] == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			f.list(w, r)
+			return
+		}
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+		return
+	}
+	key := parts[1]
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength >= 0 && int64(len(data)) != r.ContentLength {
+			http.Error(w, "incomplete body", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = fakeS3Object{data: data, modified: time.Now().UTC()}
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`))
+			}
+			return
+		}
+		// serves range requests and sets Content-Length and Last-Modified
+		http.ServeContent(w, r, key, obj.modified, bytes.NewReader(obj.data))
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	maxKeys := 1000
+	if q.Get("max-keys") != "" {
+		maxKeys, _ = strconv.Atoi(q.Get("max-keys"))
+	}
+
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, q.Get("prefix")) && k > q.Get("start-after") {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	res := listBucketResult{}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		res.IsTruncated = true
+	}
+	for _, k := range keys {
+		res.Contents = append(res.Contents, listBucketContents{
+			Key:          k,
+			Size:         int64(len(f.objects[k].data)),
+			LastModified: f.objects[k].modified.Format(time.RFC3339),
+		})
+	}
+	res.KeyCount = len(res.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(res)
+}
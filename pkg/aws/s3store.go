@@ -48,6 +48,15 @@ func (s *S3Store) Put(ctx context.Context, key string, length uint64, data io.Re
 	return err
 }
 
+// Delete removes the object stored under the passed key.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.keyPrefix + key),
+	})
+	return err
+}
+
 func NewS3Store(cfg aws.Config, bucket string, keyPrefix string, opts ...func(*s3.Options)) *S3Store {
 	return &S3Store{
 		s3Client:  s3.NewFromConfig(cfg, opts...),
@@ -18,6 +18,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/ipni/go-libipni/maurl"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/storacha/go-libstoracha/metadata"
@@ -36,6 +38,7 @@ import (
 	"github.com/storacha/piri/pkg/pdp/curio"
 	"github.com/storacha/piri/pkg/pdp/pieceadder"
 	"github.com/storacha/piri/pkg/pdp/piecefinder"
+	"github.com/storacha/piri/pkg/pdp/pieceremover"
 	"github.com/storacha/piri/pkg/presets"
 	"github.com/storacha/piri/pkg/service/storage"
 	"github.com/storacha/piri/pkg/store/delegationstore"
@@ -65,9 +68,10 @@ func (aa *AWSAggregator) AggregatePiece(ctx context.Context, pieceLink piece.Pie
 }
 
 type PDP struct {
-	aggregator  *AWSAggregator
-	pieceAdder  pieceadder.PieceAdder
-	pieceFinder piecefinder.PieceFinder
+	aggregator   *AWSAggregator
+	pieceAdder   pieceadder.PieceAdder
+	pieceFinder  piecefinder.PieceFinder
+	pieceRemover pieceremover.PieceRemover
 }
 
 // Aggregator implements pdp.PDP.
@@ -85,6 +89,11 @@ func (p *PDP) PieceFinder() piecefinder.PieceFinder {
 	return p.pieceFinder
 }
 
+// PieceRemover implements pdp.PDP.
+func (p *PDP) PieceRemover() pieceremover.PieceRemover {
+	return p.pieceRemover
+}
+
 func NewPDP(cfg Config) (*PDP, error) {
 	curioURL, err := url.Parse(cfg.CurioURL)
 	if err != nil {
@@ -101,6 +110,10 @@ func NewPDP(cfg Config) (*PDP, error) {
 		},
 		pieceAdder:  pieceadder.NewCurioAdder(curioClient),
 		pieceFinder: piecefinder.NewCurioFinder(curioClient),
+		// NOTE: pending removals are not shared between lambda invocations, so
+		// aggregate roots are only removed when all of their pieces are removed
+		// by the same instance.
+		pieceRemover: pieceremover.NewCurioRemover(curioClient, cfg.PDPProofSet, dssync.MutexWrap(datastore.NewMapDatastore())),
 	}, nil
 }
 
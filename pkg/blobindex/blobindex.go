@@ -0,0 +1,224 @@
+package blobindex
+
+import (
+	// for go:embed
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/car"
+	"github.com/storacha/go-ucanto/core/ipld"
+	"github.com/storacha/go-ucanto/core/ipld/block"
+	"github.com/storacha/go-ucanto/core/ipld/codec/cbor"
+	"github.com/storacha/go-ucanto/core/ipld/hash/sha256"
+)
+
+//go:embed blobindex.ipldsch
+var blobIndexSchema []byte
+
+var blobIndexTS *schema.TypeSystem
+
+func init() {
+	ts, err := types.LoadSchemaBytes(blobIndexSchema)
+	if err != nil {
+		panic(fmt.Errorf("loading blob index schema: %w", err))
+	}
+	blobIndexTS = ts
+}
+
+func shardedDagIndexType() schema.Type {
+	return blobIndexTS.TypeByName("ShardedDagIndex")
+}
+
+func blobIndexType() schema.Type {
+	return blobIndexTS.TypeByName("BlobIndex")
+}
+
+// ErrUnknownIndex is returned when the root block of an archive is not a
+// sharded DAG index of a known version.
+var ErrUnknownIndex = errors.New("unknown index version")
+
+// ShardedDagIndex describes where the blocks of a DAG can be found within the
+// shards (blobs) it was stored in.
+type ShardedDagIndex struct {
+	// Content is the root of the DAG.
+	Content ipld.Link
+	Shards  []Shard
+}
+
+// Shard is a blob that contains some or all of the blocks of a DAG.
+type Shard struct {
+	// Digest is the multihash of the shard.
+	Digest multihash.Multihash
+	Slices []Slice
+}
+
+// Slice is a byte range within a shard, typically a block.
+type Slice struct {
+	// Digest is the multihash of the bytes in the range.
+	Digest multihash.Multihash
+	Offset uint64
+	Length uint64
+}
+
+// Digests returns the multihashes of every slice in the index, without
+// duplicates.
+func (idx ShardedDagIndex) Digests() []multihash.Multihash {
+	seen := map[string]struct{}{}
+	var digests []multihash.Multihash
+	for _, shard := range idx.Shards {
+		for _, slice := range shard.Slices {
+			if _, ok := seen[string(slice.Digest)]; ok {
+				continue
+			}
+			seen[string(slice.Digest)] = struct{}{}
+			digests = append(digests, slice.Digest)
+		}
+	}
+	return digests
+}
+
+type shardedDagIndexModel struct {
+	Index_0_1 *shardedDagIndexModel_0_1
+}
+
+type shardedDagIndexModel_0_1 struct {
+	Content ipld.Link
+	Shards  []ipld.Link
+}
+
+type blobIndexModel struct {
+	Digest []byte
+	Slices []blobSliceModel
+}
+
+type blobSliceModel struct {
+	Digest   []byte
+	Position positionModel
+}
+
+type positionModel struct {
+	Offset int64
+	Length int64
+}
+
+// Extract reads a sharded DAG index from a CAR archive.
+func Extract(r io.Reader) (ShardedDagIndex, error) {
+	roots, blocks, err := car.Decode(r)
+	if err != nil {
+		return ShardedDagIndex{}, fmt.Errorf("decoding index archive: %w", err)
+	}
+	if len(roots) != 1 {
+		return ShardedDagIndex{}, fmt.Errorf("index archive must have a single root, found %d", len(roots))
+	}
+
+	blks := map[string]ipld.Block{}
+	for b, err := range blocks {
+		if err != nil {
+			return ShardedDagIndex{}, fmt.Errorf("reading index archive block: %w", err)
+		}
+		blks[b.Link().String()] = b
+	}
+
+	root, ok := blks[roots[0].String()]
+	if !ok {
+		return ShardedDagIndex{}, fmt.Errorf("missing index root block: %s", roots[0])
+	}
+	var model shardedDagIndexModel
+	err = block.Decode(root, &model, shardedDagIndexType(), cbor.Codec, sha256.Hasher)
+	if err != nil {
+		return ShardedDagIndex{}, fmt.Errorf("decoding index root block: %w", err)
+	}
+	if model.Index_0_1 == nil {
+		return ShardedDagIndex{}, ErrUnknownIndex
+	}
+
+	idx := ShardedDagIndex{Content: model.Index_0_1.Content}
+	for _, link := range model.Index_0_1.Shards {
+		b, ok := blks[link.String()]
+		if !ok {
+			return ShardedDagIndex{}, fmt.Errorf("missing shard block: %s", link)
+		}
+		var bi blobIndexModel
+		err := block.Decode(b, &bi, blobIndexType(), cbor.Codec, sha256.Hasher)
+		if err != nil {
+			return ShardedDagIndex{}, fmt.Errorf("decoding shard block: %s: %w", link, err)
+		}
+		shard, err := shardFromModel(bi)
+		if err != nil {
+			return ShardedDagIndex{}, fmt.Errorf("reading shard block: %s: %w", link, err)
+		}
+		idx.Shards = append(idx.Shards, shard)
+	}
+	return idx, nil
+}
+
+// Archive encodes a sharded DAG index as a CAR archive.
+func Archive(idx ShardedDagIndex) (io.Reader, error) {
+	var blks []ipld.Block
+	var links []ipld.Link
+	for _, shard := range idx.Shards {
+		bi := blobIndexModel{Digest: shard.Digest, Slices: []blobSliceModel{}}
+		for _, slice := range shard.Slices {
+			bi.Slices = append(bi.Slices, blobSliceModel{
+				Digest:   slice.Digest,
+				Position: positionModel{Offset: int64(slice.Offset), Length: int64(slice.Length)},
+			})
+		}
+		b, err := block.Encode(&bi, blobIndexType(), cbor.Codec, sha256.Hasher)
+		if err != nil {
+			return nil, fmt.Errorf("encoding shard block: %w", err)
+		}
+		blks = append(blks, b)
+		links = append(links, b.Link())
+	}
+
+	model := shardedDagIndexModel{
+		Index_0_1: &shardedDagIndexModel_0_1{Content: idx.Content, Shards: links},
+	}
+	root, err := block.Encode(&model, shardedDagIndexType(), cbor.Codec, sha256.Hasher)
+	if err != nil {
+		return nil, fmt.Errorf("encoding index root block: %w", err)
+	}
+	blks = append([]ipld.Block{root}, blks...)
+
+	return car.Encode([]ipld.Link{root.Link()}, blockIterator(blks)), nil
+}
+
+func shardFromModel(bi blobIndexModel) (Shard, error) {
+	digest, err := multihash.Cast(bi.Digest)
+	if err != nil {
+		return Shard{}, fmt.Errorf("decoding shard digest: %w", err)
+	}
+	shard := Shard{Digest: digest}
+	for _, s := range bi.Slices {
+		d, err := multihash.Cast(s.Digest)
+		if err != nil {
+			return Shard{}, fmt.Errorf("decoding slice digest: %w", err)
+		}
+		if s.Position.Offset < 0 || s.Position.Length < 0 {
+			return Shard{}, fmt.Errorf("invalid slice position: %d-%d", s.Position.Offset, s.Position.Length)
+		}
+		shard.Slices = append(shard.Slices, Slice{
+			Digest: d,
+			Offset: uint64(s.Position.Offset),
+			Length: uint64(s.Position.Length),
+		})
+	}
+	return shard, nil
+}
+
+func blockIterator(blks []ipld.Block) iter.Seq2[ipld.Block, error] {
+	return func(yield func(ipld.Block, error) bool) {
+		for _, b := range blks {
+			if !yield(b, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package blobindex
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-ucanto/core/car"
+	"github.com/storacha/go-ucanto/core/ipld"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/testutil"
+)
+
+func TestShardedDagIndex(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		idx := randomIndex(t, 2, 3)
+
+		r, err := Archive(idx)
+		require.NoError(t, err)
+
+		got, err := Extract(r)
+		require.NoError(t, err)
+		require.Equal(t, idx.Content.String(), got.Content.String())
+		require.Equal(t, idx.Shards, got.Shards)
+	})
+
+	t.Run("digests are unique", func(t *testing.T) {
+		idx := randomIndex(t, 2, 2)
+		// the same block stored in both shards
+		idx.Shards[1].Slices = append(idx.Shards[1].Slices, idx.Shards[0].Slices[0])
+
+		digests := idx.Digests()
+		require.Len(t, digests, 4)
+		require.ElementsMatch(t, []multihash.Multihash{
+			idx.Shards[0].Slices[0].Digest,
+			idx.Shards[0].Slices[1].Digest,
+			idx.Shards[1].Slices[0].Digest,
+			idx.Shards[1].Slices[1].Digest,
+		}, digests)
+	})
+
+	t.Run("rejects archives that are not an index", func(t *testing.T) {
+		r, err := Archive(randomIndex(t, 1, 1))
+		require.NoError(t, err)
+		_, blocks, err := car.Decode(r)
+		require.NoError(t, err)
+
+		// use the shard block as the root
+		var blks []ipld.Block
+		for b, err := range blocks {
+			require.NoError(t, err)
+			blks = append(blks, b)
+		}
+		archive := car.Encode([]ipld.Link{blks[1].Link()}, blockIterator(blks))
+
+		_, err = Extract(archive)
+		require.Error(t, err)
+	})
+
+	t.Run("rejects archives with missing shards", func(t *testing.T) {
+		r, err := Archive(randomIndex(t, 1, 1))
+		require.NoError(t, err)
+		roots, blocks, err := car.Decode(r)
+		require.NoError(t, err)
+
+		var blks []ipld.Block
+		for b, err := range blocks {
+			require.NoError(t, err)
+			if b.Link().String() == roots[0].String() {
+				blks = append(blks, b)
+			}
+		}
+		archive := car.Encode(roots, blockIterator(blks))
+
+		_, err = Extract(archive)
+		require.ErrorContains(t, err, "missing shard block")
+	})
+
+	t.Run("rejects invalid archives", func(t *testing.T) {
+		_, err := Extract(bytes.NewReader(testutil.RandomBytes(t, 64)))
+		require.Error(t, err)
+	})
+}
+
+func randomIndex(t *testing.T, shards, slices int) ShardedDagIndex {
+	idx := ShardedDagIndex{Content: testutil.RandomCID(t)}
+	for range shards {
+		shard := Shard{Digest: testutil.RandomMultihash(t)}
+		var offset uint64
+		for range slices {
+			shard.Slices = append(shard.Slices, Slice{Digest: testutil.RandomMultihash(t), Offset: offset, Length: 128})
+			offset += 128
+		}
+		idx.Shards = append(idx.Shards, shard)
+	}
+	return idx
+}
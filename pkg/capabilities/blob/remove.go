@@ -0,0 +1,46 @@
+// Package blob defines blob capabilities served by the storage node that are
+// not (yet) part of go-libstoracha.
+package blob
+
+import (
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/ipld"
+	"github.com/storacha/go-ucanto/core/schema"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/validator"
+)
+
+const RemoveAbility = "blob/remove"
+
+type RemoveCaveats struct {
+	// Space is the DID of the space the blob should be removed from.
+	Space did.DID
+	// Digest is the hash of the blob to remove.
+	Digest multihash.Multihash
+}
+
+func (rc RemoveCaveats) ToIPLD() (datamodel.Node, error) {
+	return ipld.WrapWithRecovery(&rc, RemoveCaveatsType(), types.Converters...)
+}
+
+type RemoveOk struct {
+	// Size is the number of bytes released from the space. It is zero if the
+	// space had no allocation for the blob.
+	Size uint64
+}
+
+func (ro RemoveOk) ToIPLD() (datamodel.Node, error) {
+	return ipld.WrapWithRecovery(&ro, RemoveOkType(), types.Converters...)
+}
+
+var RemoveCaveatsReader = schema.Struct[RemoveCaveats](RemoveCaveatsType(), nil, types.Converters...)
+var RemoveOkReader = schema.Struct[RemoveOk](RemoveOkType(), nil, types.Converters...)
+
+var Remove = validator.NewCapability(
+	RemoveAbility,
+	schema.DIDString(),
+	RemoveCaveatsReader,
+	validator.DefaultDerives,
+)
@@ -0,0 +1,48 @@
+// Package usage defines capabilities for querying the storage used on the
+// storage node.
+package usage
+
+import (
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/ipld"
+	"github.com/storacha/go-ucanto/core/schema"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/validator"
+)
+
+const GetAbility = "usage/get"
+
+type GetCaveats struct {
+	// Space is the DID of the space to report usage for. When omitted, usage
+	// across every space on the node is reported.
+	Space *did.DID
+}
+
+func (gc GetCaveats) ToIPLD() (datamodel.Node, error) {
+	return ipld.WrapWithRecovery(&gc, GetCaveatsType(), types.Converters...)
+}
+
+type GetOk struct {
+	// Allocated is the number of bytes allocated.
+	Allocated uint64
+	// Received is the number of allocated bytes that have been received.
+	Received uint64
+	// Limit is the quota on the number of bytes that can be allocated. It is
+	// omitted when there is no quota.
+	Limit *uint64
+}
+
+func (ok GetOk) ToIPLD() (datamodel.Node, error) {
+	return ipld.WrapWithRecovery(&ok, GetOkType(), types.Converters...)
+}
+
+var GetCaveatsReader = schema.Struct[GetCaveats](GetCaveatsType(), nil, types.Converters...)
+var GetOkReader = schema.Struct[GetOk](GetOkType(), nil, types.Converters...)
+
+var Get = validator.NewCapability(
+	GetAbility,
+	schema.DIDString(),
+	GetCaveatsReader,
+	validator.DefaultDerives,
+)
@@ -24,6 +24,8 @@ import (
 	"github.com/storacha/go-ucanto/principal"
 	uhttp "github.com/storacha/go-ucanto/transport/http"
 	"github.com/storacha/go-ucanto/ucan"
+
+	"github.com/storacha/piri/pkg/capabilities/usage"
 )
 
 var ErrNoReceipt = errors.New("no error for invocation")
@@ -223,6 +225,42 @@ func (s *Client) PDPInfo(pieceLink piece.PieceLink) (pdp.InfoOk, error) {
 	return result.Unwrap(result.MapError(rcpt.Out(), failure.FromFailureModel))
 }
 
+// Usage sends a usage/get invocation to the storage node and returns the bytes
+// allocated and received by the space, or by every space if space is nil.
+func (s *Client) Usage(space *did.DID) (usage.GetOk, error) {
+	inv, err := usage.Get.Invoke(
+		s.cfg.ID,
+		s.cfg.StorageNodeID,
+		s.cfg.StorageNodeID.DID().String(),
+		usage.GetCaveats{Space: space},
+		delegation.WithProof(s.cfg.StorageProof),
+	)
+	if err != nil {
+		return usage.GetOk{}, fmt.Errorf("generating invocation: %w", err)
+	}
+
+	res, err := client.Execute([]invocation.Invocation{inv}, s.conn)
+	if err != nil {
+		return usage.GetOk{}, fmt.Errorf("sending invocation: %w", err)
+	}
+
+	reader, err := receipt.NewReceiptReaderFromTypes[usage.GetOk, fdm.FailureModel](usage.GetOkType(), fdm.FailureType(), types.Converters...)
+	if err != nil {
+		return usage.GetOk{}, fmt.Errorf("generating receipt reader: %w", err)
+	}
+
+	rcptLink, ok := res.Get(inv.Link())
+	if !ok {
+		return usage.GetOk{}, ErrNoReceipt
+	}
+
+	rcpt, err := reader.Read(rcptLink, res.Blocks())
+	if err != nil {
+		return usage.GetOk{}, fmt.Errorf("reading receipt: %w", err)
+	}
+	return result.Unwrap(result.MapError(rcpt.Out(), failure.FromFailureModel))
+}
+
 func NewClient(cfg Config) (*Client, error) {
 	ch := uhttp.NewHTTPChannel(&cfg.StorageNodeURL)
 	conn, err := client.NewConnection(cfg.StorageNodeID, ch)
@@ -0,0 +1,24 @@
+package gormdb
+
+import (
+	"fmt"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// NewPostgres connects to the PostgreSQL database at the passed connection
+// string, which may be a URL ("postgres://...") or a keyword/value string.
+func NewPostgres(dsn string) (*gorm.DB, error) {
+	log.Info("connecting to GORM PostgreSQL")
+	db, err := gorm.Open(
+		postgres.Open(dsn),
+		&gorm.Config{
+			SkipDefaultTransaction: true,
+			Logger:                 newGormLogger(log),
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
@@ -9,3 +9,12 @@ func Format(digest multihash.Multihash) string {
 	key, _ := multibase.Encode(multibase.Base58BTC, digest)
 	return key
 }
+
+// Parse decodes a digest formatted by [Format].
+func Parse(input string) (multihash.Multihash, error) {
+	_, bytes, err := multibase.Decode(input)
+	if err != nil {
+		return nil, err
+	}
+	return multihash.Cast(bytes)
+}
@@ -0,0 +1,47 @@
+package digestutil
+
+import (
+	"sync"
+
+	"github.com/multiformats/go-multihash"
+)
+
+// Locks provides mutual exclusion per digest, so that services acting on the
+// same blob do not interleave. The zero value is ready to use.
+type Locks struct {
+	mutex sync.Mutex
+	locks map[string]*digestLock
+}
+
+type digestLock struct {
+	mutex sync.Mutex
+	refs  int
+}
+
+// Lock locks the digest, blocking until it is available. The returned function
+// unlocks it.
+func (l *Locks) Lock(digest multihash.Multihash) func() {
+	k := string(digest)
+	l.mutex.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*digestLock{}
+	}
+	lk, ok := l.locks[k]
+	if !ok {
+		lk = &digestLock{}
+		l.locks[k] = lk
+	}
+	lk.refs++
+	l.mutex.Unlock()
+
+	lk.mutex.Lock()
+	return func() {
+		lk.mutex.Unlock()
+		l.mutex.Lock()
+		lk.refs--
+		if lk.refs == 0 {
+			delete(l.locks, k)
+		}
+		l.mutex.Unlock()
+	}
+}
@@ -23,6 +23,8 @@ type Config struct {
 	MaxWorkers uint
 	MaxRetries uint
 	MaxTimeout time.Duration
+	BackoffMin time.Duration
+	BackoffMax time.Duration
 }
 type Option func(c *Config) error
 
@@ -63,6 +65,23 @@ func WithMaxTimeout(maxTimeout time.Duration) Option {
 	}
 }
 
+// WithBackoff retries failed jobs with an exponential backoff, waiting min
+// after the first failed attempt and doubling the wait on each subsequent
+// failure, up to max.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Config) error {
+		if min <= 0 {
+			return errors.New("backoff minimum must be greater than zero")
+		}
+		if max < min {
+			return errors.New("backoff maximum cannot be less than the minimum")
+		}
+		c.BackoffMin = min
+		c.BackoffMax = max
+		return nil
+	}
+}
+
 type JobQueue[T any] struct {
 	worker *worker.Worker[T]
 	queue  *queue.Queue
@@ -102,7 +121,11 @@ func New[T any](name string, db *sql.DB, ser serializer.Serializer[T], opts ...O
 	}
 
 	// instantiate worker which consumes from queue
-	w := worker.New[T](q, ser, worker.WithLog(c.Logger), worker.WithLimit(int(c.MaxWorkers)))
+	w := worker.New[T](q, ser,
+		worker.WithLog(c.Logger),
+		worker.WithLimit(int(c.MaxWorkers)),
+		worker.WithBackoff(c.BackoffMin, c.BackoffMax),
+	)
 
 	return &JobQueue[T]{
 		queue:  q,
@@ -121,3 +144,21 @@ func (j *JobQueue[T]) Register(name string, fn func(context.Context, T) error) e
 func (j *JobQueue[T]) Enqueue(ctx context.Context, name string, msg T) error {
 	return j.worker.Enqueue(ctx, name, msg)
 }
+
+// EnqueueTx is like Enqueue, but within an existing transaction, so that the
+// job is only queued if the transaction commits.
+func (j *JobQueue[T]) EnqueueTx(ctx context.Context, tx *sql.Tx, name string, msg T) error {
+	return j.worker.EnqueueTx(ctx, tx, name, msg)
+}
+
+// OnFailure registers a function to call when the named job fails on its final
+// attempt. It is retried until it succeeds.
+func (j *JobQueue[T]) OnFailure(name string, fn func(context.Context, T, error) error) error {
+	return j.worker.OnFailure(name, fn)
+}
+
+// List the jobs waiting in the queue, oldest first, including failed jobs
+// whose failure has not yet been handled.
+func (j *JobQueue[T]) List(ctx context.Context) ([]worker.Job[T], error) {
+	return j.worker.List(ctx)
+}
@@ -21,6 +21,9 @@ import (
 //go:embed schema.sql
 var schema string
 
+// parked is the timeout given to messages that are not to be received again.
+const parked = "9999-12-31T23:59:59.999Z"
+
 // rfc3339Milli is like time.RFC3339Nano, but with millisecond precision, and fractional seconds do not have trailing
 // zeros removed.
 const rfc3339Milli = "2006-01-02T15:04:05.000Z07:00"
@@ -149,6 +152,27 @@ func (q *Queue) Receive(ctx context.Context) (*Message, error) {
 
 // receiveTx is like Receive, but within an existing transaction.
 func (q *Queue) receiveTx(ctx context.Context, tx *sql.Tx) (*Message, error) {
+	return q.receiveWhereTx(ctx, tx, "received < ?")
+}
+
+// ReceiveExhausted receives a Message that has already been received
+// MaxReceive times, or nil if there is none, so that its failure can be
+// handled. Each receive still increments the receive count, so the number of
+// attempts at handling the failure is Received - MaxReceive.
+func (q *Queue) ReceiveExhausted(ctx context.Context) (*Message, error) {
+	var m *Message
+	err := internalsql.InTx(q.db, func(tx *sql.Tx) error {
+		var err error
+		m, err = q.receiveWhereTx(ctx, tx, "received >= ?")
+		return err
+	})
+	return m, err
+}
+
+// receiveWhereTx receives the oldest message whose timeout has passed and
+// whose receive count satisfies the condition, which is compared with
+// MaxReceive.
+func (q *Queue) receiveWhereTx(ctx context.Context, tx *sql.Tx, receivedCond string) (*Message, error) {
 	now := time.Now()
 	nowFormatted := now.Format(rfc3339Milli)
 	timeoutFormatted := now.Add(q.timeout).Format(rfc3339Milli)
@@ -163,7 +187,7 @@ func (q *Queue) receiveTx(ctx context.Context, tx *sql.Tx) (*Message, error) {
 			where
 				queue = ? and
 				? >= timeout and
-				received < ?
+				` + receivedCond + `
 			order by created
 			limit 1
 		)
@@ -220,6 +244,26 @@ func (q *Queue) extendTx(ctx context.Context, tx *sql.Tx, id ID, delay time.Dura
 	return err
 }
 
+// Release a received Message back to the queue, so that it can be received
+// again straight away without the receive counting towards MaxReceive.
+func (q *Queue) Release(ctx context.Context, id ID) error {
+	return internalsql.InTx(q.db, func(tx *sql.Tx) error {
+		timeout := time.Now().Format(rfc3339Milli)
+		query := `update jobqueue set timeout = ?, received = max(received - 1, 0) where queue = ? and id = ?`
+		_, err := tx.ExecContext(ctx, query, timeout, q.name, id)
+		return err
+	})
+}
+
+// Park a Message so that it is never received again. It remains in the queue,
+// and is listed, until it is deleted.
+func (q *Queue) Park(ctx context.Context, id ID) error {
+	return internalsql.InTx(q.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `update jobqueue set timeout = ? where queue = ? and id = ?`, parked, q.name, id)
+		return err
+	})
+}
+
 // Delete a Message from the queue by id.
 func (q *Queue) Delete(ctx context.Context, id ID) error {
 	return internalsql.InTx(q.db, func(tx *sql.Tx) error {
@@ -233,6 +277,46 @@ func (q *Queue) deleteTx(ctx context.Context, tx *sql.Tx, id ID) error {
 	return err
 }
 
+// Entry is a message held in the queue, along with its delivery state.
+type Entry struct {
+	ID       ID
+	Created  time.Time
+	Timeout  time.Time // Time after which the message can be received again.
+	Received int
+	Body     []byte
+}
+
+// List all messages in the queue, oldest first. Messages that have been
+// received MaxReceive times are included, since they remain in the queue
+// until they are deleted. Parked messages have a zero Timeout.
+func (q *Queue) List(ctx context.Context) ([]Entry, error) {
+	query := `select id, created, timeout, received, body from jobqueue where queue = ? order by created`
+	rows, err := q.db.QueryContext(ctx, query, q.name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		var created, timeout string
+		if err := rows.Scan(&e.ID, &created, &timeout, &e.Received, &e.Body); err != nil {
+			return nil, err
+		}
+		if e.Created, err = time.Parse(rfc3339Milli, created); err != nil {
+			return nil, fmt.Errorf("parsing created time of message %s: %w", e.ID, err)
+		}
+		if timeout != parked {
+			if e.Timeout, err = time.Parse(rfc3339Milli, timeout); err != nil {
+				return nil, fmt.Errorf("parsing timeout of message %s: %w", e.ID, err)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
 // Setup the queue in the database.
 func Setup(ctx context.Context, db *sql.DB) error {
 	_, err := db.ExecContext(ctx, schema)
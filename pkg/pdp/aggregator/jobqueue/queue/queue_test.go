@@ -248,6 +248,127 @@ func TestQueue_Extend(t *testing.T) {
 	})
 }
 
+func TestQueue_Release(t *testing.T) {
+	t.Run("can receive a released message again without counting the receive", func(t *testing.T) {
+		q := newQ(t, queue.NewOpts{Timeout: time.Minute})
+
+		err := q.Send(context.Background(), queue.Message{Body: []byte("yo")})
+		require.NoError(t, err)
+
+		m, err := q.Receive(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, m)
+		require.Equal(t, 1, m.Received)
+
+		err = q.Release(context.Background(), m.ID)
+		require.NoError(t, err)
+
+		m, err = q.Receive(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, m)
+		require.Equal(t, 1, m.Received)
+	})
+}
+
+func TestQueue_ReceiveExhausted(t *testing.T) {
+	t.Run("receives only messages that reached the max receive count", func(t *testing.T) {
+		q := newQ(t, queue.NewOpts{MaxReceive: 1, Timeout: time.Millisecond})
+
+		err := q.Send(context.Background(), queue.Message{Body: []byte("yo")})
+		require.NoError(t, err)
+
+		m, err := q.ReceiveExhausted(context.Background())
+		require.NoError(t, err)
+		require.Nil(t, m)
+
+		m, err = q.Receive(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, m)
+		time.Sleep(time.Millisecond)
+
+		m, err = q.Receive(context.Background())
+		require.NoError(t, err)
+		require.Nil(t, m)
+
+		m, err = q.ReceiveExhausted(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, m)
+		require.Equal(t, 2, m.Received)
+	})
+}
+
+func TestQueue_Park(t *testing.T) {
+	t.Run("does not receive a parked message", func(t *testing.T) {
+		q := newQ(t, queue.NewOpts{MaxReceive: 1, Timeout: time.Millisecond})
+
+		id, err := q.SendAndGetID(context.Background(), queue.Message{Body: []byte("yo")})
+		require.NoError(t, err)
+		err = q.Park(context.Background(), id)
+		require.NoError(t, err)
+
+		m, err := q.Receive(context.Background())
+		require.NoError(t, err)
+		require.Nil(t, m)
+		m, err = q.ReceiveExhausted(context.Background())
+		require.NoError(t, err)
+		require.Nil(t, m)
+
+		entries, err := q.List(context.Background())
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.True(t, entries[0].Timeout.IsZero())
+	})
+}
+
+func TestQueue_List(t *testing.T) {
+	t.Run("lists messages in the queue with their delivery state", func(t *testing.T) {
+		q := newQ(t, queue.NewOpts{Timeout: time.Second})
+
+		entries, err := q.List(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, entries)
+
+		first, err := q.SendAndGetID(context.Background(), queue.Message{Body: []byte("yo")})
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond)
+		second, err := q.SendAndGetID(context.Background(), queue.Message{Body: []byte("hey"), Delay: time.Minute})
+		require.NoError(t, err)
+
+		m, err := q.Receive(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, first, m.ID)
+
+		entries, err = q.List(context.Background())
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+
+		require.Equal(t, first, entries[0].ID)
+		require.Equal(t, "yo", string(entries[0].Body))
+		require.Equal(t, 1, entries[0].Received)
+		require.WithinDuration(t, time.Now().Add(time.Second), entries[0].Timeout, 500*time.Millisecond)
+
+		require.Equal(t, second, entries[1].ID)
+		require.Equal(t, 0, entries[1].Received)
+		require.WithinDuration(t, time.Now().Add(time.Minute), entries[1].Timeout, 500*time.Millisecond)
+		require.False(t, entries[1].Created.Before(entries[0].Created))
+	})
+
+	t.Run("does not list messages from a different queue", func(t *testing.T) {
+		db := testing2.NewInMemoryDB(t)
+		q, err := queue.New(queue.NewOpts{DB: db, Name: "test"})
+		require.NoError(t, err)
+		other, err := queue.New(queue.NewOpts{DB: db, Name: "other"})
+		require.NoError(t, err)
+
+		err = q.Send(context.Background(), queue.Message{Body: []byte("yo")})
+		require.NoError(t, err)
+
+		entries, err := other.List(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+}
+
 func TestQueue_ReceiveAndWait(t *testing.T) {
 	t.Run("waits for a message until the context is cancelled", func(t *testing.T) {
 		q := newQ(t, queue.NewOpts{Timeout: time.Millisecond})
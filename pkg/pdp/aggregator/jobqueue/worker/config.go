@@ -10,6 +10,8 @@ type Config struct {
 	JobCountLimit int
 	PollInterval  time.Duration
 	Extend        time.Duration
+	BackoffMin    time.Duration
+	BackoffMax    time.Duration
 }
 
 // Option modifies a Config before creating the Worker.
@@ -39,6 +41,16 @@ func WithExtend(d time.Duration) Option {
 	}
 }
 
+// WithBackoff delays the retry of a failed job exponentially, starting at min
+// after the first failed attempt and doubling on each subsequent failure up to
+// max. Without it, a failed job is retried once its message timeout passes.
+func WithBackoff(min, max time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.BackoffMin = min
+		cfg.BackoffMax = max
+	}
+}
+
 // subset from ipfs go-log v2
 type StandardLogger interface {
 	Debug(args ...interface{})
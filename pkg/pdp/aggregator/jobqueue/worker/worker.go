@@ -30,11 +30,18 @@ import (
 	"github.com/storacha/piri/pkg/pdp/aggregator/jobqueue/serializer"
 )
 
+// ErrMaxAttempts is passed to a failure handler that is being retried, since
+// the error from the final attempt of the job is not kept.
+var ErrMaxAttempts = errors.New("job exhausted its attempts")
+
 type Worker[T any] struct {
 	queue         *queue.Queue
 	jobs          map[string]func(ctx context.Context, msg T) error
+	failures      map[string]func(ctx context.Context, msg T, err error) error
 	pollInterval  time.Duration
 	extend        time.Duration
+	backoffMin    time.Duration
+	backoffMax    time.Duration
 	jobCount      int
 	jobCountLimit int
 	jobCountLock  sync.RWMutex
@@ -65,7 +72,8 @@ func New[T any](q *queue.Queue, ser serializer.Serializer[T], options ...Option)
 
 	// Construct the Worker using the final config
 	jq := &Worker[T]{
-		jobs: make(map[string]func(ctx context.Context, msg T) error),
+		jobs:     make(map[string]func(ctx context.Context, msg T) error),
+		failures: make(map[string]func(ctx context.Context, msg T, err error) error),
 
 		queue:      q,
 		serializer: ser,
@@ -74,6 +82,8 @@ func New[T any](q *queue.Queue, ser serializer.Serializer[T], options ...Option)
 		jobCountLimit: cfg.JobCountLimit,
 		pollInterval:  cfg.PollInterval,
 		extend:        cfg.Extend,
+		backoffMin:    cfg.BackoffMin,
+		backoffMax:    cfg.BackoffMax,
 	}
 	return jq
 }
@@ -117,6 +127,84 @@ func (r *Worker[T]) Register(name string, fn func(ctx context.Context, msg T) er
 	return nil
 }
 
+// OnFailure registers a function that is called when the named job fails on
+// its final attempt. If the function succeeds the job is removed from the
+// queue, otherwise it is called again, with backoff, until it does. Jobs
+// without a failure handler remain in the queue, and are listed as failed,
+// until they are deleted.
+func (r *Worker[T]) OnFailure(name string, fn func(ctx context.Context, msg T, err error) error) error {
+	if _, ok := r.jobs[name]; !ok {
+		return fmt.Errorf(`job "%v" not registered`, name)
+	}
+	if _, ok := r.failures[name]; ok {
+		return fmt.Errorf(`failure handler for job "%v" already registered`, name)
+	}
+	r.failures[name] = fn
+	return nil
+}
+
+// Job is a job held in the queue, waiting to run or to be retried.
+type Job[T any] struct {
+	ID   queue.ID
+	Name string
+	Msg  T
+	// Attempts is the number of times the job has been received for running.
+	Attempts int
+	// MaxAttempts is the number of attempts after which the job is not retried.
+	MaxAttempts int
+	Created     time.Time
+	// NextAttempt is the earliest time the job, or the failure handler of a
+	// failed job, will be run again. It is zero for a failed job without a
+	// failure handler.
+	NextAttempt time.Time
+	// Failed reports that the job exhausted its attempts and will not run
+	// again. It remains in the queue until its failure has been handled.
+	Failed bool
+}
+
+// List the jobs in the queue, oldest first.
+func (r *Worker[T]) List(ctx context.Context) ([]Job[T], error) {
+	entries, err := r.queue.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing queue: %w", err)
+	}
+	jobs := make([]Job[T], 0, len(entries))
+	for _, e := range entries {
+		var jm message
+		if err := json.NewDecoder(bytes.NewReader(e.Body)).Decode(&jm); err != nil {
+			return nil, fmt.Errorf("decoding job message %s body: %w", e.ID, err)
+		}
+		msg, err := r.serializer.Deserialize(jm.Message)
+		if err != nil {
+			return nil, fmt.Errorf("deserializing job message %s: %w", e.ID, err)
+		}
+		jobs = append(jobs, Job[T]{
+			ID:          e.ID,
+			Name:        jm.Name,
+			Msg:         msg,
+			Attempts:    min(e.Received, r.queue.MaxReceive()),
+			MaxAttempts: r.queue.MaxReceive(),
+			Failed:      e.Received >= r.queue.MaxReceive(),
+			Created:     e.Created,
+			NextAttempt: e.Timeout,
+		})
+	}
+	return jobs, nil
+}
+
+// backoff returns the delay before a job that has failed the given number of
+// attempts is retried.
+func (r *Worker[T]) backoff(attempt int) time.Duration {
+	delay := r.backoffMin
+	for i := 1; i < attempt && delay < r.backoffMax; i++ {
+		delay *= 2
+	}
+	if r.backoffMax > 0 && delay > r.backoffMax {
+		delay = r.backoffMax
+	}
+	return delay
+}
+
 func (r *Worker[T]) Enqueue(ctx context.Context, name string, msg T) error {
 	r.log.Infof("Enqueue -> %s: %v", name, msg)
 	m, err := r.serializer.Serialize(msg)
@@ -153,6 +241,20 @@ func (r *Worker[T]) receiveAndRun(ctx context.Context, wg *sync.WaitGroup) {
 		r.jobCountLock.RUnlock()
 	}
 
+	// handle failures that are due to be retried before running new jobs
+	if len(r.failures) > 0 {
+		m, err := r.queue.ReceiveExhausted(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.log.Errorw("Error receiving failed job", "error", err)
+		} else if m != nil {
+			r.runFailure(ctx, wg, m)
+			return
+		}
+	}
+
 	m, err := r.queue.ReceiveAndWait(ctx, r.pollInterval)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
@@ -168,15 +270,9 @@ func (r *Worker[T]) receiveAndRun(ctx context.Context, wg *sync.WaitGroup) {
 		return
 	}
 
-	var jm message
-	if err := json.NewDecoder(bytes.NewReader(m.Body)).Decode(&jm); err != nil {
-		r.log.Errorw("Error decoding job message body", "error", err)
-		return
-	}
-
-	jobInput, err := r.serializer.Deserialize(jm.Message)
+	jm, jobInput, err := r.decode(m)
 	if err != nil {
-		r.log.Errorw("Error deserializing job message", "error", err)
+		r.log.Errorw("Error decoding job message", "error", err)
 		return
 	}
 
@@ -210,42 +306,51 @@ func (r *Worker[T]) receiveAndRun(ctx context.Context, wg *sync.WaitGroup) {
 		defer cancel()
 
 		// Extend the job message while the job is running
-		go func() {
-			// Start by sleeping so we don't extend immediately
-			time.Sleep(r.extend - r.extend/5)
-			for {
-				select {
-				case <-jobCtx.Done():
-					return
-				default:
-					r.log.Infow("Extending message timeout", "name", jm.Name)
-					if err := r.queue.Extend(jobCtx, m.ID, r.extend); err != nil {
-						r.log.Errorw("Error extending message timeout", "error", err)
-					}
-					time.Sleep(r.extend - r.extend/5)
-				}
-			}
-		}()
+		stopExtending := r.extendWhileRunning(jobCtx, m.ID, jm.Name)
 
 		r.log.Infow("Running job", "name", jm.Name, "attempt", m.Received)
 		before := time.Now()
-		if err := job(jobCtx, jobInput); err != nil {
-			if m.Received == r.queue.MaxReceive() {
+		err := job(jobCtx, jobInput)
+		// stop extending so it cannot overwrite the retry delay set below
+		stopExtending()
+		if err != nil {
+			if ctx.Err() != nil {
+				// the job was interrupted because the worker is stopping, so this
+				// attempt does not count and the job runs again on restart
+				r.log.Warnw("Job interrupted, releasing", "name", jm.Name, "attempt", m.Received, "error", err)
+				releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				if err := r.queue.Release(releaseCtx, m.ID); err != nil {
+					r.log.Errorw("Error releasing interrupted job", "error", err)
+				}
+				return
+			}
+			if m.Received >= r.queue.MaxReceive() {
 				r.log.Errorw("Failed to run job, max retries reached, will not retry",
-					"name", jm.Name,
-					"attempt", m.Received,
-					"next_attempt", r.queue.Timeout(),
-					"max_attempts", r.queue.MaxReceive(),
-					"error", err,
-				)
-			} else {
-				r.log.Warnw("Error running job, retrying",
 					"name", jm.Name,
 					"attempt", m.Received,
 					"max_attempts", r.queue.MaxReceive(),
 					"error", err,
 				)
+				r.fail(ctx, m, jm.Name, jobInput, err)
+				return
+			}
+			next := r.queue.Timeout()
+			if r.backoffMin > 0 {
+				next = r.backoff(m.Received)
+				retryCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				if err := r.queue.Extend(retryCtx, m.ID, next); err != nil {
+					r.log.Errorw("Error delaying job retry", "error", err)
+				}
 			}
+			r.log.Warnw("Error running job, retrying",
+				"name", jm.Name,
+				"attempt", m.Received,
+				"next_attempt", next,
+				"max_attempts", r.queue.MaxReceive(),
+				"error", err,
+			)
 			return
 		}
 		duration := time.Since(before)
@@ -259,3 +364,120 @@ func (r *Worker[T]) receiveAndRun(ctx context.Context, wg *sync.WaitGroup) {
 		}
 	}()
 }
+
+// extendWhileRunning extends the message timeout until the returned function
+// is called, so that the message is not received again while it is being
+// handled.
+func (r *Worker[T]) extendWhileRunning(ctx context.Context, id queue.ID, name string) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	extending := make(chan struct{})
+	go func() {
+		defer close(extending)
+		for {
+			// Start by sleeping so we don't extend immediately
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(r.extend - r.extend/5):
+			}
+			r.log.Infow("Extending message timeout", "name", name)
+			if err := r.queue.Extend(ctx, id, r.extend); err != nil && ctx.Err() == nil {
+				r.log.Errorw("Error extending message timeout", "error", err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-extending
+	}
+}
+
+// decode reads the job name and input from a received message.
+func (r *Worker[T]) decode(m *queue.Message) (message, T, error) {
+	var jm message
+	var input T
+	if err := json.NewDecoder(bytes.NewReader(m.Body)).Decode(&jm); err != nil {
+		return jm, input, fmt.Errorf("decoding body: %w", err)
+	}
+	input, err := r.serializer.Deserialize(jm.Message)
+	if err != nil {
+		return jm, input, fmt.Errorf("deserializing: %w", err)
+	}
+	return jm, input, nil
+}
+
+// runFailure retries the failure handler of a job that exhausted its
+// attempts.
+func (r *Worker[T]) runFailure(ctx context.Context, wg *sync.WaitGroup, m *queue.Message) {
+	jm, input, err := r.decode(m)
+	if err != nil {
+		r.log.Errorw("Error decoding failed job message", "error", err)
+		return
+	}
+
+	r.jobCountLock.Lock()
+	r.jobCount++
+	r.jobCountLock.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			r.jobCountLock.Lock()
+			r.jobCount--
+			r.jobCountLock.Unlock()
+		}()
+		defer func() {
+			if rec := recover(); rec != nil {
+				r.log.Errorw("Recovered from panic in job failure handler", "error", rec)
+			}
+		}()
+
+		r.log.Infow("Retrying job failure handler", "name", jm.Name, "attempt", m.Received-r.queue.MaxReceive()+1)
+		r.fail(ctx, m, jm.Name, input, ErrMaxAttempts)
+	}()
+}
+
+// fail runs the failure handler for a job that has exhausted its attempts and
+// removes the job from the queue if the handler succeeds. If the handler fails
+// it is retried after a delay, and if there is no handler the job is parked so
+// that it is not received again.
+func (r *Worker[T]) fail(ctx context.Context, m *queue.Message, name string, msg T, jobErr error) {
+	fn, ok := r.failures[name]
+	if !ok {
+		parkCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := r.queue.Park(parkCtx, m.ID); err != nil {
+			r.log.Errorw("Error parking failed job", "name", name, "error", err)
+		}
+		return
+	}
+	stopExtending := r.extendWhileRunning(ctx, m.ID, name)
+	err := fn(ctx, msg, jobErr)
+	stopExtending()
+	if err != nil {
+		// the receive count continues past the max, counting failure attempts
+		attempt := m.Received - r.queue.MaxReceive() + 1
+		next := r.queue.Timeout()
+		if r.backoffMin > 0 {
+			next = r.backoff(attempt)
+			retryCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := r.queue.Extend(retryCtx, m.ID, next); err != nil {
+				r.log.Errorw("Error delaying job failure retry", "error", err)
+			}
+		}
+		r.log.Errorw("Error handling job failure, retrying",
+			"name", name,
+			"attempt", attempt,
+			"next_attempt", next,
+			"error", err,
+		)
+		return
+	}
+	deleteCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.queue.Delete(deleteCtx, m.ID); err != nil {
+		r.log.Errorw("Error deleting failed job from queue", "name", name, "error", err)
+	}
+}
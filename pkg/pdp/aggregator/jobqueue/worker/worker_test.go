@@ -140,6 +140,178 @@ func TestRunner_Start(t *testing.T) {
 	})
 }
 
+func TestRunner_Retry(t *testing.T) {
+	t.Run("delays retries with exponential backoff", func(t *testing.T) {
+		q := internaltesting.NewQ(t, queue.NewOpts{Timeout: 10 * time.Millisecond, MaxReceive: 5})
+		r := worker.New[[]byte](
+			q,
+			&PassThroughSerializer[[]byte]{},
+			worker.WithExtend(100*time.Millisecond),
+			worker.WithPollInterval(time.Millisecond),
+			worker.WithBackoff(50*time.Millisecond, 80*time.Millisecond),
+		)
+
+		var attempts []time.Time
+		ctx, cancel := context.WithCancel(context.Background())
+		r.Register("test", func(ctx context.Context, m []byte) error {
+			attempts = append(attempts, time.Now())
+			if len(attempts) == 3 {
+				cancel()
+				return nil
+			}
+			return fmt.Errorf("attempt %d failed", len(attempts))
+		})
+
+		err := r.Enqueue(ctx, "test", []byte("yo"))
+		require.NoError(t, err)
+
+		r.Start(ctx)
+		require.Len(t, attempts, 3)
+		require.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), 50*time.Millisecond)
+		// doubled, but capped at the maximum
+		require.GreaterOrEqual(t, attempts[2].Sub(attempts[1]), 80*time.Millisecond)
+	})
+
+	t.Run("calls the failure handler after the final attempt", func(t *testing.T) {
+		q := internaltesting.NewQ(t, queue.NewOpts{Timeout: time.Millisecond, MaxReceive: 2})
+		r := worker.New[[]byte](
+			q,
+			&PassThroughSerializer[[]byte]{},
+			worker.WithExtend(100*time.Millisecond),
+			worker.WithPollInterval(time.Millisecond),
+		)
+
+		var attempts int
+		ctx, cancel := context.WithCancel(context.Background())
+		err := r.Register("test", func(ctx context.Context, m []byte) error {
+			attempts++
+			return fmt.Errorf("boom")
+		})
+		require.NoError(t, err)
+
+		var failed []byte
+		var failure error
+		err = r.OnFailure("test", func(ctx context.Context, m []byte, err error) error {
+			failed = m
+			failure = err
+			cancel()
+			return nil
+		})
+		require.NoError(t, err)
+
+		err = r.Enqueue(ctx, "test", []byte("yo"))
+		require.NoError(t, err)
+
+		r.Start(ctx)
+		require.Equal(t, 2, attempts)
+		require.Equal(t, "yo", string(failed))
+		require.EqualError(t, failure, "boom")
+
+		// the failed job is removed from the queue
+		jobs, err := r.List(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, jobs)
+	})
+
+	t.Run("retries the failure handler until it succeeds", func(t *testing.T) {
+		q := internaltesting.NewQ(t, queue.NewOpts{Timeout: time.Millisecond, MaxReceive: 1})
+		r := worker.New[[]byte](
+			q,
+			&PassThroughSerializer[[]byte]{},
+			worker.WithExtend(100*time.Millisecond),
+			worker.WithPollInterval(time.Millisecond),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		err := r.Register("test", func(ctx context.Context, m []byte) error {
+			return fmt.Errorf("boom")
+		})
+		require.NoError(t, err)
+
+		var failures []error
+		err = r.OnFailure("test", func(ctx context.Context, m []byte, err error) error {
+			failures = append(failures, err)
+			if len(failures) < 3 {
+				// the failed job is listed while its failure is unhandled
+				jobs, lerr := r.List(context.Background())
+				require.NoError(t, lerr)
+				require.Len(t, jobs, 1)
+				require.True(t, jobs[0].Failed)
+				require.Equal(t, 1, jobs[0].Attempts)
+				return fmt.Errorf("handler failed")
+			}
+			cancel()
+			return nil
+		})
+		require.NoError(t, err)
+
+		err = r.Enqueue(ctx, "test", []byte("yo"))
+		require.NoError(t, err)
+
+		r.Start(ctx)
+		require.Len(t, failures, 3)
+		require.EqualError(t, failures[0], "boom")
+		require.ErrorIs(t, failures[2], worker.ErrMaxAttempts)
+
+		jobs, err := r.List(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, jobs)
+	})
+
+	t.Run("parks failed jobs without a failure handler", func(t *testing.T) {
+		q := internaltesting.NewQ(t, queue.NewOpts{Timeout: time.Millisecond, MaxReceive: 1})
+		r := worker.New[[]byte](
+			q,
+			&PassThroughSerializer[[]byte]{},
+			worker.WithExtend(100*time.Millisecond),
+			worker.WithPollInterval(time.Millisecond),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		err := r.Register("test", func(ctx context.Context, m []byte) error {
+			return fmt.Errorf("boom")
+		})
+		require.NoError(t, err)
+		err = r.Enqueue(ctx, "test", []byte("yo"))
+		require.NoError(t, err)
+
+		go r.Start(ctx)
+		require.Eventually(t, func() bool {
+			jobs, err := r.List(context.Background())
+			require.NoError(t, err)
+			return len(jobs) == 1 && jobs[0].Failed && jobs[0].NextAttempt.IsZero()
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("errors registering a failure handler for an unknown job", func(t *testing.T) {
+		r := worker.New[[]byte](nil, nil)
+		err := r.OnFailure("test", func(ctx context.Context, m []byte, err error) error { return nil })
+		require.Error(t, err)
+	})
+}
+
+func TestRunner_List(t *testing.T) {
+	t.Run("lists queued jobs", func(t *testing.T) {
+		_, r := newRunner(t)
+
+		err := r.Enqueue(context.Background(), "test", []byte("yo"))
+		require.NoError(t, err)
+		err = r.Enqueue(context.Background(), "other", []byte("hey"))
+		require.NoError(t, err)
+
+		jobs, err := r.List(context.Background())
+		require.NoError(t, err)
+		require.Len(t, jobs, 2)
+		require.Equal(t, "test", jobs[0].Name)
+		require.Equal(t, "yo", string(jobs[0].Msg))
+		require.Equal(t, 0, jobs[0].Attempts)
+		require.Equal(t, 3, jobs[0].MaxAttempts)
+		require.Equal(t, "other", jobs[1].Name)
+		require.Equal(t, "hey", string(jobs[1].Msg))
+	})
+}
+
 func TestCreateTx(t *testing.T) {
 	t.Run("can create a job inside a transaction", func(t *testing.T) {
 		db := internaltesting.NewInMemoryDB(t)
@@ -22,6 +22,7 @@ type PDPClient interface {
 	GetProofSet(ctx context.Context, id uint64) (ProofSet, error)
 	DeleteProofSet(ctx context.Context, id uint64) error
 	AddRootsToProofSet(ctx context.Context, id uint64, addRoots []AddRootRequest) error
+	DeleteRootFromProofSet(ctx context.Context, id uint64, rootID uint64) error
 	AddPiece(ctx context.Context, addPiece AddPiece) (*UploadRef, error)
 	UploadPiece(ctx context.Context, ref UploadRef, data io.Reader) error
 	FindPiece(ctx context.Context, piece PieceHash) (FoundPiece, error)
@@ -196,6 +197,11 @@ func (c *Client) AddRootsToProofSet(ctx context.Context, id uint64, roots []AddR
 	return c.verifySuccess(c.postJson(ctx, url, payload))
 }
 
+func (c *Client) DeleteRootFromProofSet(ctx context.Context, id uint64, rootID uint64) error {
+	url := c.endpoint.JoinPath(pdpRoutePath, proofSetsPath, "/", strconv.FormatUint(id, 10), rootsPath, "/", strconv.FormatUint(rootID, 10)).String()
+	return c.verifySuccess(c.sendRequest(ctx, http.MethodDelete, url, nil))
+}
+
 func (c *Client) AddPiece(ctx context.Context, addPiece AddPiece) (*UploadRef, error) {
 	url := c.endpoint.JoinPath(pdpRoutePath, piecePath).String()
 	res, err := c.postJson(ctx, url, addPiece)
@@ -4,10 +4,12 @@ import (
 	"github.com/storacha/piri/pkg/pdp/aggregator"
 	"github.com/storacha/piri/pkg/pdp/pieceadder"
 	"github.com/storacha/piri/pkg/pdp/piecefinder"
+	"github.com/storacha/piri/pkg/pdp/pieceremover"
 )
 
 type PDP interface {
 	PieceAdder() pieceadder.PieceAdder
 	PieceFinder() piecefinder.PieceFinder
+	PieceRemover() pieceremover.PieceRemover
 	Aggregator() aggregator.Aggregator
 }
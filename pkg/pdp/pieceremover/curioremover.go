@@ -0,0 +1,102 @@
+package pieceremover
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/storacha/go-libstoracha/piece/piece"
+
+	"github.com/storacha/piri/pkg/pdp/curio"
+)
+
+var log = logging.Logger("pdp/pieceremover")
+
+type PieceRemover interface {
+	// RemovePiece marks a piece as no longer required. The proof set root the
+	// piece was aggregated into is scheduled for removal once all of its pieces
+	// have been removed.
+	RemovePiece(ctx context.Context, piece piece.PieceLink) error
+}
+
+// Removes roots from the proof set by interacting with Curio
+type CurioRemover struct {
+	client   curio.PDPClient
+	proofSet uint64
+	removed  datastore.Datastore
+}
+
+var _ PieceRemover = (*CurioRemover)(nil)
+
+func (r *CurioRemover) RemovePiece(ctx context.Context, p piece.PieceLink) error {
+	// subroots are added to the proof set by their v1 piece CID
+	subroot := p.V1Link().String()
+	log := log.With("piece", subroot)
+
+	err := r.removed.Put(ctx, removedKey(subroot), []byte{})
+	if err != nil {
+		return fmt.Errorf("recording piece removal: %w", err)
+	}
+
+	proofSet, err := r.client.GetProofSet(ctx, r.proofSet)
+	if err != nil {
+		return fmt.Errorf("getting proof set: %w", err)
+	}
+
+	// find the root the piece was added to as a subroot
+	var rootID uint64
+	found := false
+	for _, entry := range proofSet.Roots {
+		if entry.SubrootCID == subroot {
+			rootID = entry.RootID
+			found = true
+			break
+		}
+	}
+	if !found {
+		log.Warn("piece not found in proof set, root removal will happen when other pieces in its aggregate are removed")
+		return nil
+	}
+
+	var subroots []string
+	for _, entry := range proofSet.Roots {
+		if entry.RootID != rootID {
+			continue
+		}
+		has, err := r.removed.Has(ctx, removedKey(entry.SubrootCID))
+		if err != nil {
+			return fmt.Errorf("checking subroot removal: %w", err)
+		}
+		if !has {
+			log.Infow("root still has pieces that have not been removed", "root", rootID, "subroot", entry.SubrootCID)
+			return nil
+		}
+		subroots = append(subroots, entry.SubrootCID)
+	}
+
+	err = r.client.DeleteRootFromProofSet(ctx, r.proofSet, rootID)
+	if err != nil {
+		return fmt.Errorf("deleting root %d from proof set %d: %w", rootID, r.proofSet, err)
+	}
+	log.Infow("scheduled root removal from proof set", "root", rootID, "proofSet", r.proofSet)
+
+	for _, s := range subroots {
+		err := r.removed.Delete(ctx, removedKey(s))
+		if err != nil {
+			return fmt.Errorf("clearing piece removal: %w", err)
+		}
+	}
+	return nil
+}
+
+// NewCurioRemover creates a [PieceRemover] that removes roots from the passed
+// proof set. The datastore is used to track pieces that have been removed
+// from roots that still contain other pieces.
+func NewCurioRemover(client curio.PDPClient, proofSet uint64, removed datastore.Datastore) PieceRemover {
+	return &CurioRemover{client, proofSet, removed}
+}
+
+func removedKey(pieceCID string) datastore.Key {
+	return datastore.NewKey(pieceCID)
+}
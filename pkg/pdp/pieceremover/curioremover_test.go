@@ -0,0 +1,58 @@
+package pieceremover_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/storacha/piri/internal/mocks"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/pdp/curio"
+	"github.com/storacha/piri/pkg/pdp/pieceremover"
+)
+
+func TestRemovePiece(t *testing.T) {
+	ctx := context.Background()
+	proofSetID := uint64(7)
+
+	t.Run("removes root once all subroots are removed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		clientMock := mocks.NewMockPDPClient(ctrl)
+		remover := pieceremover.NewCurioRemover(clientMock, proofSetID, datastore.NewMapDatastore())
+
+		piece0 := testutil.CreatePiece(t, 1024)
+		piece1 := testutil.CreatePiece(t, 1024)
+		proofSet := curio.ProofSet{
+			ID: proofSetID,
+			Roots: []curio.RootEntry{
+				{RootID: 1, SubrootCID: piece0.V1Link().String()},
+				{RootID: 1, SubrootCID: piece1.V1Link().String()},
+			},
+		}
+
+		clientMock.EXPECT().GetProofSet(ctx, proofSetID).Return(proofSet, nil).Times(2)
+		err := remover.RemovePiece(ctx, piece0)
+		require.NoError(t, err)
+
+		clientMock.EXPECT().DeleteRootFromProofSet(ctx, proofSetID, uint64(1)).Return(nil)
+		err = remover.RemovePiece(ctx, piece1)
+		require.NoError(t, err)
+	})
+
+	t.Run("piece not in proof set", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		clientMock := mocks.NewMockPDPClient(ctrl)
+		remover := pieceremover.NewCurioRemover(clientMock, proofSetID, datastore.NewMapDatastore())
+
+		clientMock.EXPECT().GetProofSet(ctx, proofSetID).Return(curio.ProofSet{ID: proofSetID}, nil)
+		err := remover.RemovePiece(ctx, testutil.CreatePiece(t, 1024))
+		require.NoError(t, err)
+	})
+}
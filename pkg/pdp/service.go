@@ -6,21 +6,24 @@ import (
 	"fmt"
 
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	"github.com/storacha/go-ucanto/ucan"
 
 	"github.com/storacha/piri/pkg/pdp/aggregator"
 	"github.com/storacha/piri/pkg/pdp/curio"
 	"github.com/storacha/piri/pkg/pdp/pieceadder"
 	"github.com/storacha/piri/pkg/pdp/piecefinder"
+	"github.com/storacha/piri/pkg/pdp/pieceremover"
 	"github.com/storacha/piri/pkg/store/receiptstore"
 )
 
 type PDPService struct {
-	aggregator  aggregator.Aggregator
-	pieceFinder piecefinder.PieceFinder
-	pieceAdder  pieceadder.PieceAdder
-	startFuncs  []func(ctx context.Context) error
-	closeFuncs  []func(ctx context.Context) error
+	aggregator   aggregator.Aggregator
+	pieceFinder  piecefinder.PieceFinder
+	pieceAdder   pieceadder.PieceAdder
+	pieceRemover pieceremover.PieceRemover
+	startFuncs   []func(ctx context.Context) error
+	closeFuncs   []func(ctx context.Context) error
 }
 
 func (p *PDPService) Aggregator() aggregator.Aggregator {
@@ -35,6 +38,10 @@ func (p *PDPService) PieceFinder() piecefinder.PieceFinder {
 	return p.pieceFinder
 }
 
+func (p *PDPService) PieceRemover() pieceremover.PieceRemover {
+	return p.pieceRemover
+}
+
 func (p *PDPService) Startup(ctx context.Context) error {
 	var err error
 	for _, startFunc := range p.startFuncs {
@@ -53,6 +60,8 @@ func (p *PDPService) Shutdown(ctx context.Context) error {
 
 var _ PDP = (*PDPService)(nil)
 
+const removalsPrefix = "removals/"
+
 func NewRemotePDPService(
 	ds datastore.Datastore,
 	dbPath string,
@@ -69,6 +78,11 @@ func NewRemotePDPService(
 		aggregator:  aggregator,
 		pieceFinder: piecefinder.NewCurioFinder(client),
 		pieceAdder:  pieceadder.NewCurioAdder(client),
+		pieceRemover: pieceremover.NewCurioRemover(
+			client,
+			proofSet,
+			namespace.Wrap(ds, datastore.NewKey(removalsPrefix)),
+		),
 		startFuncs: []func(ctx context.Context) error{
 			func(ctx context.Context) error {
 				return aggregator.Startup(ctx)
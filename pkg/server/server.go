@@ -11,8 +11,12 @@ import (
 	"github.com/storacha/go-ucanto/server"
 	"github.com/storacha/piri/pkg/build"
 	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/capacity"
 	"github.com/storacha/piri/pkg/service/claims"
+	"github.com/storacha/piri/pkg/service/outbox"
 	"github.com/storacha/piri/pkg/service/publisher"
+	"github.com/storacha/piri/pkg/service/replicator"
+	"github.com/storacha/piri/pkg/service/scrubber"
 	"github.com/storacha/piri/pkg/service/storage"
 )
 
@@ -61,6 +65,32 @@ func NewServer(service storage.Service, options ...server.Option) (*http.ServeMu
 		httpBlobsSrv.Serve(mux)
 	}
 
+	httpCapacitySrv, err := capacity.NewServer(service.Blobs().Capacity())
+	if err != nil {
+		return nil, fmt.Errorf("creating capacity server: %w", err)
+	}
+	httpCapacitySrv.Serve(mux)
+
+	httpReplicatorSrv, err := replicator.NewServer(service.Replicator())
+	if err != nil {
+		return nil, fmt.Errorf("creating replicator server: %w", err)
+	}
+	httpReplicatorSrv.Serve(mux)
+
+	httpOutboxSrv, err := outbox.NewServer(service.Outbox())
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox server: %w", err)
+	}
+	httpOutboxSrv.Serve(mux)
+
+	if scrub := service.Scrubber(); scrub != nil {
+		httpScrubberSrv, err := scrubber.NewServer(scrub)
+		if err != nil {
+			return nil, fmt.Errorf("creating scrubber server: %w", err)
+		}
+		httpScrubberSrv.Serve(mux)
+	}
+
 	publisherStore := service.Claims().Publisher().Store()
 	encodableStore, ok := publisherStore.(store.EncodeableStore)
 	if !ok {
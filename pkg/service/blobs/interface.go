@@ -3,8 +3,10 @@ package blobs
 import (
 	"github.com/storacha/piri/pkg/access"
 	"github.com/storacha/piri/pkg/presigner"
+	"github.com/storacha/piri/pkg/service/capacity"
 	"github.com/storacha/piri/pkg/store/allocationstore"
 	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
 )
 
 type Blobs interface {
@@ -16,4 +18,9 @@ type Blobs interface {
 	Presigner() presigner.RequestPresigner
 	// Access provides an interface to allowing public access to download blobs.
 	Access() access.Access
+	// Usage is a ledger of the bytes allocated and received by each space.
+	Usage() usagestore.UsageStore
+	// Capacity tracks the space reserved for allocated blobs against the space
+	// available to store them.
+	Capacity() capacity.Manager
 }
@@ -11,8 +11,10 @@ import (
 	"github.com/storacha/piri/pkg/access"
 	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/presigner"
+	"github.com/storacha/piri/pkg/service/capacity"
 	"github.com/storacha/piri/pkg/store/allocationstore"
 	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
 )
 
 type options struct {
@@ -20,6 +22,8 @@ type options struct {
 	allocStore allocationstore.AllocationStore
 	blobStore  blobstore.Blobstore
 	presigner  presigner.RequestPresigner
+	usageStore usagestore.UsageStore
+	capacity   capacity.Manager
 }
 
 type Option func(*options) error
@@ -97,3 +101,28 @@ func WithDSAllocationStore(allocsDatastore datastore.Datastore) Option {
 		return nil
 	}
 }
+
+func WithUsageStore(usageStore usagestore.UsageStore) Option {
+	return func(o *options) error {
+		o.usageStore = usageStore
+		return nil
+	}
+}
+
+func WithDSUsageStore(usageDatastore datastore.Batching, opts ...usagestore.Option) Option {
+	return func(o *options) error {
+		usageStore, err := usagestore.NewDsUsageStore(usageDatastore, opts...)
+		if err != nil {
+			return err
+		}
+		o.usageStore = usageStore
+		return nil
+	}
+}
+
+func WithCapacity(capacity capacity.Manager) Option {
+	return func(o *options) error {
+		o.capacity = capacity
+		return nil
+	}
+}
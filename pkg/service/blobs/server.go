@@ -1,8 +1,10 @@
 package blobs
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,28 +14,55 @@ import (
 	"github.com/multiformats/go-multibase"
 	"github.com/multiformats/go-multihash"
 	"github.com/storacha/piri/internal/telemetry"
+	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/presigner"
+	"github.com/storacha/piri/pkg/store"
 	"github.com/storacha/piri/pkg/store/allocationstore"
 	"github.com/storacha/piri/pkg/store/blobstore"
 )
 
 var log = logging.Logger("blobs")
 
+const (
+	// UploadOffsetHeader is the header carrying the number of bytes of a
+	// resumable upload that have been received.
+	UploadOffsetHeader = "Upload-Offset"
+	// UploadLengthHeader is the header carrying the total size of the blob in
+	// a resumable upload.
+	UploadLengthHeader = "Upload-Length"
+)
+
 type Server struct {
 	blobs     blobstore.Blobstore
 	presigner presigner.RequestPresigner
 	allocs    allocationstore.AllocationStore
+	uploads   *Uploads
 }
 
+// NewServer creates a server for uploading and retrieving blobs. Partial data
+// of resumable uploads is staged in the tmp directory of the volume the
+// blobstore will place the blob on (or the default directory for temporary
+// files if the blobstore has none) and is encrypted if the blobstore encrypts
+// blobs. See [NewBlobstoreUploads].
 func NewServer(presigner presigner.RequestPresigner, allocs allocationstore.AllocationStore, blobs blobstore.Blobstore) (*Server, error) {
-	return &Server{blobs, presigner, allocs}, nil
+	uploads, err := NewBlobstoreUploads(blobs)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{blobs, presigner, allocs, uploads}, nil
 }
 
 func (srv *Server) Serve(mux *http.ServeMux) {
-	mux.Handle("GET /blob/{blob}", NewBlobGetHandler(srv.blobs))
+	get := NewBlobGetHandler(srv.blobs)
+	mux.Handle("GET /blob/{blob}", get)
+	mux.Handle("HEAD /blob/{blob}", NewBlobHeadHandler(srv.presigner, srv.uploads, get))
 	mux.Handle("PUT /blob/{blob}", NewBlobPutHandler(srv.presigner, srv.allocs, srv.blobs))
+	mux.Handle("PATCH /blob/{blob}", NewBlobPatchHandler(srv.presigner, srv.allocs, srv.blobs, srv.uploads))
 }
 
+// NewBlobGetHandler serves blobs. Blobstores that implement
+// [blobstore.FileSystemer] are served from their filesystem, and any other
+// blobstore with [NewBlobRetrievalHandler].
 func NewBlobGetHandler(blobs blobstore.Blobstore) http.Handler {
 	if fsblobs, ok := blobs.(blobstore.FileSystemer); ok {
 		serveHTTP := http.FileServer(fsblobs.FileSystem()).ServeHTTP
@@ -42,11 +71,55 @@ func NewBlobGetHandler(blobs blobstore.Blobstore) http.Handler {
 			serveHTTP(w, r)
 		})
 	}
+	return NewBlobRetrievalHandler(blobs)
+}
 
-	log.Error("blobstore does not support filesystem access")
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not supported", http.StatusInternalServerError)
-	})
+// NewBlobRetrievalHandler serves blobs from any blobstore using ranged reads.
+// It supports HEAD, single and multi-range requests, and conditional requests
+// against an ETag derived from the digest.
+func NewBlobRetrievalHandler(blobs blobstore.Blobstore) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		digest, err := parseDigest(r)
+		if err != nil {
+			return err
+		}
+
+		info, err := statBlob(r.Context(), blobs, digest)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return telemetry.NewHTTPError(errors.New("blob not found"), http.StatusNotFound)
+			}
+			return telemetry.NewHTTPError(fmt.Errorf("reading blob: %w", err), http.StatusInternalServerError)
+		}
+
+		// blobs are content addressed so the digest identifies the content
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, digestutil.Format(digest)))
+		w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+		// avoid a read to sniff the content type
+		w.Header().Set("Content-Type", "application/octet-stream")
+
+		body := blobstore.NewObjectReader(r.Context(), blobs, digest, info.Size)
+		defer body.Close()
+		http.ServeContent(w, r, "", info.ModTime, body)
+		return nil
+	}
+
+	return telemetry.NewErrorReportingHandler(handler)
+}
+
+// statBlob retrieves information about a blob without reading its body.
+func statBlob(ctx context.Context, blobs blobstore.Blobstore, digest multihash.Multihash) (blobstore.ObjectInfo, error) {
+	if l, ok := blobs.(blobstore.Lister); ok {
+		return l.Stat(ctx, digest)
+	}
+	obj, err := blobs.Get(ctx, digest)
+	if err != nil {
+		return blobstore.ObjectInfo{}, err
+	}
+	if c, ok := obj.Body().(io.Closer); ok {
+		c.Close()
+	}
+	return blobstore.ObjectInfo{Digest: digest, Size: obj.Size()}, nil
 }
 
 func NewBlobPutHandler(presigner presigner.RequestPresigner, allocs allocationstore.AllocationStore, blobs blobstore.Blobstore) http.Handler {
@@ -56,60 +129,190 @@ func NewBlobPutHandler(presigner presigner.RequestPresigner, allocs allocationst
 			return telemetry.NewHTTPError(err, http.StatusUnauthorized)
 		}
 
-		parts := strings.Split(r.URL.Path, "/")
-		_, bytes, err := multibase.Decode(parts[len(parts)-1])
+		digest, err := parseDigest(r)
 		if err != nil {
-			return telemetry.NewHTTPError(fmt.Errorf("decoding multibase encoded digest: %w", err), http.StatusBadRequest)
+			return err
 		}
 
-		digest, err := multihash.Cast(bytes)
+		err = requireAllocation(r.Context(), allocs, digest)
 		if err != nil {
-			return telemetry.NewHTTPError(fmt.Errorf("invalid multihash digest: %w", err), http.StatusBadRequest)
+			return err
 		}
 
-		results, err := allocs.List(r.Context(), digest)
+		// ensure the size comes from a signed header
+		contentLength, err := strconv.ParseInt(sHeaders.Get("Content-Length"), 10, 64)
 		if err != nil {
-			return telemetry.NewHTTPError(fmt.Errorf("list allocations failed: %w", err), http.StatusInternalServerError)
+			return telemetry.NewHTTPError(fmt.Errorf("parsing signed Content-Length header: %w", err), http.StatusInternalServerError)
 		}
 
-		if len(results) == 0 {
-			return telemetry.NewHTTPError(fmt.Errorf("missing allocation for write to: z%s", digest.B58String()), http.StatusForbidden)
+		err = blobs.Put(r.Context(), digest, uint64(contentLength), r.Body)
+		if err != nil {
+			log.Errorf("writing to: z%s: %w", digest.B58String(), err)
+			if errors.Is(err, blobstore.ErrDataInconsistent) {
+				return telemetry.NewHTTPError(errors.New("data consistency check failed"), http.StatusConflict)
+			}
+
+			return telemetry.NewHTTPError(fmt.Errorf("write failed: %w", err), http.StatusInternalServerError)
 		}
 
-		expired := true
-		for _, a := range results {
-			exp := a.Expires
-			if exp > uint64(time.Now().Unix()) {
-				expired = false
-				break
-			}
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	return telemetry.NewErrorReportingHandler(handler)
+}
+
+// NewBlobPatchHandler receives a chunk of a resumable upload. Requests are
+// made to the same presigned URL as a PUT, with the total size of the blob in
+// the Upload-Length header in place of the signed Content-Length, and the
+// number of bytes already received in the Upload-Offset header. The number of
+// bytes received after the chunk is returned in the Upload-Offset header. The
+// blob is verified and stored once the final chunk is received.
+func NewBlobPatchHandler(presigner presigner.RequestPresigner, allocs allocationstore.AllocationStore, blobs blobstore.Blobstore, uploads *Uploads) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Cache-Control", "no-store")
+
+		size, err := verifyUploadRequest(r, presigner)
+		if err != nil {
+			return err
 		}
 
-		if expired {
-			return telemetry.NewHTTPError(errors.New("expired allocation"), http.StatusForbidden)
+		digest, err := parseDigest(r)
+		if err != nil {
+			return err
 		}
 
-		log.Infof("Found %d allocations for write to: z%s", len(results), digest.B58String())
+		err = requireAllocation(r.Context(), allocs, digest)
+		if err != nil {
+			return err
+		}
 
-		// ensure the size comes from a signed header
-		contentLength, err := strconv.ParseInt(sHeaders.Get("Content-Length"), 10, 64)
+		offset, err := strconv.ParseUint(r.Header.Get(UploadOffsetHeader), 10, 64)
 		if err != nil {
-			return telemetry.NewHTTPError(fmt.Errorf("parsing signed Content-Length header: %w", err), http.StatusInternalServerError)
+			return telemetry.NewHTTPError(fmt.Errorf("parsing %s header: %w", UploadOffsetHeader, err), http.StatusBadRequest)
 		}
 
-		err = blobs.Put(r.Context(), digest, uint64(contentLength), r.Body)
+		received, err := uploads.Receive(r.Context(), blobs, digest, size, offset, r.Body)
 		if err != nil {
-			log.Errorf("writing to: z%s: %w", digest.B58String(), err)
-			if errors.Is(err, blobstore.ErrDataInconsistent) {
+			log.Errorf("receiving chunk for: z%s: %s", digest.B58String(), err)
+			if !errors.Is(err, ErrUploadInProgress) {
+				w.Header().Set(UploadOffsetHeader, strconv.FormatUint(received, 10))
+			}
+			switch {
+			case errors.Is(err, ErrUploadOffsetMismatch):
+				return telemetry.NewHTTPError(err, http.StatusConflict)
+			case errors.Is(err, ErrUploadInProgress):
+				return telemetry.NewHTTPError(err, http.StatusLocked)
+			case errors.Is(err, blobstore.ErrTooLarge):
+				return telemetry.NewHTTPError(errors.New("chunk exceeds upload length"), http.StatusRequestEntityTooLarge)
+			case errors.Is(err, blobstore.ErrDataInconsistent):
 				return telemetry.NewHTTPError(errors.New("data consistency check failed"), http.StatusConflict)
 			}
-
 			return telemetry.NewHTTPError(fmt.Errorf("write failed: %w", err), http.StatusInternalServerError)
 		}
 
-		w.WriteHeader(http.StatusOK)
+		w.Header().Set(UploadOffsetHeader, strconv.FormatUint(received, 10))
+		w.WriteHeader(http.StatusNoContent)
 		return nil
 	}
 
 	return telemetry.NewErrorReportingHandler(handler)
 }
+
+// NewBlobHeadHandler reports the progress of a resumable upload when the
+// request carries the Upload-Length header, returning the number of bytes
+// received so far in the Upload-Offset header. Other requests are passed to
+// the next handler.
+func NewBlobHeadHandler(presigner presigner.RequestPresigner, uploads *Uploads, next http.Handler) http.Handler {
+	handler := telemetry.NewErrorReportingHandler(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Cache-Control", "no-store")
+
+		size, err := verifyUploadRequest(r, presigner)
+		if err != nil {
+			return err
+		}
+
+		digest, err := parseDigest(r)
+		if err != nil {
+			return err
+		}
+
+		received, err := uploads.Offset(digest)
+		if err != nil {
+			return telemetry.NewHTTPError(err, http.StatusInternalServerError)
+		}
+
+		w.Header().Set(UploadOffsetHeader, strconv.FormatUint(received, 10))
+		w.Header().Set(UploadLengthHeader, strconv.FormatUint(size, 10))
+		w.WriteHeader(http.StatusOK)
+		return nil
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(UploadLengthHeader) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// verifyUploadRequest verifies a resumable upload request was made to a
+// presigned upload URL, and returns the signed size of the blob.
+func verifyUploadRequest(r *http.Request, presigner presigner.RequestPresigner) (uint64, error) {
+	// the upload URL is signed for the total size of the blob, not the chunk
+	headers := r.Header.Clone()
+	headers.Set("Content-Length", r.Header.Get(UploadLengthHeader))
+	_, sHeaders, err := presigner.VerifyUploadURL(r.Context(), *r.URL, headers)
+	if err != nil {
+		return 0, telemetry.NewHTTPError(err, http.StatusUnauthorized)
+	}
+
+	size, err := strconv.ParseUint(sHeaders.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return 0, telemetry.NewHTTPError(fmt.Errorf("parsing signed Content-Length header: %w", err), http.StatusInternalServerError)
+	}
+	return size, nil
+}
+
+func parseDigest(r *http.Request) (multihash.Multihash, error) {
+	parts := strings.Split(r.URL.Path, "/")
+	_, bytes, err := multibase.Decode(parts[len(parts)-1])
+	if err != nil {
+		return nil, telemetry.NewHTTPError(fmt.Errorf("decoding multibase encoded digest: %w", err), http.StatusBadRequest)
+	}
+
+	digest, err := multihash.Cast(bytes)
+	if err != nil {
+		return nil, telemetry.NewHTTPError(fmt.Errorf("invalid multihash digest: %w", err), http.StatusBadRequest)
+	}
+	return digest, nil
+}
+
+// requireAllocation ensures there is an unexpired allocation for the blob.
+func requireAllocation(ctx context.Context, allocs allocationstore.AllocationStore, digest multihash.Multihash) error {
+	results, err := allocs.List(ctx, digest)
+	if err != nil {
+		return telemetry.NewHTTPError(fmt.Errorf("list allocations failed: %w", err), http.StatusInternalServerError)
+	}
+
+	if len(results) == 0 {
+		return telemetry.NewHTTPError(fmt.Errorf("missing allocation for write to: z%s", digest.B58String()), http.StatusForbidden)
+	}
+
+	expired := true
+	for _, a := range results {
+		exp := a.Expires
+		if exp > uint64(time.Now().Unix()) {
+			expired = false
+			break
+		}
+	}
+
+	if expired {
+		return telemetry.NewHTTPError(errors.New("expired allocation"), http.StatusForbidden)
+	}
+
+	log.Infof("Found %d allocations for write to: z%s", len(results), digest.B58String())
+	return nil
+}
@@ -5,11 +5,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"testing"
 	"time"
 
@@ -110,6 +113,124 @@ func TestServer(t *testing.T) {
 			requireRetrievableBlob(t, *srvurl, digest, data)
 		})
 	})
+
+	t.Run("resumable upload", func(t *testing.T) {
+		t.Run("basic", func(t *testing.T) {
+			data := testutil.RandomBytes(t, 100)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+			require.NoError(t, allocs.Put(context.Background(), randomAllocation(t, digest, uint64(len(data)))))
+
+			url, _ := signUpload(t, presigner, digest, uint64(len(data)))
+			require.Equal(t, uint64(0), uploadOffset(t, url, uint64(len(data))))
+
+			for offset := 0; offset < len(data); offset += 30 {
+				end := min(offset+30, len(data))
+				res := patchBlob(t, url, uint64(len(data)), uint64(offset), data[offset:end])
+				require.Equal(t, http.StatusNoContent, res.StatusCode)
+				require.Equal(t, strconv.Itoa(end), res.Header.Get(UploadOffsetHeader))
+				if end < len(data) {
+					require.Equal(t, uint64(end), uploadOffset(t, url, uint64(len(data))))
+				}
+			}
+
+			requireRetrievableBlob(t, *srvurl, digest, data)
+			// the partial upload is removed once complete
+			require.Equal(t, uint64(0), uploadOffset(t, url, uint64(len(data))))
+		})
+
+		t.Run("offset mismatch", func(t *testing.T) {
+			data := testutil.RandomBytes(t, 100)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+			require.NoError(t, allocs.Put(context.Background(), randomAllocation(t, digest, uint64(len(data)))))
+
+			url, _ := signUpload(t, presigner, digest, uint64(len(data)))
+			res := patchBlob(t, url, uint64(len(data)), 0, data[:40])
+			require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+			res = patchBlob(t, url, uint64(len(data)), 20, data[20:60])
+			require.Equal(t, http.StatusConflict, res.StatusCode)
+			require.Equal(t, "40", res.Header.Get(UploadOffsetHeader))
+
+			res = patchBlob(t, url, uint64(len(data)), 40, data[40:])
+			require.Equal(t, http.StatusNoContent, res.StatusCode)
+			requireRetrievableBlob(t, *srvurl, digest, data)
+		})
+
+		t.Run("inconsistent data", func(t *testing.T) {
+			data := testutil.RandomBytes(t, 100)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+			require.NoError(t, allocs.Put(context.Background(), randomAllocation(t, digest, uint64(len(data)))))
+
+			url, _ := signUpload(t, presigner, digest, uint64(len(data)))
+			res := patchBlob(t, url, uint64(len(data)), 0, data[:50])
+			require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+			res = patchBlob(t, url, uint64(len(data)), 50, testutil.RandomBytes(t, 50))
+			require.Equal(t, http.StatusConflict, res.StatusCode)
+			// the upload must start again
+			require.Equal(t, uint64(0), uploadOffset(t, url, uint64(len(data))))
+		})
+
+		t.Run("chunk exceeds upload length", func(t *testing.T) {
+			data := testutil.RandomBytes(t, 100)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+			require.NoError(t, allocs.Put(context.Background(), randomAllocation(t, digest, uint64(len(data)))))
+
+			url, _ := signUpload(t, presigner, digest, uint64(len(data)))
+			res := patchBlob(t, url, uint64(len(data)), 0, append(data, 1))
+			require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+			require.Equal(t, uint64(0), uploadOffset(t, url, uint64(len(data))))
+		})
+
+		t.Run("upload length must match signature", func(t *testing.T) {
+			data := testutil.RandomBytes(t, 100)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+			require.NoError(t, allocs.Put(context.Background(), randomAllocation(t, digest, uint64(len(data)))))
+
+			url, _ := signUpload(t, presigner, digest, uint64(len(data)))
+			res := patchBlob(t, url, uint64(len(data)+1), 0, data)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		})
+
+		t.Run("missing allocation", func(t *testing.T) {
+			data := testutil.RandomBytes(t, 100)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+			url, _ := signUpload(t, presigner, digest, uint64(len(data)))
+			res := patchBlob(t, url, uint64(len(data)), 0, data)
+			require.Equal(t, http.StatusForbidden, res.StatusCode)
+		})
+	})
+}
+
+func signUpload(t *testing.T, presigner presigner.RequestPresigner, digest multihash.Multihash, size uint64) (url.URL, http.Header) {
+	url, hd, err := presigner.SignUploadURL(context.Background(), digest, size, 900)
+	require.NoError(t, err)
+	return url, hd
+}
+
+func patchBlob(t *testing.T, url url.URL, size uint64, offset uint64, chunk []byte) *http.Response {
+	req, err := http.NewRequest(http.MethodPatch, url.String(), bytes.NewReader(chunk))
+	require.NoError(t, err)
+	req.Header.Set(UploadLengthHeader, strconv.FormatUint(size, 10))
+	req.Header.Set(UploadOffsetHeader, strconv.FormatUint(offset, 10))
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func uploadOffset(t *testing.T, url url.URL, size uint64) uint64 {
+	req, err := http.NewRequest(http.MethodHead, url.String(), nil)
+	require.NoError(t, err)
+	req.Header.Set(UploadLengthHeader, strconv.FormatUint(size, 10))
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	return testutil.Must(strconv.ParseUint(res.Header.Get(UploadOffsetHeader), 10, 64))(t)
 }
 
 func randomAllocation(t *testing.T, digest multihash.Multihash, size uint64) allocation.Allocation {
@@ -152,3 +273,96 @@ func requireRetrievableBlob(t *testing.T, endpoint url.URL, digest multihash.Mul
 	require.NoError(t, err)
 	require.Equal(t, data, body)
 }
+
+func TestBlobRetrievalHandler(t *testing.T) {
+	// hide the filesystem so that blobs are served with ranged reads
+	blobs := struct{ blobstore.Blobstore }{blobstore.NewMapBlobstore()}
+	mux := http.NewServeMux()
+	mux.Handle("GET /blob/{blob}", NewBlobGetHandler(blobs))
+	httpsrv := httptest.NewServer(mux)
+	t.Cleanup(httpsrv.Close)
+
+	data := testutil.RandomBytes(t, 100)
+	digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+	require.NoError(t, blobs.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+	bloburl := fmt.Sprintf("%s/blob/%s", httpsrv.URL, digestutil.Format(digest))
+	etag := fmt.Sprintf(`"%s"`, digestutil.Format(digest))
+
+	get := func(t *testing.T, method string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(method, bloburl, nil)
+		require.NoError(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	t.Run("full", func(t *testing.T) {
+		res := get(t, http.MethodGet, nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, etag, res.Header.Get("ETag"))
+		require.Equal(t, data, testutil.Must(io.ReadAll(res.Body))(t))
+	})
+
+	t.Run("head", func(t *testing.T) {
+		res := get(t, http.MethodHead, nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, int64(len(data)), res.ContentLength)
+		require.Empty(t, testutil.Must(io.ReadAll(res.Body))(t))
+	})
+
+	t.Run("single range", func(t *testing.T) {
+		res := get(t, http.MethodGet, map[string]string{"Range": "bytes=10-19"})
+		require.Equal(t, http.StatusPartialContent, res.StatusCode)
+		require.Equal(t, "bytes 10-19/100", res.Header.Get("Content-Range"))
+		require.Equal(t, data[10:20], testutil.Must(io.ReadAll(res.Body))(t))
+	})
+
+	t.Run("multi range", func(t *testing.T) {
+		res := get(t, http.MethodGet, map[string]string{"Range": "bytes=0-4,90-"})
+		require.Equal(t, http.StatusPartialContent, res.StatusCode)
+
+		_, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		mr := multipart.NewReader(res.Body, params["boundary"])
+		var parts [][]byte
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			parts = append(parts, testutil.Must(io.ReadAll(p))(t))
+		}
+		require.Equal(t, [][]byte{data[0:5], data[90:]}, parts)
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		res := get(t, http.MethodGet, map[string]string{"If-None-Match": etag})
+		require.Equal(t, http.StatusNotModified, res.StatusCode)
+
+		res = get(t, http.MethodGet, map[string]string{"If-None-Match": `"other"`})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("if range", func(t *testing.T) {
+		res := get(t, http.MethodGet, map[string]string{"Range": "bytes=0-4", "If-Range": etag})
+		require.Equal(t, http.StatusPartialContent, res.StatusCode)
+
+		res = get(t, http.MethodGet, map[string]string{"Range": "bytes=0-4", "If-Range": `"other"`})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, data, testutil.Must(io.ReadAll(res.Body))(t))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/blob/%s", httpsrv.URL, digestutil.Format(testutil.RandomMultihash(t))), nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+}
@@ -3,8 +3,10 @@ package blobs
 import (
 	"github.com/storacha/piri/pkg/access"
 	"github.com/storacha/piri/pkg/presigner"
+	"github.com/storacha/piri/pkg/service/capacity"
 	"github.com/storacha/piri/pkg/store/allocationstore"
 	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
 )
 
 type BlobService struct {
@@ -27,6 +29,14 @@ func (b *BlobService) Store() blobstore.Blobstore {
 	return b.blobStore
 }
 
+func (b *BlobService) Usage() usagestore.UsageStore {
+	return b.usageStore
+}
+
+func (b *BlobService) Capacity() capacity.Manager {
+	return b.capacity
+}
+
 var _ Blobs = (*BlobService)(nil)
 
 func New(opts ...Option) (*BlobService, error) {
@@ -0,0 +1,298 @@
+package blobs
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/multiformats/go-multihash"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store/blobstore"
+)
+
+// DefaultUploadTTL is how long a partial upload is kept after the last chunk
+// of it was received.
+const DefaultUploadTTL = 24 * time.Hour
+
+// ErrUploadOffsetMismatch is returned when a chunk does not start at the
+// number of bytes received so far.
+var ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+
+// ErrUploadInProgress is returned when a chunk is received for an upload that
+// is already receiving a chunk.
+var ErrUploadInProgress = errors.New("upload in progress")
+
+// Uploads holds the data received so far for resumable uploads, in a file per
+// blob within a directory. When all of the data has been received it is
+// written to a blobstore, which verifies it against the digest.
+type Uploads struct {
+	dirs   []string
+	place  func(size uint64) (string, error)
+	cipher blobstore.StagingEncrypter
+	ttl    time.Duration
+	mu     sync.Mutex
+	active map[string]struct{}
+}
+
+// NewUploads creates storage for partial uploads in the passed directory.
+func NewUploads(dir string) (*Uploads, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("upload directory not writable: %w", err)
+	}
+	place := func(uint64) (string, error) { return dir, nil }
+	return &Uploads{dirs: []string{dir}, place: place, ttl: DefaultUploadTTL, active: map[string]struct{}{}}, nil
+}
+
+// NewBlobstoreUploads creates storage for partial uploads that is staged in
+// the tmp directories of the passed blobstore (see [blobstore.Stager]), so
+// that each upload is kept on the volume its blob will be placed on. If the
+// blobstore encrypts blobs (see [blobstore.StagingEncrypterOf]) partial
+// uploads are encrypted too.
+func NewBlobstoreUploads(blobs blobstore.Blobstore) (*Uploads, error) {
+	var dirs []string
+	for _, dir := range blobstore.StagingDirs(blobs) {
+		dir = filepath.Join(dir, "uploads")
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("upload directory not writable: %w", err)
+		}
+		dirs = append(dirs, dir)
+	}
+	place := func(size uint64) (string, error) {
+		dir, err := blobstore.StagingDir(blobs, size)
+		if err != nil {
+			return "", fmt.Errorf("placing upload: %w", err)
+		}
+		return filepath.Join(dir, "uploads"), nil
+	}
+	enc, _ := blobstore.StagingEncrypterOf(blobs)
+	return &Uploads{dirs: dirs, place: place, cipher: enc, ttl: DefaultUploadTTL, active: map[string]struct{}{}}, nil
+}
+
+// Offset returns the number of bytes received so far for the blob.
+func (u *Uploads) Offset(digest multihash.Multihash) (uint64, error) {
+	name, err := u.locate(digest)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	inf, err := os.Stat(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("stat upload: %w", err)
+	}
+	return uint64(max(0, inf.Size()-u.headerSize())), nil
+}
+
+// Receive appends a chunk of the blob, which must start at the passed offset,
+// and returns the number of bytes received so far. Bytes received before an
+// error reading the body are kept, so the upload can be resumed from them.
+//
+// Once size bytes have been received the blob is written to the blobstore and
+// the partial upload is removed. If the data is inconsistent with the digest
+// the partial upload is also removed, since it can never complete.
+func (u *Uploads) Receive(ctx context.Context, blobs blobstore.Blobstore, digest multihash.Multihash, size uint64, offset uint64, body io.Reader) (uint64, error) {
+	k := digestutil.Format(digest)
+	u.mu.Lock()
+	if _, ok := u.active[k]; ok {
+		u.mu.Unlock()
+		return 0, ErrUploadInProgress
+	}
+	u.active[k] = struct{}{}
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		delete(u.active, k)
+		u.mu.Unlock()
+	}()
+
+	if offset == 0 {
+		u.prune()
+	}
+
+	name, err := u.locate(digest)
+	if errors.Is(err, fs.ErrNotExist) {
+		var dir string
+		dir, err = u.place(size)
+		name = filepath.Join(dir, k)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	received, err := u.append(name, digest, size, offset, body)
+	if err != nil {
+		return received, err
+	}
+	if received < size {
+		return received, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return received, fmt.Errorf("opening upload: %w", err)
+	}
+	defer f.Close()
+
+	var data io.Reader = f
+	if u.cipher != nil {
+		iv := make([]byte, blobstore.StagingIVSize)
+		_, err := io.ReadFull(f, iv)
+		if err != nil {
+			return received, fmt.Errorf("reading upload IV: %w", err)
+		}
+		stream, err := u.cipher.StagingCipher(digest, iv, 0)
+		if err != nil {
+			return received, fmt.Errorf("creating upload cipher: %w", err)
+		}
+		data = cipher.StreamReader{S: stream, R: f}
+	}
+
+	err = blobs.Put(ctx, digest, size, data)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrDataInconsistent) {
+			u.remove(name)
+			return 0, err
+		}
+		return received, err
+	}
+	u.remove(name)
+	return received, nil
+}
+
+func (u *Uploads) append(name string, digest multihash.Multihash, size uint64, offset uint64, body io.Reader) (uint64, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("opening upload: %w", err)
+	}
+	defer f.Close()
+
+	inf, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat upload: %w", err)
+	}
+	header := u.headerSize()
+	var iv []byte
+	if u.cipher != nil {
+		iv = make([]byte, header)
+		if inf.Size() < header {
+			// a new upload, or one interrupted before its IV was written
+			_, err = rand.Read(iv)
+			if err != nil {
+				return 0, fmt.Errorf("generating upload IV: %w", err)
+			}
+			if err := f.Truncate(0); err != nil {
+				return 0, fmt.Errorf("truncating upload: %w", err)
+			}
+			if _, err := f.WriteAt(iv, 0); err != nil {
+				return 0, fmt.Errorf("writing upload IV: %w", err)
+			}
+		} else if _, err := f.ReadAt(iv, 0); err != nil {
+			return 0, fmt.Errorf("reading upload IV: %w", err)
+		}
+	}
+	received := uint64(max(0, inf.Size()-header))
+	if offset != received {
+		return received, ErrUploadOffsetMismatch
+	}
+
+	var w io.Writer = f
+	if u.cipher != nil {
+		stream, err := u.cipher.StagingCipher(digest, iv, received)
+		if err != nil {
+			return received, fmt.Errorf("creating upload cipher: %w", err)
+		}
+		w = cipher.StreamWriter{S: stream, W: f}
+	}
+
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return received, fmt.Errorf("seeking upload: %w", err)
+	}
+	// read one more byte than remains to detect oversized uploads
+	n, err := io.Copy(w, io.LimitReader(body, int64(size-received)+1))
+	if received+uint64(n) > size {
+		if terr := f.Truncate(header + int64(received)); terr != nil {
+			return received, fmt.Errorf("truncating upload: %w", terr)
+		}
+		return received, blobstore.ErrTooLarge
+	}
+	received += uint64(n)
+	if err != nil {
+		return received, fmt.Errorf("receiving chunk: %w", err)
+	}
+	return received, nil
+}
+
+// prune removes partial uploads that have not received a chunk within the TTL.
+func (u *Uploads) prune() {
+	for _, dir := range u.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Warnw("reading upload directory", "dir", dir, "error", err)
+			continue
+		}
+		for _, e := range entries {
+			inf, err := e.Info()
+			if err != nil || time.Since(inf.ModTime()) < u.ttl {
+				continue
+			}
+			u.mu.Lock()
+			_, active := u.active[e.Name()]
+			u.mu.Unlock()
+			if active {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Warnw("removing stale upload", "upload", e.Name(), "error", err)
+			}
+		}
+	}
+}
+
+func (u *Uploads) remove(name string) {
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warnw("removing upload", "upload", name, "error", err)
+	}
+}
+
+// locate returns the path of the partial upload of the blob, in whichever
+// directory it was staged in, or an error wrapping [fs.ErrNotExist] if there
+// is none.
+func (u *Uploads) locate(digest multihash.Multihash) (string, error) {
+	k := digestutil.Format(digest)
+	for _, dir := range u.dirs {
+		name := filepath.Join(dir, k)
+		_, err := os.Stat(name)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("stat upload: %w", err)
+		}
+	}
+	return "", fmt.Errorf("upload %s: %w", k, fs.ErrNotExist)
+}
+
+// headerSize is the number of bytes preceding the data in a partial upload,
+// which hold the IV when uploads are encrypted.
+func (u *Uploads) headerSize() int64 {
+	if u.cipher != nil {
+		return blobstore.StagingIVSize
+	}
+	return 0
+}
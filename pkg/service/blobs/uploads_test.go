@@ -0,0 +1,139 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/blobstore"
+)
+
+func TestUploads(t *testing.T) {
+	t.Run("keeps data received before an interruption", func(t *testing.T) {
+		uploads := testutil.Must(NewUploads(t.TempDir()))(t)
+		blobs := blobstore.NewMapBlobstore()
+
+		data := testutil.RandomBytes(t, 100)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+		body := io.MultiReader(bytes.NewReader(data[:35]), &erroringReader{errors.New("connection reset")})
+		received, err := uploads.Receive(context.Background(), blobs, digest, uint64(len(data)), 0, body)
+		require.Error(t, err)
+		require.Equal(t, uint64(35), received)
+		require.Equal(t, uint64(35), testutil.Must(uploads.Offset(digest))(t))
+
+		_, err = blobs.Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+
+		received, err = uploads.Receive(context.Background(), blobs, digest, uint64(len(data)), 35, bytes.NewReader(data[35:]))
+		require.NoError(t, err)
+		require.Equal(t, uint64(len(data)), received)
+
+		obj, err := blobs.Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+	})
+
+	t.Run("retries storing a complete upload", func(t *testing.T) {
+		uploads := testutil.Must(NewUploads(t.TempDir()))(t)
+
+		data := testutil.RandomBytes(t, 100)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+		_, err := uploads.Receive(context.Background(), failingPutBlobstore{blobstore.NewMapBlobstore()}, digest, uint64(len(data)), 0, bytes.NewReader(data))
+		require.Error(t, err)
+		require.Equal(t, uint64(len(data)), testutil.Must(uploads.Offset(digest))(t))
+
+		// an empty chunk at the end of the upload completes it
+		blobs := blobstore.NewMapBlobstore()
+		_, err = uploads.Receive(context.Background(), blobs, digest, uint64(len(data)), uint64(len(data)), bytes.NewReader(nil))
+		require.NoError(t, err)
+
+		obj, err := blobs.Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+	})
+
+	t.Run("encrypts partial uploads for an encrypted blobstore", func(t *testing.T) {
+		dir := t.TempDir()
+		inner := testutil.Must(blobstore.NewFsBlobstore(filepath.Join(dir, "blobs"), filepath.Join(dir, "tmp")))(t)
+		blobs := testutil.Must(blobstore.NewEncryptedBlobstore(inner, testutil.RandomBytes(t, blobstore.EncryptionKeySize)))(t)
+		uploads := testutil.Must(NewBlobstoreUploads(blobs))(t)
+
+		data := testutil.RandomBytes(t, 100)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+		received, err := uploads.Receive(context.Background(), blobs, digest, uint64(len(data)), 0, bytes.NewReader(data[:35]))
+		require.NoError(t, err)
+		require.Equal(t, uint64(35), received)
+		require.Equal(t, uint64(35), testutil.Must(uploads.Offset(digest))(t))
+
+		staged := testutil.Must(os.ReadFile(filepath.Join(dir, "tmp", "uploads", digestutil.Format(digest))))(t)
+		require.Len(t, staged, blobstore.StagingIVSize+35)
+		require.NotContains(t, string(staged), string(data[:35]))
+
+		_, err = uploads.Receive(context.Background(), blobs, digest, uint64(len(data)), 35, bytes.NewReader(data[35:]))
+		require.NoError(t, err)
+
+		obj, err := blobs.Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+	})
+
+	t.Run("stages uploads where the blobstore places them", func(t *testing.T) {
+		blobs := stagingBlobstore{blobstore.NewMapBlobstore(), []string{t.TempDir(), t.TempDir()}}
+		uploads := testutil.Must(NewBlobstoreUploads(blobs))(t)
+
+		data := testutil.RandomBytes(t, 100)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+		_, err := uploads.Receive(context.Background(), blobs, digest, uint64(len(data)), 0, bytes.NewReader(data[:35]))
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(blobs.dirs[1], "uploads", digestutil.Format(digest)))
+
+		received, err := uploads.Receive(context.Background(), blobs, digest, uint64(len(data)), 35, bytes.NewReader(data[35:]))
+		require.NoError(t, err)
+		require.Equal(t, uint64(len(data)), received)
+		require.NoFileExists(t, filepath.Join(blobs.dirs[1], "uploads", digestutil.Format(digest)))
+	})
+}
+
+// stagingBlobstore stages blobs in the last of its directories.
+type stagingBlobstore struct {
+	blobstore.Blobstore
+	dirs []string
+}
+
+func (s stagingBlobstore) StagingDirs() []string {
+	return s.dirs
+}
+
+func (s stagingBlobstore) StagingDir(uint64) (string, error) {
+	return s.dirs[len(s.dirs)-1], nil
+}
+
+type erroringReader struct {
+	err error
+}
+
+func (r *erroringReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+type failingPutBlobstore struct {
+	blobstore.Blobstore
+}
+
+func (f failingPutBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...blobstore.PutOption) error {
+	return errors.New("unavailable")
+}
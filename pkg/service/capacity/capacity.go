@@ -0,0 +1,364 @@
+package capacity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/allocationstore"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+)
+
+var log = logging.Logger("capacity")
+
+// DefaultInterval is the default time between measurements of the space used
+// and available.
+const DefaultInterval = time.Minute
+
+// Capacity is a snapshot of the storage available to the node.
+type Capacity struct {
+	// Bounded indicates the node has a limit or a source of finite space. When
+	// false, Free and Available are meaningless.
+	Bounded bool `json:"bounded"`
+	// Limit is the configured maximum number of bytes the node stores, or zero
+	// if it is limited by free space only.
+	Limit uint64 `json:"limit"`
+	// Stored is the number of bytes occupied by blobs.
+	Stored uint64 `json:"stored"`
+	// Reserved is the number of bytes set aside for blobs that were allocated
+	// but have not been received.
+	Reserved uint64 `json:"reserved"`
+	// Free is the number of bytes that can be written to the storage.
+	Free uint64 `json:"free"`
+	// Available is the number of bytes that can be allocated, taking the limit
+	// and reservations into account.
+	Available uint64 `json:"available"`
+}
+
+type Manager interface {
+	// Reserve sets aside size bytes for a blob that is due to be uploaded, until
+	// the passed expiry time (in seconds since unix epoch). It returns an
+	// [InsufficientCapacityError] if the node does not have the bytes available.
+	// Reserving a blob that is already reserved extends the reservation. It
+	// reports whether a new reservation was made, which the caller should
+	// cancel if the blob will not be uploaded after all.
+	Reserve(ctx context.Context, digest multihash.Multihash, size uint64, expires uint64) (bool, error)
+	// Commit records that a reserved blob was received, so that its bytes are
+	// counted as stored rather than reserved.
+	Commit(ctx context.Context, digest multihash.Multihash)
+	// Cancel releases the reservation for a blob that will not be uploaded.
+	Cancel(ctx context.Context, digest multihash.Multihash)
+	// Capacity returns the current capacity of the node.
+	Capacity(ctx context.Context) (Capacity, error)
+}
+
+type reservation struct {
+	size    uint64
+	expires uint64
+}
+
+// Service tracks the bytes reserved for blobs that are due to be uploaded,
+// and periodically measures the space used and available in the storage the
+// blobs are written to.
+type Service struct {
+	allocs   allocationstore.AllocationStore
+	blobs    blobstore.Blobstore
+	sources  []blobstore.SpaceReporter
+	limit    uint64
+	interval time.Duration
+
+	mu           sync.Mutex
+	reservations map[string]reservation
+	measured     bool
+	bounded      bool
+	used         uint64
+	free         uint64
+	// committed is the number of bytes received since the last measurement.
+	committed uint64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ Manager = (*Service)(nil)
+
+// New creates a capacity manager. Reservations are restored from unexpired
+// allocations when the manager is started, and blobs found in the blobstore
+// are assumed to have been received. The blobstore may be nil, in which case
+// every unexpired allocation is assumed to be awaiting upload.
+func New(allocs allocationstore.AllocationStore, blobs blobstore.Blobstore, opts ...Option) (*Service, error) {
+	o := &options{interval: DefaultInterval}
+	for _, opt := range opts {
+		err := opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Service{
+		allocs:       allocs,
+		blobs:        blobs,
+		sources:      o.sources,
+		limit:        o.limit,
+		interval:     o.interval,
+		reservations: map[string]reservation{},
+	}, nil
+}
+
+func (s *Service) Reserve(ctx context.Context, digest multihash.Multihash, size uint64, expires uint64) (bool, error) {
+	if err := s.ensureMeasured(ctx); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := digestutil.Format(digest)
+	if r, ok := s.reservations[k]; ok {
+		r.expires = max(r.expires, expires)
+		s.reservations[k] = r
+		return false, nil
+	}
+
+	c := s.capacity()
+	if c.Bounded && size > c.Available {
+		return false, InsufficientCapacityError{Requested: size, Available: c.Available}
+	}
+	s.reservations[k] = reservation{size: size, expires: expires}
+	return true, nil
+}
+
+func (s *Service) Commit(ctx context.Context, digest multihash.Multihash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := digestutil.Format(digest)
+	r, ok := s.reservations[k]
+	if !ok {
+		return
+	}
+	delete(s.reservations, k)
+	s.committed += r.size
+}
+
+func (s *Service) Cancel(ctx context.Context, digest multihash.Multihash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reservations, digestutil.Format(digest))
+}
+
+func (s *Service) Capacity(ctx context.Context) (Capacity, error) {
+	if err := s.ensureMeasured(ctx); err != nil {
+		return Capacity{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.capacity(), nil
+}
+
+// capacity calculates the capacity from the last measurement, adjusted for
+// bytes received since. It must be called with the lock held.
+func (s *Service) capacity() Capacity {
+	now := uint64(time.Now().Unix())
+	var reserved uint64
+	for k, r := range s.reservations {
+		if r.expires < now {
+			delete(s.reservations, k)
+			continue
+		}
+		reserved += r.size
+	}
+
+	c := Capacity{
+		Bounded:   s.bounded || s.limit > 0,
+		Limit:     s.limit,
+		Stored:    s.used + s.committed,
+		Reserved:  reserved,
+		Available: math.MaxUint64,
+	}
+	if s.bounded {
+		c.Free = sub(s.free, s.committed)
+		c.Available = sub(c.Free, reserved)
+	}
+	if s.limit > 0 {
+		c.Available = min(c.Available, sub(s.limit, c.Stored+reserved))
+	}
+	if !c.Bounded {
+		c.Available = 0
+	}
+	return c
+}
+
+// ensureMeasured measures the space used and available if it has not been
+// measured yet.
+func (s *Service) ensureMeasured(ctx context.Context) error {
+	s.mu.Lock()
+	measured := s.measured
+	s.mu.Unlock()
+	if measured {
+		return nil
+	}
+	return s.measure(ctx)
+}
+
+// measure sums the space used and available across every source. Sources
+// that wrap storage of unknown size are treated as unbounded. Measuring may
+// walk the whole of the storage, so it is done without holding the lock, and
+// the results are swapped in once complete.
+func (s *Service) measure(ctx context.Context) error {
+	// bytes committed while measuring may not be counted by the measurement,
+	// so only those committed before it started are cleared
+	s.mu.Lock()
+	committed := s.committed
+	s.mu.Unlock()
+
+	var used, free uint64
+	bounded := false
+	for _, src := range s.sources {
+		sp, err := src.Space(ctx)
+		if err != nil {
+			if errors.Is(err, errors.ErrUnsupported) {
+				continue
+			}
+			return fmt.Errorf("measuring space: %w", err)
+		}
+		used += sp.Used
+		free += sp.Available
+		bounded = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used, s.free, s.bounded = used, free, bounded
+	s.committed -= min(s.committed, committed)
+	s.measured = true
+	return nil
+}
+
+// restore reserves space for unexpired allocations of blobs that have not
+// been received. Allocations retained for received blobs are skipped.
+func (s *Service) restore(ctx context.Context) error {
+	now := uint64(time.Now().Unix())
+	allocs, err := s.allocs.ListUnexpired(ctx, now)
+	if err != nil {
+		return fmt.Errorf("listing allocations: %w", err)
+	}
+
+	pending := map[string]reservation{}
+	received := map[string]bool{}
+	for _, a := range allocs {
+		if a.Expires == allocation.Retained {
+			continue
+		}
+		k := digestutil.Format(a.Blob.Digest)
+		if r, ok := pending[k]; ok {
+			r.expires = max(r.expires, a.Expires)
+			pending[k] = r
+			continue
+		}
+		if received[k] {
+			continue
+		}
+		if s.blobs != nil {
+			ok, err := s.received(ctx, a.Blob.Digest)
+			if err != nil {
+				return fmt.Errorf("getting blob %s: %w", k, err)
+			}
+			if ok {
+				received[k] = true
+				continue
+			}
+		}
+		pending[k] = reservation{size: a.Blob.Size, expires: a.Expires}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, p := range pending {
+		if r, ok := s.reservations[k]; ok {
+			p.expires = max(p.expires, r.expires)
+		}
+		s.reservations[k] = p
+	}
+	return nil
+}
+
+// received reports whether the blob is in the blobstore.
+func (s *Service) received(ctx context.Context, digest multihash.Multihash) (bool, error) {
+	var err error
+	if l, ok := s.blobs.(blobstore.Lister); ok {
+		_, err = l.Stat(ctx, digest)
+	} else {
+		var obj blobstore.Object
+		obj, err = s.blobs.Get(ctx, digest)
+		if err == nil {
+			if c, ok := obj.Body().(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Start restores reservations for allocations that are awaiting upload, and
+// begins periodic measurement of the space used and available.
+func (s *Service) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	if err := s.restore(ctx); err != nil {
+		return fmt.Errorf("restoring reservations: %w", err)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			err := s.measure(ctx)
+			if err != nil {
+				log.Errorf("measuring capacity failed: %s", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends periodic measurement, waiting for any in progress measurement to
+// complete.
+func (s *Service) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+// sub subtracts b from a, clamping at zero.
+func sub(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
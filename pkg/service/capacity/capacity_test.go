@@ -0,0 +1,192 @@
+package capacity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store/allocationstore"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+)
+
+type fixedSpace blobstore.Space
+
+func (f fixedSpace) Space(context.Context) (blobstore.Space, error) {
+	return blobstore.Space(f), nil
+}
+
+// blockingSpace signals started when a measurement begins, and blocks it
+// until signalled on release.
+type blockingSpace struct {
+	fixedSpace
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b blockingSpace) Space(ctx context.Context) (blobstore.Space, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return b.fixedSpace.Space(ctx)
+}
+
+type unsupportedSpace struct{}
+
+func (unsupportedSpace) Space(context.Context) (blobstore.Space, error) {
+	return blobstore.Space{}, errors.ErrUnsupported
+}
+
+func TestCapacity(t *testing.T) {
+	expires := uint64(time.Now().Add(time.Hour).Unix())
+
+	t.Run("reserves space until full", func(t *testing.T) {
+		m := newManager(t, nil, WithSources(fixedSpace{Used: 10, Available: 100}))
+
+		_, err := m.Reserve(context.Background(), testutil.RandomMultihash(t), 60, expires)
+		require.NoError(t, err)
+
+		_, err = m.Reserve(context.Background(), testutil.RandomMultihash(t), 60, expires)
+		var cerr InsufficientCapacityError
+		require.ErrorAs(t, err, &cerr)
+		require.Equal(t, "InsufficientCapacity", cerr.Name())
+		require.Equal(t, uint64(60), cerr.Requested)
+		require.Equal(t, uint64(40), cerr.Available)
+
+		c, err := m.Capacity(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Capacity{Bounded: true, Stored: 10, Reserved: 60, Free: 100, Available: 40}, c)
+	})
+
+	t.Run("reserving the same blob twice is idempotent", func(t *testing.T) {
+		m := newManager(t, nil, WithSources(fixedSpace{Available: 100}))
+		digest := testutil.RandomMultihash(t)
+
+		reserved, err := m.Reserve(context.Background(), digest, 60, expires)
+		require.NoError(t, err)
+		require.True(t, reserved)
+		reserved, err = m.Reserve(context.Background(), digest, 60, expires)
+		require.NoError(t, err)
+		require.False(t, reserved)
+
+		c, err := m.Capacity(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, uint64(60), c.Reserved)
+	})
+
+	t.Run("limit caps stored and reserved bytes", func(t *testing.T) {
+		m := newManager(t, nil, WithLimit(50), WithSources(fixedSpace{Used: 20, Available: 100}))
+
+		_, err := m.Reserve(context.Background(), testutil.RandomMultihash(t), 40, expires)
+		require.ErrorAs(t, err, new(InsufficientCapacityError))
+
+		c, err := m.Capacity(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, uint64(30), c.Available)
+	})
+
+	t.Run("committed blobs count as stored", func(t *testing.T) {
+		m := newManager(t, nil, WithSources(fixedSpace{Available: 100}))
+		digest := testutil.RandomMultihash(t)
+
+		_, err := m.Reserve(context.Background(), digest, 60, expires)
+		require.NoError(t, err)
+		m.Commit(context.Background(), digest)
+
+		c, err := m.Capacity(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Capacity{Bounded: true, Stored: 60, Free: 40, Available: 40}, c)
+	})
+
+	t.Run("cancelled and expired reservations are released", func(t *testing.T) {
+		m := newManager(t, nil, WithSources(fixedSpace{Available: 100}))
+		digest := testutil.RandomMultihash(t)
+
+		_, err := m.Reserve(context.Background(), digest, 60, expires)
+		require.NoError(t, err)
+		m.Cancel(context.Background(), digest)
+		_, err = m.Reserve(context.Background(), testutil.RandomMultihash(t), 60, uint64(time.Now().Add(-time.Minute).Unix()))
+		require.NoError(t, err)
+
+		c, err := m.Capacity(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), c.Reserved)
+		require.Equal(t, uint64(100), c.Available)
+	})
+
+	t.Run("unbounded without limit or sources", func(t *testing.T) {
+		m := newManager(t, nil, WithSources(unsupportedSpace{}))
+
+		_, err := m.Reserve(context.Background(), testutil.RandomMultihash(t), 1<<40, expires)
+		require.NoError(t, err)
+
+		c, err := m.Capacity(context.Background())
+		require.NoError(t, err)
+		require.False(t, c.Bounded)
+	})
+
+	t.Run("restores reservations for blobs awaiting upload", func(t *testing.T) {
+		allocs := testutil.Must(allocationstore.NewDsAllocationStore(datastore.NewMapDatastore()))(t)
+		blobs := blobstore.NewMapBlobstore()
+
+		received := testutil.RandomBytes(t, 16)
+		receivedDigest := putAllocation(t, allocs, received, expires)
+		require.NoError(t, blobs.Put(context.Background(), receivedDigest, uint64(len(received)), bytes.NewReader(received)))
+		putAllocation(t, allocs, testutil.RandomBytes(t, 32), expires)
+		putAllocation(t, allocs, testutil.RandomBytes(t, 64), uint64(time.Now().Add(-time.Minute).Unix()))
+
+		m, err := New(allocs, blobs, WithSources(fixedSpace{Available: 100}))
+		require.NoError(t, err)
+		require.NoError(t, m.Start(context.Background()))
+		t.Cleanup(func() { m.Stop(context.Background()) })
+
+		c, err := m.Capacity(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, uint64(32), c.Reserved)
+	})
+
+	t.Run("reserves while measuring", func(t *testing.T) {
+		src := blockingSpace{fixedSpace{Available: 100}, make(chan struct{}, 1), make(chan struct{}, 1)}
+		m := newManager(t, nil, WithSources(src))
+
+		src.release <- struct{}{}
+		require.NoError(t, m.measure(context.Background()))
+		<-src.started
+
+		done := make(chan error, 1)
+		go func() { done <- m.measure(context.Background()) }()
+		<-src.started
+		_, err := m.Reserve(context.Background(), testutil.RandomMultihash(t), 60, expires)
+		require.NoError(t, err)
+
+		src.release <- struct{}{}
+		require.NoError(t, <-done)
+		c, err := m.Capacity(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, uint64(60), c.Reserved)
+	})
+}
+
+func newManager(t *testing.T, blobs blobstore.Blobstore, opts ...Option) *Service {
+	allocs := testutil.Must(allocationstore.NewDsAllocationStore(datastore.NewMapDatastore()))(t)
+	return testutil.Must(New(allocs, blobs, opts...))(t)
+}
+
+func putAllocation(t *testing.T, allocs allocationstore.AllocationStore, data []byte, expires uint64) multihash.Multihash {
+	digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+	err := allocs.Put(context.Background(), allocation.Allocation{
+		Space:   testutil.RandomDID(t),
+		Blob:    allocation.Blob(types.Blob{Digest: digest, Size: uint64(len(data))}),
+		Expires: expires,
+		Cause:   testutil.RandomCID(t),
+	})
+	require.NoError(t, err)
+	return digest
+}
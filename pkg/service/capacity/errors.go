@@ -0,0 +1,21 @@
+package capacity
+
+import "fmt"
+
+// InsufficientCapacityError is returned when a reservation would commit more
+// bytes than the node has available. The upload service should allocate the
+// blob on another node.
+type InsufficientCapacityError struct {
+	// Requested is the number of bytes that were requested.
+	Requested uint64
+	// Available is the number of bytes that could have been reserved.
+	Available uint64
+}
+
+func (ie InsufficientCapacityError) Name() string {
+	return "InsufficientCapacity"
+}
+
+func (ie InsufficientCapacityError) Error() string {
+	return fmt.Sprintf("insufficient capacity to allocate %d bytes, %d bytes available", ie.Requested, ie.Available)
+}
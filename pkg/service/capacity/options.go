@@ -0,0 +1,55 @@
+package capacity
+
+import (
+	"errors"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+
+	"github.com/storacha/piri/pkg/store/blobstore"
+)
+
+type options struct {
+	interval time.Duration
+	limit    uint64
+	sources  []blobstore.SpaceReporter
+}
+
+type Option func(*options) error
+
+// WithInterval configures how often the space used and available is measured.
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) error {
+		if interval <= 0 {
+			return errors.New("measurement interval must be greater than zero")
+		}
+		o.interval = interval
+		return nil
+	}
+}
+
+// WithLimit caps the number of bytes the node stores, regardless of how much
+// space is free. A limit of zero means the node is limited by free space only.
+func WithLimit(limit uint64) Option {
+	return func(o *options) error {
+		o.limit = limit
+		return nil
+	}
+}
+
+// WithSources adds storage that blobs are written to. The space used and
+// available is summed across every source.
+func WithSources(sources ...blobstore.SpaceReporter) Option {
+	return func(o *options) error {
+		o.sources = append(o.sources, sources...)
+		return nil
+	}
+}
+
+// WithLogLevel changes the log level for the capacity subsystem.
+func WithLogLevel(level string) Option {
+	return func(o *options) error {
+		logging.SetLogLevel("capacity", level)
+		return nil
+	}
+}
@@ -0,0 +1,41 @@
+package capacity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/storacha/piri/internal/telemetry"
+)
+
+type Server struct {
+	manager Manager
+}
+
+func NewServer(manager Manager) (*Server, error) {
+	return &Server{manager}, nil
+}
+
+func (srv *Server) Serve(mux *http.ServeMux) {
+	mux.Handle("GET /capacity", NewHandler(srv.manager))
+}
+
+// NewHandler reports the current capacity of the node as JSON.
+func NewHandler(manager Manager) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		c, err := manager.Capacity(r.Context())
+		if err != nil {
+			return telemetry.NewHTTPError(fmt.Errorf("failed to get capacity: %w", err), http.StatusInternalServerError)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(c)
+		if err != nil {
+			return fmt.Errorf("serving capacity: %w", err)
+		}
+
+		return nil
+	}
+
+	return telemetry.NewErrorReportingHandler(handler)
+}
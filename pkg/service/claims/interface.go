@@ -1,6 +1,8 @@
 package claims
 
 import (
+	"time"
+
 	"github.com/storacha/piri/pkg/service/publisher"
 	"github.com/storacha/piri/pkg/store/claimstore"
 )
@@ -11,4 +13,7 @@ type Claims interface {
 	// Publisher advertises content claims/commitments found on this node to the
 	// storacha network.
 	Publisher() publisher.Publisher
+	// LocationClaimExpiration is how long location claims issued by this node
+	// are valid for. Zero means they do not expire.
+	LocationClaimExpiration() time.Duration
 }
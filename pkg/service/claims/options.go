@@ -1,7 +1,9 @@
 package claims
 
 import (
+	"database/sql"
 	"net/url"
+	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/multiformats/go-multiaddr"
@@ -9,6 +11,8 @@ import (
 	"github.com/storacha/go-ucanto/core/delegation"
 	"github.com/storacha/go-ucanto/transport/http"
 	"github.com/storacha/go-ucanto/ucan"
+
+	"github.com/storacha/piri/pkg/service/publisher"
 )
 
 type options struct {
@@ -17,6 +21,11 @@ type options struct {
 	blobAddr              multiaddr.Multiaddr
 	indexingService       client.Connection
 	indexingServiceProofs delegation.Proofs
+	blobs                 publisher.BlobGetter
+	batchDB               *sql.DB
+	batchWindow           time.Duration
+	batchSize             int
+	locationExpiration    time.Duration
 }
 
 type Option func(*options) error
@@ -79,6 +88,52 @@ func WithPublisherIndexingServiceProof(proof ...delegation.Proof) Option {
 	}
 }
 
+// WithPublisherBlobGetter sets the source that the publisher reads index
+// blobs from when publishing index claims.
+func WithPublisherBlobGetter(blobs publisher.BlobGetter) Option {
+	return func(o *options) error {
+		o.blobs = blobs
+		return nil
+	}
+}
+
+// WithPublisherBatchDatabase enables batching of location commitment
+// advertisements, persisting pending location commitments in the passed
+// database.
+func WithPublisherBatchDatabase(db *sql.DB) Option {
+	return func(o *options) error {
+		o.batchDB = db
+		return nil
+	}
+}
+
+// WithPublisherBatchWindow sets the maximum time a location commitment is held
+// before it is advertised.
+func WithPublisherBatchWindow(window time.Duration) Option {
+	return func(o *options) error {
+		o.batchWindow = window
+		return nil
+	}
+}
+
+// WithPublisherBatchSize sets the number of pending location commitments that
+// causes a batch to be advertised before the window has passed.
+func WithPublisherBatchSize(size int) Option {
+	return func(o *options) error {
+		o.batchSize = size
+		return nil
+	}
+}
+
+// WithLocationClaimExpiration sets how long location claims issued by this
+// node are valid for. By default they do not expire.
+func WithLocationClaimExpiration(d time.Duration) Option {
+	return func(o *options) error {
+		o.locationExpiration = d
+		return nil
+	}
+}
+
 // WithLogLevel changes the log level for the claims subsystem.
 func WithLogLevel(level string) Option {
 	return func(c *options) error {
@@ -1,6 +1,9 @@
 package claims
 
 import (
+	"context"
+	"time"
+
 	"github.com/multiformats/go-multiaddr"
 	"github.com/storacha/go-libstoracha/ipnipublisher/store"
 	"github.com/storacha/go-ucanto/principal"
@@ -9,8 +12,9 @@ import (
 )
 
 type ClaimService struct {
-	store     claimstore.ClaimStore
-	publisher publisher.Publisher
+	store              claimstore.ClaimStore
+	publisher          *publisher.PublisherService
+	locationExpiration time.Duration
 }
 
 func (c *ClaimService) Publisher() publisher.Publisher {
@@ -21,6 +25,21 @@ func (c *ClaimService) Store() claimstore.ClaimStore {
 	return c.store
 }
 
+func (c *ClaimService) LocationClaimExpiration() time.Duration {
+	return c.locationExpiration
+}
+
+// Start begins advertising batched location commitments, if batching is
+// enabled.
+func (c *ClaimService) Start(ctx context.Context) error {
+	return c.publisher.Start(ctx)
+}
+
+// Stop ends advertising batched location commitments.
+func (c *ClaimService) Stop(ctx context.Context) error {
+	return c.publisher.Stop(ctx)
+}
+
 var _ Claims = (*ClaimService)(nil)
 
 func New(id principal.Signer, claimStore claimstore.ClaimStore, publisherStore store.PublisherStore, publicAddr multiaddr.Multiaddr, opts ...Option) (*ClaimService, error) {
@@ -41,10 +60,14 @@ func New(id principal.Signer, claimStore claimstore.ClaimStore, publisherStore s
 		publisher.WithIndexingServiceProof(o.indexingServiceProofs...),
 		publisher.WithAnnounceAddress(o.announceAddr),
 		publisher.WithBlobAddress(o.blobAddr),
+		publisher.WithBlobGetter(o.blobs),
+		publisher.WithBatchDatabase(o.batchDB),
+		publisher.WithBatchWindow(o.batchWindow),
+		publisher.WithBatchSize(o.batchSize),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &ClaimService{claimStore, publisher}, nil
+	return &ClaimService{claimStore, publisher, o.locationExpiration}, nil
 }
@@ -0,0 +1,275 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/ucan"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/publisher"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/claimstore"
+)
+
+var log = logging.Logger("collector")
+
+// DefaultInterval is the default time between garbage collection passes.
+const DefaultInterval = time.Hour
+
+type Collector interface {
+	// Collect performs a single garbage collection pass, removing expired
+	// allocations that were never accepted, and the blobs and location and
+	// equals claims that are no longer referenced by any allocation. Blob stores that
+	// implement [blobstore.Compacter] are compacted at the end of every pass,
+	// so that space freed by blobs removed elsewhere is reclaimed too.
+	Collect(context.Context) error
+}
+
+// Service periodically collects blobs that were allocated but never accepted.
+type Service struct {
+	blobs     blobs.Blobs
+	claims    claimstore.ClaimStore
+	lister    claimstore.ContentLister
+	publisher publisher.Publisher
+	locks     *digestutil.Locks
+	interval  time.Duration
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+var _ Collector = (*Service)(nil)
+
+// New creates a garbage collector for the blobs, allocations and location
+// claims held by this node. The claim store must implement
+// [claimstore.ContentLister] so that location claims can be found for blobs.
+func New(b blobs.Blobs, claimStore claimstore.ClaimStore, opts ...Option) (*Service, error) {
+	o := &options{interval: DefaultInterval}
+	for _, opt := range opts {
+		err := opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lister, ok := claimStore.(claimstore.ContentLister)
+	if !ok {
+		return nil, errors.New("claim store does not support listing claims by content")
+	}
+	if o.locks == nil {
+		o.locks = &digestutil.Locks{}
+	}
+
+	return &Service{
+		blobs:     b,
+		claims:    claimStore,
+		lister:    lister,
+		publisher: o.publisher,
+		locks:     o.locks,
+		interval:  o.interval,
+	}, nil
+}
+
+func (s *Service) Collect(ctx context.Context) error {
+	now := uint64(time.Now().Unix())
+	expired, err := s.blobs.Allocations().ListExpired(ctx, now)
+	if err != nil {
+		return fmt.Errorf("listing expired allocations: %w", err)
+	}
+
+	var errs error
+	seen := map[string]struct{}{}
+	for _, a := range expired {
+		k := digestutil.Format(a.Blob.Digest)
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+
+		err := s.collectBlob(ctx, a.Blob.Digest, now)
+		if err != nil {
+			log.Errorw("collecting blob", "blob", k, "error", err)
+			errs = errors.Join(errs, fmt.Errorf("collecting blob %s: %w", k, err))
+		}
+	}
+
+	// reclaim the space left behind by deleted blobs in stores that need it,
+	// including blobs deleted since the last pass by blob/remove
+	if c, ok := s.blobs.Store().(blobstore.Compacter); ok {
+		err := c.Compact(ctx)
+		if err != nil {
+			log.Errorw("compacting blob store", "error", err)
+			errs = errors.Join(errs, fmt.Errorf("compacting blob store: %w", err))
+		}
+	}
+	return errs
+}
+
+func (s *Service) collectBlob(ctx context.Context, digest multihash.Multihash, now uint64) error {
+	log := log.With("blob", digestutil.Format(digest))
+
+	unlock := s.locks.Lock(digest)
+	defer unlock()
+
+	claimLinks, err := s.lister.ListByContent(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("listing claims: %w", err)
+	}
+
+	// spaces with a location claim for the blob have accepted it
+	accepted := map[did.DID][]ucan.Link{}
+	var equals []ucan.Link
+	for _, l := range claimLinks {
+		claim, err := s.claims.Get(ctx, l)
+		if err != nil {
+			// the claim was removed since it was listed
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			return fmt.Errorf("getting claim %s: %w", l, err)
+		}
+		if claim.Capabilities()[0].Can() == assert.EqualsAbility {
+			equals = append(equals, l)
+			continue
+		}
+		nb, err := assert.LocationCaveatsReader.Read(claim.Capabilities()[0].Nb())
+		if err != nil {
+			return fmt.Errorf("reading location claim %s: %w", l, err)
+		}
+		accepted[nb.Space] = append(accepted[nb.Space], l)
+	}
+
+	allocs, err := s.blobs.Allocations().List(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("listing allocations: %w", err)
+	}
+
+	remaining := 0
+	kept := map[did.DID]struct{}{}
+	deleted := map[did.DID]struct{}{}
+	for _, a := range allocs {
+		if _, ok := accepted[a.Space]; ok {
+			remaining++
+			kept[a.Space] = struct{}{}
+			// mark the allocation retained so it is not collected again
+			if a.Expires != allocation.Retained {
+				a.Expires = allocation.Retained
+				err := s.blobs.Allocations().Put(ctx, a)
+				if err != nil {
+					return fmt.Errorf("retaining allocation %s: %w", a.Cause, err)
+				}
+			}
+			continue
+		}
+		if a.Expires >= now {
+			remaining++
+			kept[a.Space] = struct{}{}
+			continue
+		}
+		err := s.blobs.Allocations().Delete(ctx, digest, a.Cause)
+		if err != nil {
+			return fmt.Errorf("deleting allocation %s: %w", a.Cause, err)
+		}
+		deleted[a.Space] = struct{}{}
+		log.Infow("deleted expired allocation", "space", a.Space, "cause", a.Cause)
+	}
+
+	// release the bytes allocated by spaces left without an allocation
+	for space := range deleted {
+		if _, ok := kept[space]; ok {
+			continue
+		}
+		err := s.blobs.Usage().Release(ctx, space, digest)
+		if err != nil {
+			return fmt.Errorf("releasing usage for space %s: %w", space, err)
+		}
+	}
+	if remaining > 0 {
+		return nil
+	}
+
+	// nothing refers to the blob anymore, so it can be removed
+	if s.blobs.Store() != nil {
+		err = s.blobs.Store().Delete(ctx, digest)
+		if err != nil {
+			return fmt.Errorf("deleting blob: %w", err)
+		}
+		log.Info("deleted blob")
+	}
+	// retract before deleting, so claims are kept while they are still advertised
+	for space, links := range accepted {
+		if s.publisher != nil {
+			err := s.publisher.Retract(ctx, space, digest)
+			if err != nil {
+				return fmt.Errorf("retracting location commitment for space %s: %w", space, err)
+			}
+		}
+		for _, l := range links {
+			err := s.claims.Delete(ctx, l)
+			if err != nil {
+				return fmt.Errorf("deleting location claim %s: %w", l, err)
+			}
+			log.Infow("deleted location claim", "claim", l)
+		}
+	}
+	if len(equals) > 0 {
+		if s.publisher != nil {
+			err := s.publisher.RetractEquals(ctx, digest)
+			if err != nil {
+				return fmt.Errorf("retracting equals claims: %w", err)
+			}
+		}
+		for _, l := range equals {
+			err := s.claims.Delete(ctx, l)
+			if err != nil {
+				return fmt.Errorf("deleting equals claim %s: %w", l, err)
+			}
+			log.Infow("deleted equals claim", "claim", l)
+		}
+	}
+	return nil
+}
+
+// Start begins periodic garbage collection.
+func (s *Service) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := s.Collect(ctx)
+				if err != nil {
+					log.Errorf("garbage collection failed: %s", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends periodic garbage collection, waiting for any in progress pass to
+// complete.
+func (s *Service) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,295 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/publisher"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/allocationstore"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/claimstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
+	"github.com/storacha/piri/pkg/store/usagestore/usage"
+)
+
+func TestCollector(t *testing.T) {
+	t.Run("collects expired allocation that was never accepted", func(t *testing.T) {
+		c, blobService, _ := newCollector(t)
+		data, digest := putRandomBlob(t, blobService)
+		alloc := putAllocation(t, blobService, testutil.RandomDID(t), digest, uint64(len(data)), -time.Minute)
+
+		err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		allocs, err := blobService.Allocations().List(context.Background(), alloc.Blob.Digest)
+		require.NoError(t, err)
+		require.Empty(t, allocs)
+
+		_, err = blobService.Store().Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+	})
+
+	t.Run("retains unexpired allocation", func(t *testing.T) {
+		c, blobService, _ := newCollector(t)
+		data, digest := putRandomBlob(t, blobService)
+		putAllocation(t, blobService, testutil.RandomDID(t), digest, uint64(len(data)), -time.Minute)
+		putAllocation(t, blobService, testutil.RandomDID(t), digest, uint64(len(data)), time.Hour)
+
+		err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		allocs, err := blobService.Allocations().List(context.Background(), digest)
+		require.NoError(t, err)
+		require.Len(t, allocs, 1)
+
+		_, err = blobService.Store().Get(context.Background(), digest)
+		require.NoError(t, err)
+	})
+
+	t.Run("releases usage of collected allocations", func(t *testing.T) {
+		c, blobService, _ := newCollector(t)
+		data, digest := putRandomBlob(t, blobService)
+		expired := testutil.RandomDID(t)
+		unexpired := testutil.RandomDID(t)
+		putAllocation(t, blobService, expired, digest, uint64(len(data)), -time.Minute)
+		putAllocation(t, blobService, unexpired, digest, uint64(len(data)), -time.Minute)
+		putAllocation(t, blobService, unexpired, digest, uint64(len(data)), time.Hour)
+
+		err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		u, err := blobService.Usage().Get(context.Background(), expired)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{}, u)
+
+		// the space still holds an unexpired allocation for the blob
+		u, err = blobService.Usage().Get(context.Background(), unexpired)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{Allocated: uint64(len(data))}, u)
+	})
+
+	t.Run("retains accepted blob", func(t *testing.T) {
+		c, blobService, claimStore := newCollector(t)
+		data, digest := putRandomBlob(t, blobService)
+		space := testutil.RandomDID(t)
+		putAllocation(t, blobService, space, digest, uint64(len(data)), -time.Minute)
+		claim := putLocationClaim(t, claimStore, space, digest)
+
+		err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		allocs, err := blobService.Allocations().List(context.Background(), digest)
+		require.NoError(t, err)
+		require.Len(t, allocs, 1)
+
+		_, err = blobService.Store().Get(context.Background(), digest)
+		require.NoError(t, err)
+
+		_, err = claimStore.Get(context.Background(), claim.Link())
+		require.NoError(t, err)
+
+		// the allocation is no longer listed as expired
+		require.Equal(t, allocation.Retained, allocs[0].Expires)
+		expired, err := blobService.Allocations().ListExpired(context.Background(), uint64(time.Now().Unix()))
+		require.NoError(t, err)
+		require.Empty(t, expired)
+	})
+
+	t.Run("removes location claims for collected blob", func(t *testing.T) {
+		c, blobService, claimStore := newCollector(t)
+		pub := &retractRecorder{}
+		c.publisher = pub
+		data, digest := putRandomBlob(t, blobService)
+		putAllocation(t, blobService, testutil.RandomDID(t), digest, uint64(len(data)), -time.Minute)
+		// claim for a space that holds no allocation for the blob
+		space := testutil.RandomDID(t)
+		claim := putLocationClaim(t, claimStore, space, digest)
+
+		err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		_, err = blobService.Store().Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+
+		_, err = claimStore.Get(context.Background(), claim.Link())
+		require.ErrorIs(t, err, store.ErrNotFound)
+
+		require.Equal(t, []retraction{{space, digest}}, pub.retracted)
+	})
+
+	t.Run("removes equals claims for collected blob", func(t *testing.T) {
+		c, blobService, claimStore := newCollector(t)
+		pub := &retractRecorder{}
+		c.publisher = pub
+		data, digest := putRandomBlob(t, blobService)
+		putAllocation(t, blobService, testutil.RandomDID(t), digest, uint64(len(data)), -time.Minute)
+		claim := putEqualsClaim(t, claimStore, testutil.RandomDID(t), digest)
+
+		err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		_, err = claimStore.Get(context.Background(), claim.Link())
+		require.ErrorIs(t, err, store.ErrNotFound)
+		require.Equal(t, []multihash.Multihash{digest}, pub.equals)
+	})
+
+	t.Run("waits for the blob to be released", func(t *testing.T) {
+		c, blobService, _ := newCollector(t)
+		data, digest := putRandomBlob(t, blobService)
+		putAllocation(t, blobService, testutil.RandomDID(t), digest, uint64(len(data)), -time.Minute)
+		unlock := c.locks.Lock(digest)
+
+		done := make(chan error, 1)
+		go func() { done <- c.Collect(context.Background()) }()
+		select {
+		case <-done:
+			t.Fatal("collected while the blob was locked")
+		case <-time.After(50 * time.Millisecond):
+		}
+		_, err := blobService.Store().Get(context.Background(), digest)
+		require.NoError(t, err)
+
+		unlock()
+		require.NoError(t, <-done)
+		_, err = blobService.Store().Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+	})
+
+	t.Run("compacts the blobstore when nothing has expired", func(t *testing.T) {
+		bs := &compactingBlobstore{MapBlobstore: blobstore.NewMapBlobstore()}
+		allocs := testutil.Must(allocationstore.NewDsAllocationStore(datastore.NewMapDatastore()))(t)
+		blobService := testutil.Must(blobs.New(
+			blobs.WithBlobstore(bs),
+			blobs.WithAllocationStore(allocs),
+			blobs.WithUsageStore(testutil.Must(usagestore.NewDsUsageStore(datastore.NewMapDatastore()))(t)),
+		))(t)
+		claimStore := testutil.Must(claimstore.NewDsClaimStore(datastore.NewMapDatastore()))(t)
+		c := testutil.Must(New(blobService, claimStore))(t)
+
+		require.NoError(t, c.Collect(context.Background()))
+		require.Equal(t, 1, bs.compactions)
+	})
+}
+
+// compactingBlobstore counts the times it is compacted.
+type compactingBlobstore struct {
+	*blobstore.MapBlobstore
+	compactions int
+}
+
+func (c *compactingBlobstore) Compact(context.Context) error {
+	c.compactions++
+	return nil
+}
+
+type retraction struct {
+	space  did.DID
+	digest multihash.Multihash
+}
+
+// retractRecorder is a publisher that records the content it retracts.
+type retractRecorder struct {
+	publisher.Publisher
+	retracted []retraction
+	equals    []multihash.Multihash
+}
+
+func (r *retractRecorder) Retract(_ context.Context, space did.DID, digest multihash.Multihash) error {
+	r.retracted = append(r.retracted, retraction{space, digest})
+	return nil
+}
+
+func (r *retractRecorder) RetractEquals(_ context.Context, digest multihash.Multihash) error {
+	r.equals = append(r.equals, digest)
+	return nil
+}
+
+func newCollector(t *testing.T) (*Service, blobs.Blobs, claimstore.ClaimStore) {
+	allocs, err := allocationstore.NewDsAllocationStore(datastore.NewMapDatastore())
+	require.NoError(t, err)
+	blobService, err := blobs.New(
+		blobs.WithBlobstore(blobstore.NewMapBlobstore()),
+		blobs.WithAllocationStore(allocs),
+		blobs.WithUsageStore(testutil.Must(usagestore.NewDsUsageStore(datastore.NewMapDatastore()))(t)),
+	)
+	require.NoError(t, err)
+	claimStore, err := claimstore.NewDsClaimStore(datastore.NewMapDatastore())
+	require.NoError(t, err)
+	c, err := New(blobService, claimStore)
+	require.NoError(t, err)
+	return c, blobService, claimStore
+}
+
+func putRandomBlob(t *testing.T, blobService blobs.Blobs) ([]byte, multihash.Multihash) {
+	data := testutil.RandomBytes(t, 32)
+	digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+	err := blobService.Store().Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+	require.NoError(t, err)
+	return data, digest
+}
+
+func putAllocation(t *testing.T, blobService blobs.Blobs, space did.DID, digest multihash.Multihash, size uint64, expiresIn time.Duration) allocation.Allocation {
+	alloc := allocation.Allocation{
+		Space:   space,
+		Blob:    allocation.Blob{Digest: digest, Size: size},
+		Expires: uint64(time.Now().Add(expiresIn).Unix()),
+		Cause:   testutil.RandomCID(t),
+	}
+	err := blobService.Allocations().Put(context.Background(), alloc)
+	require.NoError(t, err)
+	err = blobService.Usage().Allocate(context.Background(), space, digest, size)
+	require.NoError(t, err)
+	return alloc
+}
+
+func putLocationClaim(t *testing.T, claimStore claimstore.ClaimStore, space did.DID, digest multihash.Multihash) delegation.Delegation {
+	signer := testutil.RandomSigner(t)
+	claim, err := assert.Location.Delegate(
+		signer,
+		space,
+		signer.DID().String(),
+		assert.LocationCaveats{
+			Space:    space,
+			Content:  types.FromHash(digest),
+			Location: []url.URL{testutil.RandomLocalURL(t)},
+		},
+		delegation.WithNoExpiration(),
+	)
+	require.NoError(t, err)
+	err = claimStore.Put(context.Background(), claim)
+	require.NoError(t, err)
+	return claim
+}
+
+func putEqualsClaim(t *testing.T, claimStore claimstore.ClaimStore, space did.DID, digest multihash.Multihash) delegation.Delegation {
+	signer := testutil.RandomSigner(t)
+	claim, err := assert.Equals.Delegate(
+		signer,
+		space,
+		signer.DID().String(),
+		assert.EqualsCaveats{
+			Content: types.FromHash(digest),
+			Equals:  testutil.RandomCID(t),
+		},
+		delegation.WithNoExpiration(),
+	)
+	require.NoError(t, err)
+	err = claimStore.Put(context.Background(), claim)
+	require.NoError(t, err)
+	return claim
+}
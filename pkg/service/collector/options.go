@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"errors"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/service/publisher"
+)
+
+type options struct {
+	interval  time.Duration
+	publisher publisher.Publisher
+	locks     *digestutil.Locks
+}
+
+type Option func(*options) error
+
+// WithInterval configures how often a garbage collection pass is performed.
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) error {
+		if interval <= 0 {
+			return errors.New("collection interval must be greater than zero")
+		}
+		o.interval = interval
+		return nil
+	}
+}
+
+// WithPublisher configures the publisher used to retract the advertisements
+// of location claims that are collected.
+func WithPublisher(p publisher.Publisher) Option {
+	return func(o *options) error {
+		o.publisher = p
+		return nil
+	}
+}
+
+// WithBlobLocks configures the locks that are held on a blob while it is
+// collected, so that services sharing them do not act on it at the same time.
+func WithBlobLocks(locks *digestutil.Locks) Option {
+	return func(o *options) error {
+		o.locks = locks
+		return nil
+	}
+}
+
+// WithLogLevel changes the log level for the collector subsystem.
+func WithLogLevel(level string) Option {
+	return func(o *options) error {
+		logging.SetLogLevel("collector", level)
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the number of times delivery of a receipt is
+	// attempted before it is marked as failed.
+	DefaultMaxAttempts = 20
+	// DefaultMinBackoff is the delay before a failed delivery is first retried.
+	DefaultMinBackoff = 5 * time.Second
+	// DefaultMaxBackoff is the longest delay between delivery attempts.
+	DefaultMaxBackoff = time.Hour
+	// DefaultMaxWorkers is the number of receipts delivered concurrently.
+	DefaultMaxWorkers = 4
+)
+
+type options struct {
+	maxAttempts uint
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxWorkers  uint
+}
+
+type Option func(*options) error
+
+// WithMaxAttempts sets the number of times delivery of a receipt is attempted
+// before it is marked as failed.
+func WithMaxAttempts(n uint) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return errors.New("max attempts must be greater than zero")
+		}
+		o.maxAttempts = n
+		return nil
+	}
+}
+
+// WithBackoff sets the delay before a failed delivery is first retried, which
+// doubles on each subsequent failure up to max.
+func WithBackoff(min, max time.Duration) Option {
+	return func(o *options) error {
+		if min <= 0 {
+			return errors.New("minimum backoff must be greater than zero")
+		}
+		if max < min {
+			return errors.New("maximum backoff cannot be less than the minimum")
+		}
+		o.minBackoff = min
+		o.maxBackoff = max
+		return nil
+	}
+}
+
+// WithMaxWorkers sets the number of receipts delivered concurrently.
+func WithMaxWorkers(n uint) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return errors.New("max workers must be greater than zero")
+		}
+		o.maxWorkers = n
+		return nil
+	}
+}
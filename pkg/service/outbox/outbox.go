@@ -0,0 +1,365 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	// for go:embed
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/client"
+	"github.com/storacha/go-ucanto/core/invocation"
+	"github.com/storacha/go-ucanto/core/ipld"
+	"github.com/storacha/go-ucanto/core/message"
+	"github.com/storacha/go-ucanto/core/receipt"
+
+	"github.com/storacha/piri/pkg/pdp/aggregator/jobqueue"
+	"github.com/storacha/piri/pkg/pdp/aggregator/jobqueue/serializer"
+	"github.com/storacha/piri/pkg/store/receiptstore"
+)
+
+var log = logging.Logger("outbox")
+
+//go:embed schema.sql
+var schemaSQL string
+
+// DeliverTask is the name of the job that delivers a receipt.
+const DeliverTask = "receipt_deliver"
+
+const rfc3339Milli = "2006-01-02T15:04:05.000Z07:00"
+
+// States of a receipt delivery.
+const (
+	// DeliveryPending is the state of a receipt waiting to be delivered,
+	// including one waiting for a failed delivery to be retried.
+	DeliveryPending = "pending"
+	// DeliveryDelivered is the state of a receipt the remote service accepted.
+	DeliveryDelivered = "delivered"
+	// DeliveryFailed is the state of a receipt that could not be delivered in
+	// the maximum number of attempts. Sending it again retries delivery.
+	DeliveryFailed = "failed"
+)
+
+// ErrDeliveryNotFound is returned when a receipt was never sent through the
+// outbox.
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// Outbox delivers receipts to a remote service, retrying with backoff until
+// they are accepted.
+type Outbox interface {
+	// Send stores the receipt and queues it for delivery. Sending a receipt that
+	// is pending or delivered does nothing, sending one that failed to be
+	// delivered queues it again.
+	Send(ctx context.Context, rcpt receipt.AnyReceipt) error
+	// Delivery reports the delivery of the receipt with the given root CID, or
+	// [ErrDeliveryNotFound] if it was never sent.
+	Delivery(ctx context.Context, rcpt ipld.Link) (Delivery, error)
+	// Undelivered lists the receipts that are pending or failed to be
+	// delivered, oldest first.
+	Undelivered(ctx context.Context) ([]Delivery, error)
+}
+
+// Delivery is the record of sending a receipt through the outbox.
+type Delivery struct {
+	// Receipt is the CID of the receipt.
+	Receipt string `json:"receipt"`
+	// Ran is the CID of the invocation the receipt is for.
+	Ran string `json:"ran"`
+	// State is one of [DeliveryPending], [DeliveryDelivered] or
+	// [DeliveryFailed].
+	State string `json:"state"`
+	// Attempts is the number of times delivery has been attempted.
+	Attempts int `json:"attempts"`
+	// LastError is the error from the most recent failed attempt, if any.
+	LastError string    `json:"lastError,omitempty"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
+type Service struct {
+	name     string
+	conn     client.Connection
+	receipts receiptstore.ReceiptStore
+	db       *sql.DB
+	queue    *jobqueue.JobQueue[datamodel.Link]
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+var _ Outbox = (*Service)(nil)
+
+// New creates an outbox that delivers receipts over the given connection. The
+// receipts waiting to be delivered and the record of their delivery are held
+// in the given SQLite database, so that delivery resumes after a restart. The
+// name distinguishes outboxes for different remote services that share a
+// database.
+func New(
+	name string,
+	conn client.Connection,
+	receipts receiptstore.ReceiptStore,
+	db *sql.DB,
+	opts ...Option,
+) (*Service, error) {
+	o := &options{
+		maxAttempts: DefaultMaxAttempts,
+		minBackoff:  DefaultMinBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		maxWorkers:  DefaultMaxWorkers,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, schemaSQL); err != nil {
+		return nil, fmt.Errorf("setting up outbox schema: %w", err)
+	}
+
+	queueName := "outbox_" + name
+	q, err := jobqueue.New(
+		queueName,
+		db,
+		&serializer.IPLDSerializerCBOR[datamodel.Link]{
+			Typ:  &schema.TypeLink{},
+			Opts: types.Converters,
+		},
+		jobqueue.WithLogger(logging.Logger("jobqueue").With("queue", queueName)),
+		jobqueue.WithMaxRetries(o.maxAttempts),
+		jobqueue.WithMaxWorkers(o.maxWorkers),
+		jobqueue.WithBackoff(o.minBackoff, o.maxBackoff),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox job-queue: %w", err)
+	}
+
+	s := &Service{name: name, conn: conn, receipts: receipts, db: db, queue: q}
+	if err := q.Register(DeliverTask, s.deliver); err != nil {
+		return nil, fmt.Errorf("registering %s task: %w", DeliverTask, err)
+	}
+	if err := q.OnFailure(DeliverTask, func(ctx context.Context, root datamodel.Link, cause error) error {
+		log.Errorw("abandoning receipt delivery", "outbox", name, "receipt", root.String(), "attempts", o.maxAttempts, "error", cause)
+		return s.update(ctx, root, DeliveryFailed)
+	}); err != nil {
+		return nil, fmt.Errorf("registering %s failure handler: %w", DeliverTask, err)
+	}
+	return s, nil
+}
+
+func (s *Service) Send(ctx context.Context, rcpt receipt.AnyReceipt) error {
+	if err := s.receipts.Put(ctx, rcpt); err != nil {
+		return fmt.Errorf("storing receipt: %w", err)
+	}
+
+	ran := rcpt.Ran()
+	if ran == nil {
+		return errors.New("receipt does not include the invocation it is for")
+	}
+	root := rcpt.Root().Link()
+
+	// the delivery is recorded and queued together, so that a pending delivery
+	// always has a job to deliver it
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		insert into outbox (outbox, receipt, ran) values (?, ?, ?)
+		on conflict (outbox, receipt) do update
+			set state = 'pending', attempts = 0, last_error = '', updated = strftime('%Y-%m-%dT%H:%M:%fZ')
+			where state = 'failed'`,
+		s.name, root.String(), ran.Link().String(),
+	)
+	if err != nil {
+		return fmt.Errorf("recording receipt delivery: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("recording receipt delivery: %w", err)
+	}
+	if n == 0 {
+		log.Debugw("receipt already sent", "outbox", s.name, "receipt", root.String())
+		return nil
+	}
+
+	if err := s.queue.EnqueueTx(ctx, tx, DeliverTask, root); err != nil {
+		return fmt.Errorf("queueing receipt for delivery: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing receipt delivery: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) Delivery(ctx context.Context, rcpt ipld.Link) (Delivery, error) {
+	row := s.db.QueryRowContext(ctx, `
+		select receipt, ran, state, attempts, last_error, created, updated from outbox
+		where outbox = ? and receipt = ?`,
+		s.name, rcpt.String(),
+	)
+	d, err := scanDelivery(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Delivery{}, ErrDeliveryNotFound
+		}
+		return Delivery{}, fmt.Errorf("getting receipt delivery: %w", err)
+	}
+	return d, nil
+}
+
+func (s *Service) Undelivered(ctx context.Context) ([]Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		select receipt, ran, state, attempts, last_error, created, updated from outbox
+		where outbox = ? and state != 'delivered'
+		order by created`,
+		s.name,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing undelivered receipts: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("listing undelivered receipts: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing undelivered receipts: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Start begins delivering queued receipts, including any that were queued
+// before the node was last stopped.
+func (s *Service) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.queue.Start(ctx)
+	}()
+	return nil
+}
+
+// Stop ends delivery. Deliveries interrupted by stopping are attempted again
+// when the outbox is next started.
+func (s *Service) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+// deliver sends the receipt, along with the invocation it is for, to the
+// remote service.
+func (s *Service) deliver(ctx context.Context, root datamodel.Link) error {
+	err := s.send(ctx, root)
+	if ctx.Err() != nil {
+		// interrupted by shutdown, not a failed attempt
+		return err
+	}
+	if err != nil {
+		log.Warnw("receipt delivery failed", "outbox", s.name, "receipt", root.String(), "error", err)
+		if _, uerr := s.db.ExecContext(ctx, `
+			update outbox set attempts = attempts + 1, last_error = ?, updated = strftime('%Y-%m-%dT%H:%M:%fZ')
+			where outbox = ? and receipt = ?`,
+			err.Error(), s.name, root.String(),
+		); uerr != nil {
+			log.Errorw("recording failed receipt delivery", "outbox", s.name, "receipt", root.String(), "error", uerr)
+		}
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		update outbox set state = 'delivered', attempts = attempts + 1, last_error = '', updated = strftime('%Y-%m-%dT%H:%M:%fZ')
+		where outbox = ? and receipt = ?`,
+		s.name, root.String(),
+	); err != nil {
+		// the receipt was delivered, so there is no need to deliver it again
+		log.Errorw("recording receipt delivery", "outbox", s.name, "receipt", root.String(), "error", err)
+	}
+	return nil
+}
+
+func (s *Service) send(ctx context.Context, root datamodel.Link) error {
+	rcpt, err := s.receipts.Get(ctx, root)
+	if err != nil {
+		return fmt.Errorf("getting receipt: %w", err)
+	}
+
+	ran := rcpt.Ran()
+	if ran == nil {
+		return errors.New("receipt does not include the invocation it is for")
+	}
+	msg, err := message.Build([]invocation.Invocation{ran}, []receipt.AnyReceipt{rcpt})
+	if err != nil {
+		return fmt.Errorf("building message for receipt failed: %w", err)
+	}
+
+	req, err := s.conn.Codec().Encode(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message for receipt to http request: %w", err)
+	}
+
+	res, err := s.conn.Channel().Request(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request for receipt: %w", err)
+	}
+	if res.Status() >= 300 || res.Status() < 200 {
+		resData, err := io.ReadAll(io.LimitReader(res.Body(), 1024))
+		if err != nil {
+			resData = []byte(fmt.Sprintf("failed to read response body: %s", err))
+		}
+		return fmt.Errorf("unsuccessful http POST to remote service status code %d response body: %s", res.Status(), resData)
+	}
+	return nil
+}
+
+func (s *Service) update(ctx context.Context, root datamodel.Link, state string) error {
+	_, err := s.db.ExecContext(ctx, `
+		update outbox set state = ?, updated = strftime('%Y-%m-%dT%H:%M:%fZ')
+		where outbox = ? and receipt = ?`,
+		state, s.name, root.String(),
+	)
+	if err != nil {
+		return fmt.Errorf("updating receipt delivery: %w", err)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDelivery(row scanner) (Delivery, error) {
+	var d Delivery
+	var created, updated string
+	if err := row.Scan(&d.Receipt, &d.Ran, &d.State, &d.Attempts, &d.LastError, &created, &updated); err != nil {
+		return Delivery{}, err
+	}
+	var err error
+	if d.Created, err = time.Parse(rfc3339Milli, created); err != nil {
+		return Delivery{}, fmt.Errorf("parsing created time of delivery %s: %w", d.Receipt, err)
+	}
+	if d.Updated, err = time.Parse(rfc3339Milli, updated); err != nil {
+		return Delivery{}, fmt.Errorf("parsing updated time of delivery %s: %w", d.Receipt, err)
+	}
+	return d, nil
+}
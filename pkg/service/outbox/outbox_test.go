@@ -0,0 +1,242 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/storacha/go-libstoracha/capabilities/blob/replica"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/client"
+	"github.com/storacha/go-ucanto/core/car"
+	"github.com/storacha/go-ucanto/core/dag/blockstore"
+	"github.com/storacha/go-ucanto/core/invocation/ran"
+	"github.com/storacha/go-ucanto/core/ipld"
+	"github.com/storacha/go-ucanto/core/message"
+	"github.com/storacha/go-ucanto/core/receipt"
+	"github.com/storacha/go-ucanto/core/result"
+	ucanhttp "github.com/storacha/go-ucanto/transport/http"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/database/sqlitedb"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store/receiptstore"
+)
+
+func TestOutbox(t *testing.T) {
+	t.Run("delivers a receipt once", func(t *testing.T) {
+		svc := newRemoteService(t, 0)
+		receipts := newReceiptStore(t)
+		ob := newOutbox(t, newMemoryDB(t), svc.conn, receipts)
+		rcpt := randomReceipt(t)
+
+		require.NoError(t, ob.Send(context.Background(), rcpt))
+		// sending it again is ignored
+		require.NoError(t, ob.Send(context.Background(), rcpt))
+
+		stored, err := receipts.Get(context.Background(), rcpt.Root().Link())
+		require.NoError(t, err)
+		require.Equal(t, rcpt.Root().Link(), stored.Root().Link())
+
+		require.NoError(t, ob.Start(context.Background()))
+		t.Cleanup(func() { ob.Stop(context.Background()) })
+
+		d := waitForState(t, ob, rcpt.Root().Link(), DeliveryDelivered)
+		require.Equal(t, 1, d.Attempts)
+		require.Equal(t, rcpt.Ran().Link().String(), d.Ran)
+		require.Empty(t, d.LastError)
+
+		msgs := svc.messages()
+		require.Len(t, msgs, 1)
+		link, ok := msgs[0].Get(rcpt.Ran().Link())
+		require.True(t, ok)
+		require.Equal(t, rcpt.Root().Link(), link)
+
+		// a delivered receipt is not sent again
+		require.NoError(t, ob.Send(context.Background(), rcpt))
+		undelivered, err := ob.Undelivered(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, undelivered)
+	})
+
+	t.Run("retries failed deliveries", func(t *testing.T) {
+		svc := newRemoteService(t, 2)
+		ob := newOutbox(t, newMemoryDB(t), svc.conn, newReceiptStore(t), WithBackoff(10*time.Millisecond, 10*time.Millisecond))
+		rcpt := randomReceipt(t)
+
+		require.NoError(t, ob.Send(context.Background(), rcpt))
+		require.NoError(t, ob.Start(context.Background()))
+		t.Cleanup(func() { ob.Stop(context.Background()) })
+
+		d := waitForState(t, ob, rcpt.Root().Link(), DeliveryDelivered)
+		require.Equal(t, 3, d.Attempts)
+		require.Len(t, svc.messages(), 1)
+	})
+
+	t.Run("marks deliveries failed after the final attempt", func(t *testing.T) {
+		svc := newRemoteService(t, -1)
+		ob := newOutbox(t, newMemoryDB(t), svc.conn, newReceiptStore(t),
+			WithMaxAttempts(2),
+			WithBackoff(10*time.Millisecond, 10*time.Millisecond),
+		)
+		rcpt := randomReceipt(t)
+
+		require.NoError(t, ob.Send(context.Background(), rcpt))
+		require.NoError(t, ob.Start(context.Background()))
+		t.Cleanup(func() { ob.Stop(context.Background()) })
+
+		d := waitForState(t, ob, rcpt.Root().Link(), DeliveryFailed)
+		require.Equal(t, 2, d.Attempts)
+		require.Contains(t, d.LastError, "503")
+
+		undelivered, err := ob.Undelivered(context.Background())
+		require.NoError(t, err)
+		require.Len(t, undelivered, 1)
+		require.Equal(t, rcpt.Root().Link().String(), undelivered[0].Receipt)
+
+		// sending a failed receipt again queues it for delivery
+		svc.recover()
+		require.NoError(t, ob.Send(context.Background(), rcpt))
+		waitForState(t, ob, rcpt.Root().Link(), DeliveryDelivered)
+	})
+
+	t.Run("resumes delivery after restart", func(t *testing.T) {
+		svc := newRemoteService(t, 0)
+		receipts := newReceiptStore(t)
+		dbPath := filepath.Join(t.TempDir(), "outbox.db")
+		rcpt := randomReceipt(t)
+
+		db, err := sqlitedb.New(dbPath)
+		require.NoError(t, err)
+		ob := newOutbox(t, db, svc.conn, receipts)
+		require.NoError(t, ob.Send(context.Background(), rcpt))
+		require.NoError(t, db.Close())
+
+		db, err = sqlitedb.New(dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		ob = newOutbox(t, db, svc.conn, receipts)
+
+		d, err := ob.Delivery(context.Background(), rcpt.Root().Link())
+		require.NoError(t, err)
+		require.Equal(t, DeliveryPending, d.State)
+
+		require.NoError(t, ob.Start(context.Background()))
+		t.Cleanup(func() { ob.Stop(context.Background()) })
+		waitForState(t, ob, rcpt.Root().Link(), DeliveryDelivered)
+	})
+
+	t.Run("reports unknown receipts as not found", func(t *testing.T) {
+		ob := newOutbox(t, newMemoryDB(t), nil, newReceiptStore(t))
+		_, err := ob.Delivery(context.Background(), testutil.RandomCID(t))
+		require.ErrorIs(t, err, ErrDeliveryNotFound)
+	})
+}
+
+func newOutbox(t *testing.T, db *sql.DB, conn client.Connection, receipts receiptstore.ReceiptStore, opts ...Option) *Service {
+	ob, err := New("test", conn, receipts, db, opts...)
+	require.NoError(t, err)
+	return ob
+}
+
+func newMemoryDB(t *testing.T) *sql.DB {
+	db, err := sqlitedb.NewMemory()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func waitForState(t *testing.T, ob *Service, rcpt ipld.Link, state string) Delivery {
+	t.Helper()
+	var d Delivery
+	require.Eventually(t, func() bool {
+		var err error
+		d, err = ob.Delivery(context.Background(), rcpt)
+		require.NoError(t, err)
+		return d.State == state
+	}, 10*time.Second, 10*time.Millisecond)
+	return d
+}
+
+func randomReceipt(t *testing.T) receipt.AnyReceipt {
+	inv, err := replica.Transfer.Invoke(
+		testutil.Alice,
+		testutil.Alice,
+		testutil.Alice.DID().String(),
+		replica.TransferCaveats{
+			Space: testutil.RandomDID(t),
+			Blob:  types.Blob{Digest: testutil.RandomMultihash(t), Size: 128},
+			Site:  testutil.RandomCID(t),
+			Cause: testutil.RandomCID(t),
+		},
+	)
+	require.NoError(t, err)
+	ok := result.Ok[replica.TransferOk, ipld.Builder](replica.TransferOk{Site: testutil.RandomCID(t)})
+	rcpt, err := receipt.Issue(testutil.Alice, ok, ran.FromInvocation(inv))
+	require.NoError(t, err)
+	return rcpt
+}
+
+func newReceiptStore(t *testing.T) receiptstore.ReceiptStore {
+	rs, err := receiptstore.NewDsReceiptStore(datastore.NewMapDatastore())
+	require.NoError(t, err)
+	return rs
+}
+
+// remoteService records the agent messages it receives, failing the given
+// number of requests first. A negative number fails every request until it
+// recovers.
+type remoteService struct {
+	conn client.Connection
+	mu   sync.Mutex
+	fail int
+	msgs []message.AgentMessage
+}
+
+func newRemoteService(t *testing.T, fail int) *remoteService {
+	s := &remoteService{fail: fail}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail != 0 {
+			if s.fail > 0 {
+				s.fail--
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		roots, blocks, err := car.Decode(r.Body)
+		require.NoError(t, err)
+		bs, err := blockstore.NewBlockReader(blockstore.WithBlocksIterator(blocks))
+		require.NoError(t, err)
+		msg, err := message.NewMessage(roots, bs)
+		require.NoError(t, err)
+		s.msgs = append(s.msgs, msg)
+	}))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	conn, err := client.NewConnection(testutil.Alice, ucanhttp.NewHTTPChannel(u))
+	require.NoError(t, err)
+	s.conn = conn
+	return s
+}
+
+func (s *remoteService) recover() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = 0
+}
+
+func (s *remoteService) messages() []message.AgentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.msgs
+}
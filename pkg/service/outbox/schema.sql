@@ -0,0 +1,15 @@
+-- outbox records the delivery of each receipt sent through an outbox, so that
+-- a receipt is delivered once and its delivery can be inspected.
+create table if not exists outbox (
+  outbox text not null,
+  receipt text not null,
+  ran text not null,
+  state text not null default 'pending',
+  attempts integer not null default 0,
+  last_error text not null default '',
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  updated text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  primary key (outbox, receipt)
+) strict;
+
+create index if not exists outbox_state_created_idx on outbox (outbox, state, created);
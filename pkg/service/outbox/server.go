@@ -0,0 +1,78 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+
+	"github.com/storacha/piri/internal/telemetry"
+)
+
+type Server struct {
+	outbox Outbox
+}
+
+func NewServer(outbox Outbox) (*Server, error) {
+	return &Server{outbox}, nil
+}
+
+func (srv *Server) Serve(mux *http.ServeMux) {
+	mux.Handle("GET /outbox", NewHandler(srv.outbox))
+	mux.Handle("GET /outbox/{receipt}", NewDeliveryHandler(srv.outbox))
+}
+
+// NewHandler lists the receipts that are pending or failed to be delivered as
+// JSON.
+func NewHandler(outbox Outbox) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		deliveries, err := outbox.Undelivered(r.Context())
+		if err != nil {
+			return telemetry.NewHTTPError(fmt.Errorf("failed to list undelivered receipts: %w", err), http.StatusInternalServerError)
+		}
+		if deliveries == nil {
+			deliveries = []Delivery{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(deliveries)
+		if err != nil {
+			return fmt.Errorf("serving undelivered receipts: %w", err)
+		}
+
+		return nil
+	}
+
+	return telemetry.NewErrorReportingHandler(handler)
+}
+
+// NewDeliveryHandler reports the delivery of the receipt in the path as JSON.
+func NewDeliveryHandler(outbox Outbox) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		c, err := cid.Parse(r.PathValue("receipt"))
+		if err != nil {
+			return telemetry.NewHTTPError(fmt.Errorf("invalid receipt CID: %w", err), http.StatusBadRequest)
+		}
+
+		delivery, err := outbox.Delivery(r.Context(), cidlink.Link{Cid: c})
+		if err != nil {
+			if errors.Is(err, ErrDeliveryNotFound) {
+				return telemetry.NewHTTPError(fmt.Errorf("not found: %s", c), http.StatusNotFound)
+			}
+			return telemetry.NewHTTPError(fmt.Errorf("failed to get receipt delivery: %w", err), http.StatusInternalServerError)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(delivery)
+		if err != nil {
+			return fmt.Errorf("serving receipt delivery: %w", err)
+		}
+
+		return nil
+	}
+
+	return telemetry.NewErrorReportingHandler(handler)
+}
@@ -0,0 +1,298 @@
+package publisher
+
+import (
+	"context"
+	"database/sql"
+	// for go:embed
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/storacha/go-libstoracha/advertisement"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-ucanto/core/delegation"
+)
+
+//go:embed batch.sql
+var batchSchemaSQL string
+
+const (
+	// DefaultBatchWindow is the default time location commitments are held
+	// before they are advertised.
+	DefaultBatchWindow = 10 * time.Second
+	// DefaultBatchSize is the default number of pending location commitments
+	// that causes a batch to be advertised before the window has passed.
+	DefaultBatchSize = 1000
+)
+
+// batcher coalesces location commitments made over a time or size window, so
+// that only the latest commitment for each blob in a space is advertised, and
+// a batch of commitments is appended to the chain at once and announced
+// together rather than each on its own. Each commitment is still advertised
+// under its own context ID with its own metadata, with the entries chunked by
+// the publisher store. Commitments are kept queued until they have been
+// cached with the indexing service, so that caching is retried.
+type batcher struct {
+	db      *sql.DB
+	window  time.Duration
+	size    int
+	flushMu sync.Mutex
+	notify  chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newBatcher(db *sql.DB, window time.Duration, size int) (*batcher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, batchSchemaSQL); err != nil {
+		return nil, fmt.Errorf("setting up publisher batch schema: %w", err)
+	}
+	return &batcher{
+		db:     db,
+		window: window,
+		size:   size,
+		notify: make(chan struct{}, 1),
+	}, nil
+}
+
+// add queues a location commitment to be advertised with the next batch.
+func (b *batcher) add(ctx context.Context, locationCommitment delegation.Delegation) error {
+	nb, rerr := assert.LocationCaveatsReader.Read(locationCommitment.Capabilities()[0].Nb())
+	if rerr != nil {
+		return fmt.Errorf("reading location commitment data: %w", rerr)
+	}
+	contextid, err := advertisement.EncodeContextID(nb.Space, nb.Content.Hash())
+	if err != nil {
+		return fmt.Errorf("encoding advertisement context ID: %w", err)
+	}
+	data, err := io.ReadAll(locationCommitment.Archive())
+	if err != nil {
+		return fmt.Errorf("archiving location commitment: %w", err)
+	}
+
+	_, err = b.db.ExecContext(ctx, `
+		insert into publisher_batch (context_id, claim) values (?, ?)
+		on conflict (context_id) do update set claim = excluded.claim, advertised = 0`,
+		[]byte(contextid), data,
+	)
+	if err != nil {
+		return fmt.Errorf("queueing location commitment: %w", err)
+	}
+
+	var pending int
+	err = b.db.QueryRowContext(ctx, `select count(*) from publisher_batch`).Scan(&pending)
+	if err != nil {
+		return fmt.Errorf("counting pending location commitments: %w", err)
+	}
+	if pending >= b.size {
+		select {
+		case b.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// remove drops a location commitment that has not been handled yet.
+func (b *batcher) remove(ctx context.Context, contextID []byte) error {
+	_, err := b.db.ExecContext(ctx, `delete from publisher_batch where context_id = ?`, contextID)
+	if err != nil {
+		return fmt.Errorf("removing pending location commitment: %w", err)
+	}
+	return nil
+}
+
+type pendingCommitment struct {
+	contextID  []byte
+	data       []byte
+	advertised bool
+	claim      delegation.Delegation
+}
+
+// next returns up to a batch of the oldest pending location commitments.
+func (b *batcher) next(ctx context.Context) ([]pendingCommitment, error) {
+	rows, err := b.db.QueryContext(ctx, `
+		select context_id, claim, advertised from publisher_batch order by created limit ?`,
+		b.size,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying pending location commitments: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []pendingCommitment
+	for rows.Next() {
+		var p pendingCommitment
+		if err := rows.Scan(&p.contextID, &p.data, &p.advertised); err != nil {
+			return nil, fmt.Errorf("scanning pending location commitment: %w", err)
+		}
+		p.claim, err = delegation.Extract(p.data)
+		if err != nil {
+			return nil, fmt.Errorf("extracting pending location commitment: %w", err)
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// markAdvertised records that a location commitment was advertised, so that
+// only caching remains to be done for it.
+func (b *batcher) markAdvertised(ctx context.Context, p pendingCommitment) error {
+	_, err := b.db.ExecContext(ctx, `
+		update publisher_batch set advertised = 1 where context_id = ? and claim = ?`,
+		p.contextID, p.data,
+	)
+	return err
+}
+
+// done removes a handled location commitment, unless it was replaced by a
+// newer one while it was being handled.
+func (b *batcher) done(ctx context.Context, p pendingCommitment) error {
+	_, err := b.db.ExecContext(ctx, `
+		delete from publisher_batch where context_id = ? and claim = ?`,
+		p.contextID, p.data,
+	)
+	return err
+}
+
+// requeue moves a location commitment that could not be handled to the back
+// of the queue, so that it does not hold up the rest.
+func (b *batcher) requeue(ctx context.Context, p pendingCommitment) error {
+	_, err := b.db.ExecContext(ctx, `
+		update publisher_batch set created = strftime('%Y-%m-%dT%H:%M:%fZ')
+		where context_id = ? and claim = ?`,
+		p.contextID, p.data,
+	)
+	return err
+}
+
+// Flush advertises a batch of pending location commitments, caches them with
+// the indexing service and announces the new head to indexers. Commitments
+// that could not be advertised or cached stay queued and are retried by a
+// later flush. It is a no-op when batching is not configured.
+func (pub *PublisherService) Flush(ctx context.Context) error {
+	b := pub.batch
+	if b == nil {
+		return nil
+	}
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	pending, err := b.next(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var errs error
+	fail := func(p pendingCommitment, msg string, err error) {
+		log.Errorw(msg, "claim", p.claim.Link(), "error", err)
+		errs = errors.Join(errs, fmt.Errorf("%s %s: %w", msg, p.claim.Link(), err))
+		if err := b.requeue(ctx, p); err != nil {
+			log.Errorw("requeueing location commitment", "claim", p.claim.Link(), "error", err)
+		}
+	}
+
+	var advertised []pendingCommitment
+	var entries []batchEntry
+	var unadvertised []pendingCommitment
+	for _, p := range pending {
+		if p.advertised {
+			advertised = append(advertised, p)
+			continue
+		}
+		contextID, digest, meta, err := locationCommitmentAdvert(pub.provider, p.claim)
+		if err != nil {
+			fail(p, "advertising location commitment", err)
+			continue
+		}
+		entries = append(entries, batchEntry{contextID: contextID, digest: digest, meta: meta})
+		unadvertised = append(unadvertised, p)
+	}
+
+	if len(entries) > 0 {
+		published := 0
+		for i, err := range pub.chain.PublishBatch(ctx, pub.provider, entries) {
+			p := unadvertised[i]
+			if err != nil {
+				fail(p, "advertising location commitment", err)
+				continue
+			}
+			if err := b.markAdvertised(ctx, p); err != nil {
+				log.Errorw("marking location commitment advertised", "claim", p.claim.Link(), "error", err)
+			}
+			advertised = append(advertised, p)
+			published++
+		}
+		if published > 0 {
+			if err := pub.chain.announceHead(ctx); err != nil {
+				log.Errorw("announcing advertisements", "error", err)
+			}
+		}
+	}
+
+	cached := 0
+	for _, p := range advertised {
+		err := CacheClaim(ctx, pub.id, pub.indexingService, pub.indexingServiceProofs, p.claim, pub.provider.Addrs)
+		if err != nil {
+			fail(p, "caching location commitment", err)
+			continue
+		}
+		if err := b.done(ctx, p); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("removing cached location commitment %s: %w", p.claim.Link(), err))
+		}
+		cached++
+	}
+	log.Infow("flushed batch", "advertised", len(advertised), "cached", cached, "pending", len(pending))
+	return errs
+}
+
+// Start begins advertising batches of location commitments, including any
+// that were queued before the node was last stopped. It is a no-op when
+// batching is not configured.
+func (pub *PublisherService) Start(_ context.Context) error {
+	b := pub.batch
+	if b == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(b.window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-b.notify:
+			}
+			if err := pub.Flush(ctx); err != nil {
+				log.Errorw("flushing location commitments", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends batching. Location commitments that are still pending are kept,
+// and advertised when the publisher is next started.
+func (pub *PublisherService) Stop(_ context.Context) error {
+	b := pub.batch
+	if b == nil {
+		return nil
+	}
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.wg.Wait()
+	return nil
+}
@@ -0,0 +1,12 @@
+-- publisher_batch holds location commitments waiting to be advertised or
+-- cached with the indexing service. There is one row per claim context ID, so
+-- a newer commitment for the same blob in the same space replaces one that has
+-- not been handled yet. Advertised commitments are kept until they are cached.
+create table if not exists publisher_batch (
+  context_id blob primary key,
+  claim blob not null,
+  advertised integer not null default 0,
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ'))
+) strict;
+
+create index if not exists publisher_batch_created_idx on publisher_batch (created);
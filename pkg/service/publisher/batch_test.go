@@ -0,0 +1,349 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipni/go-libipni/ingest/schema"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-libstoracha/capabilities/claim"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+	"github.com/storacha/go-libstoracha/metadata"
+	"github.com/storacha/go-ucanto/client"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/core/invocation"
+	"github.com/storacha/go-ucanto/core/receipt/fx"
+	"github.com/storacha/go-ucanto/core/result/ok"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/server"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/database/sqlitedb"
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/service/publisher/advertisement"
+)
+
+func TestBatching(t *testing.T) {
+	addr, err := multiaddr.NewMultiaddr("/dns4/localhost/tcp/3000/http")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	newPublisherStore := func() store.PublisherStore {
+		dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+		return store.FromDatastore(dstore, store.WithMetadataContext(metadata.MetadataContext))
+	}
+
+	locationCommitment := func(t *testing.T, space did.DID, shard multihash.Multihash, opts ...delegation.Option) delegation.Delegation {
+		location := testutil.Must(url.Parse(fmt.Sprintf("http://localhost:3000/blob/%s", digestutil.Format(shard))))(t)
+		claim, err := assert.Location.Delegate(
+			testutil.Alice,
+			space,
+			testutil.Alice.DID().String(),
+			assert.LocationCaveats{
+				Space:    space,
+				Content:  types.FromHash(shard),
+				Location: []url.URL{*location},
+			},
+			opts...,
+		)
+		require.NoError(t, err)
+		return claim
+	}
+
+	// adverts returns the advertisements in the chain, newest first.
+	adverts := func(t *testing.T, publisherStore store.PublisherStore) []schema.Advertisement {
+		var ads []schema.Advertisement
+		hd, err := publisherStore.Head(ctx)
+		if store.IsNotFound(err) {
+			return ads
+		}
+		require.NoError(t, err)
+
+		next := hd.Head
+		for next != nil {
+			ad, err := publisherStore.Advert(ctx, next)
+			require.NoError(t, err)
+			ads = append(ads, ad)
+			next = ad.PreviousID
+		}
+		return ads
+	}
+
+	entries := func(t *testing.T, publisherStore store.PublisherStore, ad schema.Advertisement) []multihash.Multihash {
+		var digests []multihash.Multihash
+		for digest, err := range publisherStore.Entries(ctx, ad.Entries) {
+			require.NoError(t, err)
+			digests = append(digests, digest)
+		}
+		return digests
+	}
+
+	// advertisedClaim returns the claim in the metadata of the latest
+	// advertisement for the blob in the space, or an empty string if it is
+	// not advertised.
+	advertisedClaim := func(t *testing.T, publisherStore store.PublisherStore, space did.DID, shard multihash.Multihash) string {
+		contextID := testutil.Must(advertisement.EncodeContextID(space, shard))(t)
+		for _, ad := range adverts(t, publisherStore) {
+			if !bytes.Equal(ad.ContextID, contextID) {
+				continue
+			}
+			if ad.IsRm {
+				return ""
+			}
+			require.Equal(t, []multihash.Multihash{shard}, entries(t, publisherStore, ad))
+			meta := metadata.MetadataContext.New()
+			require.NoError(t, meta.UnmarshalBinary(ad.Metadata))
+			lcmeta, ok := meta.Get(metadata.LocationCommitmentID).(*metadata.LocationCommitmentMetadata)
+			require.True(t, ok)
+			return lcmeta.Claim.String()
+		}
+		return ""
+	}
+
+	t.Run("queues location commitments until flushed", func(t *testing.T) {
+		db, err := sqlitedb.NewMemory()
+		require.NoError(t, err)
+		publisherStore := newPublisherStore()
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithBatchDatabase(db))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		var shards []multihash.Multihash
+		var claims []delegation.Delegation
+		for range 3 {
+			shard := testutil.RandomMultihash(t)
+			claim := locationCommitment(t, space, shard, delegation.WithNoExpiration())
+			require.NoError(t, svc.Publish(ctx, claim))
+			shards = append(shards, shard)
+			claims = append(claims, claim)
+		}
+
+		_, err = publisherStore.Head(ctx)
+		require.True(t, store.IsNotFound(err))
+
+		require.NoError(t, svc.Flush(ctx))
+
+		// each claim is advertised with its own metadata
+		require.Len(t, adverts(t, publisherStore), 3)
+		for i, claim := range claims {
+			require.Equal(t, claim.Link().String(), advertisedClaim(t, publisherStore, space, shards[i]))
+		}
+
+		// nothing is left to flush
+		hd, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+		require.NoError(t, svc.Flush(ctx))
+		again, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, hd.Head, again.Head)
+	})
+
+	t.Run("coalesces location commitments for the same blob", func(t *testing.T) {
+		db, err := sqlitedb.NewMemory()
+		require.NoError(t, err)
+		publisherStore := newPublisherStore()
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithBatchDatabase(db))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		shard := testutil.RandomMultihash(t)
+		first := locationCommitment(t, space, shard, delegation.WithExpiration(1000))
+		latest := locationCommitment(t, space, shard, delegation.WithExpiration(2000))
+		require.NoError(t, svc.Publish(ctx, first))
+		require.NoError(t, svc.Publish(ctx, latest))
+
+		require.NoError(t, svc.Flush(ctx))
+
+		require.Equal(t, latest.Link().String(), advertisedClaim(t, publisherStore, space, shard))
+		require.Len(t, adverts(t, publisherStore), 1)
+	})
+
+	t.Run("flushes a batch when the size is reached", func(t *testing.T) {
+		db, err := sqlitedb.NewMemory()
+		require.NoError(t, err)
+		publisherStore := newPublisherStore()
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithBatchDatabase(db), WithBatchWindow(time.Hour), WithBatchSize(2))
+		require.NoError(t, err)
+		require.NoError(t, svc.Start(ctx))
+		t.Cleanup(func() { svc.Stop(ctx) })
+
+		space := testutil.RandomDID(t)
+		shards := []multihash.Multihash{testutil.RandomMultihash(t), testutil.RandomMultihash(t)}
+		for _, shard := range shards {
+			require.NoError(t, svc.Publish(ctx, locationCommitment(t, space, shard)))
+		}
+
+		require.Eventually(t, func() bool {
+			return len(adverts(t, publisherStore)) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+		for _, shard := range shards {
+			require.NotEmpty(t, advertisedClaim(t, publisherStore, space, shard))
+		}
+	})
+
+	t.Run("keeps pending location commitments across restarts", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "batch.db")
+		db, err := sqlitedb.New(dbPath)
+		require.NoError(t, err)
+		publisherStore := newPublisherStore()
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithBatchDatabase(db))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		shard := testutil.RandomMultihash(t)
+		claim := locationCommitment(t, space, shard)
+		require.NoError(t, svc.Publish(ctx, claim))
+		require.NoError(t, db.Close())
+
+		db, err = sqlitedb.New(dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+
+		svc, err = New(testutil.Alice, publisherStore, addr, WithBatchDatabase(db))
+		require.NoError(t, err)
+		require.NoError(t, svc.Flush(ctx))
+
+		require.Equal(t, claim.Link().String(), advertisedClaim(t, publisherStore, space, shard))
+	})
+
+	t.Run("drops pending location commitments when retracted", func(t *testing.T) {
+		db, err := sqlitedb.NewMemory()
+		require.NoError(t, err)
+		publisherStore := newPublisherStore()
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithBatchDatabase(db))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		shard := testutil.RandomMultihash(t)
+		require.NoError(t, svc.Publish(ctx, locationCommitment(t, space, shard)))
+		require.NoError(t, svc.Retract(ctx, space, shard))
+		require.NoError(t, svc.Flush(ctx))
+
+		_, err = publisherStore.Head(ctx)
+		require.True(t, store.IsNotFound(err))
+	})
+
+	t.Run("retracts a single blob", func(t *testing.T) {
+		db, err := sqlitedb.NewMemory()
+		require.NoError(t, err)
+		publisherStore := newPublisherStore()
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithBatchDatabase(db))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		var shards []multihash.Multihash
+		for range 3 {
+			shard := testutil.RandomMultihash(t)
+			require.NoError(t, svc.Publish(ctx, locationCommitment(t, space, shard)))
+			shards = append(shards, shard)
+		}
+		require.NoError(t, svc.Flush(ctx))
+
+		require.NoError(t, svc.Retract(ctx, space, shards[0]))
+
+		// only the retracted blob is removed
+		ads := adverts(t, publisherStore)
+		require.Len(t, ads, 4)
+		require.True(t, ads[0].IsRm)
+		require.Empty(t, advertisedClaim(t, publisherStore, space, shards[0]))
+		require.NotEmpty(t, advertisedClaim(t, publisherStore, space, shards[1]))
+		require.NotEmpty(t, advertisedClaim(t, publisherStore, space, shards[2]))
+
+		// retracting again is not an error
+		require.NoError(t, svc.Retract(ctx, space, shards[0]))
+		require.Len(t, adverts(t, publisherStore), 4)
+	})
+
+	t.Run("advertises a new claim for a blob that is already advertised", func(t *testing.T) {
+		db, err := sqlitedb.NewMemory()
+		require.NoError(t, err)
+		publisherStore := newPublisherStore()
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithBatchDatabase(db))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		shard := testutil.RandomMultihash(t)
+		require.NoError(t, svc.Publish(ctx, locationCommitment(t, space, shard, delegation.WithExpiration(1000))))
+		require.NoError(t, svc.Flush(ctx))
+
+		renewed := locationCommitment(t, space, shard, delegation.WithExpiration(2000))
+		require.NoError(t, svc.Publish(ctx, renewed))
+		require.NoError(t, svc.Flush(ctx))
+
+		require.Len(t, adverts(t, publisherStore), 2)
+		require.Equal(t, renewed.Link().String(), advertisedClaim(t, publisherStore, space, shard))
+	})
+
+	t.Run("keeps location commitments queued until they are cached", func(t *testing.T) {
+		db, err := sqlitedb.NewMemory()
+		require.NoError(t, err)
+		publisherStore := newPublisherStore()
+
+		var mutex sync.Mutex
+		calls := 0
+		handler := func(cap ucan.Capability[claim.CacheCaveats], inv invocation.Invocation, ctx server.InvocationContext) (ok.Unit, fx.Effects, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			calls++
+			if calls == 1 {
+				return ok.Unit{}, nil, fmt.Errorf("indexing service unavailable")
+			}
+			return ok.Unit{}, nil, nil
+		}
+		idxConn, err := client.NewConnection(testutil.Bob, mockIndexingService(t, testutil.Bob, handler))
+		require.NoError(t, err)
+		prf, err := delegation.Delegate(
+			testutil.Bob,
+			testutil.Alice,
+			[]ucan.Capability[ucan.NoCaveats]{
+				ucan.NewCapability(claim.CacheAbility, testutil.Bob.DID().String(), ucan.NoCaveats{}),
+			},
+		)
+		require.NoError(t, err)
+
+		svc, err := New(
+			testutil.Alice,
+			publisherStore,
+			addr,
+			WithBatchDatabase(db),
+			WithIndexingService(idxConn),
+			WithIndexingServiceProof(delegation.FromDelegation(prf)),
+		)
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		require.NoError(t, svc.Publish(ctx, locationCommitment(t, space, testutil.RandomMultihash(t))))
+
+		require.Error(t, svc.Flush(ctx))
+		require.Len(t, adverts(t, publisherStore), 1)
+
+		// caching is retried without advertising again
+		require.NoError(t, svc.Flush(ctx))
+		require.Len(t, adverts(t, publisherStore), 1)
+		require.Equal(t, 2, calls)
+
+		require.NoError(t, svc.Flush(ctx))
+		require.Equal(t, 2, calls)
+	})
+}
@@ -0,0 +1,257 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/url"
+	"slices"
+	"sync"
+
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipni/go-libipni/announce"
+	"github.com/ipni/go-libipni/announce/httpsender"
+	"github.com/ipni/go-libipni/dagsync/ipnisync/head"
+	"github.com/ipni/go-libipni/ingest/schema"
+	ipnimd "github.com/ipni/go-libipni/metadata"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	ipnipub "github.com/storacha/go-libstoracha/ipnipublisher/publisher"
+	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+)
+
+// DefaultIngestTopic is the default topic signed into the head of the
+// advertisement chain.
+const DefaultIngestTopic = "/indexer/ingest/mainnet"
+
+// adChain appends advertisements to the chain this node publishes to IPNI. It
+// follows the same steps as the IPNI publisher, which only appends
+// advertisements for new content, and also appends removals. It is the only
+// writer of the chain, and serialises appends so that it is safe for
+// concurrent use.
+type adChain struct {
+	key           crypto.PrivKey
+	store         store.PublisherStore
+	topic         string
+	sender        announce.Sender
+	announceAddrs []multiaddr.Multiaddr
+	mutex         sync.Mutex
+}
+
+func newAdChain(key crypto.PrivKey, publisherStore store.PublisherStore, topic string, announceAddr multiaddr.Multiaddr, announceURLs []url.URL) (*adChain, error) {
+	peerID, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating libp2p peer ID from private key: %w", err)
+	}
+	c := &adChain{
+		key:           key,
+		store:         publisherStore,
+		topic:         topic,
+		announceAddrs: []multiaddr.Multiaddr{announceAddr},
+	}
+	if len(announceURLs) > 0 {
+		var urls []*url.URL
+		for _, u := range announceURLs {
+			log.Infof("Announcing new IPNI adverts to: %s", u.String())
+			urls = append(urls, &u)
+		}
+		c.sender, err = httpsender.New(urls, peerID)
+		if err != nil {
+			return nil, fmt.Errorf("creating HTTP announce sender: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Publish appends an advertisement of the digests under the context ID and
+// announces it. It returns [ipnipub.ErrAlreadyAdvertised] if the context ID is
+// already advertised with the same metadata.
+func (c *adChain) Publish(ctx context.Context, provider peer.AddrInfo, contextID string, digests iter.Seq[multihash.Multihash], meta ipnimd.Metadata) (ipld.Link, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.publish(ctx, provider, []byte(contextID), digests, meta, true)
+}
+
+// batchEntry is a blob to advertise under the context ID of the claim it is
+// advertised for, with the metadata of the claim.
+type batchEntry struct {
+	contextID []byte
+	digest    multihash.Multihash
+	meta      ipnimd.Metadata
+}
+
+// PublishBatch appends an advertisement for each entry, each under its own
+// context ID and carrying its own metadata, without announcing them, so that
+// the caller can announce the head once. Entries that are already advertised
+// with the same metadata are skipped. It returns the error for each entry that
+// could not be advertised, indexed as the entries.
+func (c *adChain) PublishBatch(ctx context.Context, provider peer.AddrInfo, entries []batchEntry) []error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	errs := make([]error, len(entries))
+	for i, e := range entries {
+		_, err := c.publish(ctx, provider, e.contextID, slices.Values([]multihash.Multihash{e.digest}), e.meta, false)
+		if err != nil && !errors.Is(err, ipnipub.ErrAlreadyAdvertised) {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// publish appends an advertisement of the digests under the context ID. The
+// caller must hold the mutex.
+func (c *adChain) publish(ctx context.Context, provider peer.AddrInfo, contextID []byte, digests iter.Seq[multihash.Multihash], meta ipnimd.Metadata, announce bool) (ipld.Link, error) {
+	entries, err := c.store.ChunkLinkForProviderAndContextID(ctx, provider.ID, contextID)
+	if err != nil && !store.IsNotFound(err) {
+		return nil, fmt.Errorf("getting entries for context ID: %w", err)
+	}
+	if entries == nil {
+		entries, err = c.store.PutEntries(ctx, digests)
+		if err != nil {
+			return nil, fmt.Errorf("storing entries: %w", err)
+		}
+		if entries == nil {
+			entries = schema.NoEntries
+		}
+		err = c.store.PutChunkLinkForProviderAndContextID(ctx, provider.ID, contextID, entries)
+		if err != nil {
+			return nil, fmt.Errorf("storing entries for context ID: %w", err)
+		}
+	} else {
+		prev, err := c.store.MetadataForProviderAndContextID(ctx, provider.ID, contextID)
+		if err != nil && !store.IsNotFound(err) {
+			return nil, fmt.Errorf("getting metadata for context ID: %w", err)
+		}
+		if meta.Equal(prev) {
+			return nil, ipnipub.ErrAlreadyAdvertised
+		}
+		// same entries with new metadata are advertised again
+	}
+	err = c.store.PutMetadataForProviderAndContextID(ctx, provider.ID, contextID, meta)
+	if err != nil {
+		return nil, fmt.Errorf("storing metadata for context ID: %w", err)
+	}
+
+	return c.append(ctx, provider, contextID, entries, meta, false, announce)
+}
+
+// Retract appends a removal advertisement for the context ID and announces it.
+// It returns [ErrNotAdvertised] if the context ID is not advertised.
+func (c *adChain) Retract(ctx context.Context, provider peer.AddrInfo, contextID []byte) (ipld.Link, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, err := c.store.ChunkLinkForProviderAndContextID(ctx, provider.ID, contextID)
+	if err != nil {
+		if store.IsNotFound(err) {
+			return nil, ErrNotAdvertised
+		}
+		return nil, fmt.Errorf("getting entries for context ID: %w", err)
+	}
+
+	err = c.store.DeleteChunkLinkForProviderAndContextID(ctx, provider.ID, contextID)
+	if err != nil {
+		return nil, fmt.Errorf("deleting entries for context ID: %w", err)
+	}
+	err = c.store.DeleteMetadataForProviderAndContextID(ctx, provider.ID, contextID)
+	if err != nil {
+		return nil, fmt.Errorf("deleting metadata for context ID: %w", err)
+	}
+
+	// removal adverts have no entries, but still require valid metadata
+	return c.append(ctx, provider, contextID, schema.NoEntries, ipnimd.Default.New(), true, true)
+}
+
+// append links a new advertisement to the head of the chain, signs and stores
+// it, and makes it the new head. The caller must hold the mutex.
+func (c *adChain) append(ctx context.Context, provider peer.AddrInfo, contextID []byte, entries ipld.Link, meta ipnimd.Metadata, isRm bool, announce bool) (ipld.Link, error) {
+	mdBytes, err := meta.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("encoding metadata: %w", err)
+	}
+
+	var addrs []string
+	for _, addr := range provider.Addrs {
+		addrs = append(addrs, addr.String())
+	}
+
+	adv := schema.Advertisement{
+		Provider:  provider.ID.String(),
+		Addresses: addrs,
+		Entries:   entries,
+		ContextID: contextID,
+		Metadata:  mdBytes,
+		IsRm:      isRm,
+	}
+
+	prevHead, err := c.store.Head(ctx)
+	if err != nil && !store.IsNotFound(err) {
+		return nil, fmt.Errorf("getting latest advertisement: %w", err)
+	}
+	if prevHead != nil {
+		adv.PreviousID = prevHead.Head
+	}
+
+	err = adv.Sign(c.key)
+	if err != nil {
+		return nil, fmt.Errorf("signing advertisement: %w", err)
+	}
+	err = adv.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("validating advertisement: %w", err)
+	}
+
+	lnk, err := c.store.PutAdvert(ctx, adv)
+	if err != nil {
+		return nil, fmt.Errorf("storing advertisement: %w", err)
+	}
+	hd, err := head.NewSignedHead(lnk.(cidlink.Link).Cid, c.topic, c.key)
+	if err != nil {
+		return nil, fmt.Errorf("signing head: %w", err)
+	}
+	_, err = c.store.PutHead(ctx, hd)
+	if err != nil {
+		return nil, fmt.Errorf("updating head: %w", err)
+	}
+
+	if announce {
+		if err := c.announce(ctx, lnk); err != nil {
+			log.Errorw("Failed to announce advertisement", "err", err)
+		}
+	}
+	return lnk, nil
+}
+
+// announceHead announces the current head of the chain to indexers, if direct
+// announcements are configured.
+func (c *adChain) announceHead(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.sender == nil {
+		return nil
+	}
+	hd, err := c.store.Head(ctx)
+	if err != nil {
+		return fmt.Errorf("getting latest advertisement: %w", err)
+	}
+	return c.announce(ctx, hd.Head)
+}
+
+func (c *adChain) announce(ctx context.Context, lnk ipld.Link) error {
+	if c.sender == nil {
+		return nil
+	}
+	err := announce.Send(ctx, lnk.(cidlink.Link).Cid, c.announceAddrs, c.sender)
+	if err != nil {
+		return fmt.Errorf("announcing advertisement: %w", err)
+	}
+	return nil
+}
+
+var _ ipnipub.Publisher = (*adChain)(nil)
@@ -2,9 +2,12 @@ package publisher
 
 import (
 	"context"
+	"io"
 
+	"github.com/multiformats/go-multihash"
 	"github.com/storacha/go-libstoracha/ipnipublisher/store"
 	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
 )
 
 type Publisher interface {
@@ -13,4 +16,20 @@ type Publisher interface {
 	// Publish advertises content claims/commitments found on this node to the
 	// storacha network.
 	Publish(context.Context, delegation.Delegation) error
+	// Retract publishes a removal advertisement for the location commitments
+	// made for a blob in a space, so that indexers stop directing clients to
+	// this node for it. It is not an error to retract content that was never
+	// advertised.
+	Retract(ctx context.Context, space did.DID, digest multihash.Multihash) error
+	// RetractEquals publishes a removal advertisement for the equals claims
+	// made for a blob, once it is no longer stored by this node. It is not an
+	// error to retract content that was never advertised.
+	RetractEquals(ctx context.Context, digest multihash.Multihash) error
+}
+
+// BlobGetter reads blobs stored on this node. It is used to read the sharded
+// DAG index referenced by an index claim.
+type BlobGetter interface {
+	// Get returns the bytes of the blob identified by the passed digest.
+	Get(ctx context.Context, digest multihash.Multihash) (io.ReadCloser, error)
 }
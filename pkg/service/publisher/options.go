@@ -1,7 +1,9 @@
 package publisher
 
 import (
+	"database/sql"
 	"net/url"
+	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/multiformats/go-multiaddr"
@@ -17,6 +19,11 @@ type options struct {
 	announceURLs          []url.URL
 	indexingService       client.Connection
 	indexingServiceProofs delegation.Proofs
+	blobs                 BlobGetter
+	batchDB               *sql.DB
+	batchWindow           time.Duration
+	batchSize             int
+	topic                 string
 }
 
 type Option func(*options) error
@@ -30,6 +37,15 @@ func WithAnnounceAddress(addr multiaddr.Multiaddr) Option {
 	}
 }
 
+// WithIngestTopic sets the topic signed into the head of the advertisement
+// chain. It defaults to [DefaultIngestTopic].
+func WithIngestTopic(topic string) Option {
+	return func(o *options) error {
+		o.topic = topic
+		return nil
+	}
+}
+
 // WithBlobAddress sets a custom address to tell indexers where to fetch blobs from
 func WithBlobAddress(addr multiaddr.Multiaddr) Option {
 	return func(o *options) error {
@@ -77,6 +93,44 @@ func WithIndexingServiceProof(proof ...delegation.Proof) Option {
 	}
 }
 
+// WithBlobGetter sets the source that index blobs are read from when
+// publishing index claims.
+func WithBlobGetter(blobs BlobGetter) Option {
+	return func(opts *options) error {
+		opts.blobs = blobs
+		return nil
+	}
+}
+
+// WithBatchDatabase enables batching of location commitment advertisements.
+// Pending location commitments are persisted in the passed database, so that
+// they are advertised after a restart.
+func WithBatchDatabase(db *sql.DB) Option {
+	return func(opts *options) error {
+		opts.batchDB = db
+		return nil
+	}
+}
+
+// WithBatchWindow sets the maximum time a location commitment is held before
+// it is advertised. It has no effect unless batching is enabled.
+func WithBatchWindow(window time.Duration) Option {
+	return func(opts *options) error {
+		opts.batchWindow = window
+		return nil
+	}
+}
+
+// WithBatchSize sets the number of pending location commitments that causes
+// a batch to be advertised before the window has passed. It has no effect
+// unless batching is enabled.
+func WithBatchSize(size int) Option {
+	return func(opts *options) error {
+		opts.batchSize = size
+		return nil
+	}
+}
+
 // WithLogLevel changes the log level for the publisher subsystem.
 func WithLogLevel(level string) Option {
 	return func(c *options) error {
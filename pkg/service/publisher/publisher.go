@@ -12,6 +12,7 @@ import (
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	ipnimd "github.com/ipni/go-libipni/metadata"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
@@ -30,6 +31,9 @@ import (
 	"github.com/storacha/go-ucanto/principal"
 
 	"github.com/storacha/go-libstoracha/advertisement"
+
+	"github.com/storacha/piri/pkg/blobindex"
+	"github.com/storacha/piri/pkg/internal/digestutil"
 )
 
 var log = logging.Logger("publisher")
@@ -41,6 +45,9 @@ type PublisherService struct {
 	provider              peer.AddrInfo
 	indexingService       client.Connection
 	indexingServiceProofs delegation.Proofs
+	blobs                 BlobGetter
+	chain                 *adChain
+	batch                 *batcher
 	mutex                 sync.Mutex
 }
 
@@ -52,16 +59,64 @@ func (pub *PublisherService) Publish(ctx context.Context, claim delegation.Deleg
 	ability := claim.Capabilities()[0].Can()
 	switch ability {
 	case assert.LocationAbility:
+		if pub.batch != nil {
+			return pub.batch.add(ctx, claim)
+		}
 		err := PublishLocationCommitment(ctx, &pub.mutex, pub.publisher, pub.provider, claim)
 		if err != nil {
 			return err
 		}
 		return CacheClaim(ctx, pub.id, pub.indexingService, pub.indexingServiceProofs, claim, pub.provider.Addrs)
+	case assert.EqualsAbility:
+		err := PublishEqualsClaim(ctx, &pub.mutex, pub.publisher, pub.provider, claim)
+		if err != nil {
+			return err
+		}
+		return CacheClaim(ctx, pub.id, pub.indexingService, pub.indexingServiceProofs, claim, pub.provider.Addrs)
+	case assert.IndexAbility:
+		index, err := pub.readIndex(ctx, claim)
+		if err != nil {
+			return err
+		}
+		err = PublishIndexClaim(ctx, &pub.mutex, pub.publisher, pub.provider, claim, index)
+		if err != nil {
+			return err
+		}
+		return CacheClaim(ctx, pub.id, pub.indexingService, pub.indexingServiceProofs, claim, pub.provider.Addrs)
 	default:
 		return fmt.Errorf("unknown claim: %s", ability)
 	}
 }
 
+// readIndex reads and parses the sharded DAG index referenced by an index
+// claim from the blobs stored on this node.
+func (pub *PublisherService) readIndex(ctx context.Context, indexClaim delegation.Delegation) (blobindex.ShardedDagIndex, error) {
+	if pub.blobs == nil {
+		return blobindex.ShardedDagIndex{}, errors.New("cannot read index - blob getter is not configured")
+	}
+
+	nb, rerr := assert.IndexCaveatsReader.Read(indexClaim.Capabilities()[0].Nb())
+	if rerr != nil {
+		return blobindex.ShardedDagIndex{}, fmt.Errorf("reading index claim data: %w", rerr)
+	}
+
+	digest := asCID(nb.Index).Hash()
+	body, err := pub.blobs.Get(ctx, digest)
+	if err != nil {
+		return blobindex.ShardedDagIndex{}, fmt.Errorf("getting index blob: %s: %w", digestutil.Format(digest), err)
+	}
+	defer body.Close()
+
+	index, err := blobindex.Extract(body)
+	if err != nil {
+		return blobindex.ShardedDagIndex{}, fmt.Errorf("extracting index: %s: %w", digestutil.Format(digest), err)
+	}
+	if index.Content.String() != nb.Content.String() {
+		return blobindex.ShardedDagIndex{}, fmt.Errorf("index content %s does not match claimed content %s", index.Content, nb.Content)
+	}
+	return index, nil
+}
+
 func PublishLocationCommitment(
 	ctx context.Context,
 	mutex *sync.Mutex,
@@ -71,16 +126,40 @@ func PublishLocationCommitment(
 ) error {
 	log := log.With("claim", locationCommitment.Link())
 
+	contextid, digest, meta, err := locationCommitmentAdvert(provider, locationCommitment)
+	if err != nil {
+		return err
+	}
+	digests := []multihash.Multihash{digest}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	adlink, err := publisher.Publish(ctx, provider, string(contextid), slices.Values(digests), meta)
+	if err != nil {
+		if errors.Is(err, ipnipub.ErrAlreadyAdvertised) {
+			log.Warnf("Skipping previously published claim")
+			return nil
+		}
+		return fmt.Errorf("publishing claim: %w", err)
+	}
+
+	log.Infof("Published advertisement: %s", adlink)
+	return nil
+}
+
+// locationCommitmentAdvert returns the context ID, the blob digest and the
+// metadata that a location commitment is advertised with.
+func locationCommitmentAdvert(provider peer.AddrInfo, locationCommitment delegation.Delegation) ([]byte, multihash.Multihash, ipnimd.Metadata, error) {
 	capability := locationCommitment.Capabilities()[0]
 	nb, rerr := assert.LocationCaveatsReader.Read(capability.Nb())
 	if rerr != nil {
-		return fmt.Errorf("reading location commitment data: %w", rerr)
+		return nil, nil, ipnimd.Metadata{}, fmt.Errorf("reading location commitment data: %w", rerr)
 	}
 
-	digests := []multihash.Multihash{nb.Content.Hash()}
 	contextid, err := advertisement.EncodeContextID(nb.Space, nb.Content.Hash())
 	if err != nil {
-		return fmt.Errorf("encoding advertisement context ID: %w", err)
+		return nil, nil, ipnimd.Metadata{}, fmt.Errorf("encoding advertisement context ID: %w", err)
 	}
 
 	var exp int
@@ -90,7 +169,7 @@ func PublishLocationCommitment(
 
 	shardCid, err := advertisement.ShardCID(provider, nb)
 	if err != nil {
-		return fmt.Errorf("failed to extract shard CID for provider: %s locationCommitment %s: %w", provider, capability, err)
+		return nil, nil, ipnimd.Metadata{}, fmt.Errorf("failed to extract shard CID for provider: %s locationCommitment %s: %w", provider, capability, err)
 	}
 
 	meta := metadata.MetadataContext.New(
@@ -100,6 +179,97 @@ func PublishLocationCommitment(
 			Expiration: int64(exp),
 		},
 	)
+	return contextid, nb.Content.Hash(), meta, nil
+}
+
+// PublishEqualsClaim advertises an assert/equals claim to IPNI. The advert
+// contains both the content multihash and the multihash of the equivalent CID,
+// so that the claim can be found by either of them.
+func PublishEqualsClaim(
+	ctx context.Context,
+	mutex *sync.Mutex,
+	publisher ipnipub.Publisher,
+	provider peer.AddrInfo,
+	equalsClaim delegation.Delegation,
+) error {
+	log := log.With("claim", equalsClaim.Link())
+
+	capability := equalsClaim.Capabilities()[0]
+	nb, rerr := assert.EqualsCaveatsReader.Read(capability.Nb())
+	if rerr != nil {
+		return fmt.Errorf("reading equals claim data: %w", rerr)
+	}
+
+	equals := asCID(nb.Equals)
+	digests := []multihash.Multihash{nb.Content.Hash(), equals.Hash()}
+	contextid := nb.Content.Hash()
+
+	var exp int
+	if equalsClaim.Expiration() != nil {
+		exp = *equalsClaim.Expiration()
+	}
+
+	meta := metadata.MetadataContext.New(
+		&metadata.EqualsClaimMetadata{
+			Equals:     equals,
+			Claim:      asCID(equalsClaim.Link()),
+			Expiration: int64(exp),
+		},
+	)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	adlink, err := publisher.Publish(ctx, provider, string(contextid), slices.Values(digests), meta)
+	if err != nil {
+		if errors.Is(err, ipnipub.ErrAlreadyAdvertised) {
+			log.Warnf("Skipping previously published claim")
+			return nil
+		}
+		return fmt.Errorf("publishing claim: %w", err)
+	}
+
+	log.Infof("Published advertisement: %s", adlink)
+	return nil
+}
+
+// PublishIndexClaim advertises an assert/index claim to IPNI. The advert
+// contains the multihash of every block in the index, so that the content can
+// be found by the CID of any of its blocks.
+func PublishIndexClaim(
+	ctx context.Context,
+	mutex *sync.Mutex,
+	publisher ipnipub.Publisher,
+	provider peer.AddrInfo,
+	indexClaim delegation.Delegation,
+	index blobindex.ShardedDagIndex,
+) error {
+	log := log.With("claim", indexClaim.Link())
+
+	capability := indexClaim.Capabilities()[0]
+	nb, rerr := assert.IndexCaveatsReader.Read(capability.Nb())
+	if rerr != nil {
+		return fmt.Errorf("reading index claim data: %w", rerr)
+	}
+
+	digests := index.Digests()
+	if len(digests) == 0 {
+		return errors.New("index does not contain any blocks")
+	}
+	contextid := asCID(nb.Index).Bytes()
+
+	var exp int
+	if indexClaim.Expiration() != nil {
+		exp = *indexClaim.Expiration()
+	}
+
+	meta := metadata.MetadataContext.New(
+		&metadata.IndexClaimMetadata{
+			Index:      asCID(nb.Index),
+			Claim:      asCID(indexClaim.Link()),
+			Expiration: int64(exp),
+		},
+	)
 
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -182,7 +352,7 @@ func CacheClaim(
 	return result.MatchResultR1(
 		rcpt.Out(),
 		func(ok ok.Unit) error {
-			log.Info("Cached location commitment with indexing service")
+			log.Info("Cached claim with indexing service")
 			return nil
 		},
 		func(node ipld.Node) error {
@@ -242,12 +412,11 @@ func New(
 		announceAddr = publicAddr
 	}
 
-	ipnipubOpts := []ipnipub.Option{ipnipub.WithAnnounceAddrs(announceAddr.String())}
-	for _, u := range o.announceURLs {
-		log.Infof("Announcing new IPNI adverts to: %s", u.String())
-		ipnipubOpts = append(ipnipubOpts, ipnipub.WithDirectAnnounce(u.String()))
+	topic := o.topic
+	if topic == "" {
+		topic = DefaultIngestTopic
 	}
-	publisher, err := ipnipub.New(priv, publisherStore, ipnipubOpts...)
+	chain, err := newAdChain(priv, publisherStore, topic, announceAddr, o.announceURLs)
 	if err != nil {
 		return nil, fmt.Errorf("creating IPNI publisher instance: %w", err)
 	}
@@ -273,13 +442,32 @@ func New(
 		log.Errorf("Indexing service is not configured - claims will not be cached")
 	}
 
+	var batch *batcher
+	if o.batchDB != nil {
+		window := o.batchWindow
+		if window <= 0 {
+			window = DefaultBatchWindow
+		}
+		size := o.batchSize
+		if size <= 0 {
+			size = DefaultBatchSize
+		}
+		batch, err = newBatcher(o.batchDB, window, size)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &PublisherService{
 		id:                    id,
 		store:                 publisherStore,
-		publisher:             publisher,
+		publisher:             chain,
 		provider:              provInfo,
 		indexingService:       o.indexingService,
 		indexingServiceProofs: o.indexingServiceProofs,
+		blobs:                 o.blobs,
+		chain:                 chain,
+		batch:                 batch,
 	}, nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sync"
 	"testing"
 
 	"github.com/ipfs/go-datastore"
@@ -96,6 +97,226 @@ func TestPublisherService(t *testing.T) {
 		require.Equal(t, shard, ents[0])
 	})
 
+	t.Run("publishes equals claims", func(t *testing.T) {
+		dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+		publisherStore := store.FromDatastore(dstore, store.WithMetadataContext(metadata.MetadataContext))
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithLogLevel("info"))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		digest := testutil.RandomMultihash(t)
+		piece := testutil.RandomCID(t)
+
+		claim, err := assert.Equals.Delegate(
+			testutil.Alice,
+			space,
+			testutil.Alice.DID().String(),
+			assert.EqualsCaveats{
+				Content: types.FromHash(digest),
+				Equals:  piece,
+			},
+			delegation.WithNoExpiration(),
+		)
+		require.NoError(t, err)
+
+		err = svc.Publish(ctx, claim)
+		require.NoError(t, err)
+
+		hd, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+
+		ad, err := publisherStore.Advert(ctx, hd.Head)
+		require.NoError(t, err)
+
+		meta := metadata.MetadataContext.New()
+		err = meta.UnmarshalBinary(ad.Metadata)
+		require.NoError(t, err)
+
+		protocol := meta.Get(metadata.EqualsClaimID)
+		require.NotNil(t, protocol)
+
+		eqmeta, ok := protocol.(*metadata.EqualsClaimMetadata)
+		require.True(t, ok)
+
+		require.Equal(t, claim.Link().String(), eqmeta.Claim.String())
+		require.Equal(t, piece.String(), eqmeta.Equals.String())
+
+		var ents []multihash.Multihash
+		for digest, err := range publisherStore.Entries(ctx, ad.Entries) {
+			require.NoError(t, err)
+			ents = append(ents, digest)
+		}
+		require.ElementsMatch(t, []multihash.Multihash{digest, asCID(piece).Hash()}, ents)
+	})
+
+	t.Run("retracts location commitments", func(t *testing.T) {
+		dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+		publisherStore := store.FromDatastore(dstore, store.WithMetadataContext(metadata.MetadataContext))
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithLogLevel("info"))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		shard := testutil.RandomMultihash(t)
+		location := testutil.Must(url.Parse(fmt.Sprintf("http://localhost:3000/blob/%s", digestutil.Format(shard))))(t)
+
+		claim, err := assert.Location.Delegate(
+			testutil.Alice,
+			space,
+			testutil.Alice.DID().String(),
+			assert.LocationCaveats{
+				Space:    space,
+				Content:  types.FromHash(shard),
+				Location: []url.URL{*location},
+			},
+			delegation.WithNoExpiration(),
+		)
+		require.NoError(t, err)
+
+		err = svc.Publish(ctx, claim)
+		require.NoError(t, err)
+
+		published, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+
+		err = svc.Retract(ctx, space, shard)
+		require.NoError(t, err)
+
+		hd, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+
+		ad, err := publisherStore.Advert(ctx, hd.Head)
+		require.NoError(t, err)
+		require.True(t, ad.IsRm)
+		require.Equal(t, published.Head, ad.PreviousID)
+		require.Equal(
+			t,
+			testutil.Must(advertisement.EncodeContextID(space, shard))(t),
+			ad.ContextID,
+		)
+
+		// retracting again does nothing
+		err = svc.Retract(ctx, space, shard)
+		require.NoError(t, err)
+		again, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, hd.Head, again.Head)
+
+		// the claim can be published again after it was retracted
+		err = svc.Publish(ctx, claim)
+		require.NoError(t, err)
+		republished, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+		require.NotEqual(t, hd.Head, republished.Head)
+	})
+
+	t.Run("retracts equals claims", func(t *testing.T) {
+		dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+		publisherStore := store.FromDatastore(dstore, store.WithMetadataContext(metadata.MetadataContext))
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithLogLevel("info"))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		digest := testutil.RandomMultihash(t)
+		claim, err := assert.Equals.Delegate(
+			testutil.Alice,
+			space,
+			testutil.Alice.DID().String(),
+			assert.EqualsCaveats{
+				Content: types.FromHash(digest),
+				Equals:  testutil.RandomCID(t),
+			},
+			delegation.WithNoExpiration(),
+		)
+		require.NoError(t, err)
+
+		err = svc.Publish(ctx, claim)
+		require.NoError(t, err)
+		published, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+
+		err = svc.RetractEquals(ctx, digest)
+		require.NoError(t, err)
+
+		hd, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+		ad, err := publisherStore.Advert(ctx, hd.Head)
+		require.NoError(t, err)
+		require.True(t, ad.IsRm)
+		require.Equal(t, published.Head, ad.PreviousID)
+		require.Equal(t, []byte(digest), ad.ContextID)
+
+		// retracting again does nothing
+		err = svc.RetractEquals(ctx, digest)
+		require.NoError(t, err)
+		again, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, hd.Head, again.Head)
+	})
+
+	t.Run("links concurrent publications and retractions in one chain", func(t *testing.T) {
+		dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+		publisherStore := store.FromDatastore(dstore, store.WithMetadataContext(metadata.MetadataContext))
+
+		svc, err := New(testutil.Alice, publisherStore, addr, WithLogLevel("info"))
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		var claims []delegation.Delegation
+		var shards []multihash.Multihash
+		for range 10 {
+			shard := testutil.RandomMultihash(t)
+			location := testutil.Must(url.Parse(fmt.Sprintf("http://localhost:3000/blob/%s", digestutil.Format(shard))))(t)
+			claim, err := assert.Location.Delegate(
+				testutil.Alice,
+				space,
+				testutil.Alice.DID().String(),
+				assert.LocationCaveats{
+					Space:    space,
+					Content:  types.FromHash(shard),
+					Location: []url.URL{*location},
+				},
+				delegation.WithNoExpiration(),
+			)
+			require.NoError(t, err)
+			require.NoError(t, svc.Publish(ctx, claim))
+			claims = append(claims, claim)
+			shards = append(shards, shard)
+		}
+
+		var wg sync.WaitGroup
+		for i := range claims {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if i%2 == 0 {
+					require.NoError(t, svc.Retract(ctx, space, shards[i]))
+				} else {
+					require.NoError(t, svc.Publish(ctx, claims[i]))
+				}
+			}()
+		}
+		wg.Wait()
+
+		// 10 publications and 5 retractions, since republishing is a no-op
+		hd, err := publisherStore.Head(ctx)
+		require.NoError(t, err)
+		removals := 0
+		ads := 0
+		for lnk := hd.Head; lnk != nil; ads++ {
+			ad, err := publisherStore.Advert(ctx, lnk)
+			require.NoError(t, err)
+			if ad.IsRm {
+				removals++
+			}
+			lnk = ad.PreviousID
+		}
+		require.Equal(t, 15, ads)
+		require.Equal(t, 5, removals)
+	})
+
 	t.Run("allow skip publish existing advert", func(t *testing.T) {
 		dstore := dssync.MutexWrap(datastore.NewMapDatastore())
 		publisherStore := store.FromDatastore(dstore, store.WithMetadataContext(metadata.MetadataContext))
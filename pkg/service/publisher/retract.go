@@ -0,0 +1,65 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/advertisement"
+	"github.com/storacha/go-ucanto/did"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+)
+
+// ErrNotAdvertised is returned when retracting content that has no current
+// advertisement.
+var ErrNotAdvertised = errors.New("content is not advertised")
+
+func (pub *PublisherService) Retract(ctx context.Context, space did.DID, digest multihash.Multihash) error {
+	contextid, err := advertisement.EncodeContextID(space, digest)
+	if err != nil {
+		return fmt.Errorf("encoding advertisement context ID: %w", err)
+	}
+	log := log.With("space", space, "blob", digestutil.Format(digest))
+
+	if pub.batch != nil {
+		// wait for a flush in progress, so that a commitment it has already
+		// read is not advertised after it is retracted
+		pub.batch.flushMu.Lock()
+		defer pub.batch.flushMu.Unlock()
+		if err := pub.batch.remove(ctx, contextid); err != nil {
+			return err
+		}
+	}
+
+	adlink, err := pub.chain.Retract(ctx, pub.provider, contextid)
+	if err != nil {
+		if errors.Is(err, ErrNotAdvertised) {
+			log.Warnf("Skipping retraction of content that is not advertised")
+			return nil
+		}
+		return fmt.Errorf("retracting advertisement: %w", err)
+	}
+
+	log.Infof("Published removal advertisement: %s", adlink)
+	return nil
+}
+
+func (pub *PublisherService) RetractEquals(ctx context.Context, digest multihash.Multihash) error {
+	log := log.With("blob", digestutil.Format(digest))
+
+	// equals claims are advertised under the content digest, see
+	// [PublishEqualsClaim]
+	adlink, err := pub.chain.Retract(ctx, pub.provider, digest)
+	if err != nil {
+		if errors.Is(err, ErrNotAdvertised) {
+			log.Warnf("Skipping retraction of equals claim that is not advertised")
+			return nil
+		}
+		return fmt.Errorf("retracting advertisement: %w", err)
+	}
+
+	log.Infof("Published removal advertisement: %s", adlink)
+	return nil
+}
@@ -0,0 +1,59 @@
+package renewer
+
+import (
+	"errors"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+)
+
+type options struct {
+	interval    time.Duration
+	renewBefore time.Duration
+	locks       *digestutil.Locks
+}
+
+type Option func(*options) error
+
+// WithInterval configures how often location claims are checked for renewal.
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) error {
+		if interval <= 0 {
+			return errors.New("renewal interval must be greater than zero")
+		}
+		o.interval = interval
+		return nil
+	}
+}
+
+// WithRenewBefore configures how long before they expire location claims are
+// renewed. It must be shorter than the location claim expiration.
+func WithRenewBefore(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return errors.New("renewal window must be greater than zero")
+		}
+		o.renewBefore = d
+		return nil
+	}
+}
+
+// WithBlobLocks configures the locks that are held on a blob while its
+// location claims are renewed. They should be shared with the garbage
+// collector, so that claims are not renewed for a blob as it is removed.
+func WithBlobLocks(locks *digestutil.Locks) Option {
+	return func(o *options) error {
+		o.locks = locks
+		return nil
+	}
+}
+
+// WithLogLevel changes the log level for the renewer subsystem.
+func WithLogLevel(level string) Option {
+	return func(o *options) error {
+		logging.SetLogLevel("renewer", level)
+		return nil
+	}
+}
@@ -0,0 +1,280 @@
+package renewer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/storacha/go-ucanto/ucan"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/pdp"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/claims"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/claimstore"
+)
+
+var log = logging.Logger("renewer")
+
+const (
+	// DefaultInterval is the default time between renewal passes.
+	DefaultInterval = time.Hour
+	// DefaultRenewBefore is the default time before they expire that location
+	// claims are renewed.
+	DefaultRenewBefore = 24 * time.Hour
+)
+
+type Renewer interface {
+	// Renew performs a single renewal pass, re-issuing the location claims
+	// that expire within the renewal window. Renewed claims are stored,
+	// published to IPNI and cached with the indexing service, and the claims
+	// they replace are removed.
+	Renew(context.Context) error
+}
+
+// Service periodically renews the location claims issued by this node before
+// they expire. Claims are only renewed while the space still has a live
+// allocation for the blob and the blob is still stored here, and the claims
+// for data that was removed are left to expire.
+type Service struct {
+	id          principal.Signer
+	pdp         pdp.PDP
+	blobs       blobs.Blobs
+	claims      claims.Claims
+	locks       *digestutil.Locks
+	lister      claimstore.ExpiryLister
+	expiration  time.Duration
+	renewBefore time.Duration
+	interval    time.Duration
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+var _ Renewer = (*Service)(nil)
+
+// New creates a renewer for the location claims issued by this node. Location
+// claims must be configured to expire, and the claim store must implement
+// [claimstore.ExpiryLister] so that expiring claims can be found. When the
+// default renewal window is not shorter than the expiration, claims are
+// renewed half way through their validity instead. When PDP is configured,
+// blobs are looked up as pieces rather than in the blob store.
+func New(id principal.Signer, p pdp.PDP, b blobs.Blobs, c claims.Claims, opts ...Option) (*Service, error) {
+	expiration := c.LocationClaimExpiration()
+	if expiration <= 0 {
+		return nil, errors.New("location claims are not configured to expire")
+	}
+
+	o := &options{interval: DefaultInterval}
+	for _, opt := range opts {
+		err := opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.renewBefore == 0 {
+		o.renewBefore = DefaultRenewBefore
+		if o.renewBefore >= expiration {
+			o.renewBefore = expiration / 2
+		}
+	}
+	if o.renewBefore >= expiration {
+		return nil, fmt.Errorf("renewal window %s must be shorter than the location claim expiration %s", o.renewBefore, expiration)
+	}
+
+	lister, ok := c.Store().(claimstore.ExpiryLister)
+	if !ok {
+		return nil, errors.New("claim store does not support listing claims by expiration")
+	}
+	if o.locks == nil {
+		o.locks = &digestutil.Locks{}
+	}
+
+	return &Service{
+		id:          id,
+		pdp:         p,
+		blobs:       b,
+		claims:      c,
+		locks:       o.locks,
+		lister:      lister,
+		expiration:  expiration,
+		renewBefore: o.renewBefore,
+		interval:    o.interval,
+	}, nil
+}
+
+func (s *Service) Renew(ctx context.Context) error {
+	now := time.Now()
+	expiring, err := s.lister.ListExpiring(ctx, int(now.Add(s.renewBefore).Unix()))
+	if err != nil {
+		return fmt.Errorf("listing expiring location claims: %w", err)
+	}
+
+	var errs error
+	renewed := 0
+	for _, l := range expiring {
+		ok, err := s.renewClaim(ctx, l, now)
+		if err != nil {
+			log.Errorw("renewing location claim", "claim", l, "error", err)
+			errs = errors.Join(errs, fmt.Errorf("renewing location claim %s: %w", l, err))
+			continue
+		}
+		if ok {
+			renewed++
+		}
+	}
+	if renewed > 0 {
+		log.Infow("renewed location claims", "count", renewed)
+	}
+	return errs
+}
+
+// renewClaim re-issues the location claim with a new expiration. It reports
+// false if the claim was not issued by this node, or its blob is no longer
+// stored, and so is not renewed.
+func (s *Service) renewClaim(ctx context.Context, link ucan.Link, now time.Time) (bool, error) {
+	claim, err := s.claims.Store().Get(ctx, link)
+	if err != nil {
+		return false, fmt.Errorf("getting location claim: %w", err)
+	}
+	if claim.Issuer().DID() != s.id.DID() {
+		log.Warnw("skipping renewal of location claim issued by another node", "claim", link, "issuer", claim.Issuer().DID())
+		return false, nil
+	}
+
+	nb, err := assert.LocationCaveatsReader.Read(claim.Capabilities()[0].Nb())
+	if err != nil {
+		return false, fmt.Errorf("reading location claim: %w", err)
+	}
+
+	// the blob is held until renewal is done, so it cannot be collected and
+	// its claims removed part way through
+	unlock := s.locks.Lock(nb.Content.Hash())
+	defer unlock()
+
+	ok, err := s.stored(ctx, nb.Space, nb.Content.Hash(), now)
+	if err != nil {
+		return false, fmt.Errorf("checking blob is stored: %w", err)
+	}
+	if !ok {
+		log.Warnw("skipping renewal of location claim for blob that is no longer stored", "claim", link, "blob", digestutil.Format(nb.Content.Hash()))
+		return false, nil
+	}
+
+	renewed, err := assert.Location.Delegate(
+		s.id,
+		claim.Audience(),
+		s.id.DID().String(),
+		nb,
+		delegation.WithExpiration(int(now.Add(s.expiration).Unix())),
+	)
+	if err != nil {
+		return false, fmt.Errorf("creating location commitment: %w", err)
+	}
+
+	err = s.claims.Store().Put(ctx, renewed)
+	if err != nil {
+		return false, fmt.Errorf("putting renewed location claim: %w", err)
+	}
+
+	// publishing replaces the advertised claim and caches the renewed claim
+	// with the indexing service
+	err = s.claims.Publisher().Publish(ctx, renewed)
+	if err != nil {
+		// remove the renewed claim so the original is renewed on the next pass
+		if derr := s.claims.Store().Delete(ctx, renewed.Link()); derr != nil {
+			log.Errorw("removing unpublished location claim", "claim", renewed.Link(), "error", derr)
+		}
+		return false, fmt.Errorf("publishing renewed location claim: %w", err)
+	}
+
+	err = s.claims.Store().Delete(ctx, link)
+	if err != nil {
+		return false, fmt.Errorf("deleting expiring location claim: %w", err)
+	}
+	log.Debugw("renewed location claim", "claim", link, "renewed", renewed.Link())
+	return true, nil
+}
+
+// stored reports whether the space has a live allocation for the blob, and the
+// blob is still held by this node.
+func (s *Service) stored(ctx context.Context, space did.DID, digest multihash.Multihash, now time.Time) (bool, error) {
+	allocs, err := s.blobs.Allocations().List(ctx, digest)
+	if err != nil {
+		return false, fmt.Errorf("listing allocations: %w", err)
+	}
+	var size uint64
+	live := false
+	for _, a := range allocs {
+		if a.Space == space && a.Expires >= uint64(now.Unix()) {
+			size = a.Blob.Size
+			live = true
+			break
+		}
+	}
+	if !live {
+		return false, nil
+	}
+
+	if s.pdp != nil {
+		_, err = s.pdp.PieceFinder().FindPiece(ctx, digest, size)
+	} else {
+		var obj blobstore.Object
+		obj, err = s.blobs.Store().Get(ctx, digest)
+		if err == nil {
+			if c, ok := obj.Body().(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Start begins periodic renewal of location claims.
+func (s *Service) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := s.Renew(ctx)
+				if err != nil {
+					log.Errorf("location claim renewal failed: %s", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends periodic renewal, waiting for any in progress pass to complete.
+func (s *Service) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,260 @@
+package renewer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/publisher"
+	"github.com/storacha/piri/pkg/store/allocationstore"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/claimstore"
+)
+
+func TestRenewer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("renews expiring location claims", func(t *testing.T) {
+		c := newTestClaims(t, 48*time.Hour)
+		r, err := New(testutil.Alice, nil, c.blobs, c)
+		require.NoError(t, err)
+
+		claim := putLocationClaim(t, c, testutil.Alice, time.Hour)
+
+		err = r.Renew(ctx)
+		require.NoError(t, err)
+
+		_, err = c.Store().Get(ctx, claim.Link())
+		require.Error(t, err)
+
+		links, err := c.store.ListExpiring(ctx, int(time.Now().Add(100*time.Hour).Unix()))
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+
+		renewed, err := c.Store().Get(ctx, links[0])
+		require.NoError(t, err)
+		require.Equal(t, claim.Audience().DID(), renewed.Audience().DID())
+		require.InDelta(t, time.Now().Add(48*time.Hour).Unix(), *renewed.Expiration(), 5)
+
+		nb, err := assert.LocationCaveatsReader.Read(renewed.Capabilities()[0].Nb())
+		require.NoError(t, err)
+		orig, err := assert.LocationCaveatsReader.Read(claim.Capabilities()[0].Nb())
+		require.NoError(t, err)
+		require.Equal(t, orig.Space, nb.Space)
+		require.Equal(t, orig.Content.Hash(), nb.Content.Hash())
+		require.Equal(t, orig.Location, nb.Location)
+
+		require.Len(t, c.pub.published, 1)
+		require.Equal(t, renewed.Link(), c.pub.published[0].Link())
+	})
+
+	t.Run("does not renew claims outside the renewal window", func(t *testing.T) {
+		c := newTestClaims(t, 48*time.Hour)
+		r, err := New(testutil.Alice, nil, c.blobs, c)
+		require.NoError(t, err)
+
+		claim := putLocationClaim(t, c, testutil.Alice, 47*time.Hour)
+
+		err = r.Renew(ctx)
+		require.NoError(t, err)
+
+		_, err = c.Store().Get(ctx, claim.Link())
+		require.NoError(t, err)
+		require.Empty(t, c.pub.published)
+	})
+
+	t.Run("skips claims issued by another node", func(t *testing.T) {
+		c := newTestClaims(t, 48*time.Hour)
+		r, err := New(testutil.Alice, nil, c.blobs, c)
+		require.NoError(t, err)
+
+		claim := putLocationClaim(t, c, testutil.Bob, time.Hour)
+
+		err = r.Renew(ctx)
+		require.NoError(t, err)
+
+		_, err = c.Store().Get(ctx, claim.Link())
+		require.NoError(t, err)
+		require.Empty(t, c.pub.published)
+	})
+
+	t.Run("skips claims for blobs the space no longer has an allocation for", func(t *testing.T) {
+		c := newTestClaims(t, 48*time.Hour)
+		r, err := New(testutil.Alice, nil, c.blobs, c)
+		require.NoError(t, err)
+
+		claim := putLocationClaim(t, c, testutil.Alice, time.Hour)
+		nb := testutil.Must(assert.LocationCaveatsReader.Read(claim.Capabilities()[0].Nb()))(t)
+		allocs := testutil.Must(c.blobs.Allocations().List(ctx, nb.Content.Hash()))(t)
+		for _, a := range allocs {
+			require.NoError(t, c.blobs.Allocations().Delete(ctx, a.Blob.Digest, a.Cause))
+		}
+
+		err = r.Renew(ctx)
+		require.NoError(t, err)
+
+		_, err = c.Store().Get(ctx, claim.Link())
+		require.NoError(t, err)
+		require.Empty(t, c.pub.published)
+	})
+
+	t.Run("skips claims for blobs that are no longer stored", func(t *testing.T) {
+		c := newTestClaims(t, 48*time.Hour)
+		r, err := New(testutil.Alice, nil, c.blobs, c)
+		require.NoError(t, err)
+
+		claim := putLocationClaim(t, c, testutil.Alice, time.Hour)
+		nb := testutil.Must(assert.LocationCaveatsReader.Read(claim.Capabilities()[0].Nb()))(t)
+		require.NoError(t, c.blobs.Store().Delete(ctx, nb.Content.Hash()))
+
+		err = r.Renew(ctx)
+		require.NoError(t, err)
+
+		_, err = c.Store().Get(ctx, claim.Link())
+		require.NoError(t, err)
+		require.Empty(t, c.pub.published)
+	})
+
+	t.Run("waits for the blob to be released", func(t *testing.T) {
+		c := newTestClaims(t, 48*time.Hour)
+		locks := &digestutil.Locks{}
+		r, err := New(testutil.Alice, nil, c.blobs, c, WithBlobLocks(locks))
+		require.NoError(t, err)
+
+		claim := putLocationClaim(t, c, testutil.Alice, time.Hour)
+		nb := testutil.Must(assert.LocationCaveatsReader.Read(claim.Capabilities()[0].Nb()))(t)
+		unlock := locks.Lock(nb.Content.Hash())
+
+		done := make(chan error, 1)
+		go func() { done <- r.Renew(ctx) }()
+		select {
+		case <-done:
+			t.Fatal("renewed while the blob was locked")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		unlock()
+		require.NoError(t, <-done)
+		require.Len(t, c.pub.published, 1)
+	})
+
+	t.Run("keeps the claim when publishing fails", func(t *testing.T) {
+		c := newTestClaims(t, 48*time.Hour)
+		c.pub.err = errors.New("boom")
+		r, err := New(testutil.Alice, nil, c.blobs, c)
+		require.NoError(t, err)
+
+		claim := putLocationClaim(t, c, testutil.Alice, time.Hour)
+
+		err = r.Renew(ctx)
+		require.Error(t, err)
+
+		links, err := c.store.ListExpiring(ctx, int(time.Now().Add(100*time.Hour).Unix()))
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		require.Equal(t, claim.Link(), links[0])
+	})
+
+	t.Run("renews half way through short expirations", func(t *testing.T) {
+		c := newTestClaims(t, 2*time.Hour)
+		r, err := New(testutil.Alice, nil, c.blobs, c)
+		require.NoError(t, err)
+		require.Equal(t, time.Hour, r.renewBefore)
+
+		_, err = New(testutil.Alice, nil, c.blobs, c, WithRenewBefore(2*time.Hour))
+		require.Error(t, err)
+	})
+
+	t.Run("requires location claims to expire", func(t *testing.T) {
+		c := newTestClaims(t, 0)
+		_, err := New(testutil.Alice, nil, c.blobs, c)
+		require.Error(t, err)
+	})
+}
+
+type testClaims struct {
+	blobs      blobs.Blobs
+	store      *claimstore.DsClaimStore
+	pub        *publishRecorder
+	expiration time.Duration
+}
+
+func newTestClaims(t *testing.T, expiration time.Duration) *testClaims {
+	s, err := claimstore.NewDsClaimStore(datastore.NewMapDatastore())
+	require.NoError(t, err)
+	allocs, err := allocationstore.NewDsAllocationStore(datastore.NewMapDatastore())
+	require.NoError(t, err)
+	b, err := blobs.New(
+		blobs.WithBlobstore(blobstore.NewMapBlobstore()),
+		blobs.WithAllocationStore(allocs),
+	)
+	require.NoError(t, err)
+	return &testClaims{blobs: b, store: s, pub: &publishRecorder{}, expiration: expiration}
+}
+
+func (c *testClaims) Store() claimstore.ClaimStore           { return c.store }
+func (c *testClaims) Publisher() publisher.Publisher         { return c.pub }
+func (c *testClaims) LocationClaimExpiration() time.Duration { return c.expiration }
+
+// publishRecorder records published claims, failing with err when it is set.
+type publishRecorder struct {
+	publisher.Publisher
+	published []delegation.Delegation
+	err       error
+}
+
+func (p *publishRecorder) Publish(_ context.Context, claim delegation.Delegation) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, claim)
+	return nil
+}
+
+// putLocationClaim stores a location claim for a new blob, along with the
+// blob and an allocation for it.
+func putLocationClaim(t *testing.T, c *testClaims, issuer principal.Signer, expiresIn time.Duration) delegation.Delegation {
+	space := testutil.RandomDID(t)
+	data := testutil.RandomBytes(t, 32)
+	digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+	err := c.blobs.Store().Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+	require.NoError(t, err)
+	err = c.blobs.Allocations().Put(context.Background(), allocation.Allocation{
+		Space:   space,
+		Blob:    allocation.Blob{Digest: digest, Size: uint64(len(data))},
+		Expires: allocation.Retained,
+		Cause:   testutil.RandomCID(t),
+	})
+	require.NoError(t, err)
+
+	claim, err := assert.Location.Delegate(
+		issuer,
+		space,
+		issuer.DID().String(),
+		assert.LocationCaveats{
+			Space:    space,
+			Content:  types.FromHash(digest),
+			Location: []url.URL{testutil.RandomLocalURL(t)},
+		},
+		delegation.WithExpiration(int(time.Now().Add(expiresIn).Unix())),
+	)
+	require.NoError(t, err)
+	err = c.Store().Put(context.Background(), claim)
+	require.NoError(t, err)
+	return claim
+}
@@ -0,0 +1,87 @@
+package replicator
+
+import (
+	"errors"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+const (
+	// DefaultMaxAttempts is the number of times a transfer is attempted before
+	// a failure receipt is issued for it.
+	DefaultMaxAttempts = 10
+	// DefaultMinBackoff is the delay before a failed transfer is first retried.
+	DefaultMinBackoff = 5 * time.Second
+	// DefaultMaxBackoff is the longest delay between attempts of a transfer.
+	DefaultMaxBackoff = 30 * time.Minute
+	// DefaultMaxWorkers is the number of transfers run concurrently.
+	DefaultMaxWorkers = 4
+)
+
+type options struct {
+	maxAttempts uint
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxWorkers  uint
+	bandwidth   uint64
+}
+
+type Option func(*options) error
+
+// WithMaxAttempts sets the number of times a transfer is attempted before it
+// is abandoned and a failure receipt is issued for it.
+func WithMaxAttempts(n uint) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return errors.New("max attempts must be greater than zero")
+		}
+		o.maxAttempts = n
+		return nil
+	}
+}
+
+// WithBackoff sets the delay before a failed transfer is first retried, which
+// doubles on each subsequent failure up to max.
+func WithBackoff(min, max time.Duration) Option {
+	return func(o *options) error {
+		if min <= 0 {
+			return errors.New("minimum backoff must be greater than zero")
+		}
+		if max < min {
+			return errors.New("maximum backoff cannot be less than the minimum")
+		}
+		o.minBackoff = min
+		o.maxBackoff = max
+		return nil
+	}
+}
+
+// WithMaxWorkers sets the number of transfers run concurrently.
+func WithMaxWorkers(n uint) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return errors.New("max workers must be greater than zero")
+		}
+		o.maxWorkers = n
+		return nil
+	}
+}
+
+// WithBandwidth limits the total rate, in bytes per second, at which blobs are
+// fetched from replication sources across all concurrent transfers. Zero means
+// unlimited.
+func WithBandwidth(bytesPerSecond uint64) Option {
+	return func(o *options) error {
+		o.bandwidth = bytesPerSecond
+		return nil
+	}
+}
+
+// WithLogLevel changes the log level for the replicator.
+func WithLogLevel(level string) Option {
+	return func(o *options) error {
+		logging.SetLogLevel("replicator", level)
+		return nil
+	}
+}
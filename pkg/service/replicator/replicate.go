@@ -2,36 +2,138 @@ package replicator
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
 
 	logging "github.com/ipfs/go-log/v2"
-	"github.com/storacha/go-libstoracha/jobqueue"
-	"github.com/storacha/go-ucanto/client"
+	"github.com/storacha/go-libstoracha/capabilities/blob/replica"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/ipld"
+	"github.com/storacha/go-ucanto/core/receipt"
+	"github.com/storacha/go-ucanto/core/result"
+	fdm "github.com/storacha/go-ucanto/core/result/failure/datamodel"
 	"github.com/storacha/go-ucanto/principal"
+	"golang.org/x/time/rate"
 
+	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/pdp"
+	"github.com/storacha/piri/pkg/pdp/aggregator/jobqueue"
 	"github.com/storacha/piri/pkg/service/blobs"
 	"github.com/storacha/piri/pkg/service/claims"
+	"github.com/storacha/piri/pkg/service/outbox"
 	replicahandler "github.com/storacha/piri/pkg/service/storage/handlers/replica"
+	"github.com/storacha/piri/pkg/store"
 	"github.com/storacha/piri/pkg/store/receiptstore"
 )
 
 var log = logging.Logger("replicator")
 
+// QueueName is the name of the job queue that holds replication requests.
+const QueueName = "replication"
+
+// TransferTask is the name of the job that transfers a replica.
+const TransferTask = "replica_transfer"
+
+// ResponseHeaderTimeout is how long to wait for a replication source or sink
+// to respond to a request before the transfer attempt fails.
+const ResponseHeaderTimeout = time.Minute
+
+// ErrTransferNotFound is returned when a transfer is neither queued nor has a
+// receipt.
+var ErrTransferNotFound = errors.New("transfer not found")
+
+// States of a transfer reported in a [TransferStatus].
+const (
+	// TransferPending is the state of a transfer that is queued or running,
+	// including one waiting to be retried.
+	TransferPending = "pending"
+	// TransferCompleted is the state of a transfer that has a successful
+	// receipt.
+	TransferCompleted = "completed"
+	// TransferFailed is the state of a transfer that exhausted its attempts. It
+	// will not be retried. The failure receipt is issued once the failure has
+	// been handled.
+	TransferFailed = "failed"
+)
+
+// maxBurst caps the number of bytes read from a source in one go when the
+// bandwidth is limited, so that the limit is applied smoothly.
+const maxBurst = 256 * 1024
+
 type Replicator interface {
+	// Replicate queues a transfer, which is retried until it succeeds or
+	// exhausts its attempts, in which case a failure receipt is issued for it.
 	Replicate(context.Context, *replicahandler.TransferRequest) error
+	// Pending lists the transfers waiting to run or to be retried, oldest
+	// first. Transfers that exhausted their attempts are not included.
+	Pending(context.Context) ([]PendingTransfer, error)
+	// Status reports the state of the transfer for the given replica/transfer
+	// invocation, or [ErrTransferNotFound] if there is no record of it.
+	Status(ctx context.Context, cause ipld.Link) (TransferStatus, error)
+}
+
+// PendingTransfer is a transfer held in the replication queue.
+type PendingTransfer struct {
+	ID      string   `json:"id"`
+	Space   string   `json:"space"`
+	Blob    string   `json:"blob"`
+	Size    uint64   `json:"size"`
+	Sources []string `json:"sources"`
+	Sink    string   `json:"sink,omitempty"`
+	// Cause is the CID of the replica/transfer invocation.
+	Cause string `json:"cause"`
+	// Attempts is the number of times the transfer has been attempted.
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"maxAttempts"`
+	Created     time.Time `json:"created"`
+	// NextAttempt is the earliest time the transfer will be attempted again.
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// TransferStatus tells a transfer that is still running apart from one that
+// has completed or permanently failed.
+type TransferStatus struct {
+	// Cause is the CID of the replica/transfer invocation.
+	Cause string `json:"cause"`
+	// State is one of [TransferPending], [TransferCompleted] or
+	// [TransferFailed].
+	State string `json:"state"`
+	// Pending is the queued transfer, while the transfer is pending.
+	Pending *PendingTransfer `json:"pending,omitempty"`
+	// Receipt is the CID of the receipt issued for a completed or failed
+	// transfer. It is empty for a failed transfer whose failure receipt has not
+	// yet been issued.
+	Receipt string `json:"receipt,omitempty"`
+	// Error is the failure reported in the receipt of a failed transfer.
+	Error *TransferError `json:"error,omitempty"`
+}
+
+// TransferError is the failure reported in the receipt of a failed transfer.
+type TransferError struct {
+	// Name identifies the kind of failure, for example "SourceUnreachable" or
+	// "DigestMismatch".
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
 }
 
 type Service struct {
-	queue *jobqueue.JobQueue[*replicahandler.TransferRequest]
+	queue    *jobqueue.JobQueue[*replicahandler.TransferRequest]
+	receipts receiptstore.ReceiptStore
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
 }
 
 type adapter struct {
-	id         principal.Signer
-	pdp        pdp.PDP
-	blobs      blobs.Blobs
-	claims     claims.Claims
-	receipts   receiptstore.ReceiptStore
-	uploadConn client.Connection
+	id       principal.Signer
+	pdp      pdp.PDP
+	blobs    blobs.Blobs
+	claims   claims.Claims
+	receipts receiptstore.ReceiptStore
+	outbox   outbox.Outbox
 }
 
 func (a adapter) ID() principal.Signer                { return a.id }
@@ -39,47 +141,206 @@ func (a adapter) PDP() pdp.PDP                        { return a.pdp }
 func (a adapter) Blobs() blobs.Blobs                  { return a.blobs }
 func (a adapter) Claims() claims.Claims               { return a.claims }
 func (a adapter) Receipts() receiptstore.ReceiptStore { return a.receipts }
-func (a adapter) UploadConnection() client.Connection { return a.uploadConn }
+func (a adapter) Outbox() outbox.Outbox               { return a.outbox }
 
+// New creates a replicator that queues transfers in the given SQLite
+// database, so that transfers accepted before a restart are resumed after it.
+// Transfer receipts are sent to the upload service through the outbox.
 func New(
 	id principal.Signer,
 	p pdp.PDP,
 	b blobs.Blobs,
 	c claims.Claims,
 	rstore receiptstore.ReceiptStore,
-	uploadConn client.Connection,
+	ob outbox.Outbox,
+	db *sql.DB,
+	opts ...Option,
 ) (*Service, error) {
+	o := &options{
+		maxAttempts: DefaultMaxAttempts,
+		minBackoff:  DefaultMinBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		maxWorkers:  DefaultMaxWorkers,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
 
-	replicationQueue := jobqueue.NewJobQueue[*replicahandler.TransferRequest](
-		jobqueue.JobHandler(func(ctx context.Context, request *replicahandler.TransferRequest) error {
-			return replicahandler.Transfer(ctx,
-				&adapter{
-					id:         id,
-					pdp:        p,
-					blobs:      b,
-					claims:     c,
-					receipts:   rstore,
-					uploadConn: uploadConn,
-				},
-				request)
-		}),
-		jobqueue.WithErrorHandler(func(err error) {
-			log.Errorf("error while handling replication request: %s", err)
-		}),
+	replicationQueue, err := jobqueue.New(
+		QueueName,
+		db,
+		newTransferSerializer(),
+		jobqueue.WithLogger(logging.Logger("jobqueue").With("queue", QueueName)),
+		jobqueue.WithMaxRetries(o.maxAttempts),
+		jobqueue.WithMaxWorkers(o.maxWorkers),
+		jobqueue.WithBackoff(o.minBackoff, o.maxBackoff),
 	)
+	if err != nil {
+		return nil, fmt.Errorf("creating replication job-queue: %w", err)
+	}
 
-	return &Service{queue: replicationQueue}, nil
+	transferOpts := []replicahandler.TransferOption{
+		replicahandler.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: ResponseHeaderTimeout,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+			},
+		}),
+	}
+	if o.bandwidth > 0 {
+		transferOpts = append(transferOpts, replicahandler.WithRateLimiter(newLimiter(o.bandwidth)))
+	}
+
+	svc := &adapter{
+		id:       id,
+		pdp:      p,
+		blobs:    b,
+		claims:   c,
+		receipts: rstore,
+		outbox:   ob,
+	}
+
+	if err := replicationQueue.Register(TransferTask, func(ctx context.Context, request *replicahandler.TransferRequest) error {
+		err := replicahandler.Transfer(ctx, svc, request, transferOpts...)
+		if err != nil {
+			log.Warnw("transfer failed", "blob", digestutil.Format(request.Blob.Digest), "error", err)
+		}
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("registering %s task: %w", TransferTask, err)
+	}
+
+	if err := replicationQueue.OnFailure(TransferTask, func(ctx context.Context, request *replicahandler.TransferRequest, cause error) error {
+		log.Errorw("abandoning transfer", "blob", digestutil.Format(request.Blob.Digest), "cause", request.Cause.Link().String(), "attempts", o.maxAttempts, "error", cause)
+		return replicahandler.TransferFailure(ctx, svc, request, cause)
+	}); err != nil {
+		return nil, fmt.Errorf("registering %s failure handler: %w", TransferTask, err)
+	}
+
+	return &Service{queue: replicationQueue, receipts: rstore}, nil
 }
 
 func (r *Service) Replicate(ctx context.Context, task *replicahandler.TransferRequest) error {
-	return r.queue.Queue(ctx, task)
+	return r.queue.Enqueue(ctx, TransferTask, task)
+}
+
+func (r *Service) Pending(ctx context.Context) ([]PendingTransfer, error) {
+	pending, _, err := r.list(ctx)
+	return pending, err
+}
+
+// list returns the queued transfers that are pending, and the causes of those
+// that exhausted their attempts but do not yet have a failure receipt.
+func (r *Service) list(ctx context.Context) ([]PendingTransfer, map[string]bool, error) {
+	jobs, err := r.queue.List(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing replication jobs: %w", err)
+	}
+	pending := make([]PendingTransfer, 0, len(jobs))
+	failed := map[string]bool{}
+	for _, j := range jobs {
+		if j.Failed {
+			failed[j.Msg.Cause.Link().String()] = true
+			continue
+		}
+		t := PendingTransfer{
+			ID:          string(j.ID),
+			Space:       j.Msg.Space.String(),
+			Blob:        digestutil.Format(j.Msg.Blob.Digest),
+			Size:        j.Msg.Blob.Size,
+			Cause:       j.Msg.Cause.Link().String(),
+			Attempts:    j.Attempts,
+			MaxAttempts: j.MaxAttempts,
+			Created:     j.Created,
+			NextAttempt: j.NextAttempt,
+		}
+		for _, source := range j.Msg.Sources {
+			t.Sources = append(t.Sources, source.String())
+		}
+		if j.Msg.Sink != nil {
+			t.Sink = j.Msg.Sink.String()
+		}
+		pending = append(pending, t)
+	}
+	return pending, failed, nil
 }
 
+func (r *Service) Status(ctx context.Context, cause ipld.Link) (TransferStatus, error) {
+	status := TransferStatus{Cause: cause.String()}
+
+	// check the queue first, the receipt is stored before the job is removed
+	pending, failed, err := r.list(ctx)
+	if err != nil {
+		return TransferStatus{}, err
+	}
+	for _, p := range pending {
+		if p.Cause == status.Cause {
+			status.State = TransferPending
+			status.Pending = &p
+			return status, nil
+		}
+	}
+
+	anyRcpt, err := r.receipts.GetByRan(ctx, cause)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			if failed[status.Cause] {
+				status.State = TransferFailed
+				status.Error = &TransferError{Message: "transfer exhausted its attempts"}
+				return status, nil
+			}
+			return TransferStatus{}, ErrTransferNotFound
+		}
+		return TransferStatus{}, fmt.Errorf("getting transfer receipt: %w", err)
+	}
+	rcpt, err := receipt.Rebind[replica.TransferOk, fdm.FailureModel](anyRcpt, replica.TransferOkType(), fdm.FailureType(), types.Converters...)
+	if err != nil {
+		return TransferStatus{}, fmt.Errorf("reading transfer receipt: %w", err)
+	}
+	status.Receipt = rcpt.Root().Link().String()
+	result.MatchResultR0(rcpt.Out(), func(replica.TransferOk) {
+		status.State = TransferCompleted
+	}, func(f fdm.FailureModel) {
+		status.State = TransferFailed
+		status.Error = &TransferError{Message: f.Message}
+		if f.Name != nil {
+			status.Error.Name = *f.Name
+		}
+	})
+	return status, nil
+}
+
+// Start begins running queued transfers, including any that were queued before
+// the node was last stopped.
 func (r *Service) Start(_ context.Context) error {
-	r.queue.Startup()
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.queue.Start(ctx)
+	}()
 	return nil
 }
 
+// Stop ends running transfers. Transfers interrupted by stopping are run again
+// when the replicator is next started.
 func (r *Service) Stop(ctx context.Context) error {
-	return r.queue.Shutdown(ctx)
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+	return nil
+}
+
+func newLimiter(bytesPerSecond uint64) *rate.Limiter {
+	burst := maxBurst
+	if bytesPerSecond < maxBurst {
+		burst = int(bytesPerSecond)
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
 }
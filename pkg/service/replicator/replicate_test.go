@@ -0,0 +1,256 @@
+package replicator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/storacha/go-libstoracha/capabilities/blob/replica"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/client"
+	"github.com/storacha/go-ucanto/core/car"
+	"github.com/storacha/go-ucanto/core/dag/blockstore"
+	"github.com/storacha/go-ucanto/core/message"
+	"github.com/storacha/go-ucanto/core/receipt"
+	"github.com/storacha/go-ucanto/core/result"
+	"github.com/storacha/go-ucanto/core/result/failure"
+	fdm "github.com/storacha/go-ucanto/core/result/failure/datamodel"
+	ucanhttp "github.com/storacha/go-ucanto/transport/http"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/database/sqlitedb"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/service/outbox"
+	replicahandler "github.com/storacha/piri/pkg/service/storage/handlers/replica"
+	"github.com/storacha/piri/pkg/store/receiptstore"
+)
+
+func TestTransferSerializer(t *testing.T) {
+	ser := newTransferSerializer()
+
+	t.Run("round trip", func(t *testing.T) {
+		sink := testutil.RandomLocalURL(t)
+		req := randomTransferRequest(t, testutil.RandomLocalURL(t), &sink)
+		req.Sources = append(req.Sources, testutil.RandomLocalURL(t))
+		req.SinkHeader = http.Header{"Content-Length": []string{"128"}, "X-Amz-Checksum-Sha256": []string{"abc"}}
+
+		data, err := ser.Serialize(req)
+		require.NoError(t, err)
+
+		got, err := ser.Deserialize(data)
+		require.NoError(t, err)
+		require.Equal(t, req.Space, got.Space)
+		require.Equal(t, req.Blob, got.Blob)
+		require.Equal(t, req.Sources, got.Sources)
+		require.Equal(t, req.Sink.String(), got.Sink.String())
+		require.Equal(t, req.SinkHeader, got.SinkHeader)
+		require.Equal(t, req.Cause.Link(), got.Cause.Link())
+		require.Equal(t, req.Cause.Capabilities()[0].Can(), got.Cause.Capabilities()[0].Can())
+	})
+
+	t.Run("round trip without sink", func(t *testing.T) {
+		req := randomTransferRequest(t, testutil.RandomLocalURL(t), nil)
+
+		data, err := ser.Serialize(req)
+		require.NoError(t, err)
+
+		got, err := ser.Deserialize(data)
+		require.NoError(t, err)
+		require.Nil(t, got.Sink)
+		require.Nil(t, got.SinkHeader)
+		require.Equal(t, req.Cause.Link(), got.Cause.Link())
+	})
+
+	t.Run("decodes jobs with a single source", func(t *testing.T) {
+		req := randomTransferRequest(t, testutil.RandomLocalURL(t), nil)
+		data, err := ser.Serialize(req)
+		require.NoError(t, err)
+
+		// strip the sources, as in jobs queued before they were added
+		model, err := ser.cbor.Deserialize(data)
+		require.NoError(t, err)
+		model.Sources = nil
+		data, err = ser.cbor.Serialize(model)
+		require.NoError(t, err)
+
+		got, err := ser.Deserialize(data)
+		require.NoError(t, err)
+		require.Equal(t, req.Sources, got.Sources)
+	})
+}
+
+func TestReplicator(t *testing.T) {
+	t.Run("resumes queued transfers after restart", func(t *testing.T) {
+		dbPath := filepath.Join(t.TempDir(), "jobqueue.db")
+		req := randomTransferRequest(t, testutil.RandomLocalURL(t), nil)
+
+		db, err := sqlitedb.New(dbPath)
+		require.NoError(t, err)
+		repl, err := New(testutil.Alice, nil, nil, nil, newReceiptStore(t), nil, db)
+		require.NoError(t, err)
+
+		err = repl.Replicate(context.Background(), req)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		db, err = sqlitedb.New(dbPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		repl, err = New(testutil.Alice, nil, nil, nil, newReceiptStore(t), nil, db)
+		require.NoError(t, err)
+
+		pending, err := repl.Pending(context.Background())
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		require.Equal(t, req.Cause.Link().String(), pending[0].Cause)
+		require.Equal(t, req.Space.String(), pending[0].Space)
+		require.Equal(t, req.Blob.Size, pending[0].Size)
+		require.Equal(t, 0, pending[0].Attempts)
+		require.Equal(t, DefaultMaxAttempts, pending[0].MaxAttempts)
+
+		status, err := repl.Status(context.Background(), req.Cause.Link())
+		require.NoError(t, err)
+		require.Equal(t, TransferPending, status.State)
+		require.NotNil(t, status.Pending)
+		require.Equal(t, pending[0].ID, status.Pending.ID)
+	})
+
+	t.Run("reports unknown transfers as not found", func(t *testing.T) {
+		db, err := sqlitedb.NewMemory()
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		repl, err := New(testutil.Alice, nil, nil, nil, newReceiptStore(t), nil, db)
+		require.NoError(t, err)
+
+		_, err = repl.Status(context.Background(), testutil.RandomCID(t))
+		require.ErrorIs(t, err, ErrTransferNotFound)
+	})
+
+	t.Run("issues a failure receipt after the final attempt", func(t *testing.T) {
+		msgs := make(chan message.AgentMessage, 1)
+		uploadService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			roots, blocks, err := car.Decode(r.Body)
+			require.NoError(t, err)
+			bs, err := blockstore.NewBlockReader(blockstore.WithBlocksIterator(blocks))
+			require.NoError(t, err)
+			msg, err := message.NewMessage(roots, bs)
+			require.NoError(t, err)
+			msgs <- msg
+		}))
+		t.Cleanup(uploadService.Close)
+		uploadURL, err := url.Parse(uploadService.URL)
+		require.NoError(t, err)
+		conn, err := client.NewConnection(testutil.Alice, ucanhttp.NewHTTPChannel(uploadURL))
+		require.NoError(t, err)
+
+		// a source that cannot be reached, so every attempt fails
+		source := httptest.NewServer(http.NotFoundHandler())
+		sourceURL, err := url.Parse(source.URL)
+		require.NoError(t, err)
+		source.Close()
+
+		sinkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+		}))
+		t.Cleanup(sinkServer.Close)
+		sink, err := url.Parse(sinkServer.URL)
+		require.NoError(t, err)
+		req := randomTransferRequest(t, *sourceURL, sink)
+
+		db, err := sqlitedb.NewMemory()
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		receipts := newReceiptStore(t)
+		ob, err := outbox.New("test", conn, receipts, db)
+		require.NoError(t, err)
+		require.NoError(t, ob.Start(context.Background()))
+		t.Cleanup(func() { ob.Stop(context.Background()) })
+		repl, err := New(
+			testutil.Alice, nil, nil, nil, receipts, ob, db,
+			WithMaxAttempts(2),
+			WithBackoff(10*time.Millisecond, 10*time.Millisecond),
+		)
+		require.NoError(t, err)
+
+		err = repl.Replicate(context.Background(), req)
+		require.NoError(t, err)
+
+		require.NoError(t, repl.Start(context.Background()))
+		t.Cleanup(func() { repl.Stop(context.Background()) })
+
+		var msg message.AgentMessage
+		select {
+		case msg = <-msgs:
+		case <-time.After(10 * time.Second):
+			t.Fatal("failure receipt was not sent to the upload service")
+		}
+
+		rcptLink, ok := msg.Get(req.Cause.Link())
+		require.True(t, ok)
+		reader, err := receipt.NewReceiptReaderFromTypes[replica.TransferOk, fdm.FailureModel](
+			replica.TransferOkType(), fdm.FailureType(), types.Converters...,
+		)
+		require.NoError(t, err)
+		rcpt, err := reader.Read(rcptLink, msg.Blocks())
+		require.NoError(t, err)
+
+		_, err = result.Unwrap(result.MapError(rcpt.Out(), failure.FromFailureModel))
+		require.Error(t, err)
+		var named failure.Named
+		require.ErrorAs(t, err, &named)
+		require.Equal(t, "SourceUnreachable", named.Name())
+
+		stored, err := receipts.GetByRan(context.Background(), req.Cause.Link())
+		require.NoError(t, err)
+		require.Equal(t, rcptLink, stored.Root().Link())
+
+		require.Eventually(t, func() bool {
+			pending, err := repl.Pending(context.Background())
+			return err == nil && len(pending) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		status, err := repl.Status(context.Background(), req.Cause.Link())
+		require.NoError(t, err)
+		require.Equal(t, TransferFailed, status.State)
+		require.Equal(t, rcptLink.String(), status.Receipt)
+		require.NotNil(t, status.Error)
+		require.Equal(t, "SourceUnreachable", status.Error.Name)
+		require.Contains(t, status.Error.Message, sourceURL.String())
+	})
+}
+
+func randomTransferRequest(t *testing.T, source url.URL, sink *url.URL) *replicahandler.TransferRequest {
+	space := testutil.RandomDID(t)
+	blob := types.Blob{Digest: testutil.RandomMultihash(t), Size: 128}
+	inv, err := replica.Transfer.Invoke(
+		testutil.Alice,
+		testutil.Alice,
+		testutil.Alice.DID().String(),
+		replica.TransferCaveats{
+			Space: space,
+			Blob:  blob,
+			Site:  testutil.RandomCID(t),
+			Cause: testutil.RandomCID(t),
+		},
+	)
+	require.NoError(t, err)
+	return &replicahandler.TransferRequest{
+		Space:   space,
+		Blob:    blob,
+		Sources: []url.URL{source},
+		Sink:    sink,
+		Cause:   inv,
+	}
+}
+
+func newReceiptStore(t *testing.T) receiptstore.ReceiptStore {
+	rs, err := receiptstore.NewDsReceiptStore(datastore.NewMapDatastore())
+	require.NoError(t, err)
+	return rs
+}
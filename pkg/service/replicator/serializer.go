@@ -0,0 +1,155 @@
+package replicator
+
+import (
+	// for go:embed
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+
+	"github.com/storacha/piri/pkg/pdp/aggregator/jobqueue/serializer"
+	replicahandler "github.com/storacha/piri/pkg/service/storage/handlers/replica"
+)
+
+//go:embed transfer.ipldsch
+var transferSchema []byte
+
+var transferTS *schema.TypeSystem
+
+func init() {
+	ts, err := types.LoadSchemaBytes(transferSchema)
+	if err != nil {
+		panic(fmt.Errorf("loading transfer schema: %w", err))
+	}
+	transferTS = ts
+}
+
+func TransferJobType() schema.Type {
+	return transferTS.TypeByName("TransferJob")
+}
+
+type transferJobModel struct {
+	Space      string
+	Digest     []byte
+	Size       int64
+	Source     string
+	Sources    []string
+	Sink       *string
+	SinkHeader *headerModel
+	Cause      []byte
+}
+
+type headerModel struct {
+	Keys   []string
+	Values map[string][]string
+}
+
+// transferSerializer encodes transfer requests for the replication queue. The
+// cause invocation is archived so that it can be restored with all of its
+// blocks when the job is run.
+type transferSerializer struct {
+	cbor serializer.IPLDSerializerCBOR[transferJobModel]
+}
+
+var _ serializer.Serializer[*replicahandler.TransferRequest] = (*transferSerializer)(nil)
+
+func newTransferSerializer() *transferSerializer {
+	return &transferSerializer{
+		cbor: serializer.IPLDSerializerCBOR[transferJobModel]{Typ: TransferJobType()},
+	}
+}
+
+func (s *transferSerializer) Serialize(req *replicahandler.TransferRequest) ([]byte, error) {
+	cause, err := io.ReadAll(req.Cause.Archive())
+	if err != nil {
+		return nil, fmt.Errorf("archiving transfer invocation: %w", err)
+	}
+	model := transferJobModel{
+		Space:  req.Space.String(),
+		Digest: req.Blob.Digest,
+		Size:   int64(req.Blob.Size),
+		Cause:  cause,
+	}
+	for _, source := range req.Sources {
+		model.Sources = append(model.Sources, source.String())
+	}
+	if len(model.Sources) > 0 {
+		model.Source = model.Sources[0]
+	}
+	if req.Sink != nil {
+		sink := req.Sink.String()
+		model.Sink = &sink
+	}
+	if len(req.SinkHeader) > 0 {
+		header := &headerModel{Values: map[string][]string{}}
+		for k, v := range req.SinkHeader {
+			header.Keys = append(header.Keys, k)
+			header.Values[k] = v
+		}
+		slices.Sort(header.Keys)
+		model.SinkHeader = header
+	}
+	return s.cbor.Serialize(model)
+}
+
+func (s *transferSerializer) Deserialize(data []byte) (*replicahandler.TransferRequest, error) {
+	model, err := s.cbor.Deserialize(data)
+	if err != nil {
+		return nil, err
+	}
+	space, err := did.Parse(model.Space)
+	if err != nil {
+		return nil, fmt.Errorf("parsing space: %w", err)
+	}
+	digest, err := multihash.Cast(model.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("parsing blob digest: %w", err)
+	}
+	// jobs queued before multiple sources were supported only have a source
+	rawSources := model.Sources
+	if len(rawSources) == 0 && model.Source != "" {
+		rawSources = []string{model.Source}
+	}
+	sources := make([]url.URL, 0, len(rawSources))
+	for _, raw := range rawSources {
+		source, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing source URL: %w", err)
+		}
+		sources = append(sources, *source)
+	}
+	var sink *url.URL
+	if model.Sink != nil {
+		sink, err = url.Parse(*model.Sink)
+		if err != nil {
+			return nil, fmt.Errorf("parsing sink URL: %w", err)
+		}
+	}
+	cause, err := delegation.Extract(model.Cause)
+	if err != nil {
+		return nil, fmt.Errorf("extracting transfer invocation: %w", err)
+	}
+	var sinkHeader http.Header
+	if model.SinkHeader != nil {
+		sinkHeader = http.Header{}
+		for _, k := range model.SinkHeader.Keys {
+			sinkHeader[k] = model.SinkHeader.Values[k]
+		}
+	}
+	return &replicahandler.TransferRequest{
+		Space:      space,
+		Blob:       types.Blob{Digest: digest, Size: uint64(model.Size)},
+		Sources:    sources,
+		Sink:       sink,
+		SinkHeader: sinkHeader,
+		Cause:      cause,
+	}, nil
+}
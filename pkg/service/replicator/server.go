@@ -0,0 +1,75 @@
+package replicator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+
+	"github.com/storacha/piri/internal/telemetry"
+)
+
+type Server struct {
+	replicator Replicator
+}
+
+func NewServer(replicator Replicator) (*Server, error) {
+	return &Server{replicator}, nil
+}
+
+func (srv *Server) Serve(mux *http.ServeMux) {
+	mux.Handle("GET /replications", NewHandler(srv.replicator))
+	mux.Handle("GET /replications/{cause}", NewStatusHandler(srv.replicator))
+}
+
+// NewHandler lists the transfers waiting in the replication queue as JSON.
+func NewHandler(replicator Replicator) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		pending, err := replicator.Pending(r.Context())
+		if err != nil {
+			return telemetry.NewHTTPError(fmt.Errorf("failed to list pending replications: %w", err), http.StatusInternalServerError)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(pending)
+		if err != nil {
+			return fmt.Errorf("serving pending replications: %w", err)
+		}
+
+		return nil
+	}
+
+	return telemetry.NewErrorReportingHandler(handler)
+}
+
+// NewStatusHandler reports the status of the transfer for the replica/transfer
+// invocation in the path as JSON.
+func NewStatusHandler(replicator Replicator) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		c, err := cid.Parse(r.PathValue("cause"))
+		if err != nil {
+			return telemetry.NewHTTPError(fmt.Errorf("invalid transfer invocation CID: %w", err), http.StatusBadRequest)
+		}
+
+		status, err := replicator.Status(r.Context(), cidlink.Link{Cid: c})
+		if err != nil {
+			if errors.Is(err, ErrTransferNotFound) {
+				return telemetry.NewHTTPError(fmt.Errorf("not found: %s", c), http.StatusNotFound)
+			}
+			return telemetry.NewHTTPError(fmt.Errorf("failed to get replication status: %w", err), http.StatusInternalServerError)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(status)
+		if err != nil {
+			return fmt.Errorf("serving replication status: %w", err)
+		}
+
+		return nil
+	}
+
+	return telemetry.NewErrorReportingHandler(handler)
+}
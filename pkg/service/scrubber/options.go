@@ -0,0 +1,44 @@
+package scrubber
+
+import (
+	"errors"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+type options struct {
+	interval time.Duration
+	rate     uint64
+}
+
+type Option func(*options) error
+
+// WithInterval configures the time between the start of consecutive scrub
+// passes.
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) error {
+		if interval <= 0 {
+			return errors.New("scrub interval must be greater than zero")
+		}
+		o.interval = interval
+		return nil
+	}
+}
+
+// WithRate limits the number of bytes read from the blobstore per second
+// while scrubbing. A rate of zero means unlimited.
+func WithRate(bytesPerSecond uint64) Option {
+	return func(o *options) error {
+		o.rate = bytesPerSecond
+		return nil
+	}
+}
+
+// WithLogLevel changes the log level for the scrubber subsystem.
+func WithLogLevel(level string) Option {
+	return func(o *options) error {
+		logging.SetLogLevel("scrubber", level)
+		return nil
+	}
+}
@@ -0,0 +1,273 @@
+package scrubber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/scrubstore"
+	"github.com/storacha/piri/pkg/store/scrubstore/scrub"
+)
+
+var log = logging.Logger("scrubber")
+
+const (
+	// DefaultInterval is the default time between scrub passes.
+	DefaultInterval = 24 * time.Hour
+	// DefaultRate is the default number of bytes read per second while
+	// scrubbing.
+	DefaultRate = 50 * 1024 * 1024
+)
+
+type Scrubber interface {
+	// Scrub performs a single pass over the blobstore, re-hashing each blob
+	// and recording the result in the report. Corrupt blobs are quarantined if
+	// the blobstore supports it. Blobs that cannot be read for other reasons
+	// are reported as errors and left in place.
+	Scrub(context.Context) error
+	// Report provides access to the results of checking each blob.
+	Report() scrubstore.ScrubStore
+}
+
+// Service periodically checks the integrity of the blobs held by this node.
+type Service struct {
+	blobs       blobstore.Blobstore
+	lister      blobstore.Lister
+	quarantiner blobstore.Quarantiner
+	report      scrubstore.ScrubStore
+	interval    time.Duration
+	rate        uint64
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+var _ Scrubber = (*Service)(nil)
+
+// New creates an integrity scrubber for the passed blobstore, which must
+// implement [blobstore.Lister]. Corrupt blobs are quarantined if the
+// blobstore implements [blobstore.Quarantiner], otherwise they are only
+// reported.
+func New(blobs blobstore.Blobstore, report scrubstore.ScrubStore, opts ...Option) (*Service, error) {
+	o := &options{interval: DefaultInterval, rate: DefaultRate}
+	for _, opt := range opts {
+		err := opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lister, ok := blobs.(blobstore.Lister)
+	if !ok {
+		return nil, errors.New("blobstore does not support enumerating blobs")
+	}
+	quarantiner, ok := blobs.(blobstore.Quarantiner)
+	if !ok {
+		log.Warn("Blobstore does not support quarantine, corrupt blobs will only be reported")
+	}
+
+	return &Service{
+		blobs:       blobs,
+		lister:      lister,
+		quarantiner: quarantiner,
+		report:      report,
+		interval:    o.interval,
+		rate:        o.rate,
+	}, nil
+}
+
+func (s *Service) Report() scrubstore.ScrubStore {
+	return s.report
+}
+
+func (s *Service) Scrub(ctx context.Context) error {
+	start := time.Now()
+	thr := newThrottle(s.rate)
+
+	// collect digests first so paging is not disturbed by quarantine
+	var digests []multihash.Multihash
+	err := blobstore.ListAll(ctx, s.lister, func(obj blobstore.ObjectInfo) error {
+		digests = append(digests, obj.Digest)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing blobstore: %w", err)
+	}
+
+	var checked, corrupt, failed int
+	var errs error
+	for _, digest := range digests {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		result, err := s.check(ctx, digest, thr)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				continue // removed since it was listed
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Errorw("checking blob", "blob", digestutil.Format(digest), "error", err)
+			errs = errors.Join(errs, fmt.Errorf("checking blob %s: %w", digestutil.Format(digest), err))
+			continue
+		}
+		checked++
+
+		if result.Status == scrub.StatusError {
+			failed++
+			log.Errorw("reading blob", "blob", digestutil.Format(digest), "error", result.Message)
+		}
+		if result.Status == scrub.StatusCorrupt {
+			corrupt++
+			log.Errorw("blob is corrupt", "blob", digestutil.Format(digest), "reason", result.Message)
+			if s.quarantiner != nil {
+				err := s.quarantiner.Quarantine(ctx, digest)
+				if err != nil {
+					errs = errors.Join(errs, fmt.Errorf("quarantining blob %s: %w", digestutil.Format(digest), err))
+				} else {
+					result.Quarantined = true
+					log.Warnw("quarantined blob", "blob", digestutil.Format(digest))
+				}
+			}
+		}
+
+		err = s.report.Put(ctx, result)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("recording result for blob %s: %w", digestutil.Format(digest), err))
+		}
+	}
+
+	log.Infow("scrub pass complete", "checked", checked, "corrupt", corrupt, "failed", failed, "bytes", thr.total, "duration", time.Since(start))
+	return errs
+}
+
+// check re-hashes the blob and compares it to the digest. Only a mismatch or a
+// truncated read is reported as corrupt; other read errors are reported with
+// [scrub.StatusError]. An error is returned only if the check could not be
+// started.
+func (s *Service) check(ctx context.Context, digest multihash.Multihash, thr *throttle) (scrub.Result, error) {
+	result := scrub.Result{Digest: digest, Checked: uint64(time.Now().Unix())}
+
+	obj, err := s.blobs.Get(ctx, digest)
+	if err != nil {
+		return result, err
+	}
+
+	body := &throttledReader{ctx: ctx, r: obj.Body(), t: thr}
+	vr, err := blobstore.NewVerifyingReader(body, digest, uint64(obj.Size()))
+	if err != nil {
+		return result, err
+	}
+
+	_, err = io.Copy(io.Discard, vr)
+	result.Size = uint64(body.n)
+	if err != nil {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		result.Status = scrub.StatusCorrupt
+		switch {
+		case errors.Is(err, blobstore.ErrTooSmall), errors.Is(err, blobstore.ErrTooLarge), errors.Is(err, io.ErrUnexpectedEOF):
+			result.Message = fmt.Sprintf("read %d bytes but object size is %d", body.n, obj.Size())
+		case errors.Is(err, blobstore.ErrDataInconsistent), errors.Is(err, blobstore.ErrDecryptionFailed):
+			result.Message = err.Error()
+		default:
+			result.Status = scrub.StatusError
+			result.Message = fmt.Sprintf("reading blob: %s", err)
+		}
+		return result, nil
+	}
+	result.Status = scrub.StatusOK
+	return result, nil
+}
+
+// Start begins periodic scrubbing.
+func (s *Service) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := s.Scrub(ctx)
+				if err != nil && !errors.Is(err, context.Canceled) {
+					log.Errorf("scrub failed: %s", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends periodic scrubbing, aborting any in progress pass.
+func (s *Service) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+// throttle limits the rate at which bytes are read over a scrub pass.
+type throttle struct {
+	rate  uint64
+	start time.Time
+	total uint64
+}
+
+func newThrottle(rate uint64) *throttle {
+	return &throttle{rate: rate, start: time.Now()}
+}
+
+// wait records that n bytes were read and blocks until reading them is
+// within the rate limit.
+func (t *throttle) wait(ctx context.Context, n int) error {
+	t.total += uint64(n)
+	if t.rate == 0 {
+		return nil
+	}
+	due := t.start.Add(time.Duration(float64(t.total) / float64(t.rate) * float64(time.Second)))
+	delay := time.Until(due)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type throttledReader struct {
+	ctx context.Context
+	r   io.Reader
+	t   *throttle
+	n   int64
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if werr := r.t.wait(r.ctx, n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
@@ -0,0 +1,193 @@
+package scrubber
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/scrubstore"
+	"github.com/storacha/piri/pkg/store/scrubstore/scrub"
+)
+
+func TestScrubber(t *testing.T) {
+	t.Run("records intact blob", func(t *testing.T) {
+		blobs, _ := newFsBlobstore(t)
+		s := newScrubber(t, blobs)
+		data, digest := putRandomBlob(t, blobs)
+
+		err := s.Scrub(context.Background())
+		require.NoError(t, err)
+
+		result, err := s.Report().Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, scrub.StatusOK, result.Status)
+		require.Equal(t, uint64(len(data)), result.Size)
+		require.False(t, result.Quarantined)
+
+		_, err = blobs.Get(context.Background(), digest)
+		require.NoError(t, err)
+	})
+
+	t.Run("quarantines corrupt blob", func(t *testing.T) {
+		blobs, rootdir := newFsBlobstore(t)
+		s := newScrubber(t, blobs)
+		data, digest := putRandomBlob(t, blobs)
+
+		// flip a bit in the stored file
+		name := findFile(t, rootdir)
+		data[0] ^= 1
+		require.NoError(t, os.WriteFile(name, data, 0644))
+
+		err := s.Scrub(context.Background())
+		require.NoError(t, err)
+
+		result, err := s.Report().Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, scrub.StatusCorrupt, result.Status)
+		require.True(t, result.Quarantined)
+		require.NotEmpty(t, result.Message)
+
+		_, err = blobs.Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+
+		corrupt, err := s.Report().List(context.Background(), scrub.StatusCorrupt)
+		require.NoError(t, err)
+		require.Len(t, corrupt, 1)
+		require.Equal(t, digest, corrupt[0].Digest)
+	})
+
+	t.Run("detects truncated blob", func(t *testing.T) {
+		blobs, rootdir := newFsBlobstore(t)
+		s := newScrubber(t, blobs)
+		data, digest := putRandomBlob(t, blobs)
+
+		name := findFile(t, rootdir)
+		require.NoError(t, os.WriteFile(name, data[:len(data)/2], 0644))
+
+		err := s.Scrub(context.Background())
+		require.NoError(t, err)
+
+		result, err := s.Report().Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, scrub.StatusCorrupt, result.Status)
+	})
+
+	t.Run("reports read errors without quarantining", func(t *testing.T) {
+		blobs := &unreadableBlobstore{MapBlobstore: blobstore.NewMapBlobstore()}
+		s := newScrubber(t, blobs)
+		_, digest := putRandomBlob(t, blobs)
+
+		err := s.Scrub(context.Background())
+		require.NoError(t, err)
+
+		result, err := s.Report().Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, scrub.StatusError, result.Status)
+		require.False(t, result.Quarantined)
+		require.Contains(t, result.Message, "input/output error")
+
+		_, err = blobs.MapBlobstore.Get(context.Background(), digest)
+		require.NoError(t, err)
+	})
+
+	t.Run("limits read rate", func(t *testing.T) {
+		blobs := blobstore.NewMapBlobstore()
+		report, err := scrubstore.NewDsScrubStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+		s, err := New(blobs, report, WithRate(256))
+		require.NoError(t, err)
+
+		data := testutil.RandomBytes(t, 128)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		require.NoError(t, blobs.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		start := time.Now()
+		err = s.Scrub(context.Background())
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	})
+
+	t.Run("requires enumerable blobstore", func(t *testing.T) {
+		report, err := scrubstore.NewDsScrubStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+		// embedding hides the methods of the underlying store
+		unlistable := struct{ blobstore.Blobstore }{blobstore.NewMapBlobstore()}
+		_, err = New(unlistable, report)
+		require.Error(t, err)
+	})
+}
+
+// unreadableBlobstore fails to read the body of every blob.
+type unreadableBlobstore struct {
+	*blobstore.MapBlobstore
+}
+
+func (u *unreadableBlobstore) Get(ctx context.Context, digest multihash.Multihash, opts ...blobstore.GetOption) (blobstore.Object, error) {
+	obj, err := u.MapBlobstore.Get(ctx, digest, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return unreadableObject{obj}, nil
+}
+
+type unreadableObject struct {
+	blobstore.Object
+}
+
+func (unreadableObject) Body() io.Reader {
+	return iotest.ErrReader(errors.New("input/output error"))
+}
+
+func newFsBlobstore(t *testing.T) (*blobstore.FsBlobstore, string) {
+	rootdir := t.TempDir()
+	blobs, err := blobstore.NewFsBlobstore(rootdir, t.TempDir())
+	require.NoError(t, err)
+	return blobs, rootdir
+}
+
+func newScrubber(t *testing.T, blobs blobstore.Blobstore) *Service {
+	report, err := scrubstore.NewDsScrubStore(datastore.NewMapDatastore())
+	require.NoError(t, err)
+	s, err := New(blobs, report, WithRate(0))
+	require.NoError(t, err)
+	return s
+}
+
+func putRandomBlob(t *testing.T, blobs blobstore.Blobstore) ([]byte, multihash.Multihash) {
+	data := testutil.RandomBytes(t, 64)
+	digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+	err := blobs.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+	require.NoError(t, err)
+	return data, digest
+}
+
+// findFile returns the path of the only file in the passed directory tree.
+func findFile(t *testing.T, root string) string {
+	var name string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			name = p
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, name)
+	return name
+}
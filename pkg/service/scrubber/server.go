@@ -0,0 +1,115 @@
+package scrubber
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/storacha/piri/internal/telemetry"
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/scrubstore/scrub"
+)
+
+// BlobReport is the most recent result of checking a blob, as served by the
+// scrub report API.
+type BlobReport struct {
+	// Blob is the multibase encoded digest of the blob.
+	Blob string `json:"blob"`
+	// Size is the number of bytes read from the store.
+	Size uint64 `json:"size"`
+	// Status is one of [scrub.StatusOK], [scrub.StatusCorrupt] or
+	// [scrub.StatusError].
+	Status      string    `json:"status"`
+	Checked     time.Time `json:"checked"`
+	Quarantined bool      `json:"quarantined"`
+	Message     string    `json:"message,omitempty"`
+}
+
+func newBlobReport(r scrub.Result) BlobReport {
+	return BlobReport{
+		Blob:        digestutil.Format(r.Digest),
+		Size:        r.Size,
+		Status:      r.Status,
+		Checked:     time.Unix(int64(r.Checked), 0).UTC(),
+		Quarantined: r.Quarantined,
+		Message:     r.Message,
+	}
+}
+
+type Server struct {
+	scrubber Scrubber
+}
+
+func NewServer(scrubber Scrubber) (*Server, error) {
+	return &Server{scrubber}, nil
+}
+
+func (srv *Server) Serve(mux *http.ServeMux) {
+	mux.Handle("GET /scrub", NewHandler(srv.scrubber))
+	mux.Handle("GET /scrub/{blob}", NewBlobHandler(srv.scrubber))
+}
+
+// NewHandler lists the blobs whose most recent check had the status in the
+// "status" query parameter as JSON. It lists corrupt blobs by default.
+func NewHandler(scrubber Scrubber) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = scrub.StatusCorrupt
+		}
+		if status != scrub.StatusOK && status != scrub.StatusCorrupt && status != scrub.StatusError {
+			return telemetry.NewHTTPError(fmt.Errorf("invalid status: %s", status), http.StatusBadRequest)
+		}
+
+		results, err := scrubber.Report().List(r.Context(), status)
+		if err != nil {
+			return telemetry.NewHTTPError(fmt.Errorf("failed to list scrub results: %w", err), http.StatusInternalServerError)
+		}
+		reports := []BlobReport{}
+		for _, result := range results {
+			reports = append(reports, newBlobReport(result))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(reports)
+		if err != nil {
+			return fmt.Errorf("serving scrub results: %w", err)
+		}
+
+		return nil
+	}
+
+	return telemetry.NewErrorReportingHandler(handler)
+}
+
+// NewBlobHandler reports the most recent check of the blob in the path as
+// JSON.
+func NewBlobHandler(scrubber Scrubber) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		digest, err := digestutil.Parse(r.PathValue("blob"))
+		if err != nil {
+			return telemetry.NewHTTPError(fmt.Errorf("invalid blob digest: %w", err), http.StatusBadRequest)
+		}
+
+		result, err := scrubber.Report().Get(r.Context(), digest)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return telemetry.NewHTTPError(fmt.Errorf("not found: %s", r.PathValue("blob")), http.StatusNotFound)
+			}
+			return telemetry.NewHTTPError(fmt.Errorf("failed to get scrub result: %w", err), http.StatusInternalServerError)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(newBlobReport(result))
+		if err != nil {
+			return fmt.Errorf("serving scrub result: %w", err)
+		}
+
+		return nil
+	}
+
+	return telemetry.NewErrorReportingHandler(handler)
+}
@@ -0,0 +1,71 @@
+package scrubber
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store/scrubstore/scrub"
+)
+
+func TestServer(t *testing.T) {
+	blobs, rootdir := newFsBlobstore(t)
+	s := newScrubber(t, blobs)
+	data, digest := putRandomBlob(t, blobs)
+	data[0] ^= 1
+	require.NoError(t, os.WriteFile(findFile(t, rootdir), data, 0644))
+	require.NoError(t, s.Scrub(context.Background()))
+
+	mux := http.NewServeMux()
+	srv, err := NewServer(s)
+	require.NoError(t, err)
+	srv.Serve(mux)
+
+	t.Run("lists corrupt blobs", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/scrub", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var reports []BlobReport
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&reports))
+		require.Len(t, reports, 1)
+		require.Equal(t, digestutil.Format(digest), reports[0].Blob)
+		require.Equal(t, scrub.StatusCorrupt, reports[0].Status)
+		require.True(t, reports[0].Quarantined)
+	})
+
+	t.Run("lists blobs by status", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/scrub?status=ok", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, "[]", rec.Body.String())
+
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/scrub?status=bogus", nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("reports a blob", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/scrub/"+digestutil.Format(digest), nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var report BlobReport
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+		require.Equal(t, digestutil.Format(digest), report.Blob)
+		require.Equal(t, scrub.StatusCorrupt, report.Status)
+	})
+
+	t.Run("blob not checked", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/scrub/"+digestutil.Format(testutil.RandomMultihash(t)), nil))
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/multiformats/go-multihash"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/pdp"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/publisher"
+	"github.com/storacha/piri/pkg/store"
+)
+
+// blobGetter reads blobs stored on this node. When PDP is enabled blobs are
+// stored as pieces, so they are located via their allocation and read from
+// the piece URL.
+type blobGetter struct {
+	pdp    pdp.PDP
+	blobs  blobs.Blobs
+	client *http.Client
+}
+
+var _ publisher.BlobGetter = (*blobGetter)(nil)
+
+func (g *blobGetter) Get(ctx context.Context, digest multihash.Multihash) (io.ReadCloser, error) {
+	if g.pdp == nil {
+		obj, err := g.blobs.Store().Get(ctx, digest)
+		if err != nil {
+			return nil, err
+		}
+		if rc, ok := obj.Body().(io.ReadCloser); ok {
+			return rc, nil
+		}
+		return io.NopCloser(obj.Body()), nil
+	}
+
+	allocs, err := g.blobs.Allocations().List(ctx, digest)
+	if err != nil {
+		return nil, fmt.Errorf("listing allocations: %w", err)
+	}
+	if len(allocs) == 0 {
+		return nil, fmt.Errorf("no allocation for blob %s: %w", digestutil.Format(digest), store.ErrNotFound)
+	}
+
+	piece, err := g.pdp.PieceFinder().FindPiece(ctx, digest, allocs[0].Blob.Size)
+	if err != nil {
+		return nil, fmt.Errorf("finding piece: %w", err)
+	}
+	loc := g.pdp.PieceFinder().URLForPiece(piece)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, loc.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	res, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading piece: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("reading piece: unexpected status: %d", res.StatusCode)
+	}
+	return res.Body, nil
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"time"
 
 	"github.com/storacha/go-libstoracha/capabilities/assert"
 	"github.com/storacha/go-libstoracha/capabilities/blob"
 	pdp_cap "github.com/storacha/go-libstoracha/capabilities/pdp"
 	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-libstoracha/piece/piece"
 	"github.com/storacha/go-ucanto/core/delegation"
 	"github.com/storacha/go-ucanto/core/invocation"
 	"github.com/storacha/go-ucanto/did"
@@ -20,6 +23,7 @@ import (
 	"github.com/storacha/piri/pkg/service/blobs"
 	"github.com/storacha/piri/pkg/service/claims"
 	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/blobstore"
 )
 
 type AcceptService interface {
@@ -39,6 +43,9 @@ type AcceptResponse struct {
 	Claim delegation.Delegation
 	// only present when using PDP
 	PDP invocation.Invocation
+	// Equals is the claim that the blob is equivalent to its piece, only present
+	// when using PDP.
+	Equals delegation.Delegation
 }
 
 func Accept(ctx context.Context, s AcceptService, req *AcceptRequest) (*AcceptResponse, error) {
@@ -49,9 +56,11 @@ func Accept(ctx context.Context, s AcceptService, req *AcceptRequest) (*AcceptRe
 		err          error
 		loc          url.URL
 		pdpAcceptInv invocation.Invocation
+		pdpPiece     piece.PieceLink
 	)
 	if s.PDP() == nil {
-		_, err = s.Blobs().Store().Get(ctx, req.Blob.Digest)
+		var obj blobstore.Object
+		obj, err = s.Blobs().Store().Get(ctx, req.Blob.Digest)
 		if err != nil {
 			if errors.Is(err, store.ErrNotFound) {
 				return nil, fmt.Errorf("blob not found: %w", err)
@@ -59,6 +68,9 @@ func Accept(ctx context.Context, s AcceptService, req *AcceptRequest) (*AcceptRe
 			log.Errorw("getting blob", "error", err)
 			return nil, fmt.Errorf("getting blob: %w", err)
 		}
+		if c, ok := obj.Body().(io.Closer); ok {
+			c.Close()
+		}
 
 		loc, err = s.Blobs().Access().GetDownloadURL(req.Blob.Digest)
 		if err != nil {
@@ -67,7 +79,7 @@ func Accept(ctx context.Context, s AcceptService, req *AcceptRequest) (*AcceptRe
 		}
 	} else {
 		// locate the piece from the pdp service
-		pdpPiece, err := s.PDP().PieceFinder().FindPiece(ctx, req.Blob.Digest, req.Blob.Size)
+		pdpPiece, err = s.PDP().PieceFinder().FindPiece(ctx, req.Blob.Digest, req.Blob.Size)
 		if err != nil {
 			log.Errorw("finding piece for blob", "error", err)
 			return nil, fmt.Errorf("finding piece for blob: %w", err)
@@ -95,6 +107,19 @@ func Accept(ctx context.Context, s AcceptService, req *AcceptRequest) (*AcceptRe
 		pdpAcceptInv = pieceAccept
 	}
 
+	err = s.Blobs().Usage().Receive(ctx, req.Space, req.Blob.Digest)
+	if err != nil {
+		log.Errorw("recording usage", "error", err)
+		return nil, fmt.Errorf("recording usage: %w", err)
+	}
+	s.Blobs().Capacity().Commit(ctx, req.Blob.Digest)
+
+	// expiring claims are renewed for as long as the blob is stored here
+	expiration := delegation.WithNoExpiration()
+	if ttl := s.Claims().LocationClaimExpiration(); ttl > 0 {
+		expiration = delegation.WithExpiration(int(time.Now().Add(ttl).Unix()))
+	}
+
 	claim, err := assert.Location.Delegate(
 		s.ID(),
 		req.Space,
@@ -104,7 +129,7 @@ func Accept(ctx context.Context, s AcceptService, req *AcceptRequest) (*AcceptRe
 			Content:  types.FromHash(req.Blob.Digest),
 			Location: []url.URL{loc},
 		},
-		delegation.WithNoExpiration(),
+		expiration,
 	)
 	if err != nil {
 		log.Errorw("creating location commitment", "error", err)
@@ -123,8 +148,39 @@ func Accept(ctx context.Context, s AcceptService, req *AcceptRequest) (*AcceptRe
 		return nil, fmt.Errorf("publishing location commitment: %w", err)
 	}
 
+	var equals delegation.Delegation
+	if pdpPiece != nil {
+		equals, err = assert.Equals.Delegate(
+			s.ID(),
+			req.Space,
+			s.ID().DID().String(),
+			assert.EqualsCaveats{
+				Content: types.FromHash(req.Blob.Digest),
+				Equals:  pdpPiece.Link(),
+			},
+			delegation.WithNoExpiration(),
+		)
+		if err != nil {
+			log.Errorw("creating equals claim", "error", err)
+			return nil, fmt.Errorf("creating equals claim: %w", err)
+		}
+
+		err = s.Claims().Store().Put(ctx, equals)
+		if err != nil {
+			log.Errorw("putting equals claim for blob", "error", err)
+			return nil, fmt.Errorf("putting equals claim for blob: %w", err)
+		}
+
+		err = s.Claims().Publisher().Publish(ctx, equals)
+		if err != nil {
+			log.Errorw("publishing equals claim", "error", err)
+			return nil, fmt.Errorf("publishing equals claim: %w", err)
+		}
+	}
+
 	return &AcceptResponse{
-		Claim: claim,
-		PDP:   pdpAcceptInv,
+		Claim:  claim,
+		PDP:    pdpAcceptInv,
+		Equals: equals,
 	}, nil
 }
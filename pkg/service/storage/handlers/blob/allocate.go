@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"time"
@@ -17,8 +18,11 @@ import (
 	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/pdp"
 	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/capacity"
 	"github.com/storacha/piri/pkg/store"
 	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
 )
 
 var log = logging.Logger("storage/handlers/blob")
@@ -39,7 +43,13 @@ type AllocateResponse struct {
 	Address *blob.Address
 }
 
-func Allocate(ctx context.Context, s AllocateService, req *AllocateRequest) (*AllocateResponse, error) {
+// Allocate creates an allocation for a blob in a space, returning an address
+// to upload the blob to if it has not been received. A new allocation in a
+// space is counted against the space's usage, and is refused with a
+// [usagestore.QuotaExceededError] when a quota would be exceeded. Space is
+// reserved for a blob that has not been received, and the allocation is
+// refused with a [capacity.InsufficientCapacityError] when the node is full.
+func Allocate(ctx context.Context, s AllocateService, req *AllocateRequest) (_ *AllocateResponse, err error) {
 	log := log.With("blob", digestutil.Format(req.Blob.Digest))
 	log.Infof("%s space: %s", blob.AllocateAbility, req.Space)
 
@@ -64,7 +74,13 @@ func Allocate(ctx context.Context, s AllocateService, req *AllocateRequest) (*Al
 		if s.PDP() != nil {
 			_, err = s.PDP().PieceFinder().FindPiece(ctx, req.Blob.Digest, req.Blob.Size)
 		} else {
-			_, err = s.Blobs().Store().Get(ctx, req.Blob.Digest)
+			var obj blobstore.Object
+			obj, err = s.Blobs().Store().Get(ctx, req.Blob.Digest)
+			if err == nil {
+				if c, ok := obj.Body().(io.Closer); ok {
+					c.Close()
+				}
+			}
 		}
 		if err == nil {
 			received = true
@@ -94,6 +110,28 @@ func Allocate(ctx context.Context, s AllocateService, req *AllocateRequest) (*Al
 		}, nil
 	}
 
+	// count the bytes against the space before handing out an upload address
+	if !allocated {
+		err = s.Blobs().Usage().Allocate(ctx, req.Space, req.Blob.Digest, req.Blob.Size)
+		if err != nil {
+			var qerr usagestore.QuotaExceededError
+			if errors.As(err, &qerr) {
+				log.Warnw("refusing allocation", "error", err)
+				return nil, qerr
+			}
+			log.Errorw("recording usage", "error", err)
+			return nil, fmt.Errorf("recording usage: %w", err)
+		}
+		defer func() {
+			if err == nil {
+				return
+			}
+			if rerr := s.Blobs().Usage().Release(ctx, req.Space, req.Blob.Digest); rerr != nil {
+				log.Errorw("releasing usage", "error", rerr)
+			}
+		}()
+	}
+
 	expiresIn := uint64(60 * 60 * 24) // 1 day
 	expiresAt := uint64(time.Now().Unix()) + expiresIn
 
@@ -101,6 +139,27 @@ func Allocate(ctx context.Context, s AllocateService, req *AllocateRequest) (*Al
 	// if not received yet, we need to generate a signed URL for the
 	// upload, and include it in the receipt.
 	if !received {
+		var reserved bool
+		reserved, err = s.Blobs().Capacity().Reserve(ctx, req.Blob.Digest, req.Blob.Size, expiresAt)
+		if err != nil {
+			var cerr capacity.InsufficientCapacityError
+			if errors.As(err, &cerr) {
+				log.Warnw("refusing allocation", "error", err)
+				return nil, cerr
+			}
+			log.Errorw("reserving capacity", "error", err)
+			return nil, fmt.Errorf("reserving capacity: %w", err)
+		}
+		// a reservation already exists if the blob was allocated previously and
+		// is still awaited, in which case it must outlive this allocation
+		if reserved {
+			defer func() {
+				if err != nil {
+					s.Blobs().Capacity().Cancel(ctx, req.Blob.Digest)
+				}
+			}()
+		}
+
 		var uploadURL url.URL
 		headers := http.Header{}
 		if s.PDP() == nil {
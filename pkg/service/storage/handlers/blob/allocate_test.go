@@ -0,0 +1,101 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/pdp"
+	"github.com/storacha/piri/pkg/presigner"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/capacity"
+	"github.com/storacha/piri/pkg/store/allocationstore"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
+)
+
+func TestAllocate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("cancels a reservation it made when allocation fails", func(t *testing.T) {
+		s := newAllocateService(t)
+		digest := testutil.RandomMultihash(t)
+		// an earlier allocation whose reservation no longer exists, e.g. after a
+		// restart
+		require.NoError(t, s.blobs.Allocations().Put(ctx, allocation.Allocation{
+			Space:   testutil.RandomDID(t),
+			Blob:    allocation.Blob{Digest: digest, Size: 32},
+			Expires: uint64(time.Now().Add(time.Hour).Unix()),
+			Cause:   testutil.RandomCID(t),
+		}))
+
+		_, err := Allocate(ctx, s, &AllocateRequest{
+			Space: testutil.RandomDID(t),
+			Blob:  types.Blob{Digest: digest, Size: 32},
+			Cause: testutil.RandomCID(t),
+		})
+		require.Error(t, err)
+
+		c, err := s.blobs.Capacity().Capacity(ctx)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), c.Reserved)
+	})
+
+	t.Run("keeps an existing reservation when allocation fails", func(t *testing.T) {
+		s := newAllocateService(t)
+		digest := testutil.RandomMultihash(t)
+		_, err := s.blobs.Capacity().Reserve(ctx, digest, 32, uint64(time.Now().Add(time.Hour).Unix()))
+		require.NoError(t, err)
+
+		_, err = Allocate(ctx, s, &AllocateRequest{
+			Space: testutil.RandomDID(t),
+			Blob:  types.Blob{Digest: digest, Size: 32},
+			Cause: testutil.RandomCID(t),
+		})
+		require.Error(t, err)
+
+		c, err := s.blobs.Capacity().Capacity(ctx)
+		require.NoError(t, err)
+		require.Equal(t, uint64(32), c.Reserved)
+	})
+}
+
+type allocateService struct {
+	blobs blobs.Blobs
+}
+
+func (s *allocateService) PDP() pdp.PDP       { return nil }
+func (s *allocateService) Blobs() blobs.Blobs { return s.blobs }
+
+func newAllocateService(t *testing.T) *allocateService {
+	allocs := testutil.Must(allocationstore.NewDsAllocationStore(datastore.NewMapDatastore()))(t)
+	bs := blobstore.NewMapBlobstore()
+	capacityMgr := testutil.Must(capacity.New(allocs, bs))(t)
+	b := testutil.Must(blobs.New(
+		blobs.WithBlobstore(bs),
+		blobs.WithAllocationStore(allocs),
+		blobs.WithUsageStore(testutil.Must(usagestore.NewDsUsageStore(datastore.NewMapDatastore()))(t)),
+		blobs.WithCapacity(capacityMgr),
+		blobs.WithPresigner(failingPresigner{}),
+	))(t)
+	return &allocateService{blobs: b}
+}
+
+// failingPresigner fails to sign upload URLs.
+type failingPresigner struct {
+	presigner.RequestPresigner
+}
+
+func (failingPresigner) SignUploadURL(context.Context, multihash.Multihash, uint64, uint64) (url.URL, http.Header, error) {
+	return url.URL{}, nil, errors.New("signer unavailable")
+}
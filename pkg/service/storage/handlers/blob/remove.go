@@ -0,0 +1,190 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/ucan"
+
+	blobcap "github.com/storacha/piri/pkg/capabilities/blob"
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/pdp"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/claims"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/claimstore"
+)
+
+type RemoveService interface {
+	PDP() pdp.PDP
+	Blobs() blobs.Blobs
+	Claims() claims.Claims
+	BlobLocks() *digestutil.Locks
+}
+
+type RemoveRequest struct {
+	Space  did.DID
+	Digest multihash.Multihash
+}
+
+type RemoveResponse struct {
+	// Size is the number of bytes released from the space.
+	Size uint64
+}
+
+// Remove drops the allocations for a blob in the passed space. When no other
+// space references the blob, the bytes and location and equals claims are
+// removed and, when using PDP, the piece is scheduled for removal from the
+// proof set. The allocations are deleted last, so that if removal fails part
+// way through, a retry finds them and finishes the cleanup. The blob is locked
+// throughout, so that the collector and renewer do not act on it at the same
+// time.
+func Remove(ctx context.Context, s RemoveService, req *RemoveRequest) (*RemoveResponse, error) {
+	log := log.With("blob", digestutil.Format(req.Digest))
+	log.Infof("%s %s", blobcap.RemoveAbility, req.Space)
+
+	unlock := s.BlobLocks().Lock(req.Digest)
+	defer unlock()
+
+	allocs, err := s.Blobs().Allocations().List(ctx, req.Digest)
+	if err != nil {
+		log.Errorw("getting allocations", "error", err)
+		return nil, fmt.Errorf("getting allocations: %w", err)
+	}
+
+	var size uint64
+	var removed []allocation.Allocation
+	remaining := 0
+	for _, a := range allocs {
+		if a.Space != req.Space {
+			remaining++
+			continue
+		}
+		size = a.Blob.Size
+		removed = append(removed, a)
+	}
+
+	// nothing to do
+	if len(removed) == 0 {
+		log.Info("no allocation for blob in space")
+		return &RemoveResponse{Size: 0}, nil
+	}
+
+	err = s.Blobs().Usage().Release(ctx, req.Space, req.Digest)
+	if err != nil {
+		log.Errorw("releasing usage", "error", err)
+		return nil, fmt.Errorf("releasing usage: %w", err)
+	}
+	if remaining == 0 {
+		s.Blobs().Capacity().Cancel(ctx, req.Digest)
+	}
+
+	// remove location claims for this space, or for every space along with
+	// the equals claims if the blob is no longer referenced, and retract their
+	// advertisements
+	if lister, ok := s.Claims().Store().(claimstore.ContentLister); ok {
+		links, err := lister.ListByContent(ctx, req.Digest)
+		if err != nil {
+			log.Errorw("listing claims", "error", err)
+			return nil, fmt.Errorf("listing claims: %w", err)
+		}
+		claims := map[did.DID][]ucan.Link{}
+		var equals []ucan.Link
+		for _, l := range links {
+			claim, err := s.Claims().Store().Get(ctx, l)
+			if err != nil {
+				// the claim was removed since it was listed
+				if errors.Is(err, store.ErrNotFound) {
+					continue
+				}
+				log.Errorw("getting claim", "claim", l, "error", err)
+				return nil, fmt.Errorf("getting claim: %w", err)
+			}
+			if claim.Capabilities()[0].Can() == assert.EqualsAbility {
+				if remaining == 0 {
+					equals = append(equals, l)
+				}
+				continue
+			}
+			nb, err := assert.LocationCaveatsReader.Read(claim.Capabilities()[0].Nb())
+			if err != nil {
+				log.Errorw("reading location claim", "claim", l, "error", err)
+				return nil, fmt.Errorf("reading location claim: %w", err)
+			}
+			if remaining > 0 && nb.Space != req.Space {
+				continue
+			}
+			claims[nb.Space] = append(claims[nb.Space], l)
+		}
+		// retract before deleting, so claims are kept while they are still advertised
+		for space, links := range claims {
+			err = s.Claims().Publisher().Retract(ctx, space, req.Digest)
+			if err != nil {
+				log.Errorw("retracting location commitment", "space", space, "error", err)
+				return nil, fmt.Errorf("retracting location commitment: %w", err)
+			}
+			for _, l := range links {
+				err = s.Claims().Store().Delete(ctx, l)
+				if err != nil {
+					log.Errorw("deleting location claim", "claim", l, "error", err)
+					return nil, fmt.Errorf("deleting location claim: %w", err)
+				}
+			}
+		}
+		if len(equals) > 0 {
+			err = s.Claims().Publisher().RetractEquals(ctx, req.Digest)
+			if err != nil {
+				log.Errorw("retracting equals claims", "error", err)
+				return nil, fmt.Errorf("retracting equals claims: %w", err)
+			}
+			for _, l := range equals {
+				err = s.Claims().Store().Delete(ctx, l)
+				if err != nil {
+					log.Errorw("deleting equals claim", "claim", l, "error", err)
+					return nil, fmt.Errorf("deleting equals claim: %w", err)
+				}
+			}
+		}
+	} else {
+		log.Warn("claim store does not support listing claims by content, location claims not removed")
+	}
+
+	if remaining > 0 {
+		log.Infof("blob still referenced by %d allocations", remaining)
+	} else if s.PDP() == nil {
+		err = s.Blobs().Store().Delete(ctx, req.Digest)
+		if err != nil {
+			log.Errorw("deleting blob", "error", err)
+			return nil, fmt.Errorf("deleting blob: %w", err)
+		}
+	} else {
+		pdpPiece, err := s.PDP().PieceFinder().FindPiece(ctx, req.Digest, size)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Errorw("finding piece for blob", "error", err)
+			return nil, fmt.Errorf("finding piece for blob: %w", err)
+		}
+		// a piece that is not found was removed by an earlier attempt
+		if err == nil {
+			err = s.PDP().PieceRemover().RemovePiece(ctx, pdpPiece)
+			if err != nil {
+				log.Errorw("removing piece from proof set", "error", err)
+				return nil, fmt.Errorf("removing piece from proof set: %w", err)
+			}
+		}
+	}
+
+	for _, a := range removed {
+		err := s.Blobs().Allocations().Delete(ctx, req.Digest, a.Cause)
+		if err != nil {
+			log.Errorw("deleting allocation", "error", err)
+			return nil, fmt.Errorf("deleting allocation: %w", err)
+		}
+	}
+
+	return &RemoveResponse{Size: size}, nil
+}
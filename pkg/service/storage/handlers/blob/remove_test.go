@@ -0,0 +1,216 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/pdp"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/capacity"
+	"github.com/storacha/piri/pkg/service/claims"
+	"github.com/storacha/piri/pkg/service/publisher"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/allocationstore"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/claimstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
+)
+
+func TestRemove(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("finishes the cleanup when retried after a failure", func(t *testing.T) {
+		s := newRemoveService(t)
+		space := testutil.RandomDID(t)
+		data := testutil.RandomBytes(t, 32)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		require.NoError(t, s.blobs.Store().Put(ctx, digest, uint64(len(data)), bytes.NewReader(data)))
+		require.NoError(t, s.blobs.Allocations().Put(ctx, allocation.Allocation{
+			Space:   space,
+			Blob:    allocation.Blob{Digest: digest, Size: uint64(len(data))},
+			Expires: allocation.Retained,
+			Cause:   testutil.RandomCID(t),
+		}))
+		claim := putLocationClaim(t, s.claims.store, space, digest)
+
+		s.store.deleteErr = errors.New("disk on fire")
+		_, err := Remove(ctx, s, &RemoveRequest{Space: space, Digest: digest})
+		require.Error(t, err)
+
+		// the allocation is kept so the removal can be retried
+		allocs, err := s.blobs.Allocations().List(ctx, digest)
+		require.NoError(t, err)
+		require.Len(t, allocs, 1)
+
+		s.store.deleteErr = nil
+		res, err := Remove(ctx, s, &RemoveRequest{Space: space, Digest: digest})
+		require.NoError(t, err)
+		require.Equal(t, uint64(len(data)), res.Size)
+
+		allocs, err = s.blobs.Allocations().List(ctx, digest)
+		require.NoError(t, err)
+		require.Empty(t, allocs)
+		_, err = s.blobs.Store().Get(ctx, digest)
+		require.ErrorIs(t, err, store.ErrNotFound)
+		_, err = s.claims.store.Get(ctx, claim.Link())
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+
+	t.Run("keeps equals claims until the blob is no longer referenced", func(t *testing.T) {
+		s := newRemoveService(t)
+		data := testutil.RandomBytes(t, 32)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		require.NoError(t, s.blobs.Store().Put(ctx, digest, uint64(len(data)), bytes.NewReader(data)))
+		var spaces []did.DID
+		for range 2 {
+			space := testutil.RandomDID(t)
+			require.NoError(t, s.blobs.Allocations().Put(ctx, allocation.Allocation{
+				Space:   space,
+				Blob:    allocation.Blob{Digest: digest, Size: uint64(len(data))},
+				Expires: allocation.Retained,
+				Cause:   testutil.RandomCID(t),
+			}))
+			spaces = append(spaces, space)
+		}
+		equals, err := assert.Equals.Delegate(
+			testutil.Alice,
+			spaces[0],
+			testutil.Alice.DID().String(),
+			assert.EqualsCaveats{Content: types.FromHash(digest), Equals: testutil.RandomCID(t)},
+			delegation.WithNoExpiration(),
+		)
+		require.NoError(t, err)
+		require.NoError(t, s.claims.store.Put(ctx, equals))
+
+		_, err = Remove(ctx, s, &RemoveRequest{Space: spaces[0], Digest: digest})
+		require.NoError(t, err)
+		_, err = s.claims.store.Get(ctx, equals.Link())
+		require.NoError(t, err)
+
+		_, err = Remove(ctx, s, &RemoveRequest{Space: spaces[1], Digest: digest})
+		require.NoError(t, err)
+		_, err = s.claims.store.Get(ctx, equals.Link())
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+
+	t.Run("waits for the blob to be released", func(t *testing.T) {
+		s := newRemoveService(t)
+		space := testutil.RandomDID(t)
+		data := testutil.RandomBytes(t, 32)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		require.NoError(t, s.blobs.Store().Put(ctx, digest, uint64(len(data)), bytes.NewReader(data)))
+		require.NoError(t, s.blobs.Allocations().Put(ctx, allocation.Allocation{
+			Space:   space,
+			Blob:    allocation.Blob{Digest: digest, Size: uint64(len(data))},
+			Expires: allocation.Retained,
+			Cause:   testutil.RandomCID(t),
+		}))
+
+		unlock := s.locks.Lock(digest)
+		done := make(chan error, 1)
+		go func() {
+			_, err := Remove(ctx, s, &RemoveRequest{Space: space, Digest: digest})
+			done <- err
+		}()
+		select {
+		case <-done:
+			t.Fatal("removed while the blob was locked")
+		case <-time.After(50 * time.Millisecond):
+		}
+		_, err := s.blobs.Store().Get(ctx, digest)
+		require.NoError(t, err)
+
+		unlock()
+		require.NoError(t, <-done)
+		_, err = s.blobs.Store().Get(ctx, digest)
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+}
+
+type removeService struct {
+	blobs  blobs.Blobs
+	store  *failingDeleteBlobstore
+	claims *testClaims
+	locks  digestutil.Locks
+}
+
+func (s *removeService) PDP() pdp.PDP          { return nil }
+func (s *removeService) Blobs() blobs.Blobs    { return s.blobs }
+func (s *removeService) Claims() claims.Claims { return s.claims }
+func (s *removeService) BlobLocks() *digestutil.Locks {
+	return &s.locks
+}
+
+func newRemoveService(t *testing.T) *removeService {
+	allocs := testutil.Must(allocationstore.NewDsAllocationStore(datastore.NewMapDatastore()))(t)
+	bs := &failingDeleteBlobstore{Blobstore: blobstore.NewMapBlobstore()}
+	capacityMgr := testutil.Must(capacity.New(allocs, bs))(t)
+	b := testutil.Must(blobs.New(
+		blobs.WithBlobstore(bs),
+		blobs.WithAllocationStore(allocs),
+		blobs.WithUsageStore(testutil.Must(usagestore.NewDsUsageStore(datastore.NewMapDatastore()))(t)),
+		blobs.WithCapacity(capacityMgr),
+	))(t)
+	claimStore := testutil.Must(claimstore.NewDsClaimStore(datastore.NewMapDatastore()))(t)
+	return &removeService{blobs: b, store: bs, claims: &testClaims{store: claimStore}}
+}
+
+// failingDeleteBlobstore fails to delete blobs with deleteErr when it is set.
+type failingDeleteBlobstore struct {
+	blobstore.Blobstore
+	deleteErr error
+}
+
+func (f *failingDeleteBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+	return f.Blobstore.Delete(ctx, digest)
+}
+
+type testClaims struct {
+	store *claimstore.DsClaimStore
+}
+
+func (c *testClaims) Store() claimstore.ClaimStore           { return c.store }
+func (c *testClaims) Publisher() publisher.Publisher         { return nopPublisher{} }
+func (c *testClaims) LocationClaimExpiration() time.Duration { return 0 }
+
+type nopPublisher struct {
+	publisher.Publisher
+}
+
+func (nopPublisher) Retract(context.Context, did.DID, multihash.Multihash) error { return nil }
+func (nopPublisher) RetractEquals(context.Context, multihash.Multihash) error    { return nil }
+
+func putLocationClaim(t *testing.T, claimStore claimstore.ClaimStore, space did.DID, digest multihash.Multihash) delegation.Delegation {
+	claim, err := assert.Location.Delegate(
+		testutil.Alice,
+		space,
+		testutil.Alice.DID().String(),
+		assert.LocationCaveats{
+			Space:    space,
+			Content:  types.FromHash(digest),
+			Location: []url.URL{testutil.RandomLocalURL(t)},
+		},
+		delegation.WithNoExpiration(),
+	)
+	require.NoError(t, err)
+	require.NoError(t, claimStore.Put(context.Background(), claim))
+	return claim
+}
@@ -0,0 +1,49 @@
+package claim
+
+import (
+	"context"
+	"fmt"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-ucanto/core/delegation"
+
+	"github.com/storacha/piri/pkg/service/claims"
+)
+
+var log = logging.Logger("storage/handlers/claim")
+
+type IndexService interface {
+	Claims() claims.Claims
+}
+
+type IndexRequest struct {
+	// Claim is the assert/index claim. The index it refers to must be stored on
+	// this node.
+	Claim delegation.Delegation
+}
+
+// Index stores an index claim and publishes an advertisement for every block
+// in the index it refers to. The claim is stored before it is published so
+// that it can be fetched by indexers that are notified of it.
+func Index(ctx context.Context, s IndexService, req *IndexRequest) error {
+	log := log.With("claim", req.Claim.Link())
+	log.Infof("%s %s", assert.IndexAbility, req.Claim.Issuer().DID())
+
+	err := s.Claims().Store().Put(ctx, req.Claim)
+	if err != nil {
+		log.Errorw("putting index claim", "error", err)
+		return fmt.Errorf("putting index claim: %w", err)
+	}
+
+	err = s.Claims().Publisher().Publish(ctx, req.Claim)
+	if err != nil {
+		log.Errorw("publishing index claim", "error", err)
+		// do not serve claims for indexes that could not be published
+		if derr := s.Claims().Store().Delete(ctx, req.Claim.Link()); derr != nil {
+			log.Errorw("deleting index claim", "error", derr)
+		}
+		return fmt.Errorf("publishing index claim: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package replica
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/multiformats/go-multihash"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+)
+
+// TransferError is the failure reported in the receipt of a transfer that could
+// not be completed, when the failure has no more specific type.
+type TransferError struct {
+	cause error
+}
+
+func NewTransferError(cause error) TransferError {
+	return TransferError{cause: cause}
+}
+
+func (e TransferError) Error() string {
+	return fmt.Sprintf("transfer failed: %s", e.cause)
+}
+
+func (e TransferError) Unwrap() error {
+	return e.cause
+}
+
+func (e TransferError) Name() string {
+	return "TransferFailed"
+}
+
+// SourceUnreachableError is returned when the blob could not be read from any
+// of its sources.
+type SourceUnreachableError struct {
+	Sources []url.URL
+	cause   error
+}
+
+func NewSourceUnreachableError(sources []url.URL, cause error) SourceUnreachableError {
+	return SourceUnreachableError{Sources: sources, cause: cause}
+}
+
+func (e SourceUnreachableError) Error() string {
+	if len(e.Sources) == 0 {
+		return fmt.Sprintf("replication sources unreachable: %s", e.cause)
+	}
+	sources := make([]string, 0, len(e.Sources))
+	for _, s := range e.Sources {
+		sources = append(sources, s.String())
+	}
+	return fmt.Sprintf("replication sources unreachable (%s): %s", strings.Join(sources, ", "), e.cause)
+}
+
+func (e SourceUnreachableError) Unwrap() error {
+	return e.cause
+}
+
+func (e SourceUnreachableError) Name() string {
+	return "SourceUnreachable"
+}
+
+// DigestMismatchError is returned when the data read from the sources does not
+// hash to the blob digest.
+type DigestMismatchError struct {
+	Digest multihash.Multihash
+	cause  error
+}
+
+func NewDigestMismatchError(digest multihash.Multihash, cause error) DigestMismatchError {
+	return DigestMismatchError{Digest: digest, cause: cause}
+}
+
+func (e DigestMismatchError) Error() string {
+	return fmt.Sprintf("replica does not match blob digest %s: %s", digestutil.Format(e.Digest), e.cause)
+}
+
+func (e DigestMismatchError) Unwrap() error {
+	return e.cause
+}
+
+func (e DigestMismatchError) Name() string {
+	return "DigestMismatch"
+}
+
+// SizeMismatchError is returned when the data read from the sources is not the
+// size of the blob.
+type SizeMismatchError struct {
+	Size  uint64
+	cause error
+}
+
+func NewSizeMismatchError(size uint64, cause error) SizeMismatchError {
+	return SizeMismatchError{Size: size, cause: cause}
+}
+
+func (e SizeMismatchError) Error() string {
+	return fmt.Sprintf("replica does not match blob size of %d bytes: %s", e.Size, e.cause)
+}
+
+func (e SizeMismatchError) Unwrap() error {
+	return e.cause
+}
+
+func (e SizeMismatchError) Name() string {
+	return "SizeMismatch"
+}
+
+// SinkError is returned when the replica could not be written to the sink. The
+// status is zero if the sink did not respond.
+type SinkError struct {
+	Sink   url.URL
+	Status int
+	cause  error
+}
+
+func NewSinkError(sink url.URL, status int, cause error) SinkError {
+	return SinkError{Sink: sink, Status: status, cause: cause}
+}
+
+func (e SinkError) Error() string {
+	return fmt.Sprintf("writing replica to sink (%s): %s", e.Sink.String(), e.cause)
+}
+
+func (e SinkError) Unwrap() error {
+	return e.cause
+}
+
+func (e SinkError) Name() string {
+	return "SinkFailed"
+}
+
+// AcceptError is returned when the replica was transferred but could not be
+// accepted.
+type AcceptError struct {
+	cause error
+}
+
+func NewAcceptError(cause error) AcceptError {
+	return AcceptError{cause: cause}
+}
+
+func (e AcceptError) Error() string {
+	return fmt.Sprintf("accepting replica: %s", e.cause)
+}
+
+func (e AcceptError) Unwrap() error {
+	return e.cause
+}
+
+func (e AcceptError) Name() string {
+	return "AcceptFailed"
+}
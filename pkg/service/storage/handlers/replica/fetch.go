@@ -0,0 +1,501 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/storacha/piri/pkg/store/blobstore"
+)
+
+const (
+	// DefaultMaxResumes is the number of times reading from a source is resumed
+	// after an interruption, before falling back to the next source.
+	DefaultMaxResumes = 5
+	// DefaultStallTimeout is how long a read from the source may wait for data
+	// before the request is considered stalled, abandoned and resumed.
+	DefaultStallTimeout = time.Minute
+	// DefaultParallelism is the number of ranges of a blob fetched at once when
+	// it is fetched from several sources.
+	DefaultParallelism = 4
+	// DefaultChunkSize is the size of the ranges a blob is fetched in when it is
+	// fetched from several sources. Blobs no bigger than this are fetched with a
+	// single request.
+	DefaultChunkSize = 16 * 1024 * 1024
+)
+
+// ErrSourceStalled is the cause of an abandoned source request that did not
+// receive any data for the stall timeout.
+var ErrSourceStalled = errors.New("source stalled")
+
+// ErrNoSources is returned when a transfer has no source to fetch from.
+var ErrNoSources = errors.New("no replication sources")
+
+type transferConfig struct {
+	client       *http.Client
+	limiter      *rate.Limiter
+	maxResumes   int
+	stallTimeout time.Duration
+	parallelism  int
+	chunkSize    uint64
+}
+
+type TransferOption func(*transferConfig)
+
+// WithHTTPClient sets the client used to fetch from the source and put to the
+// sink.
+func WithHTTPClient(c *http.Client) TransferOption {
+	return func(cfg *transferConfig) {
+		cfg.client = c
+	}
+}
+
+// WithRateLimiter limits the rate, in bytes per second, that data is read from
+// the source. A limiter may be shared between transfers to bound the total
+// bandwidth they use.
+func WithRateLimiter(l *rate.Limiter) TransferOption {
+	return func(cfg *transferConfig) {
+		cfg.limiter = l
+	}
+}
+
+// WithMaxResumes sets the number of times reading from a source is resumed
+// after an interruption, before falling back to the next source.
+func WithMaxResumes(n int) TransferOption {
+	return func(cfg *transferConfig) {
+		cfg.maxResumes = n
+	}
+}
+
+// WithStallTimeout sets how long a read from the source may wait for data
+// before the request is abandoned and resumed.
+func WithStallTimeout(d time.Duration) TransferOption {
+	return func(cfg *transferConfig) {
+		cfg.stallTimeout = d
+	}
+}
+
+// WithParallelism sets the number of ranges of a blob fetched at once when it
+// is fetched from several sources. A value of 1 or less fetches blobs
+// sequentially.
+func WithParallelism(n int) TransferOption {
+	return func(cfg *transferConfig) {
+		cfg.parallelism = n
+	}
+}
+
+// WithChunkSize sets the size of the ranges a blob is fetched in when it is
+// fetched from several sources.
+func WithChunkSize(n uint64) TransferOption {
+	return func(cfg *transferConfig) {
+		cfg.chunkSize = n
+	}
+}
+
+// SourceStatusError is returned when the source responds with an unexpected
+// status code.
+type SourceStatusError struct {
+	Source url.URL
+	Status int
+}
+
+func (e SourceStatusError) Error() string {
+	return fmt.Sprintf("unexpected status from replication source (%s): %d", e.Source.String(), e.Status)
+}
+
+// newSource creates a reader for the blob that fetches from the given sources.
+// Blobs larger than a chunk that are available from several sources are fetched
+// in parallel ranges spread across them.
+func newSource(ctx context.Context, cfg *transferConfig, sources []url.URL, size uint64) io.ReadCloser {
+	if len(sources) > 1 && cfg.parallelism > 1 && cfg.chunkSize > 0 && size > cfg.chunkSize {
+		return newRangedReader(ctx, cfg, sources, size)
+	}
+	return newSourceReader(ctx, cfg, sources, size)
+}
+
+// get requests the source, with the given range if not empty. The request is
+// cancelled if a read from the response body waits for data for longer than
+// the stall timeout.
+func get(ctx context.Context, cfg *transferConfig, source url.URL, rng string) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.String(), nil)
+	if err != nil {
+		cancel(nil)
+		return nil, fmt.Errorf("creating replication source request: %w", err)
+	}
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	res, err := cfg.client.Do(req)
+	if err != nil {
+		cancel(nil)
+		return nil, fmt.Errorf("http get replication source (%s) failed: %w", source.String(), err)
+	}
+	body := &stallingBody{body: res.Body, cancel: cancel, timeout: cfg.stallTimeout}
+	if cfg.stallTimeout > 0 {
+		body.stall = time.AfterFunc(cfg.stallTimeout, func() { cancel(ErrSourceStalled) })
+		body.stall.Stop()
+	}
+	res.Body = body
+	return res, nil
+}
+
+// stallingBody cancels its request when a read waits for data for longer than
+// the timeout.
+type stallingBody struct {
+	body    io.ReadCloser
+	cancel  context.CancelCauseFunc
+	stall   *time.Timer
+	timeout time.Duration
+}
+
+func (b *stallingBody) Read(p []byte) (int, error) {
+	if b.stall != nil {
+		b.stall.Reset(b.timeout)
+		defer b.stall.Stop()
+	}
+	return b.body.Read(p)
+}
+
+func (b *stallingBody) Close() error {
+	if b.stall != nil {
+		b.stall.Stop()
+	}
+	err := b.body.Close()
+	b.cancel(nil)
+	return err
+}
+
+// throttledReader limits the rate data is read from the underlying reader.
+type throttledReader struct {
+	ctx     context.Context
+	limiter *rate.Limiter
+	r       io.Reader
+}
+
+func (t throttledReader) Read(p []byte) (int, error) {
+	if t.limiter == nil {
+		return t.r.Read(p)
+	}
+	if len(p) > t.limiter.Burst() {
+		p = p[:t.limiter.Burst()]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.limiter.WaitN(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// sourceReader reads a blob sequentially from its sources, resuming from the
+// current offset with a range request when a read fails part way through.
+// Sources that do not support range requests are re-read from the start,
+// discarding the bytes that were already read. When a source cannot be read
+// from, or is interrupted too many times, the next source takes over from the
+// current offset.
+type sourceReader struct {
+	ctx     context.Context
+	cfg     *transferConfig
+	sources []url.URL
+	size    uint64
+
+	current int
+	offset  uint64
+	resumes int
+	errs    []error
+	body    io.ReadCloser
+	reader  io.Reader
+}
+
+func newSourceReader(ctx context.Context, cfg *transferConfig, sources []url.URL, size uint64) *sourceReader {
+	return &sourceReader{ctx: ctx, cfg: cfg, sources: sources, size: size}
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	for s.body == nil {
+		err := s.open()
+		if err == nil {
+			break
+		}
+		if s.ctx.Err() != nil || !s.fallback(err) {
+			return 0, s.err()
+		}
+	}
+
+	n, err := s.reader.Read(p)
+	s.offset += uint64(n)
+	if err == nil || errors.Is(err, io.EOF) {
+		return n, err
+	}
+
+	s.close()
+	source := s.sources[s.current]
+	err = fmt.Errorf("reading replication source (%s): %w", source.String(), err)
+	if s.ctx.Err() != nil {
+		return n, err
+	}
+	if s.resumes < s.cfg.maxResumes {
+		s.resumes++
+		log.Warnw("replication source read interrupted, resuming", "source", source.String(), "offset", s.offset, "resumes", s.resumes, "error", err)
+		// the next read reopens the source from the current offset
+		return n, nil
+	}
+	if !s.fallback(err) {
+		return n, s.err()
+	}
+	return n, nil
+}
+
+// fallback records the failure of the current source and moves on to the next
+// one. It returns false when there are no more sources to try.
+func (s *sourceReader) fallback(err error) bool {
+	s.errs = append(s.errs, err)
+	if s.current+1 >= len(s.sources) {
+		return false
+	}
+	log.Warnw(
+		"replication source failed, falling back to the next source",
+		"source", s.sources[s.current].String(),
+		"next", s.sources[s.current+1].String(),
+		"offset", s.offset,
+		"error", err,
+	)
+	s.current++
+	s.resumes = 0
+	return true
+}
+
+// err returns the error from the sources that were tried.
+func (s *sourceReader) err() error {
+	if len(s.errs) == 1 {
+		return s.errs[0]
+	}
+	return fmt.Errorf("all %d replication sources failed: %w", len(s.errs), errors.Join(s.errs...))
+}
+
+func (s *sourceReader) open() error {
+	if len(s.sources) == 0 {
+		return ErrNoSources
+	}
+	source := s.sources[s.current]
+	var rng string
+	if s.offset > 0 {
+		rng = fmt.Sprintf("bytes=%d-", s.offset)
+	}
+	res, err := get(s.ctx, s.cfg, source, rng)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusPartialContent && s.offset > 0:
+		start, err := contentRangeStart(res.Header.Get("Content-Range"))
+		if err != nil || start != s.offset {
+			res.Body.Close()
+			return fmt.Errorf("replication source (%s) returned range %q, expected offset %d", source.String(), res.Header.Get("Content-Range"), s.offset)
+		}
+	case res.StatusCode == http.StatusOK:
+		if res.ContentLength >= 0 && uint64(res.ContentLength) != s.size {
+			res.Body.Close()
+			sizeErr := blobstore.ErrTooSmall
+			if uint64(res.ContentLength) > s.size {
+				sizeErr = blobstore.ErrTooLarge
+			}
+			return fmt.Errorf("replication source (%s) content length %d does not match blob size %d: %w", source.String(), res.ContentLength, s.size, sizeErr)
+		}
+		if s.offset > 0 {
+			// the source ignored the range, skip what has already been read
+			if _, err := io.CopyN(io.Discard, res.Body, int64(s.offset)); err != nil {
+				res.Body.Close()
+				return fmt.Errorf("skipping to offset %d of replication source (%s): %w", s.offset, source.String(), err)
+			}
+		}
+	default:
+		res.Body.Close()
+		return SourceStatusError{Source: source, Status: res.StatusCode}
+	}
+
+	s.body = res.Body
+	s.reader = throttledReader{ctx: s.ctx, limiter: s.cfg.limiter, r: res.Body}
+	return nil
+}
+
+func (s *sourceReader) close() {
+	if s.body != nil {
+		s.body.Close()
+		s.body = nil
+		s.reader = nil
+	}
+}
+
+// Close releases the current request to the source, if any.
+func (s *sourceReader) Close() error {
+	s.close()
+	return nil
+}
+
+type chunk struct {
+	data []byte
+	err  error
+}
+
+// rangedReader fetches a blob in chunks with range requests spread across its
+// sources, with up to parallelism chunks in flight at once, and reads them back
+// in order. A chunk that cannot be fetched from one source is fetched from the
+// next. If a chunk cannot be fetched from any source, for example because none
+// of them support range requests, the rest of the blob is read sequentially.
+type rangedReader struct {
+	ctx     context.Context
+	cfg     *transferConfig
+	sources []url.URL
+	size    uint64
+
+	cancel   context.CancelFunc
+	pending  chan chan chunk
+	buf      []byte
+	offset   uint64
+	fallback *sourceReader
+}
+
+func newRangedReader(ctx context.Context, cfg *transferConfig, sources []url.URL, size uint64) *rangedReader {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	r := &rangedReader{
+		ctx:     ctx,
+		cfg:     cfg,
+		sources: sources,
+		size:    size,
+		cancel:  cancel,
+		// the chunk being read plus those buffered make up the chunks in flight
+		pending: make(chan chan chunk, cfg.parallelism-1),
+	}
+	go r.fetch(fetchCtx)
+	return r
+}
+
+// fetch starts fetching each chunk in turn, waiting for room in the pending
+// queue before starting the next.
+func (r *rangedReader) fetch(ctx context.Context) {
+	defer close(r.pending)
+	for i, start := 0, uint64(0); start < r.size; i, start = i+1, start+r.cfg.chunkSize {
+		end := min(start+r.cfg.chunkSize, r.size)
+		res := make(chan chunk, 1)
+		select {
+		case r.pending <- res:
+		case <-ctx.Done():
+			return
+		}
+		go func() {
+			data, err := r.fetchChunk(ctx, i, start, end)
+			res <- chunk{data: data, err: err}
+		}()
+	}
+}
+
+// fetchChunk fetches the bytes from start up to end, trying each source in
+// turn. Chunks start on different sources to spread the load between them.
+func (r *rangedReader) fetchChunk(ctx context.Context, i int, start, end uint64) ([]byte, error) {
+	var errs []error
+	for j := range r.sources {
+		source := r.sources[(i+j)%len(r.sources)]
+		data, err := r.fetchRange(ctx, source, start, end)
+		if err == nil {
+			return data, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (r *rangedReader) fetchRange(ctx context.Context, source url.URL, start, end uint64) ([]byte, error) {
+	res, err := get(ctx, r.cfg, source, fmt.Sprintf("bytes=%d-%d", start, end-1))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		first, err := contentRangeStart(res.Header.Get("Content-Range"))
+		if err != nil || first != start {
+			return nil, fmt.Errorf("replication source (%s) returned range %q, expected offset %d", source.String(), res.Header.Get("Content-Range"), start)
+		}
+	case http.StatusOK:
+		return nil, fmt.Errorf("replication source (%s) does not support range requests", source.String())
+	default:
+		return nil, SourceStatusError{Source: source, Status: res.StatusCode}
+	}
+
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(throttledReader{ctx: ctx, limiter: r.cfg.limiter, r: res.Body}, data); err != nil {
+		return nil, fmt.Errorf("reading range %d-%d of replication source (%s): %w", start, end-1, source.String(), err)
+	}
+	return data, nil
+}
+
+func (r *rangedReader) Read(p []byte) (int, error) {
+	if r.fallback != nil {
+		return r.fallback.Read(p)
+	}
+	for len(r.buf) == 0 {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+		res, ok := <-r.pending
+		if !ok {
+			return 0, r.ctx.Err()
+		}
+		c := <-res
+		if c.err != nil {
+			if r.ctx.Err() != nil {
+				return 0, c.err
+			}
+			log.Warnw("fetching replication source ranges failed, reading sequentially", "offset", r.offset, "error", c.err)
+			r.cancel()
+			r.fallback = newSourceReader(r.ctx, r.cfg, r.sources, r.size)
+			r.fallback.offset = r.offset
+			return r.fallback.Read(p)
+		}
+		r.buf = c.data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.offset += uint64(n)
+	return n, nil
+}
+
+// Close stops fetching chunks and releases the request to the source, if
+// reading has fallen back to a sequential read.
+func (r *rangedReader) Close() error {
+	r.cancel()
+	if r.fallback != nil {
+		return r.fallback.Close()
+	}
+	return nil
+}
+
+// contentRangeStart parses the first byte position from a Content-Range header
+// such as "bytes 100-199/200".
+func contentRangeStart(header string) (uint64, error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("unsupported content range: %q", header)
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, fmt.Errorf("invalid content range: %q", header)
+	}
+	return strconv.ParseUint(start, 10, 64)
+}
@@ -2,32 +2,38 @@ package replica
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 
+	logging "github.com/ipfs/go-log/v2"
 	"github.com/storacha/go-libstoracha/capabilities/blob"
 	"github.com/storacha/go-libstoracha/capabilities/blob/replica"
 	"github.com/storacha/go-libstoracha/capabilities/types"
-	"github.com/storacha/go-ucanto/client"
 	"github.com/storacha/go-ucanto/core/invocation"
 	"github.com/storacha/go-ucanto/core/invocation/ran"
 	"github.com/storacha/go-ucanto/core/ipld"
-	"github.com/storacha/go-ucanto/core/message"
 	"github.com/storacha/go-ucanto/core/receipt"
 	"github.com/storacha/go-ucanto/core/receipt/fx"
 	"github.com/storacha/go-ucanto/core/result"
+	"github.com/storacha/go-ucanto/core/result/failure"
 	"github.com/storacha/go-ucanto/did"
 	"github.com/storacha/go-ucanto/principal"
 
+	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/pdp"
 	"github.com/storacha/piri/pkg/service/blobs"
 	"github.com/storacha/piri/pkg/service/claims"
+	"github.com/storacha/piri/pkg/service/outbox"
 	blobhandler "github.com/storacha/piri/pkg/service/storage/handlers/blob"
+	"github.com/storacha/piri/pkg/store/blobstore"
 	"github.com/storacha/piri/pkg/store/receiptstore"
 )
 
+var log = logging.Logger("storage/handlers/replica")
+
 type TransferService interface {
 	// ID is the storage service identity, used to sign UCAN invocations and receipts.
 	ID() principal.Signer
@@ -39,8 +45,8 @@ type TransferService interface {
 	Claims() claims.Claims
 	// Receipts provides access to receipts
 	Receipts() receiptstore.ReceiptStore
-	// UploadConnection provides access to an upload service connection
-	UploadConnection() client.Connection
+	// Outbox delivers receipts to the upload service.
+	Outbox() outbox.Outbox
 }
 
 type TransferRequest struct {
@@ -48,53 +54,39 @@ type TransferRequest struct {
 	Space did.DID
 	// Blob is the blob in question.
 	Blob types.Blob
-	// Source is the location to replicate the blob from.
-	Source url.URL
+	// Sources are the locations to replicate the blob from, in order of
+	// preference. Later sources are used when earlier ones fail.
+	Sources []url.URL
 	// Sink is the location to replicate the blob to.
 	Sink *url.URL
+	// SinkHeader are the headers that must be sent with the request to the
+	// sink, as given in the address of the allocation.
+	SinkHeader http.Header
 	// Cause is the invocation responsible for spawning this replication
 	// should be a replica/transfer invocation.
 	Cause invocation.Invocation
 }
 
-func Transfer(ctx context.Context, service TransferService, request *TransferRequest) error {
+// Transfer replicates the blob from the source to the sink, if one is given,
+// then accepts it and issues the receipt for the transfer invocation. The data
+// is verified against the blob digest and size as it is streamed, so a
+// corrupted or truncated replica is never accepted.
+func Transfer(ctx context.Context, service TransferService, request *TransferRequest, opts ...TransferOption) error {
+	cfg := &transferConfig{
+		client:       http.DefaultClient,
+		maxResumes:   DefaultMaxResumes,
+		stallTimeout: DefaultStallTimeout,
+		parallelism:  DefaultParallelism,
+		chunkSize:    DefaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
 	// pull the data from the source if required
 	if request.Sink != nil {
-		replicaResp, err := http.Get(request.Source.String())
-		if err != nil {
-			return fmt.Errorf("http get replication source (%s) failed: %w", request.Source.String(), err)
-		}
-
-		// stream the source to the sink
-		req, err := http.NewRequest(http.MethodPut, request.Sink.String(), replicaResp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to create replication sink request: %w", err)
-		}
-		req.Header = replicaResp.Header
-		res, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return fmt.Errorf(
-				"failed http PUT to replicate blob %s from %s to %s failed: %w",
-				request.Blob.Digest,
-				request.Source.String(),
-				request.Sink.String(),
-				err,
-			)
-		}
-		// verify status codes
-		if res.StatusCode >= 300 || res.StatusCode < 200 {
-			topErr := fmt.Errorf(
-				"unsuccessful http PUT to replicate blob %s from %s to %s status code %d",
-				request.Blob.Digest,
-				request.Source.String(),
-				request.Sink.String(),
-				res.StatusCode,
-			)
-			resData, err := io.ReadAll(res.Body)
-			if err != nil {
-				return fmt.Errorf("%s failed to read replication sink response body: %w", topErr, err)
-			}
-			return fmt.Errorf("%s response body: %s: %w", topErr, resData, err)
+		if err := replicate(ctx, cfg, request); err != nil {
+			return err
 		}
 	}
 
@@ -109,7 +101,7 @@ func Transfer(ctx context.Context, service TransferService, request *TransferReq
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to accept replication source blob %s: %w", request.Blob.Digest, err)
+		return NewAcceptError(fmt.Errorf("failed to accept replication source blob %s: %w", digestutil.Format(request.Blob.Digest), err))
 	}
 
 	res := replica.TransferOk{
@@ -122,42 +114,139 @@ func Transfer(ctx context.Context, service TransferService, request *TransferReq
 		tmp := acceptResp.PDP.Link()
 		res.PDP = &tmp
 	}
+	if acceptResp.Equals != nil {
+		forks = append(forks, fx.FromInvocation(acceptResp.Equals))
+	}
 
 	ok := result.Ok[replica.TransferOk, ipld.Builder](res)
-	var opts []receipt.Option
+	var rcptOpts []receipt.Option
 	if len(forks) > 0 {
-		opts = append(opts, receipt.WithFork(forks...))
+		rcptOpts = append(rcptOpts, receipt.WithFork(forks...))
 	}
-	rcpt, err := receipt.Issue(service.ID(), ok, ran.FromInvocation(request.Cause), opts...)
+	rcpt, err := receipt.Issue(service.ID(), ok, ran.FromInvocation(request.Cause), rcptOpts...)
 	if err != nil {
 		return fmt.Errorf("issuing receipt: %w", err)
 	}
-	if err := service.Receipts().Put(ctx, rcpt); err != nil {
-		return fmt.Errorf("failed to put transfer receipt: %w", err)
+	return deliver(ctx, service, rcpt)
+}
+
+// TransferFailure issues a receipt for the transfer invocation that reports
+// the transfer failed with the given cause, and sends it to the upload service
+// so it is not left waiting on a transfer that will never complete. The
+// failure is named after the error type in the cause, such as
+// [SourceUnreachableError] or [DigestMismatchError], or "TransferFailed" if it
+// has none.
+func TransferFailure(ctx context.Context, service TransferService, request *TransferRequest, cause error) error {
+	fail := result.Error[replica.TransferOk, ipld.Builder](failure.FromError(failureOf(cause)))
+	rcpt, err := receipt.Issue(service.ID(), fail, ran.FromInvocation(request.Cause))
+	if err != nil {
+		return fmt.Errorf("issuing failure receipt: %w", err)
 	}
+	return deliver(ctx, service, rcpt)
+}
 
-	msg, err := message.Build([]invocation.Invocation{request.Cause}, []receipt.AnyReceipt{rcpt})
+// failureOf finds the named error in the chain of the cause to report in a
+// failure receipt, falling back to a [TransferError].
+func failureOf(cause error) error {
+	var named interface {
+		error
+		failure.Named
+	}
+	if errors.As(cause, &named) {
+		return named
+	}
+	return NewTransferError(cause)
+}
+
+// deliver queues the receipt for the transfer invocation for delivery to the
+// upload service. Delivery is retried by the outbox, so a transfer that has
+// completed is not repeated because the upload service could not be reached.
+func deliver(ctx context.Context, service TransferService, rcpt receipt.AnyReceipt) error {
+	if err := service.Outbox().Send(ctx, rcpt); err != nil {
+		return fmt.Errorf("sending transfer receipt: %w", err)
+	}
+	return nil
+}
+
+// replicate streams the blob from its sources to the sink, verifying it on the
+// way through.
+func replicate(ctx context.Context, cfg *transferConfig, request *TransferRequest) error {
+	if len(request.Sources) == 0 {
+		return NewSourceUnreachableError(nil, fmt.Errorf("replicating blob %s: %w", digestutil.Format(request.Blob.Digest), ErrNoSources))
+	}
+	source := newSource(ctx, cfg, request.Sources, request.Blob.Size)
+	defer source.Close()
+
+	verified, err := blobstore.NewVerifyingReader(source, request.Blob.Digest, request.Blob.Size)
 	if err != nil {
-		return fmt.Errorf("building message for receipt failed: %w", err)
+		return fmt.Errorf("verifying replication source: %w", err)
 	}
+	// record the error from reading the source, since the client may not
+	// return it as the cause of a failed request
+	body := &errRecorder{r: verified}
 
-	uploadServiceRequest, err := service.UploadConnection().Codec().Encode(msg)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, request.Sink.String(), body)
 	if err != nil {
-		return fmt.Errorf("failed to encode message for receipt to http request: %w", err)
+		return fmt.Errorf("failed to create replication sink request: %w", err)
+	}
+	for k, v := range request.SinkHeader {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(request.Blob.Size)
+	if request.Blob.Size == 0 {
+		req.Body = http.NoBody
 	}
 
-	uploadServiceResponse, err := service.UploadConnection().Channel().Request(uploadServiceRequest)
+	res, err := cfg.client.Do(req)
+	if rerr := body.err; rerr != nil {
+		if res != nil {
+			res.Body.Close()
+		}
+		rerr = fmt.Errorf("replicating blob %s: %w", digestutil.Format(request.Blob.Digest), rerr)
+		switch {
+		case errors.Is(rerr, blobstore.ErrDataInconsistent):
+			return NewDigestMismatchError(request.Blob.Digest, rerr)
+		case errors.Is(rerr, blobstore.ErrTooLarge), errors.Is(rerr, blobstore.ErrTooSmall):
+			return NewSizeMismatchError(request.Blob.Size, rerr)
+		default:
+			return NewSourceUnreachableError(request.Sources, rerr)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("failed to send request for receipt: %w", err)
+		return NewSinkError(*request.Sink, 0, fmt.Errorf(
+			"failed http PUT to replicate blob %s to %s failed: %w",
+			digestutil.Format(request.Blob.Digest),
+			request.Sink.String(),
+			err,
+		))
 	}
-	if uploadServiceResponse.Status() >= 300 || uploadServiceResponse.Status() < 200 {
-		topErr := fmt.Errorf("unsuccessful http POST to upload service")
-		resData, err := io.ReadAll(uploadServiceResponse.Body())
+	defer res.Body.Close()
+	// verify status codes
+	if res.StatusCode >= 300 || res.StatusCode < 200 {
+		resData, err := io.ReadAll(io.LimitReader(res.Body, 1024))
 		if err != nil {
-			return fmt.Errorf("%s failed to read replication sink response body: %w", topErr, err)
+			resData = []byte(fmt.Sprintf("failed to read response body: %s", err))
 		}
-		return fmt.Errorf("%s response body: %s: %w", topErr, resData, err)
+		return NewSinkError(*request.Sink, res.StatusCode, fmt.Errorf(
+			"unsuccessful http PUT to replicate blob %s to %s status code %d response body: %s",
+			digestutil.Format(request.Blob.Digest),
+			request.Sink.String(),
+			res.StatusCode,
+			resData,
+		))
 	}
-
 	return nil
 }
+
+type errRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errRecorder) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		e.err = err
+	}
+	return n, err
+}
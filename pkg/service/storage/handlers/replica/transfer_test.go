@@ -0,0 +1,446 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/result/failure"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store/blobstore"
+)
+
+func TestReplicate(t *testing.T) {
+	data := testutil.RandomBytes(t, 64*1024)
+	digest, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	require.NoError(t, err)
+
+	t.Run("streams verified data to the sink", func(t *testing.T) {
+		source := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Source-Only", "true")
+			w.Write(data)
+		}))
+		sink := newSink(t)
+
+		req := newRequest(t, digest, uint64(len(data)), source, sink.url)
+		req.SinkHeader = http.Header{"X-Signed": []string{"yes"}}
+		err := replicate(context.Background(), newConfig(), req)
+		require.NoError(t, err)
+
+		require.Equal(t, data, sink.body())
+		require.Equal(t, "yes", sink.header().Get("X-Signed"))
+		require.Empty(t, sink.header().Get("X-Source-Only"))
+		require.Equal(t, int64(len(data)), sink.contentLength())
+	})
+
+	t.Run("fails when the data does not match the digest", func(t *testing.T) {
+		corrupt := bytes.Clone(data)
+		corrupt[len(corrupt)-1] ^= 0xff
+		source := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(corrupt)
+		}))
+		sink := newSink(t)
+
+		err := replicate(context.Background(), newConfig(), newRequest(t, digest, uint64(len(data)), source, sink.url))
+		require.ErrorIs(t, err, blobstore.ErrDataInconsistent)
+		var derr DigestMismatchError
+		require.ErrorAs(t, err, &derr)
+		// the sink never receives the complete body
+		require.Less(t, len(sink.body()), len(data))
+	})
+
+	t.Run("fails when the source is truncated", func(t *testing.T) {
+		source := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data[:len(data)/2])
+		}))
+		sink := newSink(t)
+
+		err := replicate(context.Background(), newConfig(), newRequest(t, digest, uint64(len(data)), source, sink.url))
+		var serr SizeMismatchError
+		require.ErrorAs(t, err, &serr)
+		require.Less(t, len(sink.body()), len(data))
+	})
+
+	t.Run("fails when the source responds with an error", func(t *testing.T) {
+		source := newServer(t, http.NotFoundHandler())
+		sink := newSink(t)
+
+		err := replicate(context.Background(), newConfig(), newRequest(t, digest, uint64(len(data)), source, sink.url))
+		var serr SourceStatusError
+		require.ErrorAs(t, err, &serr)
+		require.Equal(t, http.StatusNotFound, serr.Status)
+		var uerr SourceUnreachableError
+		require.ErrorAs(t, err, &uerr)
+	})
+
+	t.Run("fails when the sink responds with an error", func(t *testing.T) {
+		source := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		}))
+		sink := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusForbidden)
+		}))
+
+		err := replicate(context.Background(), newConfig(), newRequest(t, digest, uint64(len(data)), source, serverURL(t, sink)))
+		var serr SinkError
+		require.ErrorAs(t, err, &serr)
+		require.Equal(t, http.StatusForbidden, serr.Status)
+	})
+
+	t.Run("resumes an interrupted read with a range request", func(t *testing.T) {
+		var mu sync.Mutex
+		var ranges []string
+		source := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			first := len(ranges) == 1
+			mu.Unlock()
+			if first {
+				interrupt(w, data)
+			}
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		}))
+		sink := newSink(t)
+
+		err := replicate(context.Background(), newConfig(), newRequest(t, digest, uint64(len(data)), source, sink.url))
+		require.NoError(t, err)
+		require.Equal(t, data, sink.body())
+		require.Len(t, ranges, 2)
+		require.Empty(t, ranges[0])
+		require.Regexp(t, `^bytes=[1-9][0-9]*-$`, ranges[1])
+	})
+
+	t.Run("resumes from sources that do not support range requests", func(t *testing.T) {
+		var mu sync.Mutex
+		var requests int
+		source := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests++
+			first := requests == 1
+			mu.Unlock()
+			if first {
+				interrupt(w, data)
+			}
+			w.Write(data)
+		}))
+		sink := newSink(t)
+
+		err := replicate(context.Background(), newConfig(), newRequest(t, digest, uint64(len(data)), source, sink.url))
+		require.NoError(t, err)
+		require.Equal(t, data, sink.body())
+		require.Equal(t, 2, requests)
+	})
+
+	t.Run("resumes a stalled read", func(t *testing.T) {
+		var mu sync.Mutex
+		var requests int
+		source := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests++
+			first := requests == 1
+			mu.Unlock()
+			if first {
+				w.Header().Set("Content-Length", "65536")
+				w.Write(data[:1024])
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+				return
+			}
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		}))
+		sink := newSink(t)
+
+		cfg := newConfig()
+		cfg.stallTimeout = 100 * time.Millisecond
+		err := replicate(context.Background(), cfg, newRequest(t, digest, uint64(len(data)), source, sink.url))
+		require.NoError(t, err)
+		require.Equal(t, data, sink.body())
+	})
+
+	t.Run("gives up after the maximum number of resumes", func(t *testing.T) {
+		source := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			interrupt(w, data)
+		}))
+		sink := newSink(t)
+
+		cfg := newConfig()
+		cfg.maxResumes = 2
+		err := replicate(context.Background(), cfg, newRequest(t, digest, uint64(len(data)), source, sink.url))
+		require.Error(t, err)
+	})
+
+	t.Run("limits bandwidth", func(t *testing.T) {
+		small := data[:3*1024]
+		smallDigest, err := multihash.Sum(small, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		source := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(small)
+		}))
+		sink := newSink(t)
+
+		cfg := newConfig()
+		cfg.limiter = rate.NewLimiter(2*1024, 1024)
+		start := time.Now()
+		err = replicate(context.Background(), cfg, newRequest(t, smallDigest, uint64(len(small)), source, sink.url))
+		require.NoError(t, err)
+		require.Equal(t, small, sink.body())
+		// the first KiB is the burst, the remaining 2KiB take a second
+		require.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+	})
+}
+
+func TestReplicateMultipleSources(t *testing.T) {
+	data := testutil.RandomBytes(t, 64*1024)
+	digest, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	require.NoError(t, err)
+
+	t.Run("falls back to the next source when a source fails", func(t *testing.T) {
+		unhealthy := newServer(t, http.NotFoundHandler())
+		healthy := newRangeSource(t, data)
+		sink := newSink(t)
+
+		req := newRequest(t, digest, uint64(len(data)), unhealthy, sink.url)
+		req.Sources = append(req.Sources, serverURL(t, healthy.Server))
+		err := replicate(context.Background(), newConfig(), req)
+		require.NoError(t, err)
+		require.Equal(t, data, sink.body())
+		require.Len(t, healthy.requests(), 1)
+	})
+
+	t.Run("continues from the current offset on the next source", func(t *testing.T) {
+		interrupted := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			interrupt(w, data)
+		}))
+		healthy := newRangeSource(t, data)
+		sink := newSink(t)
+
+		req := newRequest(t, digest, uint64(len(data)), interrupted, sink.url)
+		req.Sources = append(req.Sources, serverURL(t, healthy.Server))
+		cfg := newConfig()
+		cfg.maxResumes = 0
+		err := replicate(context.Background(), cfg, req)
+		require.NoError(t, err)
+		require.Equal(t, data, sink.body())
+		ranges := healthy.requests()
+		require.Len(t, ranges, 1)
+		require.Regexp(t, `^bytes=[1-9][0-9]*-$`, ranges[0])
+	})
+
+	t.Run("fails when every source fails", func(t *testing.T) {
+		missing := newServer(t, http.NotFoundHandler())
+		unavailable := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		sink := newSink(t)
+
+		req := newRequest(t, digest, uint64(len(data)), missing, sink.url)
+		req.Sources = append(req.Sources, serverURL(t, unavailable))
+		err := replicate(context.Background(), newConfig(), req)
+		var serr SourceStatusError
+		require.ErrorAs(t, err, &serr)
+		require.ErrorContains(t, err, "404")
+		require.ErrorContains(t, err, "503")
+	})
+
+	t.Run("fails when there are no sources", func(t *testing.T) {
+		sink := newSink(t)
+		req := &TransferRequest{
+			Space: testutil.RandomDID(t),
+			Blob:  types.Blob{Digest: digest, Size: uint64(len(data))},
+			Sink:  &sink.url,
+		}
+		err := replicate(context.Background(), newConfig(), req)
+		require.ErrorIs(t, err, ErrNoSources)
+	})
+
+	t.Run("fetches ranges in parallel from several sources", func(t *testing.T) {
+		first := newRangeSource(t, data)
+		second := newRangeSource(t, data)
+		sink := newSink(t)
+
+		req := newRequest(t, digest, uint64(len(data)), first.Server, sink.url)
+		req.Sources = append(req.Sources, serverURL(t, second.Server))
+		cfg := newConfig()
+		cfg.chunkSize = 8 * 1024
+		err := replicate(context.Background(), cfg, req)
+		require.NoError(t, err)
+		require.Equal(t, data, sink.body())
+
+		ranges := append(first.requests(), second.requests()...)
+		require.Len(t, ranges, 8)
+		require.NotEmpty(t, first.requests())
+		require.NotEmpty(t, second.requests())
+		for _, r := range ranges {
+			require.Regexp(t, `^bytes=[0-9]+-[0-9]+$`, r)
+		}
+	})
+
+	t.Run("fetches a range from another source when one fails", func(t *testing.T) {
+		unhealthy := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		healthy := newRangeSource(t, data)
+		sink := newSink(t)
+
+		req := newRequest(t, digest, uint64(len(data)), unhealthy, sink.url)
+		req.Sources = append(req.Sources, serverURL(t, healthy.Server))
+		cfg := newConfig()
+		cfg.chunkSize = 8 * 1024
+		err := replicate(context.Background(), cfg, req)
+		require.NoError(t, err)
+		require.Equal(t, data, sink.body())
+		require.Len(t, healthy.requests(), 8)
+	})
+
+	t.Run("reads sequentially when sources do not support ranges", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		})
+		sink := newSink(t)
+
+		req := newRequest(t, digest, uint64(len(data)), newServer(t, handler), sink.url)
+		req.Sources = append(req.Sources, serverURL(t, newServer(t, handler)))
+		cfg := newConfig()
+		cfg.chunkSize = 8 * 1024
+		err := replicate(context.Background(), cfg, req)
+		require.NoError(t, err)
+		require.Equal(t, data, sink.body())
+	})
+}
+
+func newConfig() *transferConfig {
+	return &transferConfig{
+		client:       http.DefaultClient,
+		maxResumes:   DefaultMaxResumes,
+		stallTimeout: DefaultStallTimeout,
+		parallelism:  DefaultParallelism,
+		chunkSize:    DefaultChunkSize,
+	}
+}
+
+func newRequest(t *testing.T, digest multihash.Multihash, size uint64, source *httptest.Server, sink url.URL) *TransferRequest {
+	return &TransferRequest{
+		Space:   testutil.RandomDID(t),
+		Blob:    types.Blob{Digest: digest, Size: size},
+		Sources: []url.URL{serverURL(t, source)},
+		Sink:    &sink,
+	}
+}
+
+func serverURL(t *testing.T, srv *httptest.Server) url.URL {
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	return *u
+}
+
+// rangeSource serves the data, recording the range of each request.
+type rangeSource struct {
+	*httptest.Server
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newRangeSource(t *testing.T, data []byte) *rangeSource {
+	s := &rangeSource{}
+	s.Server = newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.mu.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	return s
+}
+
+func (s *rangeSource) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.ranges)
+}
+
+func newServer(t *testing.T, handler http.Handler) *httptest.Server {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// interrupt sends the first half of the data then drops the connection.
+func interrupt(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Length", "65536")
+	w.Write(data[:len(data)/2])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+type sink struct {
+	url url.URL
+	mu  sync.Mutex
+	buf []byte
+	hdr http.Header
+	len int64
+}
+
+func newSink(t *testing.T) *sink {
+	s := &sink{}
+	srv := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.buf = b
+		s.hdr = r.Header
+		s.len = r.ContentLength
+		s.mu.Unlock()
+		if err != nil && !errors.Is(err, io.EOF) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	s.url = *u
+	return s
+}
+
+func (s *sink) body() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf
+}
+
+func (s *sink) header() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hdr
+}
+
+func (s *sink) contentLength() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.len
+}
+
+func TestFailureOf(t *testing.T) {
+	t.Run("reports the named error in the chain", func(t *testing.T) {
+		cause := fmt.Errorf("attempt failed: %w", NewDigestMismatchError(testutil.RandomMultihash(t), blobstore.ErrDataInconsistent))
+		fail := failure.FromError(failureOf(cause))
+		require.Equal(t, "DigestMismatch", fail.Name())
+	})
+
+	t.Run("reports other errors as a transfer failure", func(t *testing.T) {
+		fail := failure.FromError(failureOf(errors.New("boom")))
+		require.Equal(t, "TransferFailed", fail.Name())
+		require.Contains(t, fail.Error(), "boom")
+	})
+}
@@ -0,0 +1,53 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/storacha/go-ucanto/did"
+
+	usagecap "github.com/storacha/piri/pkg/capabilities/usage"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/store/usagestore/usage"
+)
+
+var log = logging.Logger("storage/handlers/usage")
+
+type GetService interface {
+	Blobs() blobs.Blobs
+}
+
+type GetRequest struct {
+	// Space is the space to report usage for. When nil, usage across every
+	// space is reported.
+	Space *did.DID
+}
+
+type GetResponse struct {
+	Usage usage.Usage
+	// Limit is the quota that applies to the usage, or zero if there is none.
+	Limit uint64
+}
+
+// Get reports the bytes allocated and received by a space, or by the node as
+// a whole, along with the quota that applies.
+func Get(ctx context.Context, s GetService, req *GetRequest) (*GetResponse, error) {
+	if req.Space == nil {
+		log.Infof("%s node", usagecap.GetAbility)
+		u, err := s.Blobs().Usage().Total(ctx)
+		if err != nil {
+			log.Errorw("getting node usage", "error", err)
+			return nil, fmt.Errorf("getting node usage: %w", err)
+		}
+		return &GetResponse{Usage: u, Limit: s.Blobs().Usage().Quota().Node}, nil
+	}
+
+	log.Infof("%s %s", usagecap.GetAbility, *req.Space)
+	u, err := s.Blobs().Usage().Get(ctx, *req.Space)
+	if err != nil {
+		log.Errorw("getting space usage", "space", *req.Space, "error", err)
+		return nil, fmt.Errorf("getting space usage: %w", err)
+	}
+	return &GetResponse{Usage: u, Limit: s.Blobs().Usage().Quota().Space}, nil
+}
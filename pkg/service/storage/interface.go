@@ -4,10 +4,13 @@ import (
 	"github.com/storacha/go-ucanto/client"
 	"github.com/storacha/go-ucanto/principal"
 
+	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/pdp"
 	"github.com/storacha/piri/pkg/service/blobs"
 	"github.com/storacha/piri/pkg/service/claims"
+	"github.com/storacha/piri/pkg/service/outbox"
 	"github.com/storacha/piri/pkg/service/replicator"
+	"github.com/storacha/piri/pkg/service/scrubber"
 	"github.com/storacha/piri/pkg/store/receiptstore"
 )
 
@@ -24,6 +27,14 @@ type Service interface {
 	Receipts() receiptstore.ReceiptStore
 	// Replicator provides access to the replication service
 	Replicator() replicator.Replicator
+	// Outbox delivers receipts to the upload service.
+	Outbox() outbox.Outbox
+	// Scrubber checks the integrity of stored blobs. It is nil if the
+	// blobstore cannot be scrubbed.
+	Scrubber() scrubber.Scrubber
+	// BlobLocks are held on a blob while it is removed, collected or its
+	// claims renewed, so that these do not interleave.
+	BlobLocks() *digestutil.Locks
 	// UploadService provides access to an upload service connection
 	UploadConnection() client.Connection
 }
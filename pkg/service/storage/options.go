@@ -2,6 +2,7 @@ package storage
 
 import (
 	"net/url"
+	"time"
 
 	"github.com/ipfs/go-datastore"
 	logging "github.com/ipfs/go-log/v2"
@@ -20,6 +21,7 @@ import (
 	"github.com/storacha/piri/pkg/store/blobstore"
 	"github.com/storacha/piri/pkg/store/claimstore"
 	"github.com/storacha/piri/pkg/store/receiptstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
 )
 
 type PDPConfig struct {
@@ -52,6 +54,30 @@ type config struct {
 	indexingService       client.Connection
 	indexingServiceProofs delegation.Proofs
 	uploadService         client.Connection
+	collectorInterval     time.Duration
+	scrubDatastore        datastore.Datastore
+	scrubberInterval      time.Duration
+	scrubberRate          *uint64
+	usageStore            usagestore.UsageStore
+	usageDatastore        datastore.Batching
+	spaceQuota            uint64
+	nodeQuota             uint64
+	capacityLimit         uint64
+	capacityDirs          []string
+	capacityInterval      time.Duration
+	sweeperInterval       time.Duration
+	sweeperReportOnly     bool
+	replicatorDBPath      string
+	replicatorMaxAttempts uint
+	replicatorConcurrency uint
+	replicatorBandwidth   uint64
+	outboxDBPath          string
+	publisherBatchDBPath  string
+	publisherBatchWindow  time.Duration
+	publisherBatchSize    int
+	locationExpiration    time.Duration
+	locationRenewBefore   time.Duration
+	renewerInterval       time.Duration
 }
 
 type Option func(*config) error
@@ -257,6 +283,234 @@ func WithLogLevel(name string, level string) Option {
 	}
 }
 
+// WithCollectorInterval configures how often the garbage collector looks for
+// expired allocations that were never accepted, and removes the blobs and
+// location claims that are no longer referenced.
+func WithCollectorInterval(interval time.Duration) Option {
+	return func(c *config) error {
+		c.collectorInterval = interval
+		return nil
+	}
+}
+
+// WithSweeperInterval configures how often allocations that expired before
+// their blob was received are swept.
+func WithSweeperInterval(interval time.Duration) Option {
+	return func(c *config) error {
+		c.sweeperInterval = interval
+		return nil
+	}
+}
+
+// WithSweeperReportOnly causes the sweeper to log expired allocations for
+// blobs that were never received, without removing them.
+func WithSweeperReportOnly(reportOnly bool) Option {
+	return func(c *config) error {
+		c.sweeperReportOnly = reportOnly
+		return nil
+	}
+}
+
+// WithReplicatorDatabasePath configures the path of the SQLite database that
+// holds the replication queue. Without it the queue is held in memory, and
+// queued transfers are lost on restart.
+func WithReplicatorDatabasePath(path string) Option {
+	return func(c *config) error {
+		c.replicatorDBPath = path
+		return nil
+	}
+}
+
+// WithReplicatorMaxAttempts configures the number of times a replica transfer
+// is attempted before a failure receipt is issued for it.
+func WithReplicatorMaxAttempts(n uint) Option {
+	return func(c *config) error {
+		c.replicatorMaxAttempts = n
+		return nil
+	}
+}
+
+// WithReplicatorConcurrency configures the number of replica transfers that
+// run at the same time.
+func WithReplicatorConcurrency(n uint) Option {
+	return func(c *config) error {
+		c.replicatorConcurrency = n
+		return nil
+	}
+}
+
+// WithReplicatorBandwidth limits the total rate, in bytes per second, at which
+// replicas are fetched from their sources. Zero means unlimited.
+func WithReplicatorBandwidth(bytesPerSecond uint64) Option {
+	return func(c *config) error {
+		c.replicatorBandwidth = bytesPerSecond
+		return nil
+	}
+}
+
+// WithOutboxDatabasePath configures the path of the SQLite database that holds
+// receipts waiting to be delivered to the upload service. Without it they are
+// held in memory, and undelivered receipts are not retried after a restart.
+func WithOutboxDatabasePath(path string) Option {
+	return func(c *config) error {
+		c.outboxDBPath = path
+		return nil
+	}
+}
+
+// WithPublisherBatchDatabasePath configures the path of the SQLite database
+// that holds location commitments waiting to be advertised in a batch. Without
+// it they are held in memory, and pending advertisements are lost on restart.
+func WithPublisherBatchDatabasePath(path string) Option {
+	return func(c *config) error {
+		c.publisherBatchDBPath = path
+		return nil
+	}
+}
+
+// WithPublisherBatchWindow enables batching of location commitment
+// advertisements, and configures the maximum time a location commitment is
+// held before it is advertised. Zero disables batching.
+func WithPublisherBatchWindow(window time.Duration) Option {
+	return func(c *config) error {
+		c.publisherBatchWindow = window
+		return nil
+	}
+}
+
+// WithPublisherBatchSize configures the number of pending location commitments
+// that causes a batch to be advertised before the batch window has passed.
+func WithPublisherBatchSize(size int) Option {
+	return func(c *config) error {
+		c.publisherBatchSize = size
+		return nil
+	}
+}
+
+// WithLocationClaimExpiration configures how long location claims issued by
+// the node are valid for. Expiring claims are renewed for as long as their blob
+// is stored here, so claims for data that was removed or moved eventually
+// lapse. Zero, the default, issues location claims that never expire.
+func WithLocationClaimExpiration(d time.Duration) Option {
+	return func(c *config) error {
+		c.locationExpiration = d
+		return nil
+	}
+}
+
+// WithLocationClaimRenewBefore configures how long before they expire location
+// claims are renewed.
+func WithLocationClaimRenewBefore(d time.Duration) Option {
+	return func(c *config) error {
+		c.locationRenewBefore = d
+		return nil
+	}
+}
+
+// WithRenewerInterval configures how often location claims are checked for
+// renewal.
+func WithRenewerInterval(interval time.Duration) Option {
+	return func(c *config) error {
+		c.renewerInterval = interval
+		return nil
+	}
+}
+
+// WithScrubDatastore configures the underlying datastore used to record the
+// results of blob integrity checks.
+func WithScrubDatastore(dstore datastore.Datastore) Option {
+	return func(c *config) error {
+		c.scrubDatastore = dstore
+		return nil
+	}
+}
+
+// WithScrubberInterval configures how often the scrubber re-hashes every blob
+// in the blobstore to detect corruption.
+func WithScrubberInterval(interval time.Duration) Option {
+	return func(c *config) error {
+		c.scrubberInterval = interval
+		return nil
+	}
+}
+
+// WithScrubberRate limits the number of bytes per second the scrubber reads
+// from the blobstore. A rate of zero means unlimited.
+func WithScrubberRate(bytesPerSecond uint64) Option {
+	return func(c *config) error {
+		c.scrubberRate = &bytesPerSecond
+		return nil
+	}
+}
+
+// WithUsageStore configures the ledger of bytes used by each space directly.
+// Quotas configured with [WithSpaceQuota] and [WithNodeQuota] do not apply to
+// a store configured this way.
+func WithUsageStore(usageStore usagestore.UsageStore) Option {
+	return func(c *config) error {
+		c.usageStore = usageStore
+		return nil
+	}
+}
+
+// WithUsageDatastore configures the underlying datastore used to record the
+// bytes allocated and received by each space. It must support batching so
+// that the records of a blob and the totals it contributes to are updated
+// together.
+func WithUsageDatastore(dstore datastore.Batching) Option {
+	return func(c *config) error {
+		c.usageDatastore = dstore
+		return nil
+	}
+}
+
+// WithSpaceQuota limits the number of bytes each space may allocate on this
+// node. A limit of zero means unlimited.
+func WithSpaceQuota(limit uint64) Option {
+	return func(c *config) error {
+		c.spaceQuota = limit
+		return nil
+	}
+}
+
+// WithNodeQuota limits the number of bytes that may be allocated on this node
+// across every space. A limit of zero means unlimited.
+func WithNodeQuota(limit uint64) Option {
+	return func(c *config) error {
+		c.nodeQuota = limit
+		return nil
+	}
+}
+
+// WithCapacityLimit caps the number of bytes the node stores. Allocations
+// that would exceed the limit, or the free space in the blobstore, are
+// refused. A limit of zero means the node is limited by free space only.
+func WithCapacityLimit(limit uint64) Option {
+	return func(c *config) error {
+		c.capacityLimit = limit
+		return nil
+	}
+}
+
+// WithCapacityDirs adds directories whose free space counts towards the
+// capacity of the node, in addition to the blobstore. For example, the
+// directory PDP pieces are stashed in before being added to the proof set.
+func WithCapacityDirs(dirs ...string) Option {
+	return func(c *config) error {
+		c.capacityDirs = append(c.capacityDirs, dirs...)
+		return nil
+	}
+}
+
+// WithCapacityInterval configures how often the space used and available to
+// the node is measured.
+func WithCapacityInterval(interval time.Duration) Option {
+	return func(c *config) error {
+		c.capacityInterval = interval
+		return nil
+	}
+}
+
 // WithPDPConfig causes the service to run through Curio and do PDP proofs
 func WithPDPConfig(pdpConfig PDPConfig) Option {
 	return func(c *config) error {
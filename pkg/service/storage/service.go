@@ -2,11 +2,13 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/ipni/go-libipni/maurl"
@@ -17,15 +19,27 @@ import (
 	ed25519 "github.com/storacha/go-ucanto/principal/ed25519/signer"
 	ucanhttp "github.com/storacha/go-ucanto/transport/http"
 
+	"github.com/storacha/piri/pkg/database"
+	"github.com/storacha/piri/pkg/database/sqlitedb"
+	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/pdp"
 	"github.com/storacha/piri/pkg/pdp/curio"
 	"github.com/storacha/piri/pkg/presets"
 	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/capacity"
 	"github.com/storacha/piri/pkg/service/claims"
+	"github.com/storacha/piri/pkg/service/collector"
+	"github.com/storacha/piri/pkg/service/outbox"
+	"github.com/storacha/piri/pkg/service/renewer"
 	"github.com/storacha/piri/pkg/service/replicator"
+	"github.com/storacha/piri/pkg/service/scrubber"
+	"github.com/storacha/piri/pkg/service/sweeper"
+	"github.com/storacha/piri/pkg/store/allocationstore"
 	"github.com/storacha/piri/pkg/store/blobstore"
-	"github.com/storacha/piri/pkg/store/delegationstore"
+	"github.com/storacha/piri/pkg/store/claimstore"
 	"github.com/storacha/piri/pkg/store/receiptstore"
+	"github.com/storacha/piri/pkg/store/scrubstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
 )
 
 type StorageService struct {
@@ -35,6 +49,9 @@ type StorageService struct {
 	pdp           pdp.PDP
 	receiptStore  receiptstore.ReceiptStore
 	replicator    replicator.Replicator
+	outbox        outbox.Outbox
+	scrubber      scrubber.Scrubber
+	blobLocks     *digestutil.Locks
 	uploadService client.Connection
 	startFuncs    []func(ctx context.Context) error
 	closeFuncs    []func(ctx context.Context) error
@@ -45,6 +62,22 @@ func (s *StorageService) Replicator() replicator.Replicator {
 	return s.replicator
 }
 
+func (s *StorageService) Outbox() outbox.Outbox {
+	return s.outbox
+}
+
+// Scrubber provides access to the blob integrity scrubber. It is nil if the
+// blobstore cannot be scrubbed.
+func (s *StorageService) Scrubber() scrubber.Scrubber {
+	return s.scrubber
+}
+
+// BlobLocks are held on a blob while it is removed, collected or its claims
+// renewed.
+func (s *StorageService) BlobLocks() *digestutil.Locks {
+	return s.blobLocks
+}
+
 func (s *StorageService) UploadConnection() client.Connection {
 	return s.uploadService
 }
@@ -89,6 +122,24 @@ func (s *StorageService) Close(ctx context.Context) error {
 
 var _ Service = (*StorageService)(nil)
 
+// UploadServiceOutbox is the name of the outbox that delivers receipts to the
+// upload service.
+const UploadServiceOutbox = "upload_service"
+
+// openQueueDB opens the SQLite database at path that holds the job queue of a
+// service, or an in-memory database if no path is configured.
+func openQueueDB(path string, service string) (*sql.DB, error) {
+	if path == "" {
+		log.Warnf("%s database not configured, using in-memory database", service)
+		return sqlitedb.NewMemory()
+	}
+	return sqlitedb.New(path,
+		database.WithJournalMode("WAL"),
+		database.WithTimeout(5*time.Second),
+		database.WithSyncMode(database.SyncModeNORMAL),
+	)
+}
+
 func New(opts ...Option) (*StorageService, error) {
 	c := &config{}
 	for _, opt := range opts {
@@ -111,19 +162,46 @@ func New(opts ...Option) (*StorageService, error) {
 
 	var closeFuncs []func(context.Context) error
 	var startFuncs []func(ctx context.Context) error
+	// services are stopped before the stores they use are closed, in the
+	// reverse of the order they are created, so that a service stops before
+	// the services it depends on
+	var stopFuncs []func(context.Context) error
+	stop := func(f func(context.Context) error) {
+		stopFuncs = append([]func(context.Context) error{f}, stopFuncs...)
+	}
 
 	blobOpts := []blobs.Option{}
 
-	if c.allocationStore == nil {
+	allocStore := c.allocationStore
+	if allocStore == nil {
 		allocDs := c.allocationDatastore
 		if allocDs == nil {
 			allocDs = datastore.NewMapDatastore()
 			log.Warn("Allocation datastore not configured, using in-memory datastore")
 		}
 		closeFuncs = append(closeFuncs, func(context.Context) error { return allocDs.Close() })
-		blobOpts = append(blobOpts, blobs.WithDSAllocationStore(allocDs))
+		var err error
+		allocStore, err = allocationstore.NewDsAllocationStore(allocDs)
+		if err != nil {
+			return nil, fmt.Errorf("creating allocation store: %w", err)
+		}
+	}
+	blobOpts = append(blobOpts, blobs.WithAllocationStore(allocStore))
+
+	if c.usageStore == nil {
+		usageDs := c.usageDatastore
+		if usageDs == nil {
+			usageDs = datastore.NewMapDatastore()
+			log.Warn("Usage datastore not configured, using in-memory datastore")
+		}
+		closeFuncs = append(closeFuncs, func(context.Context) error { return usageDs.Close() })
+		blobOpts = append(blobOpts, blobs.WithDSUsageStore(
+			usageDs,
+			usagestore.WithSpaceQuota(c.spaceQuota),
+			usagestore.WithNodeQuota(c.nodeQuota),
+		))
 	} else {
-		blobOpts = append(blobOpts, blobs.WithAllocationStore(c.allocationStore))
+		blobOpts = append(blobOpts, blobs.WithUsageStore(c.usageStore))
 	}
 
 	claimStore := c.claimStore
@@ -135,7 +213,7 @@ func New(opts ...Option) (*StorageService, error) {
 		}
 		closeFuncs = append(closeFuncs, func(context.Context) error { return claimDs.Close() })
 		var err error
-		claimStore, err = delegationstore.NewDsDelegationStore(claimDs)
+		claimStore, err = claimstore.NewDsClaimStore(claimDs)
 		if err != nil {
 			return nil, fmt.Errorf("creating claim store: %w", err)
 		}
@@ -172,14 +250,75 @@ func New(opts ...Option) (*StorageService, error) {
 		}
 	}
 
+	var uploadServiceConnection client.Connection
+	if c.uploadService == nil {
+		channel := ucanhttp.NewHTTPChannel(presets.UploadServiceURL)
+		conn, err := client.NewConnection(presets.UploadServiceDID, channel)
+		if err != nil {
+			return nil, fmt.Errorf("creating upload service connection: %w", err)
+		}
+		uploadServiceConnection = conn
+	} else {
+		uploadServiceConnection = c.uploadService
+	}
+
+	outboxDB, err := openQueueDB(c.outboxDBPath, "Outbox")
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox database: %w", err)
+	}
+	ob, err := outbox.New(UploadServiceOutbox, uploadServiceConnection, receiptStore, outboxDB)
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox: %w", err)
+	}
+	startFuncs = append(startFuncs, ob.Start)
+	stop(ob.Stop)
+
 	var pdpImpl pdp.PDP
+	var scrub scrubber.Scrubber
+	var blobStore blobstore.Blobstore
+	var capacitySources []blobstore.SpaceReporter
 	if c.pdp == nil {
-		blobStore := c.blobStore
+		blobStore = c.blobStore
 		if blobStore == nil {
 			blobStore = blobstore.NewMapBlobstore()
 			log.Warn("Blob store not configured, using in-memory store")
 		}
 
+		if sr, ok := blobStore.(blobstore.SpaceReporter); ok {
+			capacitySources = append(capacitySources, sr)
+		} else {
+			log.Warn("Blob store does not report space used, capacity limited by configured limit only")
+		}
+
+		if _, ok := blobStore.(blobstore.Lister); ok {
+			scrubDs := c.scrubDatastore
+			if scrubDs == nil {
+				scrubDs = datastore.NewMapDatastore()
+				log.Warn("Scrub datastore not configured, using in-memory datastore")
+			}
+			report, err := scrubstore.NewDsScrubStore(scrubDs)
+			if err != nil {
+				return nil, fmt.Errorf("creating scrub store: %w", err)
+			}
+			scrubberOpts := []scrubber.Option{}
+			if c.scrubberInterval > 0 {
+				scrubberOpts = append(scrubberOpts, scrubber.WithInterval(c.scrubberInterval))
+			}
+			if c.scrubberRate != nil {
+				scrubberOpts = append(scrubberOpts, scrubber.WithRate(*c.scrubberRate))
+			}
+			scrubSvc, err := scrubber.New(blobStore, report, scrubberOpts...)
+			if err != nil {
+				return nil, fmt.Errorf("creating scrubber: %w", err)
+			}
+			startFuncs = append(startFuncs, scrubSvc.Start)
+			stop(scrubSvc.Stop)
+			closeFuncs = append(closeFuncs, func(context.Context) error { return scrubDs.Close() })
+			scrub = scrubSvc
+		} else {
+			log.Warn("Blob store does not support enumerating blobs, integrity scrubbing disabled")
+		}
+
 		blobOpts = append(blobOpts, blobs.WithBlobstore(blobStore))
 		if c.blobsAccess != nil {
 			blobOpts = append(blobOpts, blobs.WithAccess(c.blobsAccess))
@@ -215,23 +354,29 @@ func New(opts ...Option) (*StorageService, error) {
 			if err != nil {
 				return nil, fmt.Errorf("creating pdp service: %w", err)
 			}
-			closeFuncs = append(closeFuncs, pdpService.Shutdown)
+			stop(pdpService.Shutdown)
 			startFuncs = append(startFuncs, pdpService.Startup)
 			pdpImpl = pdpService
 		}
 	}
 
-	var uploadServiceConnection client.Connection
-	if c.uploadService == nil {
-		channel := ucanhttp.NewHTTPChannel(presets.UploadServiceURL)
-		conn, err := client.NewConnection(presets.UploadServiceDID, channel)
-		if err != nil {
-			return nil, fmt.Errorf("creating upload service connection: %w", err)
-		}
-		uploadServiceConnection = conn
-	} else {
-		uploadServiceConnection = c.uploadService
+	for _, dir := range c.capacityDirs {
+		capacitySources = append(capacitySources, blobstore.DirSpace(dir))
 	}
+	capacityOpts := []capacity.Option{
+		capacity.WithLimit(c.capacityLimit),
+		capacity.WithSources(capacitySources...),
+	}
+	if c.capacityInterval > 0 {
+		capacityOpts = append(capacityOpts, capacity.WithInterval(c.capacityInterval))
+	}
+	capacityMgr, err := capacity.New(allocStore, blobStore, capacityOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating capacity manager: %w", err)
+	}
+	startFuncs = append(startFuncs, capacityMgr.Start)
+	stop(capacityMgr.Stop)
+	blobOpts = append(blobOpts, blobs.WithCapacity(capacityMgr))
 
 	blobs, err := blobs.New(blobOpts...)
 	if err != nil {
@@ -243,28 +388,109 @@ func New(opts ...Option) (*StorageService, error) {
 		return nil, fmt.Errorf("parsing publisher url as multiaddr: %w", err)
 	}
 
-	claims, err := claims.New(
-		id,
-		claimStore,
-		publisherStore,
-		peerAddr,
+	claimOpts := []claims.Option{
 		claims.WithPublisherDirectAnnounce(c.announceURLs...),
 		claims.WithPublisherAnnounceAddress(c.publisherAnnouceAddr),
 		claims.WithPublisherBlobAddress(c.publisherBlobAddress),
 		claims.WithPublisherIndexingService(c.indexingService),
 		claims.WithPublisherIndexingServiceProof(c.indexingServiceProofs...),
-	)
+		claims.WithPublisherBlobGetter(&blobGetter{pdp: pdpImpl, blobs: blobs, client: http.DefaultClient}),
+		claims.WithLocationClaimExpiration(c.locationExpiration),
+	}
+	if c.publisherBatchWindow > 0 {
+		batchDB, err := openQueueDB(c.publisherBatchDBPath, "Publisher batch")
+		if err != nil {
+			return nil, fmt.Errorf("creating publisher batch database: %w", err)
+		}
+		closeFuncs = append(closeFuncs, func(context.Context) error { return batchDB.Close() })
+		claimOpts = append(claimOpts,
+			claims.WithPublisherBatchDatabase(batchDB),
+			claims.WithPublisherBatchWindow(c.publisherBatchWindow),
+			claims.WithPublisherBatchSize(c.publisherBatchSize),
+		)
+	}
+	claims, err := claims.New(id, claimStore, publisherStore, peerAddr, claimOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("creating claim service: %w", err)
 	}
+	startFuncs = append(startFuncs, claims.Start)
+	stop(claims.Stop)
 
-	repl, err := replicator.New(id, pdpImpl, blobs, claims, receiptStore, uploadServiceConnection)
+	replDB, err := openQueueDB(c.replicatorDBPath, "Replicator")
+	if err != nil {
+		return nil, fmt.Errorf("creating replicator database: %w", err)
+	}
+	replOpts := []replicator.Option{replicator.WithBandwidth(c.replicatorBandwidth)}
+	if c.replicatorMaxAttempts > 0 {
+		replOpts = append(replOpts, replicator.WithMaxAttempts(c.replicatorMaxAttempts))
+	}
+	if c.replicatorConcurrency > 0 {
+		replOpts = append(replOpts, replicator.WithMaxWorkers(c.replicatorConcurrency))
+	}
+	repl, err := replicator.New(id, pdpImpl, blobs, claims, receiptStore, ob, replDB, replOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("creating replicator service: %w", err)
 	}
 
 	startFuncs = append(startFuncs, repl.Start)
-	closeFuncs = append(closeFuncs, repl.Stop)
+	stop(repl.Stop)
+	closeFuncs = append(closeFuncs, func(context.Context) error { return replDB.Close() })
+
+	sweeperOpts := []sweeper.Option{sweeper.WithReportOnly(c.sweeperReportOnly)}
+	if c.sweeperInterval > 0 {
+		sweeperOpts = append(sweeperOpts, sweeper.WithInterval(c.sweeperInterval))
+	}
+	sweep, err := sweeper.New(pdpImpl, blobs, sweeperOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating allocation sweeper: %w", err)
+	}
+	startFuncs = append(startFuncs, sweep.Start)
+	stop(sweep.Stop)
+
+	// the collector, renewer and blob/remove handler must not act on the same
+	// blob at once, so that claims are not renewed for a blob as it is removed
+	blobLocks := &digestutil.Locks{}
+
+	if _, ok := claimStore.(claimstore.ContentLister); ok {
+		collectorOpts := []collector.Option{
+			collector.WithPublisher(claims.Publisher()),
+			collector.WithBlobLocks(blobLocks),
+		}
+		if c.collectorInterval > 0 {
+			collectorOpts = append(collectorOpts, collector.WithInterval(c.collectorInterval))
+		}
+		gc, err := collector.New(blobs, claimStore, collectorOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("creating garbage collector: %w", err)
+		}
+		startFuncs = append(startFuncs, gc.Start)
+		stop(gc.Stop)
+	} else {
+		log.Warn("Claim store does not support listing claims by content, garbage collection disabled")
+	}
+
+	if c.locationExpiration > 0 {
+		if _, ok := claimStore.(claimstore.ExpiryLister); ok {
+			renewerOpts := []renewer.Option{renewer.WithBlobLocks(blobLocks)}
+			if c.renewerInterval > 0 {
+				renewerOpts = append(renewerOpts, renewer.WithInterval(c.renewerInterval))
+			}
+			if c.locationRenewBefore > 0 {
+				renewerOpts = append(renewerOpts, renewer.WithRenewBefore(c.locationRenewBefore))
+			}
+			rn, err := renewer.New(id, pdpImpl, blobs, claims, renewerOpts...)
+			if err != nil {
+				return nil, fmt.Errorf("creating location claim renewer: %w", err)
+			}
+			startFuncs = append(startFuncs, rn.Start)
+			stop(rn.Stop)
+		} else {
+			log.Warn("Claim store does not support listing claims by expiration, location claims will not be renewed")
+		}
+	}
+
+	closeFuncs = append(closeFuncs, func(context.Context) error { return outboxDB.Close() })
+	closeFuncs = append(stopFuncs, closeFuncs...)
 
 	return &StorageService{
 		id:            c.id,
@@ -275,6 +501,9 @@ func New(opts ...Option) (*StorageService, error) {
 		receiptStore:  receiptStore,
 		pdp:           pdpImpl,
 		replicator:    repl,
+		outbox:        ob,
+		scrubber:      scrub,
+		blobLocks:     blobLocks,
 		uploadService: uploadServiceConnection,
 	}, nil
 }
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 
 	logging "github.com/ipfs/go-log/v2"
@@ -19,11 +20,16 @@ import (
 	"github.com/storacha/go-ucanto/core/result"
 	"github.com/storacha/go-ucanto/core/result/failure"
 	fdm "github.com/storacha/go-ucanto/core/result/failure/datamodel"
+	"github.com/storacha/go-ucanto/core/result/ok"
 	"github.com/storacha/go-ucanto/server"
 	"github.com/storacha/go-ucanto/ucan"
 
+	blobcap "github.com/storacha/piri/pkg/capabilities/blob"
+	usagecap "github.com/storacha/piri/pkg/capabilities/usage"
 	blobhandler "github.com/storacha/piri/pkg/service/storage/handlers/blob"
+	claimhandler "github.com/storacha/piri/pkg/service/storage/handlers/claim"
 	replicahandler "github.com/storacha/piri/pkg/service/storage/handlers/replica"
+	usagehandler "github.com/storacha/piri/pkg/service/storage/handlers/usage"
 )
 
 var log = logging.Logger("storage")
@@ -111,11 +117,114 @@ func NewUCANServer(storageService Service, options ...server.Option) (server.Ser
 						tmp := resp.PDP.Link()
 						res.PDP = &tmp
 					}
+					if resp.Equals != nil {
+						forks = append(forks, fx.FromInvocation(resp.Equals))
+					}
 
 					return res, fx.NewEffects(fx.WithFork(forks...)), nil
 				},
 			),
 		),
+		server.WithServiceMethod(
+			blobcap.RemoveAbility,
+			server.Provide(
+				blobcap.Remove,
+				func(cap ucan.Capability[blobcap.RemoveCaveats], inv invocation.Invocation, iCtx server.InvocationContext) (blobcap.RemoveOk, fx.Effects, error) {
+					//
+					// UCAN Validation
+					//
+
+					// only service principal can perform a removal
+					if cap.With() != iCtx.ID().DID().String() {
+						return blobcap.RemoveOk{}, nil, NewUnsupportedCapabilityError(cap)
+					}
+
+					//
+					// end UCAN Validation
+					//
+
+					// FIXME: use a real context, requires changes to server
+					ctx := context.TODO()
+					resp, err := blobhandler.Remove(ctx, storageService, &blobhandler.RemoveRequest{
+						Space:  cap.Nb().Space,
+						Digest: cap.Nb().Digest,
+					})
+					if err != nil {
+						return blobcap.RemoveOk{}, nil, failure.FromError(err)
+					}
+
+					return blobcap.RemoveOk{Size: resp.Size}, nil, nil
+				},
+			),
+		),
+		server.WithServiceMethod(
+			assert.IndexAbility,
+			server.Provide(
+				assert.Index,
+				func(cap ucan.Capability[assert.IndexCaveats], inv invocation.Invocation, iCtx server.InvocationContext) (ok.Unit, fx.Effects, error) {
+					//
+					// UCAN Validation
+					//
+
+					// only service principal can have an index published
+					if cap.With() != iCtx.ID().DID().String() {
+						return ok.Unit{}, nil, NewUnsupportedCapabilityError(cap)
+					}
+
+					//
+					// end UCAN Validation
+					//
+
+					// FIXME: use a real context, requires changes to server
+					ctx := context.TODO()
+					err := claimhandler.Index(ctx, storageService, &claimhandler.IndexRequest{
+						Claim: inv,
+					})
+					if err != nil {
+						return ok.Unit{}, nil, failure.FromError(err)
+					}
+					return ok.Unit{}, nil, nil
+				},
+			),
+		),
+		server.WithServiceMethod(
+			usagecap.GetAbility,
+			server.Provide(
+				usagecap.Get,
+				func(cap ucan.Capability[usagecap.GetCaveats], inv invocation.Invocation, iCtx server.InvocationContext) (usagecap.GetOk, fx.Effects, error) {
+					//
+					// UCAN Validation
+					//
+
+					// only service principal can read usage
+					if cap.With() != iCtx.ID().DID().String() {
+						return usagecap.GetOk{}, nil, NewUnsupportedCapabilityError(cap)
+					}
+
+					//
+					// end UCAN Validation
+					//
+
+					// FIXME: use a real context, requires changes to server
+					ctx := context.TODO()
+					resp, err := usagehandler.Get(ctx, storageService, &usagehandler.GetRequest{
+						Space: cap.Nb().Space,
+					})
+					if err != nil {
+						return usagecap.GetOk{}, nil, failure.FromError(err)
+					}
+
+					ok := usagecap.GetOk{
+						Allocated: resp.Usage.Allocated,
+						Received:  resp.Usage.Received,
+					}
+					if resp.Limit > 0 {
+						ok.Limit = &resp.Limit
+					}
+					return ok, nil, nil
+				},
+			),
+		),
 		server.WithServiceMethod(
 			pdp.InfoAbility,
 			server.Provide(
@@ -206,9 +315,6 @@ func NewUCANServer(storageService Service, options ...server.Option) (server.Ser
 						return replica.AllocateOk{}, nil, failure.FromError(fmt.Errorf("location missing from location claim"))
 					}
 
-					// TODO: which one do we pick if > 1?
-					replicaAddress := lc.Location[0]
-
 					// FIXME: use a real context, requires changes to server
 					ctx := context.TODO()
 					resp, err := blobhandler.Allocate(ctx, storageService, &blobhandler.AllocateRequest{
@@ -251,21 +357,24 @@ func NewUCANServer(storageService Service, options ...server.Option) (server.Ser
 					// iff we didn't allocate space for the data, and didn't provide an address, then it means we have
 					// already allocated space and receieved the data. Therefore, no replication is required.
 					sink := new(url.URL)
+					var sinkHeader http.Header
 					if resp.Size == 0 && resp.Address == nil {
 						sink = nil
 					} else {
 						// we need to replicate
 						sink = &resp.Address.URL
+						sinkHeader = resp.Address.Headers
 					}
 
 					// will run replication async, sending the receipt of the transfer invocation
 					// to the upload service.
 					if err := storageService.Replicator().Replicate(ctx, &replicahandler.TransferRequest{
-						Space:  cap.Nb().Space,
-						Blob:   cap.Nb().Blob,
-						Source: replicaAddress,
-						Sink:   sink,
-						Cause:  trnsfInv,
+						Space:      cap.Nb().Space,
+						Blob:       cap.Nb().Blob,
+						Sources:    lc.Location,
+						Sink:       sink,
+						SinkHeader: sinkHeader,
+						Cause:      trnsfInv,
 					}); err != nil {
 						return replica.AllocateOk{}, nil, failure.FromError(fmt.Errorf("failed to enqueue replication task: %w", err))
 					}
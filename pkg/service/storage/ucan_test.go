@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"math/rand/v2"
 	"net/http"
 	"net/url"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/ipfs/go-cid"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 	"github.com/storacha/go-libstoracha/capabilities/assert"
 	"github.com/storacha/go-libstoracha/capabilities/blob"
@@ -30,12 +32,19 @@ import (
 	"github.com/storacha/go-ucanto/core/result/failure"
 	fdm "github.com/storacha/go-ucanto/core/result/failure/datamodel"
 	"github.com/storacha/go-ucanto/core/result/ok"
+	udm "github.com/storacha/go-ucanto/core/result/ok/datamodel"
 	"github.com/storacha/go-ucanto/did"
+	sdm "github.com/storacha/go-ucanto/server/datamodel"
 	"github.com/storacha/go-ucanto/ucan"
 	"github.com/stretchr/testify/require"
 
+	"github.com/storacha/piri/pkg/blobindex"
+	blobcap "github.com/storacha/piri/pkg/capabilities/blob"
+	usagecap "github.com/storacha/piri/pkg/capabilities/usage"
 	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
 	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/usagestore/usage"
 )
 
 func TestServer(t *testing.T) {
@@ -69,6 +78,16 @@ func TestServer(t *testing.T) {
 						testutil.Alice.DID().String(),
 						ucan.CaveatBuilder(ok.Unit{}),
 					),
+					ucan.NewCapability(
+						blobcap.RemoveAbility,
+						testutil.Alice.DID().String(),
+						ucan.CaveatBuilder(ok.Unit{}),
+					),
+					ucan.NewCapability(
+						assert.IndexAbility,
+						testutil.Alice.DID().String(),
+						ucan.CaveatBuilder(ok.Unit{}),
+					),
 				},
 			),
 		)(t),
@@ -317,6 +336,8 @@ func TestServer(t *testing.T) {
 			require.Equal(t, space, claim.Audience().DID())
 			require.Equal(t, assert.LocationAbility, claim.Capabilities()[0].Can())
 			require.Equal(t, testutil.Alice.DID().String(), claim.Capabilities()[0].With())
+			// location claims do not expire unless configured to
+			require.Nil(t, claim.Expiration())
 
 			nb, err := assert.LocationCaveatsReader.Read(claim.Capabilities()[0].Nb())
 			require.NoError(t, err)
@@ -332,12 +353,306 @@ func TestServer(t *testing.T) {
 			require.Nil(t, f)
 		})
 
+		u, err := svc.Blobs().Usage().Get(context.Background(), space)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{Allocated: size, Received: size}, u)
+
 		require.NotEmpty(t, rcpt.Fx().Fork())
 		effect := rcpt.Fx().Fork()[0]
 		claim, ok := effect.Invocation()
 		require.True(t, ok)
 		require.Equal(t, assert.LocationAbility, claim.Capabilities()[0].Can())
 	})
+
+	t.Run("blob/remove", func(t *testing.T) {
+		space := testutil.RandomDID(t)
+		size := uint64(rand.IntN(32) + 1)
+		data := testutil.RandomBytes(t, int(size))
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+		allocNb := blob.AllocateCaveats{
+			Space: space,
+			Blob: types.Blob{
+				Digest: digest,
+				Size:   size,
+			},
+			Cause: testutil.RandomCID(t),
+		}
+		allocCap := blob.Allocate.New(testutil.Alice.DID().String(), allocNb)
+		allocInv, err := invocation.Invoke(testutil.Service, testutil.Alice, allocCap, delegation.WithProof(prf))
+		require.NoError(t, err)
+
+		_, err = client.Execute([]invocation.Invocation{allocInv}, conn)
+		require.NoError(t, err)
+
+		// simulate a blob upload
+		err = svc.Blobs().Store().Put(context.Background(), digest, size, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		removeNb := blobcap.RemoveCaveats{Space: space, Digest: digest}
+		removeCap := blobcap.Remove.New(testutil.Alice.DID().String(), removeNb)
+		removeInv, err := invocation.Invoke(testutil.Service, testutil.Alice, removeCap, delegation.WithProof(prf))
+		require.NoError(t, err)
+
+		resp, err := client.Execute([]invocation.Invocation{removeInv}, conn)
+		require.NoError(t, err)
+
+		rcptlnk, ok := resp.Get(removeInv.Link())
+		require.True(t, ok, "missing receipt for invocation: %s", removeInv.Link())
+
+		reader := testutil.Must(receipt.NewReceiptReaderFromTypes[blobcap.RemoveOk, fdm.FailureModel](blobcap.RemoveOkType(), fdm.FailureType(), types.Converters...))(t)
+		rcpt := testutil.Must(reader.Read(rcptlnk, resp.Blocks()))(t)
+
+		result.MatchResultR0(rcpt.Out(), func(ok blobcap.RemoveOk) {
+			require.Equal(t, size, ok.Size)
+		}, func(f fdm.FailureModel) {
+			fmt.Println(f.Message)
+			require.Nil(t, f)
+		})
+
+		allocs, err := svc.Blobs().Allocations().List(context.Background(), digest)
+		require.NoError(t, err)
+		require.Empty(t, allocs)
+
+		_, err = svc.Blobs().Store().Get(context.Background(), digest)
+		require.ErrorIs(t, err, store.ErrNotFound)
+
+		u, err := svc.Blobs().Usage().Get(context.Background(), space)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{}, u)
+	})
+
+	t.Run("assert/index", func(t *testing.T) {
+		content := testutil.RandomCID(t)
+		shard := blobindex.Shard{Digest: testutil.RandomMultihash(t)}
+		for i := range 3 {
+			shard.Slices = append(shard.Slices, blobindex.Slice{Digest: testutil.RandomMultihash(t), Offset: uint64(i * 128), Length: 128})
+		}
+		archive, err := blobindex.Archive(blobindex.ShardedDagIndex{Content: content, Shards: []blobindex.Shard{shard}})
+		require.NoError(t, err)
+		data, err := io.ReadAll(archive)
+		require.NoError(t, err)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		index := cidlink.Link{Cid: cid.NewCidV1(uint64(multicodec.Car), digest)}
+
+		// simulate an index upload
+		err = svc.Blobs().Store().Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+		require.NoError(t, err)
+
+		indexCap := assert.Index.New(testutil.Alice.DID().String(), assert.IndexCaveats{Content: content, Index: index})
+		indexInv, err := invocation.Invoke(testutil.Service, testutil.Alice, indexCap, delegation.WithProof(prf))
+		require.NoError(t, err)
+
+		resp, err := client.Execute([]invocation.Invocation{indexInv}, conn)
+		require.NoError(t, err)
+
+		rcptlnk, found := resp.Get(indexInv.Link())
+		require.True(t, found, "missing receipt for invocation: %s", indexInv.Link())
+
+		reader := testutil.Must(receipt.NewReceiptReaderFromTypes[ok.Unit, fdm.FailureModel](udm.UnitType(), fdm.FailureType(), types.Converters...))(t)
+		rcpt := testutil.Must(reader.Read(rcptlnk, resp.Blocks()))(t)
+
+		result.MatchResultR0(rcpt.Out(), func(ok.Unit) {}, func(f fdm.FailureModel) {
+			fmt.Println(f.Message)
+			require.Nil(t, f)
+		})
+
+		claim, err := svc.Claims().Store().Get(context.Background(), indexInv.Link())
+		require.NoError(t, err)
+		require.Equal(t, assert.IndexAbility, claim.Capabilities()[0].Can())
+
+		pubStore := svc.Claims().Publisher().Store()
+		hd, err := pubStore.Head(context.Background())
+		require.NoError(t, err)
+		ad, err := pubStore.Advert(context.Background(), hd.Head)
+		require.NoError(t, err)
+		require.Equal(t, index.Cid.Bytes(), ad.ContextID)
+
+		var ents []multihash.Multihash
+		for d, err := range pubStore.Entries(context.Background(), ad.Entries) {
+			require.NoError(t, err)
+			ents = append(ents, d)
+		}
+		require.ElementsMatch(t, []multihash.Multihash{shard.Slices[0].Digest, shard.Slices[1].Digest, shard.Slices[2].Digest}, ents)
+	})
+
+	t.Run("assert/index for an index not stored here", func(t *testing.T) {
+		index := cidlink.Link{Cid: cid.NewCidV1(uint64(multicodec.Car), testutil.RandomMultihash(t))}
+		indexCap := assert.Index.New(testutil.Alice.DID().String(), assert.IndexCaveats{Content: testutil.RandomCID(t), Index: index})
+		indexInv, err := invocation.Invoke(testutil.Service, testutil.Alice, indexCap, delegation.WithProof(prf))
+		require.NoError(t, err)
+
+		resp, err := client.Execute([]invocation.Invocation{indexInv}, conn)
+		require.NoError(t, err)
+
+		rcptlnk, found := resp.Get(indexInv.Link())
+		require.True(t, found, "missing receipt for invocation: %s", indexInv.Link())
+
+		// handler errors are reported as the cause of a HandlerExecutionError
+		reader := testutil.Must(receipt.NewReceiptReaderFromTypes[ok.Unit, sdm.HandlerExecutionErrorModel](udm.UnitType(), sdm.HandlerExecutionErrorType(), types.Converters...))(t)
+		rcpt := testutil.Must(reader.Read(rcptlnk, resp.Blocks()))(t)
+
+		_, x := result.Unwrap(rcpt.Out())
+		require.True(t, x.Error)
+		require.Contains(t, x.Cause.Message, "getting index blob")
+
+		// the claim is not kept
+		_, err = svc.Claims().Store().Get(context.Background(), indexInv.Link())
+		require.Error(t, err)
+	})
+
+	t.Run("assert/index requires the authority of the node", func(t *testing.T) {
+		index := cidlink.Link{Cid: cid.NewCidV1(uint64(multicodec.Car), testutil.RandomMultihash(t))}
+		indexCap := assert.Index.New(testutil.Service.DID().String(), assert.IndexCaveats{Content: testutil.RandomCID(t), Index: index})
+		indexInv, err := invocation.Invoke(testutil.Service, testutil.Alice, indexCap)
+		require.NoError(t, err)
+
+		resp, err := client.Execute([]invocation.Invocation{indexInv}, conn)
+		require.NoError(t, err)
+
+		rcptlnk, found := resp.Get(indexInv.Link())
+		require.True(t, found, "missing receipt for invocation: %s", indexInv.Link())
+
+		reader := testutil.Must(receipt.NewReceiptReaderFromTypes[ok.Unit, sdm.HandlerExecutionErrorModel](udm.UnitType(), sdm.HandlerExecutionErrorType(), types.Converters...))(t)
+		rcpt := testutil.Must(reader.Read(rcptlnk, resp.Blocks()))(t)
+
+		_, x := result.Unwrap(rcpt.Out())
+		require.True(t, x.Error)
+		require.Equal(t, "UnsupportedCapability", *x.Cause.Name)
+
+		_, err = svc.Claims().Store().Get(context.Background(), indexInv.Link())
+		require.Error(t, err)
+	})
+}
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	svc, err := New(WithIdentity(testutil.Alice), WithLogLevel("*", "warn"), WithSpaceQuota(100), WithNodeQuota(150), WithCapacityLimit(120))
+	require.NoError(t, err)
+	err = svc.Startup(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		svc.Close(ctx)
+	})
+
+	srv, err := NewUCANServer(svc)
+	require.NoError(t, err)
+
+	conn := testutil.Must(client.NewConnection(testutil.Service, srv))(t)
+
+	prf := delegation.FromDelegation(
+		testutil.Must(
+			delegation.Delegate(
+				testutil.Alice,
+				testutil.Service,
+				[]ucan.Capability[ucan.CaveatBuilder]{
+					ucan.NewCapability(
+						blob.AllocateAbility,
+						testutil.Alice.DID().String(),
+						ucan.CaveatBuilder(ok.Unit{}),
+					),
+					ucan.NewCapability(
+						usagecap.GetAbility,
+						testutil.Alice.DID().String(),
+						ucan.CaveatBuilder(ok.Unit{}),
+					),
+				},
+			),
+		)(t),
+	)
+
+	// allocate returns the failure the handler caused, if any
+	allocate := func(t *testing.T, space did.DID, size uint64) *fdm.FailureModel {
+		nb := blob.AllocateCaveats{
+			Space: space,
+			Blob: types.Blob{
+				Digest: testutil.RandomMultihash(t),
+				Size:   size,
+			},
+			Cause: testutil.RandomCID(t),
+		}
+		cap := blob.Allocate.New(testutil.Alice.DID().String(), nb)
+		inv, err := invocation.Invoke(testutil.Service, testutil.Alice, cap, delegation.WithProof(prf))
+		require.NoError(t, err)
+
+		resp, err := client.Execute([]invocation.Invocation{inv}, conn)
+		require.NoError(t, err)
+
+		rcptlnk, ok := resp.Get(inv.Link())
+		require.True(t, ok, "missing receipt for invocation: %s", inv.Link())
+
+		// handler errors are reported as the cause of a HandlerExecutionError
+		reader := testutil.Must(receipt.NewReceiptReaderFromTypes[blob.AllocateOk, sdm.HandlerExecutionErrorModel](blob.AllocateOkType(), sdm.HandlerExecutionErrorType(), types.Converters...))(t)
+		rcpt := testutil.Must(reader.Read(rcptlnk, resp.Blocks()))(t)
+		_, x := result.Unwrap(rcpt.Out())
+		if !x.Error {
+			return nil
+		}
+		return &fdm.FailureModel{Name: x.Cause.Name, Message: x.Cause.Message}
+	}
+
+	getUsage := func(t *testing.T, space *did.DID) usagecap.GetOk {
+		cap := usagecap.Get.New(testutil.Alice.DID().String(), usagecap.GetCaveats{Space: space})
+		inv, err := invocation.Invoke(testutil.Service, testutil.Alice, cap, delegation.WithProof(prf))
+		require.NoError(t, err)
+
+		resp, err := client.Execute([]invocation.Invocation{inv}, conn)
+		require.NoError(t, err)
+
+		rcptlnk, ok := resp.Get(inv.Link())
+		require.True(t, ok, "missing receipt for invocation: %s", inv.Link())
+
+		reader := testutil.Must(receipt.NewReceiptReaderFromTypes[usagecap.GetOk, fdm.FailureModel](usagecap.GetOkType(), fdm.FailureType(), types.Converters...))(t)
+		rcpt := testutil.Must(reader.Read(rcptlnk, resp.Blocks()))(t)
+		return testutil.Must(result.Unwrap(result.MapError(rcpt.Out(), failure.FromFailureModel)))(t)
+	}
+
+	space := testutil.RandomDID(t)
+
+	t.Run("allocates within space quota", func(t *testing.T) {
+		require.Nil(t, allocate(t, space, 80))
+
+		u := getUsage(t, &space)
+		require.Equal(t, uint64(80), u.Allocated)
+		require.Equal(t, uint64(0), u.Received)
+		require.NotNil(t, u.Limit)
+		require.Equal(t, uint64(100), *u.Limit)
+	})
+
+	t.Run("refuses allocation over space quota", func(t *testing.T) {
+		f := allocate(t, space, 21)
+		require.NotNil(t, f)
+		require.Equal(t, "SpaceQuotaExceeded", *f.Name)
+
+		u := getUsage(t, &space)
+		require.Equal(t, uint64(80), u.Allocated)
+	})
+
+	t.Run("refuses allocation over node quota", func(t *testing.T) {
+		f := allocate(t, testutil.RandomDID(t), 71)
+		require.NotNil(t, f)
+		require.Equal(t, "NodeQuotaExceeded", *f.Name)
+
+		u := getUsage(t, nil)
+		require.Equal(t, uint64(80), u.Allocated)
+		require.NotNil(t, u.Limit)
+		require.Equal(t, uint64(150), *u.Limit)
+	})
+
+	t.Run("refuses allocation over capacity", func(t *testing.T) {
+		f := allocate(t, testutil.RandomDID(t), 50)
+		require.NotNil(t, f)
+		require.Equal(t, "InsufficientCapacity", *f.Name)
+
+		// usage recorded for the refused allocation is released
+		u := getUsage(t, nil)
+		require.Equal(t, uint64(80), u.Allocated)
+
+		c, err := svc.Blobs().Capacity().Capacity(ctx)
+		require.NoError(t, err)
+		require.Equal(t, uint64(80), c.Reserved)
+		require.Equal(t, uint64(40), c.Available)
+	})
 }
 
 // TestReplicaAllocateTransfer validates the full replica allocation flow in the UCAN server,
@@ -0,0 +1,43 @@
+package sweeper
+
+import (
+	"errors"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+type options struct {
+	interval   time.Duration
+	reportOnly bool
+}
+
+type Option func(*options) error
+
+// WithInterval configures how often expired allocations are swept.
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) error {
+		if interval <= 0 {
+			return errors.New("sweep interval must be greater than zero")
+		}
+		o.interval = interval
+		return nil
+	}
+}
+
+// WithReportOnly causes the sweeper to log the expired allocations it finds
+// without removing them.
+func WithReportOnly(reportOnly bool) Option {
+	return func(o *options) error {
+		o.reportOnly = reportOnly
+		return nil
+	}
+}
+
+// WithLogLevel changes the log level for the sweeper subsystem.
+func WithLogLevel(level string) Option {
+	return func(o *options) error {
+		logging.SetLogLevel("sweeper", level)
+		return nil
+	}
+}
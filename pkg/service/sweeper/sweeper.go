@@ -0,0 +1,211 @@
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/pdp"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+)
+
+var log = logging.Logger("sweeper")
+
+// DefaultInterval is the default time between sweeps.
+const DefaultInterval = 10 * time.Minute
+
+// Report summarizes the expired allocations found by a sweep.
+type Report struct {
+	// Expired is the number of expired allocations for blobs that were never
+	// received.
+	Expired int
+	// Bytes is the number of bytes those allocations reserved.
+	Bytes uint64
+	// Removed is the number of expired allocations that were deleted. It is
+	// zero when the sweeper only reports.
+	Removed int
+}
+
+type Sweeper interface {
+	// Sweep finds allocations that expired before the blob they were made for
+	// was received, and removes them unless configured to report only.
+	Sweep(context.Context) (Report, error)
+}
+
+// Service periodically sweeps allocations that expired without being
+// fulfilled. Unlike the garbage collector, it never removes blobs or location
+// claims, so it can run regardless of the claim store in use.
+type Service struct {
+	pdp        pdp.PDP
+	blobs      blobs.Blobs
+	interval   time.Duration
+	reportOnly bool
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+var _ Sweeper = (*Service)(nil)
+
+// New creates a sweeper for the allocations held by this node. When PDP is
+// not nil, it is used to determine whether a blob was received instead of the
+// blobstore.
+func New(p pdp.PDP, b blobs.Blobs, opts ...Option) (*Service, error) {
+	o := &options{interval: DefaultInterval}
+	for _, opt := range opts {
+		err := opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Service{
+		pdp:        p,
+		blobs:      b,
+		interval:   o.interval,
+		reportOnly: o.reportOnly,
+	}, nil
+}
+
+func (s *Service) Sweep(ctx context.Context) (Report, error) {
+	var report Report
+	now := uint64(time.Now().Unix())
+	expired, err := s.blobs.Allocations().ListExpired(ctx, now)
+	if err != nil {
+		return report, fmt.Errorf("listing expired allocations: %w", err)
+	}
+
+	var errs error
+	received := map[string]bool{}
+	for _, a := range expired {
+		k := digestutil.Format(a.Blob.Digest)
+		log := log.With("blob", k, "space", a.Space, "cause", a.Cause)
+
+		ok, seen := received[k]
+		if !seen {
+			ok, err = s.received(ctx, a.Blob)
+			if err != nil {
+				log.Errorw("checking blob was received", "error", err)
+				errs = errors.Join(errs, fmt.Errorf("checking blob %s was received: %w", k, err))
+				continue
+			}
+			received[k] = ok
+		}
+		if ok {
+			continue
+		}
+
+		report.Expired++
+		report.Bytes += a.Blob.Size
+		log.Infow("expired allocation", "size", a.Blob.Size, "expires", a.Expires)
+		if s.reportOnly {
+			continue
+		}
+
+		err := s.remove(ctx, a)
+		if err != nil {
+			log.Errorw("removing expired allocation", "error", err)
+			errs = errors.Join(errs, fmt.Errorf("removing allocation %s for blob %s: %w", a.Cause, k, err))
+			continue
+		}
+		report.Removed++
+	}
+
+	log.Infow("swept expired allocations", "expired", report.Expired, "bytes", report.Bytes, "removed", report.Removed)
+	return report, errs
+}
+
+func (s *Service) received(ctx context.Context, blob allocation.Blob) (bool, error) {
+	var err error
+	if s.pdp != nil {
+		_, err = s.pdp.PieceFinder().FindPiece(ctx, blob.Digest, blob.Size)
+	} else {
+		var obj blobstore.Object
+		obj, err = s.blobs.Store().Get(ctx, blob.Digest)
+		if err == nil {
+			if c, ok := obj.Body().(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// remove deletes an allocation, releasing the usage of the space and the
+// capacity reserved for the blob once nothing else refers to them.
+func (s *Service) remove(ctx context.Context, a allocation.Allocation) error {
+	err := s.blobs.Allocations().Delete(ctx, a.Blob.Digest, a.Cause)
+	if err != nil {
+		return fmt.Errorf("deleting allocation: %w", err)
+	}
+
+	remaining, err := s.blobs.Allocations().List(ctx, a.Blob.Digest)
+	if err != nil {
+		return fmt.Errorf("listing allocations: %w", err)
+	}
+	if !hasSpace(remaining, a) {
+		err = s.blobs.Usage().Release(ctx, a.Space, a.Blob.Digest)
+		if err != nil {
+			return fmt.Errorf("releasing usage: %w", err)
+		}
+	}
+	if len(remaining) == 0 {
+		s.blobs.Capacity().Cancel(ctx, a.Blob.Digest)
+	}
+	return nil
+}
+
+func hasSpace(allocs []allocation.Allocation, a allocation.Allocation) bool {
+	for _, r := range allocs {
+		if r.Space == a.Space {
+			return true
+		}
+	}
+	return false
+}
+
+// Start begins periodic sweeping of expired allocations.
+func (s *Service) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := s.Sweep(ctx)
+				if err != nil {
+					log.Errorf("sweeping expired allocations failed: %s", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends periodic sweeping, waiting for any in progress sweep to complete.
+func (s *Service) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,122 @@
+package sweeper
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/service/blobs"
+	"github.com/storacha/piri/pkg/service/capacity"
+	"github.com/storacha/piri/pkg/store/allocationstore"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+	"github.com/storacha/piri/pkg/store/blobstore"
+	"github.com/storacha/piri/pkg/store/usagestore"
+)
+
+func TestSweeper(t *testing.T) {
+	t.Run("removes expired allocation for blob never received", func(t *testing.T) {
+		s, blobService := newSweeper(t)
+		space := testutil.RandomDID(t)
+		alloc := putAllocation(t, blobService, space, testutil.RandomMultihash(t), 32, -time.Minute)
+
+		report, err := s.Sweep(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Report{Expired: 1, Bytes: 32, Removed: 1}, report)
+
+		allocs, err := blobService.Allocations().List(context.Background(), alloc.Blob.Digest)
+		require.NoError(t, err)
+		require.Empty(t, allocs)
+
+		u, err := blobService.Usage().Get(context.Background(), space)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), u.Allocated)
+	})
+
+	t.Run("retains expired allocation for received blob", func(t *testing.T) {
+		s, blobService := newSweeper(t)
+		data := testutil.RandomBytes(t, 32)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		err := blobService.Store().Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+		require.NoError(t, err)
+		putAllocation(t, blobService, testutil.RandomDID(t), digest, uint64(len(data)), -time.Minute)
+
+		report, err := s.Sweep(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Report{}, report)
+
+		allocs, err := blobService.Allocations().List(context.Background(), digest)
+		require.NoError(t, err)
+		require.Len(t, allocs, 1)
+	})
+
+	t.Run("retains unexpired allocation", func(t *testing.T) {
+		s, blobService := newSweeper(t)
+		space := testutil.RandomDID(t)
+		digest := testutil.RandomMultihash(t)
+		putAllocation(t, blobService, space, digest, 32, -time.Minute)
+		putAllocation(t, blobService, space, digest, 32, time.Hour)
+
+		report, err := s.Sweep(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Report{Expired: 1, Bytes: 32, Removed: 1}, report)
+
+		allocs, err := blobService.Allocations().List(context.Background(), digest)
+		require.NoError(t, err)
+		require.Len(t, allocs, 1)
+
+		// the space still has an allocation for the blob
+		u, err := blobService.Usage().Get(context.Background(), space)
+		require.NoError(t, err)
+		require.Equal(t, uint64(32), u.Allocated)
+	})
+
+	t.Run("only reports when configured to", func(t *testing.T) {
+		s, blobService := newSweeper(t, WithReportOnly(true))
+		alloc := putAllocation(t, blobService, testutil.RandomDID(t), testutil.RandomMultihash(t), 32, -time.Minute)
+
+		report, err := s.Sweep(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Report{Expired: 1, Bytes: 32}, report)
+
+		allocs, err := blobService.Allocations().List(context.Background(), alloc.Blob.Digest)
+		require.NoError(t, err)
+		require.Len(t, allocs, 1)
+	})
+}
+
+func newSweeper(t *testing.T, opts ...Option) (*Service, blobs.Blobs) {
+	allocs, err := allocationstore.NewDsAllocationStore(datastore.NewMapDatastore())
+	require.NoError(t, err)
+	blobStore := blobstore.NewMapBlobstore()
+	blobService, err := blobs.New(
+		blobs.WithBlobstore(blobStore),
+		blobs.WithAllocationStore(allocs),
+		blobs.WithUsageStore(testutil.Must(usagestore.NewDsUsageStore(datastore.NewMapDatastore()))(t)),
+		blobs.WithCapacity(testutil.Must(capacity.New(allocs, blobStore))(t)),
+	)
+	require.NoError(t, err)
+	s, err := New(nil, blobService, opts...)
+	require.NoError(t, err)
+	return s, blobService
+}
+
+func putAllocation(t *testing.T, blobService blobs.Blobs, space did.DID, digest multihash.Multihash, size uint64, expiresIn time.Duration) allocation.Allocation {
+	alloc := allocation.Allocation{
+		Space:   space,
+		Blob:    allocation.Blob{Digest: digest, Size: size},
+		Expires: uint64(time.Now().Add(expiresIn).Unix()),
+		Cause:   testutil.RandomCID(t),
+	}
+	err := blobService.Allocations().Put(context.Background(), alloc)
+	require.NoError(t, err)
+	err = blobService.Usage().Allocate(context.Background(), space, digest, size)
+	require.NoError(t, err)
+	return alloc
+}
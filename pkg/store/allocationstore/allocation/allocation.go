@@ -5,6 +5,7 @@ import (
 	// for go:embed
 	_ "embed"
 	"fmt"
+	"math"
 
 	ipldprime "github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/codec"
@@ -43,6 +44,11 @@ type Blob struct {
 	Size uint64
 }
 
+// Retained is the expiry given to an allocation once its blob is known to have
+// been accepted, so that it is kept until the blob is removed and no longer
+// listed as expired. It is the largest value every allocation store can hold.
+const Retained uint64 = math.MaxInt64
+
 type Allocation struct {
 	// Space is the DID of the space this data was allocated for.
 	Space did.DID
@@ -2,18 +2,41 @@ package allocationstore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"sync"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
 	"github.com/ipld/go-ipld-prime/codec/dagcbor"
 	multihash "github.com/multiformats/go-multihash"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/ucan"
 	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
 )
 
+// Allocations are keyed by /<digest>/<cause>. Secondary indexes refer back to
+// the allocation keys:
+//
+//	/index/expiry/<expires>/<digest>/<cause>
+//	/index/space/<space>/<digest>/<cause>
+//
+// Expiry times are zero padded so that keys sort in order of expiry.
+var (
+	indexPrefix       = datastore.NewKey("index")
+	expiryIndexPrefix = indexPrefix.ChildString("expiry")
+	spaceIndexPrefix  = indexPrefix.ChildString("space")
+	// indexedKey marks a datastore whose allocations have all been indexed.
+	indexedKey = indexPrefix.ChildString("indexed")
+)
+
 type DsAllocationStore struct {
 	data datastore.Datastore
+	// mu serializes writes so allocations and their index entries stay in sync.
+	mu sync.Mutex
 }
 
 func (d *DsAllocationStore) List(ctx context.Context, digest multihash.Multihash) ([]allocation.Allocation, error) {
@@ -22,11 +45,12 @@ func (d *DsAllocationStore) List(ctx context.Context, digest multihash.Multihash
 	if err != nil {
 		return nil, fmt.Errorf("querying datastore: %w", err)
 	}
+	defer results.Close()
 
 	var allocs []allocation.Allocation
 	for entry := range results.Next() {
 		if entry.Error != nil {
-			return nil, fmt.Errorf("iterating query results: %w", err)
+			return nil, fmt.Errorf("iterating query results: %w", entry.Error)
 		}
 		a, err := allocation.Decode(entry.Value, dagcbor.Decode)
 		if err != nil {
@@ -38,7 +62,21 @@ func (d *DsAllocationStore) List(ctx context.Context, digest multihash.Multihash
 }
 
 func (d *DsAllocationStore) Put(ctx context.Context, alloc allocation.Allocation) error {
-	k := encodeKey(alloc)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := encodeKey(alloc.Blob.Digest, alloc.Cause)
+	// drop index entries for the allocation being replaced
+	prev, err := d.get(ctx, k)
+	if err == nil {
+		err = d.unindex(ctx, k, prev)
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, datastore.ErrNotFound) {
+		return err
+	}
+
 	b, err := allocation.Encode(alloc, dagcbor.Encode)
 	if err != nil {
 		return fmt.Errorf("encoding data: %w", err)
@@ -49,17 +87,216 @@ func (d *DsAllocationStore) Put(ctx context.Context, alloc allocation.Allocation
 		return fmt.Errorf("writing to datastore: %w", err)
 	}
 
+	return d.index(ctx, k, alloc)
+}
+
+func (d *DsAllocationStore) ListExpired(ctx context.Context, before uint64) ([]allocation.Allocation, error) {
+	return d.listByExpiry(ctx, 0, before)
+}
+
+func (d *DsAllocationStore) ListUnexpired(ctx context.Context, after uint64) ([]allocation.Allocation, error) {
+	return d.listByExpiry(ctx, after, math.MaxUint64)
+}
+
+// listByExpiry retrieves allocations that expire at or after from and before
+// until, in order of expiry, using the expiry index.
+func (d *DsAllocationStore) listByExpiry(ctx context.Context, from, until uint64) ([]allocation.Allocation, error) {
+	q := query.Query{
+		Prefix:   expiryIndexPrefix.String() + "/",
+		KeysOnly: true,
+		Orders:   []query.Order{query.OrderByKey{}},
+	}
+	if from > 0 {
+		q.Filters = []query.Filter{query.FilterKeyCompare{
+			Op:  query.GreaterThanOrEqual,
+			Key: expiryIndexPrefix.ChildString(fmt.Sprintf("%020d", from)).String(),
+		}}
+	}
+	results, err := d.data.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("querying datastore: %w", err)
+	}
+	defer results.Close()
+
+	var allocs []allocation.Allocation
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, fmt.Errorf("iterating query results: %w", entry.Error)
+		}
+		// /index/expiry/<expires>/<digest>/<cause>
+		ns := datastore.RawKey(entry.Key).Namespaces()
+		if len(ns) < 4 {
+			continue
+		}
+		expires, err := strconv.ParseUint(ns[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing expiry index key %s: %w", entry.Key, err)
+		}
+		if expires < from {
+			continue
+		}
+		if expires >= until {
+			break
+		}
+		a, err := d.get(ctx, datastore.KeyWithNamespaces(ns[3:]))
+		if err != nil {
+			// the allocation was deleted since the query was made
+			if errors.Is(err, datastore.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		allocs = append(allocs, a)
+	}
+	return allocs, nil
+}
+
+func (d *DsAllocationStore) ListBySpace(ctx context.Context, space did.DID) ([]allocation.Allocation, error) {
+	pfx := spaceIndexPrefix.ChildString(space.String()).String() + "/"
+	results, err := d.data.Query(ctx, query.Query{Prefix: pfx, KeysOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("querying datastore: %w", err)
+	}
+	defer results.Close()
+
+	var allocs []allocation.Allocation
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, fmt.Errorf("iterating query results: %w", entry.Error)
+		}
+		// /index/space/<space>/<digest>/<cause>
+		ns := datastore.RawKey(entry.Key).Namespaces()
+		if len(ns) < 4 {
+			continue
+		}
+		a, err := d.get(ctx, datastore.KeyWithNamespaces(ns[3:]))
+		if err != nil {
+			if errors.Is(err, datastore.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		allocs = append(allocs, a)
+	}
+	return allocs, nil
+}
+
+func (d *DsAllocationStore) Delete(ctx context.Context, digest multihash.Multihash, cause ucan.Link) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := encodeKey(digest, cause)
+	a, err := d.get(ctx, k)
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	err = d.data.Delete(ctx, k)
+	if err != nil {
+		return fmt.Errorf("deleting from datastore: %w", err)
+	}
+	return d.unindex(ctx, k, a)
+}
+
+func (d *DsAllocationStore) get(ctx context.Context, k datastore.Key) (allocation.Allocation, error) {
+	b, err := d.data.Get(ctx, k)
+	if err != nil {
+		return allocation.Allocation{}, fmt.Errorf("reading from datastore: %w", err)
+	}
+	a, err := allocation.Decode(b, dagcbor.Decode)
+	if err != nil {
+		return allocation.Allocation{}, fmt.Errorf("decoding data: %w", err)
+	}
+	return a, nil
+}
+
+func (d *DsAllocationStore) index(ctx context.Context, k datastore.Key, alloc allocation.Allocation) error {
+	for _, ik := range indexKeys(k, alloc) {
+		err := d.data.Put(ctx, ik, []byte{})
+		if err != nil {
+			return fmt.Errorf("writing index to datastore: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *DsAllocationStore) unindex(ctx context.Context, k datastore.Key, alloc allocation.Allocation) error {
+	for _, ik := range indexKeys(k, alloc) {
+		err := d.data.Delete(ctx, ik)
+		if err != nil {
+			return fmt.Errorf("deleting index from datastore: %w", err)
+		}
+	}
+	return nil
+}
+
+// reindex adds index entries for allocations written before the store
+// maintained indexes.
+func (d *DsAllocationStore) reindex(ctx context.Context) error {
+	ok, err := d.data.Has(ctx, indexedKey)
+	if err != nil {
+		return fmt.Errorf("reading from datastore: %w", err)
+	}
+	if ok {
+		return nil
+	}
+
+	results, err := d.data.Query(ctx, query.Query{})
+	if err != nil {
+		return fmt.Errorf("querying datastore: %w", err)
+	}
+	defer results.Close()
+
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return fmt.Errorf("iterating query results: %w", entry.Error)
+		}
+		k := datastore.RawKey(entry.Key)
+		if indexPrefix.IsAncestorOf(k) {
+			continue
+		}
+		a, err := allocation.Decode(entry.Value, dagcbor.Decode)
+		if err != nil {
+			return fmt.Errorf("decoding data: %w", err)
+		}
+		err = d.index(ctx, k, a)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.data.Put(ctx, indexedKey, []byte{})
+	if err != nil {
+		return fmt.Errorf("writing to datastore: %w", err)
+	}
 	return nil
 }
 
 var _ AllocationStore = (*DsAllocationStore)(nil)
 
 // NewDsAllocationStore creates an [AllocationStore] backed by an IPFS datastore.
+// Allocations already in the datastore that have not been indexed by expiry
+// and space are indexed before the store is returned.
 func NewDsAllocationStore(ds datastore.Datastore) (*DsAllocationStore, error) {
-	return &DsAllocationStore{ds}, nil
+	d := &DsAllocationStore{data: ds}
+	err := d.reindex(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("indexing allocations: %w", err)
+	}
+	return d, nil
 }
 
-func encodeKey(a allocation.Allocation) datastore.Key {
-	str := digestutil.Format(a.Blob.Digest)
-	return datastore.NewKey(fmt.Sprintf("%s/%s", str, a.Cause.String()))
+func encodeKey(digest multihash.Multihash, cause ucan.Link) datastore.Key {
+	str := digestutil.Format(digest)
+	return datastore.NewKey(fmt.Sprintf("%s/%s", str, cause.String()))
+}
+
+func indexKeys(k datastore.Key, alloc allocation.Allocation) []datastore.Key {
+	return []datastore.Key{
+		expiryIndexPrefix.ChildString(fmt.Sprintf("%020d", alloc.Expires)).Child(k),
+		spaceIndexPrefix.ChildString(alloc.Space.String()).Child(k),
+	}
 }
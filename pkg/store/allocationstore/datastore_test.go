@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/storacha/go-ucanto/did"
 	"github.com/storacha/piri/pkg/internal/testutil"
 	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
 	"github.com/stretchr/testify/require"
@@ -72,4 +74,163 @@ func TestDsAllocationStore(t *testing.T) {
 			require.Equal(t, []allocation.Allocation{alloc1, alloc0}, allocs)
 		}
 	})
+	t.Run("delete", func(t *testing.T) {
+		store, err := NewDsAllocationStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		alloc := allocation.Allocation{
+			Space: testutil.RandomDID(t),
+			Blob: allocation.Blob{
+				Digest: testutil.RandomMultihash(t),
+				Size:   uint64(1 + rand.IntN(1000)),
+			},
+			Expires: uint64(time.Now().Unix()),
+			Cause:   testutil.RandomCID(t),
+		}
+
+		err = store.Put(context.Background(), alloc)
+		require.NoError(t, err)
+
+		err = store.Delete(context.Background(), alloc.Blob.Digest, alloc.Cause)
+		require.NoError(t, err)
+
+		allocs, err := store.List(context.Background(), alloc.Blob.Digest)
+		require.NoError(t, err)
+		require.Empty(t, allocs)
+	})
+
+	t.Run("list expired", func(t *testing.T) {
+		store, err := NewDsAllocationStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		now := uint64(time.Now().Unix())
+		expired := allocation.Allocation{
+			Space: testutil.RandomDID(t),
+			Blob: allocation.Blob{
+				Digest: testutil.RandomMultihash(t),
+				Size:   uint64(1 + rand.IntN(1000)),
+			},
+			Expires: now - 10,
+			Cause:   testutil.RandomCID(t),
+		}
+		unexpired := allocation.Allocation{
+			Space: testutil.RandomDID(t),
+			Blob: allocation.Blob{
+				Digest: testutil.RandomMultihash(t),
+				Size:   uint64(1 + rand.IntN(1000)),
+			},
+			Expires: now + 10,
+			Cause:   testutil.RandomCID(t),
+		}
+
+		err = store.Put(context.Background(), expired)
+		require.NoError(t, err)
+		err = store.Put(context.Background(), unexpired)
+		require.NoError(t, err)
+
+		allocs, err := store.ListExpired(context.Background(), now)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{expired}, allocs)
+
+		allocs, err = store.ListUnexpired(context.Background(), now)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{unexpired}, allocs)
+
+		allocs, err = store.ListUnexpired(context.Background(), now-10)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{expired, unexpired}, allocs)
+	})
+
+	t.Run("list expired in order of expiry", func(t *testing.T) {
+		store, err := NewDsAllocationStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		now := uint64(time.Now().Unix())
+		var allocs []allocation.Allocation
+		for _, expires := range []uint64{now - 5, now - 100, now - 20} {
+			alloc := randomAllocation(t, testutil.RandomDID(t), expires)
+			err = store.Put(context.Background(), alloc)
+			require.NoError(t, err)
+			allocs = append(allocs, alloc)
+		}
+
+		expired, err := store.ListExpired(context.Background(), now)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{allocs[1], allocs[2], allocs[0]}, expired)
+	})
+
+	t.Run("replacing an allocation updates its expiry", func(t *testing.T) {
+		store, err := NewDsAllocationStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		now := uint64(time.Now().Unix())
+		alloc := randomAllocation(t, testutil.RandomDID(t), now-10)
+		err = store.Put(context.Background(), alloc)
+		require.NoError(t, err)
+
+		alloc.Expires = now + 10
+		err = store.Put(context.Background(), alloc)
+		require.NoError(t, err)
+
+		expired, err := store.ListExpired(context.Background(), now)
+		require.NoError(t, err)
+		require.Empty(t, expired)
+	})
+
+	t.Run("list by space", func(t *testing.T) {
+		store, err := NewDsAllocationStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		space := testutil.RandomDID(t)
+		alloc0 := randomAllocation(t, space, uint64(time.Now().Unix()))
+		alloc1 := randomAllocation(t, space, uint64(time.Now().Unix()))
+		other := randomAllocation(t, testutil.RandomDID(t), uint64(time.Now().Unix()))
+		for _, a := range []allocation.Allocation{alloc0, alloc1, other} {
+			err = store.Put(context.Background(), a)
+			require.NoError(t, err)
+		}
+
+		allocs, err := store.ListBySpace(context.Background(), space)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []allocation.Allocation{alloc0, alloc1}, allocs)
+
+		err = store.Delete(context.Background(), alloc0.Blob.Digest, alloc0.Cause)
+		require.NoError(t, err)
+
+		allocs, err = store.ListBySpace(context.Background(), space)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{alloc1}, allocs)
+	})
+
+	t.Run("indexes existing allocations", func(t *testing.T) {
+		ds := datastore.NewMapDatastore()
+		alloc := randomAllocation(t, testutil.RandomDID(t), uint64(time.Now().Unix())-10)
+		b, err := allocation.Encode(alloc, dagcbor.Encode)
+		require.NoError(t, err)
+		err = ds.Put(context.Background(), encodeKey(alloc.Blob.Digest, alloc.Cause), b)
+		require.NoError(t, err)
+
+		store, err := NewDsAllocationStore(ds)
+		require.NoError(t, err)
+
+		allocs, err := store.ListExpired(context.Background(), uint64(time.Now().Unix()))
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{alloc}, allocs)
+
+		allocs, err = store.ListBySpace(context.Background(), alloc.Space)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{alloc}, allocs)
+	})
+}
+
+func randomAllocation(t *testing.T, space did.DID, expires uint64) allocation.Allocation {
+	return allocation.Allocation{
+		Space: space,
+		Blob: allocation.Blob{
+			Digest: testutil.RandomMultihash(t),
+			Size:   uint64(1 + rand.IntN(1000)),
+		},
+		Expires: expires,
+		Cause:   testutil.RandomCID(t),
+	}
 }
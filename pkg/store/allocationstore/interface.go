@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/ucan"
 	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
 )
 
@@ -14,4 +16,16 @@ type AllocationStore interface {
 	List(context.Context, multihash.Multihash) ([]allocation.Allocation, error)
 	// Put adds or replaces allocation data in the store.
 	Put(context.Context, allocation.Allocation) error
+	// ListExpired retrieves allocations that expired before the passed time (in
+	// seconds since unix epoch), in order of expiry where the store supports it.
+	ListExpired(context.Context, uint64) ([]allocation.Allocation, error)
+	// ListUnexpired retrieves allocations that expire at or after the passed
+	// time (in seconds since unix epoch).
+	ListUnexpired(context.Context, uint64) ([]allocation.Allocation, error)
+	// ListBySpace retrieves allocations made by the passed space.
+	ListBySpace(context.Context, did.DID) ([]allocation.Allocation, error)
+	// Delete removes the allocation for the digest of the data allocated, that
+	// was requested by the passed UCAN. It is not an error to delete an
+	// allocation that does not exist.
+	Delete(context.Context, multihash.Multihash, ucan.Link) error
 }
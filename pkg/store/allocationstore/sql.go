@@ -0,0 +1,148 @@
+package allocationstore
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	multihash "github.com/multiformats/go-multihash"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/ucan"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+)
+
+// allocationRecord is a row in the allocations table.
+type allocationRecord struct {
+	Digest    string    `gorm:"primaryKey;column:digest"`
+	Cause     string    `gorm:"primaryKey;column:cause"`
+	Space     string    `gorm:"not null;index;column:space"`
+	Size      uint64    `gorm:"not null;column:size"`
+	Expires   uint64    `gorm:"not null;index;column:expires;comment:Seconds since unix epoch"`
+	CreatedAt time.Time `gorm:"not null;index;column:created_at"`
+}
+
+func (allocationRecord) TableName() string {
+	return "allocations"
+}
+
+// SQLAllocationStore is an [AllocationStore] backed by a SQL database, such
+// as SQLite or PostgreSQL. Allocations are stored as rows that can be queried
+// by digest, space and expiry.
+type SQLAllocationStore struct {
+	db *gorm.DB
+}
+
+func (s *SQLAllocationStore) List(ctx context.Context, digest multihash.Multihash) ([]allocation.Allocation, error) {
+	var records []allocationRecord
+	err := s.db.WithContext(ctx).Where("digest = ?", digestutil.Format(digest)).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("querying allocations: %w", err)
+	}
+	return toAllocations(records)
+}
+
+func (s *SQLAllocationStore) Put(ctx context.Context, alloc allocation.Allocation) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "digest"}, {Name: "cause"}},
+		DoUpdates: clause.AssignmentColumns([]string{"space", "size", "expires"}),
+	}).Create(&allocationRecord{
+		Digest:  digestutil.Format(alloc.Blob.Digest),
+		Cause:   alloc.Cause.String(),
+		Space:   alloc.Space.String(),
+		Size:    alloc.Blob.Size,
+		Expires: alloc.Expires,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("writing allocation: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLAllocationStore) ListExpired(ctx context.Context, before uint64) ([]allocation.Allocation, error) {
+	// SQL integers are signed
+	if before > math.MaxInt64 {
+		before = math.MaxInt64
+	}
+	var records []allocationRecord
+	err := s.db.WithContext(ctx).Where("expires < ?", before).Order("expires").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("querying allocations: %w", err)
+	}
+	return toAllocations(records)
+}
+
+func (s *SQLAllocationStore) ListUnexpired(ctx context.Context, after uint64) ([]allocation.Allocation, error) {
+	// SQL integers are signed
+	if after > math.MaxInt64 {
+		after = math.MaxInt64
+	}
+	var records []allocationRecord
+	err := s.db.WithContext(ctx).Where("expires >= ?", after).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("querying allocations: %w", err)
+	}
+	return toAllocations(records)
+}
+
+func (s *SQLAllocationStore) ListBySpace(ctx context.Context, space did.DID) ([]allocation.Allocation, error) {
+	var records []allocationRecord
+	err := s.db.WithContext(ctx).Where("space = ?", space.String()).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("querying allocations: %w", err)
+	}
+	return toAllocations(records)
+}
+
+func (s *SQLAllocationStore) Delete(ctx context.Context, digest multihash.Multihash, cause ucan.Link) error {
+	err := s.db.WithContext(ctx).
+		Where("digest = ? AND cause = ?", digestutil.Format(digest), cause.String()).
+		Delete(&allocationRecord{}).Error
+	if err != nil {
+		return fmt.Errorf("deleting allocation: %w", err)
+	}
+	return nil
+}
+
+var _ AllocationStore = (*SQLAllocationStore)(nil)
+
+// NewSQLAllocationStore creates an [AllocationStore] backed by a SQL database,
+// creating or migrating the allocations table as necessary.
+func NewSQLAllocationStore(db *gorm.DB) (*SQLAllocationStore, error) {
+	err := db.AutoMigrate(&allocationRecord{})
+	if err != nil {
+		return nil, fmt.Errorf("migrating allocations table: %w", err)
+	}
+	return &SQLAllocationStore{db}, nil
+}
+
+func toAllocations(records []allocationRecord) ([]allocation.Allocation, error) {
+	allocs := make([]allocation.Allocation, 0, len(records))
+	for _, r := range records {
+		digest, err := digestutil.Parse(r.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("parsing digest: %w", err)
+		}
+		space, err := did.Parse(r.Space)
+		if err != nil {
+			return nil, fmt.Errorf("parsing space DID: %w", err)
+		}
+		cause, err := cid.Parse(r.Cause)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cause CID: %w", err)
+		}
+		allocs = append(allocs, allocation.Allocation{
+			Space:   space,
+			Blob:    allocation.Blob{Digest: digest, Size: r.Size},
+			Expires: r.Expires,
+			Cause:   cidlink.Link{Cid: cause},
+		})
+	}
+	return allocs, nil
+}
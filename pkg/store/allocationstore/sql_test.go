@@ -0,0 +1,102 @@
+package allocationstore
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/database/gormdb"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store/allocationstore/allocation"
+)
+
+func TestSQLAllocationStore(t *testing.T) {
+	newStore := func(t *testing.T) *SQLAllocationStore {
+		db, err := gormdb.New(filepath.Join(t.TempDir(), "allocations.db"))
+		require.NoError(t, err)
+		store, err := NewSQLAllocationStore(db)
+		require.NoError(t, err)
+		return store
+	}
+
+	t.Run("roundtrip", func(t *testing.T) {
+		store := newStore(t)
+		alloc := randomAllocation(t, testutil.RandomDID(t), uint64(time.Now().Unix()))
+
+		err := store.Put(context.Background(), alloc)
+		require.NoError(t, err)
+
+		allocs, err := store.List(context.Background(), alloc.Blob.Digest)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{alloc}, allocs)
+	})
+
+	t.Run("put replaces", func(t *testing.T) {
+		store := newStore(t)
+		alloc := randomAllocation(t, testutil.RandomDID(t), uint64(time.Now().Unix()))
+
+		err := store.Put(context.Background(), alloc)
+		require.NoError(t, err)
+		alloc.Expires += 10
+		err = store.Put(context.Background(), alloc)
+		require.NoError(t, err)
+
+		allocs, err := store.List(context.Background(), alloc.Blob.Digest)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{alloc}, allocs)
+	})
+
+	t.Run("list expired in order of expiry", func(t *testing.T) {
+		store := newStore(t)
+		now := uint64(time.Now().Unix())
+		var allocs []allocation.Allocation
+		for _, expires := range []uint64{now - 5, now + 10, now - 100} {
+			alloc := randomAllocation(t, testutil.RandomDID(t), expires)
+			err := store.Put(context.Background(), alloc)
+			require.NoError(t, err)
+			allocs = append(allocs, alloc)
+		}
+
+		expired, err := store.ListExpired(context.Background(), now)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{allocs[2], allocs[0]}, expired)
+
+		all, err := store.ListExpired(context.Background(), math.MaxUint64)
+		require.NoError(t, err)
+		require.Len(t, all, 3)
+
+		unexpired, err := store.ListUnexpired(context.Background(), now)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{allocs[1]}, unexpired)
+	})
+
+	t.Run("list by space and delete", func(t *testing.T) {
+		store := newStore(t)
+		space := testutil.RandomDID(t)
+		alloc0 := randomAllocation(t, space, uint64(time.Now().Unix()))
+		alloc1 := randomAllocation(t, space, uint64(time.Now().Unix()))
+		other := randomAllocation(t, testutil.RandomDID(t), uint64(time.Now().Unix()))
+		for _, a := range []allocation.Allocation{alloc0, alloc1, other} {
+			err := store.Put(context.Background(), a)
+			require.NoError(t, err)
+		}
+
+		allocs, err := store.ListBySpace(context.Background(), space)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []allocation.Allocation{alloc0, alloc1}, allocs)
+
+		err = store.Delete(context.Background(), alloc0.Blob.Digest, alloc0.Cause)
+		require.NoError(t, err)
+		// deleting again is not an error
+		err = store.Delete(context.Background(), alloc0.Blob.Digest, alloc0.Cause)
+		require.NoError(t, err)
+
+		allocs, err = store.ListBySpace(context.Background(), space)
+		require.NoError(t, err)
+		require.Equal(t, []allocation.Allocation{alloc1}, allocs)
+	})
+}
@@ -3,13 +3,16 @@ package blobstore
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/ipfs/go-datastore"
 	"github.com/multiformats/go-multihash"
 	"github.com/storacha/piri/pkg/internal/digestutil"
 	"github.com/storacha/piri/pkg/internal/testutil"
@@ -42,6 +45,25 @@ func TestBlobstore(t *testing.T) {
 			require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
 		})
 
+		t.Run("roundtrip non-sha2-256 "+k, func(t *testing.T) {
+			for _, code := range []uint64{multihash.BLAKE3, multihash.SHA2_512} {
+				data := testutil.RandomBytes(t, 10)
+				digest := testutil.Must(multihash.Sum(data, code, -1))(t)
+
+				err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewBuffer(data))
+				require.NoError(t, err)
+
+				obj, err := s.Get(context.Background(), digest)
+				require.NoError(t, err)
+				require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+
+				baddata := testutil.RandomBytes(t, 10)
+				digest = testutil.Must(multihash.Sum(data, code, -1))(t)
+				err = s.Put(context.Background(), digest, uint64(len(baddata)), bytes.NewBuffer(baddata))
+				require.Equal(t, ErrDataInconsistent, err)
+			}
+		})
+
 		t.Run("not found "+k, func(t *testing.T) {
 			data := testutil.RandomBytes(t, 10)
 			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
@@ -61,6 +83,24 @@ func TestBlobstore(t *testing.T) {
 			require.Equal(t, ErrDataInconsistent, err)
 		})
 
+		t.Run("delete "+k, func(t *testing.T) {
+			data := testutil.RandomBytes(t, 10)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+			err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewBuffer(data))
+			require.NoError(t, err)
+
+			err = s.Delete(context.Background(), digest)
+			require.NoError(t, err)
+
+			_, err = s.Get(context.Background(), digest)
+			require.Equal(t, store.ErrNotFound, err)
+
+			// deleting a non-existent blob is not an error
+			err = s.Delete(context.Background(), digest)
+			require.NoError(t, err)
+		})
+
 		t.Run("filesystemer "+k, func(t *testing.T) {
 			data := testutil.RandomBytes(t, 10)
 			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
@@ -79,5 +119,150 @@ func TestBlobstore(t *testing.T) {
 
 			require.Equal(t, data, b)
 		})
+
+		t.Run("stat "+k, func(t *testing.T) {
+			data := testutil.RandomBytes(t, 10)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+			err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewBuffer(data))
+			require.NoError(t, err)
+
+			l, ok := s.(Lister)
+			require.True(t, ok)
+
+			info, err := l.Stat(context.Background(), digest)
+			require.NoError(t, err)
+			require.Equal(t, digest, info.Digest)
+			require.Equal(t, int64(len(data)), info.Size)
+
+			_, err = l.Stat(context.Background(), testutil.RandomMultihash(t))
+			require.Equal(t, store.ErrNotFound, err)
+		})
+
+		t.Run("quarantine "+k, func(t *testing.T) {
+			data := testutil.RandomBytes(t, 10)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+			err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewBuffer(data))
+			require.NoError(t, err)
+
+			q, ok := s.(Quarantiner)
+			require.True(t, ok)
+
+			err = q.Quarantine(context.Background(), digest)
+			require.NoError(t, err)
+
+			_, err = s.Get(context.Background(), digest)
+			require.Equal(t, store.ErrNotFound, err)
+
+			err = ListAll(context.Background(), s.(Lister), func(obj ObjectInfo) error {
+				require.NotEqual(t, digest, obj.Digest)
+				return nil
+			})
+			require.NoError(t, err)
+
+			err = q.Quarantine(context.Background(), digest)
+			require.Equal(t, store.ErrNotFound, err)
+		})
+	}
+}
+
+func TestLister(t *testing.T) {
+	impls := map[string]func(t *testing.T) Blobstore{
+		"MapBlobstore": func(t *testing.T) Blobstore { return NewMapBlobstore() },
+		"FsBlobstore": func(t *testing.T) Blobstore {
+			return testutil.Must(NewFsBlobstore(t.TempDir(), t.TempDir()))(t)
+		},
+		"DsBlobstore": func(t *testing.T) Blobstore { return NewDsBlobstore(datastore.NewMapDatastore()) },
+		"PackBlobstore": func(t *testing.T) Blobstore {
+			return testutil.Must(NewPackBlobstore(t.TempDir(), datastore.NewMapDatastore()))(t)
+		},
+	}
+
+	for k, newStore := range impls {
+		t.Run("paginates "+k, func(t *testing.T) {
+			s := newStore(t)
+			l := s.(Lister)
+
+			var expected []string
+			for range 25 {
+				data := testutil.RandomBytes(t, 10)
+				digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+				err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewBuffer(data))
+				require.NoError(t, err)
+				expected = append(expected, digestutil.Format(digest))
+			}
+			slices.Sort(expected)
+
+			var actual []string
+			pages := 0
+			cursor := ""
+			for {
+				page, err := l.List(context.Background(), WithCursor(cursor), WithLimit(10))
+				require.NoError(t, err)
+				require.LessOrEqual(t, len(page.Objects), 10)
+				pages++
+				for _, obj := range page.Objects {
+					require.Equal(t, int64(10), obj.Size)
+					actual = append(actual, digestutil.Format(obj.Digest))
+				}
+				if page.Cursor == "" {
+					break
+				}
+				cursor = page.Cursor
+			}
+			require.Equal(t, 3, pages)
+			require.Equal(t, expected, actual)
+		})
+
+		t.Run("empty "+k, func(t *testing.T) {
+			page, err := newStore(t).(Lister).List(context.Background())
+			require.NoError(t, err)
+			require.Empty(t, page.Objects)
+			require.Empty(t, page.Cursor)
+		})
+	}
+}
+
+func TestSpaceReporter(t *testing.T) {
+	impls := map[string]func(t *testing.T) SpaceReporter{
+		"FsBlobstore": func(t *testing.T) SpaceReporter {
+			return testutil.Must(NewFsBlobstore(t.TempDir(), t.TempDir()))(t)
+		},
+		"PackBlobstore": func(t *testing.T) SpaceReporter {
+			return testutil.Must(NewPackBlobstore(t.TempDir(), datastore.NewMapDatastore()))(t)
+		},
+		"MultiFsBlobstore": func(t *testing.T) SpaceReporter {
+			return testutil.Must(NewMultiFsBlobstore(t.TempDir(), t.TempDir()))(t)
+		},
+		"EncryptedBlobstore": func(t *testing.T) SpaceReporter {
+			inner := testutil.Must(NewFsBlobstore(t.TempDir(), t.TempDir()))(t)
+			return testutil.Must(NewEncryptedBlobstore(inner, testutil.RandomBytes(t, EncryptionKeySize)))(t)
+		},
+	}
+
+	for k, newStore := range impls {
+		t.Run(k, func(t *testing.T) {
+			s := newStore(t)
+
+			sp, err := s.Space(context.Background())
+			require.NoError(t, err)
+			require.Zero(t, sp.Used)
+			require.NotZero(t, sp.Available)
+
+			data, digest := randomBlob(t)
+			err = s.(Blobstore).Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+			require.NoError(t, err)
+
+			sp, err = s.Space(context.Background())
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, sp.Used, uint64(len(data)))
+		})
 	}
+
+	t.Run("unsupported inner store", func(t *testing.T) {
+		s := testutil.Must(NewEncryptedBlobstore(NewMapBlobstore(), testutil.RandomBytes(t, EncryptionKeySize)))(t)
+		_, err := s.Space(context.Background())
+		require.ErrorIs(t, err, errors.ErrUnsupported)
+	})
 }
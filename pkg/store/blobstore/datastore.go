@@ -3,7 +3,6 @@ package blobstore
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +10,7 @@ import (
 	"net/http"
 
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
 	"github.com/multiformats/go-multihash"
 
 	"github.com/storacha/piri/pkg/internal/digestutil"
@@ -45,41 +45,100 @@ func (d *DsBlobstore) Get(ctx context.Context, digest multihash.Multihash, opts
 	return obj, nil
 }
 
-func (d *DsBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader) error {
-	info, err := multihash.Decode(digest)
+func (d *DsBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
+	vr, err := NewPutReader(body, digest, size, opts...)
 	if err != nil {
-		return fmt.Errorf("decoding digest: %w", err)
-	}
-	if info.Code != multihash.SHA2_256 {
-		return fmt.Errorf("unsupported digest: 0x%x", info.Code)
+		return err
 	}
 
-	b, err := io.ReadAll(body)
+	b, err := io.ReadAll(vr)
 	if err != nil {
+		if isVerificationError(err) {
+			return err
+		}
 		return fmt.Errorf("reading body: %w", err)
 	}
 
-	if len(b) > int(size) {
-		return ErrTooLarge
-	}
-	if len(b) < int(size) {
-		return ErrTooSmall
+	k := digestutil.Format(digest)
+	err = d.data.Put(ctx, datastore.NewKey(k), b)
+	if err != nil {
+		return fmt.Errorf("putting blob: %w", err)
 	}
 
-	hash := sha256.New()
-	hash.Write(b)
+	return nil
+}
 
-	if !bytes.Equal(hash.Sum(nil), info.Digest) {
-		return ErrDataInconsistent
+// Delete implements Blobstore.
+func (d *DsBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	k := digestutil.Format(digest)
+	err := d.data.Delete(ctx, datastore.NewKey(k))
+	if err != nil {
+		return fmt.Errorf("deleting blob: %w", err)
 	}
+	return nil
+}
 
-	k := digestutil.Format(digest)
-	err = d.data.Put(ctx, datastore.NewKey(k), b)
+// List implements Lister. Modification times are not tracked, so the ModTime
+// of listed objects is always the zero time.
+func (d *DsBlobstore) List(ctx context.Context, opts ...ListOption) (ListPage, error) {
+	o, err := newListOptions(opts)
 	if err != nil {
-		return fmt.Errorf("putting blob: %w", err)
+		return ListPage{}, err
 	}
 
-	return nil
+	q := query.Query{
+		KeysOnly:     true,
+		ReturnsSizes: true,
+		Orders:       []query.Order{query.OrderByKey{}},
+		// fetch one extra to determine if there are more results
+		Limit: o.limit + 1,
+	}
+	if o.cursor != "" {
+		q.Filters = []query.Filter{query.FilterKeyCompare{Op: query.GreaterThan, Key: datastore.NewKey(o.cursor).String()}}
+	}
+	results, err := d.data.Query(ctx, q)
+	if err != nil {
+		return ListPage{}, fmt.Errorf("querying datastore: %w", err)
+	}
+	defer results.Close()
+
+	page := ListPage{}
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return ListPage{}, fmt.Errorf("iterating query results: %w", entry.Error)
+		}
+		if len(page.Objects) == o.limit {
+			page.Cursor = digestutil.Format(page.Objects[len(page.Objects)-1].Digest)
+			break
+		}
+		digest, err := digestutil.Parse(datastore.RawKey(entry.Key).BaseNamespace())
+		if err != nil {
+			return ListPage{}, fmt.Errorf("parsing digest: %w", err)
+		}
+		size := int64(entry.Size)
+		if entry.Size < 0 {
+			n, err := d.data.GetSize(ctx, datastore.RawKey(entry.Key))
+			if err != nil {
+				return ListPage{}, fmt.Errorf("getting blob size: %w", err)
+			}
+			size = int64(n)
+		}
+		page.Objects = append(page.Objects, ObjectInfo{Digest: digest, Size: size})
+	}
+	return page, nil
+}
+
+// Stat implements Lister. Modification times are not tracked, so the ModTime
+// is always the zero time.
+func (d *DsBlobstore) Stat(ctx context.Context, digest multihash.Multihash) (ObjectInfo, error) {
+	n, err := d.data.GetSize(ctx, datastore.NewKey(digestutil.Format(digest)))
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return ObjectInfo{}, store.ErrNotFound
+		}
+		return ObjectInfo{}, fmt.Errorf("getting blob size: %w", err)
+	}
+	return ObjectInfo{Digest: digest, Size: int64(n)}, nil
 }
 
 func (d *DsBlobstore) FileSystem() http.FileSystem {
@@ -92,6 +151,7 @@ func NewDsBlobstore(ds datastore.Datastore) *DsBlobstore {
 }
 
 var _ Blobstore = (*DsBlobstore)(nil)
+var _ Lister = (*DsBlobstore)(nil)
 
 type dsDir struct {
 	data datastore.Datastore
@@ -0,0 +1,512 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/keystore"
+)
+
+const (
+	// EncryptionKeyName is the name of the key in a [keystore.KeyStore] that
+	// blobs are encrypted with.
+	EncryptionKeyName = "blob-encryption"
+	// EncryptionKeySize is the size in bytes of a blob encryption key.
+	EncryptionKeySize = 32
+
+	// encryptedChunkSize is the number of plaintext bytes sealed in each chunk.
+	encryptedChunkSize = 64 * 1024
+	// encryptionOverhead is the number of bytes added to each chunk by sealing.
+	encryptionOverhead = 16
+	encryptionInfo     = "piri blob encryption"
+	stagingInfo        = "piri staging encryption"
+)
+
+// ErrDecryptionFailed is returned when stored data cannot be authenticated
+// with the encryption key.
+var ErrDecryptionFailed = errors.New("decryption failed")
+
+// LoadEncryptionKey retrieves the blob encryption key from the key store,
+// generating and storing a new random key if there is none.
+func LoadEncryptionKey(ctx context.Context, ks keystore.KeyStore) ([]byte, error) {
+	has, err := ks.Has(ctx, EncryptionKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("checking for encryption key: %w", err)
+	}
+	if has {
+		ki, err := ks.Get(ctx, EncryptionKeyName)
+		if err != nil {
+			return nil, fmt.Errorf("getting encryption key: %w", err)
+		}
+		if len(ki.PrivateKey) != EncryptionKeySize {
+			return nil, fmt.Errorf("encryption key must be %d bytes", EncryptionKeySize)
+		}
+		return ki.PrivateKey, nil
+	}
+
+	key := make([]byte, EncryptionKeySize)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, fmt.Errorf("generating encryption key: %w", err)
+	}
+	err = ks.Put(ctx, EncryptionKeyName, keystore.KeyInfo{PrivateKey: key})
+	if err != nil {
+		return nil, fmt.Errorf("storing encryption key: %w", err)
+	}
+	return key, nil
+}
+
+// EncryptedBlobstore is a [Blobstore] that encrypts blobs before writing them
+// to another blobstore, and decrypts them when they are read.
+//
+// Blobs are split into chunks of 64KiB that are sealed individually with
+// AES-256-GCM, so a byte range can be read by decrypting only the chunks that
+// contain it. Each blob is encrypted with a key derived from the node key and
+// the blob digest, and each chunk is bound to its position in the blob, so
+// chunks cannot be reordered, truncated or moved between blobs undetected.
+type EncryptedBlobstore struct {
+	blobs  Blobstore
+	lister Lister
+	key    []byte
+}
+
+var _ Blobstore = (*EncryptedBlobstore)(nil)
+var _ Lister = (*EncryptedBlobstore)(nil)
+var _ FileSystemer = (*EncryptedBlobstore)(nil)
+var _ TempDirer = (*EncryptedBlobstore)(nil)
+var _ SpaceReporter = (*EncryptedBlobstore)(nil)
+var _ Stager = (*EncryptedBlobstore)(nil)
+var _ StagingEncrypter = (*EncryptedBlobstore)(nil)
+var _ Compacter = (*EncryptedBlobstore)(nil)
+
+// NewEncryptedBlobstore creates a [Blobstore] that stores blobs encrypted with
+// the passed key in another blobstore, which must implement [Lister]. The key
+// must be [EncryptionKeySize] bytes. See [LoadEncryptionKey].
+func NewEncryptedBlobstore(blobs Blobstore, key []byte) (*EncryptedBlobstore, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes", EncryptionKeySize)
+	}
+	lister, ok := blobs.(Lister)
+	if !ok {
+		return nil, errors.New("encrypted blobstore must support listing")
+	}
+	return &EncryptedBlobstore{blobs: blobs, lister: lister, key: key}, nil
+}
+
+// Put encrypts the bytes and writes them to the underlying store. The
+// plaintext is verified against the digest.
+func (e *EncryptedBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
+	pr, err := NewPutReader(body, digest, size, opts...)
+	if err != nil {
+		return err
+	}
+	aead, err := e.aead(digest)
+	if err != nil {
+		return err
+	}
+	er := &encryptingReader{
+		r:      pr,
+		aead:   aead,
+		size:   size,
+		chunks: chunkCount(size),
+		plain:  make([]byte, encryptedChunkSize),
+		sealed: make([]byte, 0, encryptedChunkSize+encryptionOverhead),
+	}
+	// the ciphertext does not hash to the digest, but the plaintext has been
+	// verified as it is read
+	return e.blobs.Put(ctx, digest, encryptedSize(size), er, WithoutVerification())
+}
+
+// Get retrieves and decrypts a blob. When a range is requested only the chunks
+// that contain it are read from the underlying store.
+func (e *EncryptedBlobstore) Get(ctx context.Context, digest multihash.Multihash, opts ...GetOption) (Object, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	first := o.byteRange.Offset / encryptedChunkSize
+	inner := Range{Offset: first * (encryptedChunkSize + encryptionOverhead)}
+	if o.byteRange.Length != nil {
+		last := first
+		if *o.byteRange.Length > 0 {
+			last = (o.byteRange.Offset + *o.byteRange.Length - 1) / encryptedChunkSize
+		}
+		length := (last+1)*(encryptedChunkSize+encryptionOverhead) - inner.Offset
+		inner.Length = &length
+	}
+
+	obj, err := e.blobs.Get(ctx, digest, WithRange(inner))
+	if err != nil {
+		return nil, err
+	}
+	size, err := decryptedSize(uint64(obj.Size()))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := e.aead(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := size - min(o.byteRange.Offset, size)
+	if o.byteRange.Length != nil {
+		remaining = min(remaining, *o.byteRange.Length)
+	}
+	return EncryptedObject{
+		obj:       obj,
+		aead:      aead,
+		size:      size,
+		first:     first,
+		skip:      o.byteRange.Offset - first*encryptedChunkSize,
+		remaining: remaining,
+	}, nil
+}
+
+func (e *EncryptedBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	return e.blobs.Delete(ctx, digest)
+}
+
+func (e *EncryptedBlobstore) List(ctx context.Context, opts ...ListOption) (ListPage, error) {
+	page, err := e.lister.List(ctx, opts...)
+	if err != nil {
+		return ListPage{}, err
+	}
+	for i, obj := range page.Objects {
+		size, err := decryptedSize(uint64(obj.Size))
+		if err != nil {
+			return ListPage{}, fmt.Errorf("blob %s: %w", digestutil.Format(obj.Digest), err)
+		}
+		page.Objects[i].Size = int64(size)
+	}
+	return page, nil
+}
+
+func (e *EncryptedBlobstore) Stat(ctx context.Context, digest multihash.Multihash) (ObjectInfo, error) {
+	info, err := e.lister.Stat(ctx, digest)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	size, err := decryptedSize(uint64(info.Size))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info.Size = int64(size)
+	return info, nil
+}
+
+// Space returns the space used and available in the underlying store. The
+// space used includes the encryption overhead.
+func (e *EncryptedBlobstore) Space(ctx context.Context) (Space, error) {
+	sr, ok := e.blobs.(SpaceReporter)
+	if !ok {
+		return Space{}, errors.ErrUnsupported
+	}
+	return sr.Space(ctx)
+}
+
+// Compact compacts the underlying store, if it implements [Compacter].
+func (e *EncryptedBlobstore) Compact(ctx context.Context) error {
+	c, ok := e.blobs.(Compacter)
+	if !ok {
+		return nil
+	}
+	return c.Compact(ctx)
+}
+
+// TempDir returns the tmp directory of the underlying store, or the default
+// directory for temporary files if it does not have one. Data staged there by
+// the underlying store is encrypted. Callers staging data themselves should
+// encrypt it with [EncryptedBlobstore.StagingCipher].
+func (e *EncryptedBlobstore) TempDir() string {
+	return tempDir(e.blobs)
+}
+
+// StagingDirs returns every directory the underlying store stages data in.
+func (e *EncryptedBlobstore) StagingDirs() []string {
+	return StagingDirs(e.blobs)
+}
+
+// StagingDir returns the directory the underlying store would stage a blob of
+// the passed size in, once encrypted.
+func (e *EncryptedBlobstore) StagingDir(size uint64) (string, error) {
+	return StagingDir(e.blobs, encryptedSize(size))
+}
+
+// StagingCipher returns an AES-CTR stream for data staged for the blob,
+// keyed with a key derived from the node key and the blob digest and
+// positioned at the passed offset. Staged data is not authenticated, so it
+// must be verified against the digest once decrypted, as [Put] does.
+func (e *EncryptedBlobstore) StagingCipher(digest multihash.Multihash, iv []byte, offset uint64) (cipher.Stream, error) {
+	if len(iv) != StagingIVSize {
+		return nil, fmt.Errorf("staging IV must be %d bytes", StagingIVSize)
+	}
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, e.key, digest, []byte(stagingInfo)), key)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	// advance the counter to the block containing the offset, then discard the
+	// key stream up to the offset within it
+	hi, lo := binary.BigEndian.Uint64(iv[:8]), binary.BigEndian.Uint64(iv[8:])
+	next := lo + offset/aes.BlockSize
+	if next < lo {
+		hi++
+	}
+	ctr := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(ctr[:8], hi)
+	binary.BigEndian.PutUint64(ctr[8:], next)
+	stream := cipher.NewCTR(block, ctr)
+	skip := make([]byte, offset%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+	return stream, nil
+}
+
+// FileSystem returns a filesystem interface for reading decrypted blobs, which
+// supports seeking and so serves HTTP range requests.
+func (e *EncryptedBlobstore) FileSystem() http.FileSystem {
+	return &encryptedDir{e}
+}
+
+// aead creates the cipher for a blob, keyed with a key derived from the node
+// key and the blob digest.
+func (e *EncryptedBlobstore) aead(digest multihash.Multihash) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, e.key, digest, []byte(encryptionInfo)), key)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce is the nonce for the chunk at the passed index. The final chunk
+// is marked so that truncation at a chunk boundary is detected.
+func chunkNonce(index uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, index)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// chunkCount is the number of chunks plaintext of the passed size is sealed
+// in. Empty plaintext is sealed in a single empty chunk.
+func chunkCount(size uint64) uint64 {
+	return max(1, (size+encryptedChunkSize-1)/encryptedChunkSize)
+}
+
+func encryptedSize(size uint64) uint64 {
+	return size + chunkCount(size)*encryptionOverhead
+}
+
+func decryptedSize(size uint64) (uint64, error) {
+	full := size / (encryptedChunkSize + encryptionOverhead)
+	rem := size % (encryptedChunkSize + encryptionOverhead)
+	if rem == 0 {
+		if full == 0 {
+			return 0, fmt.Errorf("%w: object is empty", ErrDecryptionFailed)
+		}
+		return full * encryptedChunkSize, nil
+	}
+	if rem < encryptionOverhead {
+		return 0, fmt.Errorf("%w: invalid object size %d", ErrDecryptionFailed, size)
+	}
+	return full*encryptedChunkSize + rem - encryptionOverhead, nil
+}
+
+type encryptingReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	size   uint64
+	chunks uint64
+	index  uint64
+	plain  []byte
+	sealed []byte
+	buf    []byte
+	err    error
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		if e.index == e.chunks {
+			// the put reader fails if there is more data than expected
+			_, err := io.ReadFull(e.r, make([]byte, 1))
+			if err == nil {
+				err = ErrTooLarge
+			}
+			e.err = err
+			continue
+		}
+		n := min(encryptedChunkSize, e.size-e.index*encryptedChunkSize)
+		_, err := io.ReadFull(e.r, e.plain[:n])
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				err = ErrTooSmall
+			}
+			e.err = err
+			continue
+		}
+		e.buf = e.aead.Seal(e.sealed[:0], chunkNonce(e.index, e.index == e.chunks-1), e.plain[:n], nil)
+		e.index++
+	}
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+	return n, nil
+}
+
+// EncryptedObject is an object read from an [EncryptedBlobstore].
+type EncryptedObject struct {
+	obj       Object
+	aead      cipher.AEAD
+	size      uint64
+	first     uint64
+	skip      uint64
+	remaining uint64
+}
+
+// Size returns the total size of the decrypted object in bytes.
+func (o EncryptedObject) Size() int64 {
+	return int64(o.size)
+}
+
+func (o EncryptedObject) Body() io.Reader {
+	return &decryptingReader{
+		r:         o.obj.Body(),
+		aead:      o.aead,
+		size:      o.size,
+		chunks:    chunkCount(o.size),
+		index:     o.first,
+		skip:      o.skip,
+		remaining: o.remaining,
+		sealed:    make([]byte, encryptedChunkSize+encryptionOverhead),
+		plain:     make([]byte, 0, encryptedChunkSize),
+	}
+}
+
+type decryptingReader struct {
+	r         io.Reader
+	aead      cipher.AEAD
+	size      uint64
+	chunks    uint64
+	index     uint64
+	skip      uint64
+	remaining uint64
+	sealed    []byte
+	plain     []byte
+	buf       []byte
+	err       error
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.remaining == 0 || d.index >= d.chunks {
+			d.err = io.EOF
+			continue
+		}
+		n := min(encryptedChunkSize, d.size-d.index*encryptedChunkSize) + encryptionOverhead
+		_, err := io.ReadFull(d.r, d.sealed[:n])
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			d.err = fmt.Errorf("reading chunk %d: %w", d.index, err)
+			continue
+		}
+		plain, err := d.aead.Open(d.plain[:0], chunkNonce(d.index, d.index == d.chunks-1), d.sealed[:n], nil)
+		if err != nil {
+			d.err = fmt.Errorf("%w: chunk %d", ErrDecryptionFailed, d.index)
+			continue
+		}
+		d.index++
+		plain = plain[min(d.skip, uint64(len(plain))):]
+		d.skip = 0
+		if uint64(len(plain)) > d.remaining {
+			plain = plain[:d.remaining]
+		}
+		d.remaining -= uint64(len(plain))
+		d.buf = plain
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// Close closes the underlying body if it is closeable.
+func (d *decryptingReader) Close() error {
+	if c, ok := d.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type encryptedDir struct {
+	e *EncryptedBlobstore
+}
+
+var _ http.FileSystem = (*encryptedDir)(nil)
+
+func (d *encryptedDir) Open(name string) (http.File, error) {
+	digest, err := digestutil.Parse(name[1:])
+	if err != nil {
+		return nil, fs.ErrNotExist
+	}
+	info, err := d.e.Stat(context.Background(), digest)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	return &encryptedFile{
+		ObjectReader: NewObjectReader(context.Background(), d.e, digest, info.Size),
+		info:         blobFileInfo{name: name[1:], size: info.Size, modified: info.ModTime},
+	}, nil
+}
+
+// encryptedFile reads a decrypted blob, starting a new ranged read after each
+// seek.
+type encryptedFile struct {
+	*ObjectReader
+	info blobFileInfo
+}
+
+var _ http.File = (*encryptedFile)(nil)
+
+func (f *encryptedFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (f *encryptedFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
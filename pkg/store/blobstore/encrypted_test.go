@@ -0,0 +1,235 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store/keystore"
+)
+
+func TestEncryptedBlobstore(t *testing.T) {
+	impls := map[string]func(t *testing.T) Blobstore{
+		"MapBlobstore": func(t *testing.T) Blobstore { return NewMapBlobstore() },
+		"FsBlobstore": func(t *testing.T) Blobstore {
+			return testutil.Must(NewFsBlobstore(t.TempDir(), t.TempDir()))(t)
+		},
+		"DsBlobstore": func(t *testing.T) Blobstore { return NewDsBlobstore(datastore.NewMapDatastore()) },
+	}
+
+	sizes := []int{0, 1, encryptedChunkSize, encryptedChunkSize + 1, 3*encryptedChunkSize + 7}
+
+	for k, newStore := range impls {
+		t.Run("roundtrip "+k, func(t *testing.T) {
+			inner := newStore(t)
+			s := testutil.Must(NewEncryptedBlobstore(inner, testutil.RandomBytes(t, EncryptionKeySize)))(t)
+
+			for _, size := range sizes {
+				data := testutil.RandomBytes(t, size)
+				digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+				err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+				require.NoError(t, err)
+
+				obj, err := s.Get(context.Background(), digest)
+				require.NoError(t, err)
+				require.Equal(t, int64(size), obj.Size())
+				require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+
+				// the underlying store holds ciphertext
+				raw, err := inner.Get(context.Background(), digest)
+				require.NoError(t, err)
+				require.Equal(t, int64(encryptedSize(uint64(size))), raw.Size())
+				if size >= 32 {
+					require.NotContains(t, string(testutil.Must(io.ReadAll(raw.Body()))(t)), string(data))
+				}
+
+				info, err := s.Stat(context.Background(), digest)
+				require.NoError(t, err)
+				require.Equal(t, int64(size), info.Size)
+			}
+
+			page, err := s.List(context.Background())
+			require.NoError(t, err)
+			require.Len(t, page.Objects, len(sizes))
+		})
+
+		t.Run("ranged read "+k, func(t *testing.T) {
+			s := testutil.Must(NewEncryptedBlobstore(newStore(t), testutil.RandomBytes(t, EncryptionKeySize)))(t)
+
+			data := testutil.RandomBytes(t, 3*encryptedChunkSize+7)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+			err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+			require.NoError(t, err)
+
+			ranges := []struct{ offset, length uint64 }{
+				{0, 10},
+				{encryptedChunkSize - 5, 10},
+				{encryptedChunkSize, encryptedChunkSize},
+				{10, 2*encryptedChunkSize + 100},
+				{3*encryptedChunkSize + 2, 5},
+				{3*encryptedChunkSize + 2, 100},
+			}
+			for _, r := range ranges {
+				length := r.length
+				obj, err := s.Get(context.Background(), digest, WithRange(Range{Offset: r.offset, Length: &length}))
+				require.NoError(t, err)
+				require.Equal(t, int64(len(data)), obj.Size())
+				end := min(r.offset+r.length, uint64(len(data)))
+				require.Equal(t, data[r.offset:end], testutil.Must(io.ReadAll(obj.Body()))(t), "range %d-%d", r.offset, end)
+			}
+
+			obj, err := s.Get(context.Background(), digest, WithRange(Range{Offset: encryptedChunkSize + 3}))
+			require.NoError(t, err)
+			require.Equal(t, data[encryptedChunkSize+3:], testutil.Must(io.ReadAll(obj.Body()))(t))
+		})
+
+		t.Run("data consistency "+k, func(t *testing.T) {
+			s := testutil.Must(NewEncryptedBlobstore(newStore(t), testutil.RandomBytes(t, EncryptionKeySize)))(t)
+
+			data := testutil.RandomBytes(t, encryptedChunkSize+10)
+			baddata := testutil.RandomBytes(t, encryptedChunkSize+10)
+			digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+			err := s.Put(context.Background(), digest, uint64(len(baddata)), bytes.NewReader(baddata))
+			require.ErrorIs(t, err, ErrDataInconsistent)
+
+			err = s.Put(context.Background(), digest, uint64(len(data)+1), bytes.NewReader(data))
+			require.ErrorIs(t, err, ErrTooSmall)
+
+			short := testutil.Must(multihash.Sum(data[:len(data)-1], multihash.SHA2_256, -1))(t)
+			err = s.Put(context.Background(), short, uint64(len(data)-1), bytes.NewReader(data))
+			require.ErrorIs(t, err, ErrTooLarge)
+		})
+	}
+
+	t.Run("detects tampering", func(t *testing.T) {
+		inner := NewMapBlobstore()
+		s := testutil.Must(NewEncryptedBlobstore(inner, testutil.RandomBytes(t, EncryptionKeySize)))(t)
+
+		data := testutil.RandomBytes(t, 2*encryptedChunkSize)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		inner.data[digestutil.Format(digest)][encryptedChunkSize+100] ^= 0xff
+
+		obj, err := s.Get(context.Background(), digest)
+		require.NoError(t, err)
+		_, err = io.ReadAll(obj.Body())
+		require.ErrorIs(t, err, ErrDecryptionFailed)
+
+		// the first chunk is intact
+		length := uint64(10)
+		obj, err = s.Get(context.Background(), digest, WithRange(Range{Length: &length}))
+		require.NoError(t, err)
+		require.Equal(t, data[:10], testutil.Must(io.ReadAll(obj.Body()))(t))
+	})
+
+	t.Run("detects truncation", func(t *testing.T) {
+		inner := NewMapBlobstore()
+		s := testutil.Must(NewEncryptedBlobstore(inner, testutil.RandomBytes(t, EncryptionKeySize)))(t)
+
+		data := testutil.RandomBytes(t, 2*encryptedChunkSize)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		// drop the final chunk, leaving a valid but non-final chunk at the end
+		k := digestutil.Format(digest)
+		inner.data[k] = inner.data[k][:encryptedChunkSize+encryptionOverhead]
+
+		obj, err := s.Get(context.Background(), digest)
+		require.NoError(t, err)
+		_, err = io.ReadAll(obj.Body())
+		require.ErrorIs(t, err, ErrDecryptionFailed)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		inner := NewMapBlobstore()
+		s := testutil.Must(NewEncryptedBlobstore(inner, testutil.RandomBytes(t, EncryptionKeySize)))(t)
+
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		other := testutil.Must(NewEncryptedBlobstore(inner, testutil.RandomBytes(t, EncryptionKeySize)))(t)
+		obj, err := other.Get(context.Background(), digest)
+		require.NoError(t, err)
+		_, err = io.ReadAll(obj.Body())
+		require.ErrorIs(t, err, ErrDecryptionFailed)
+	})
+
+	t.Run("serves HTTP range requests", func(t *testing.T) {
+		s := testutil.Must(NewEncryptedBlobstore(NewMapBlobstore(), testutil.RandomBytes(t, EncryptionKeySize)))(t)
+
+		data := testutil.RandomBytes(t, 2*encryptedChunkSize)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		server := httptest.NewServer(http.FileServer(s.FileSystem()))
+		t.Cleanup(server.Close)
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", server.URL, digestutil.Format(digest)), nil)
+		require.NoError(t, err)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", encryptedChunkSize-10, encryptedChunkSize+9))
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusPartialContent, res.StatusCode)
+		require.Equal(t, data[encryptedChunkSize-10:encryptedChunkSize+10], testutil.Must(io.ReadAll(res.Body))(t))
+	})
+
+	t.Run("loads key from key store", func(t *testing.T) {
+		ks := keystore.NewMemKeyStore()
+
+		key, err := LoadEncryptionKey(context.Background(), ks)
+		require.NoError(t, err)
+		require.Len(t, key, EncryptionKeySize)
+
+		again, err := LoadEncryptionKey(context.Background(), ks)
+		require.NoError(t, err)
+		require.Equal(t, key, again)
+	})
+
+	t.Run("staging cipher resumes at any offset", func(t *testing.T) {
+		s := testutil.Must(NewEncryptedBlobstore(NewMapBlobstore(), testutil.RandomBytes(t, EncryptionKeySize)))(t)
+		data, digest := randomBlob(t)
+		data = append(data, testutil.RandomBytes(t, 90)...)
+		// the counter carries into the high half of the IV within the data
+		iv := bytes.Repeat([]byte{0xff}, StagingIVSize)
+		iv[0] = 0
+
+		whole := make([]byte, len(data))
+		stream := testutil.Must(s.StagingCipher(digest, iv, 0))(t)
+		stream.XORKeyStream(whole, data)
+		require.NotEqual(t, data, whole)
+
+		for _, offset := range []uint64{5, 16, 37} {
+			part := make([]byte, len(data)-int(offset))
+			stream := testutil.Must(s.StagingCipher(digest, iv, offset))(t)
+			stream.XORKeyStream(part, data[offset:])
+			require.Equal(t, whole[offset:], part)
+		}
+	})
+
+	t.Run("compacts the underlying store", func(t *testing.T) {
+		inner := &compactingBlobstore{MapBlobstore: NewMapBlobstore()}
+		s := testutil.Must(NewEncryptedBlobstore(inner, testutil.RandomBytes(t, EncryptionKeySize)))(t)
+		require.NoError(t, s.Compact(context.Background()))
+		require.Equal(t, 1, inner.compactions)
+	})
+
+	t.Run("requires lister", func(t *testing.T) {
+		_, err := NewEncryptedBlobstore(struct{ Blobstore }{NewMapBlobstore()}, testutil.RandomBytes(t, EncryptionKeySize))
+		require.Error(t, err)
+	})
+}
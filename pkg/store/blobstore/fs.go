@@ -1,9 +1,7 @@
 package blobstore
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/multiformats/go-multibase"
@@ -68,6 +67,11 @@ func encodePath(digest multihash.Multihash) string {
 	return path.Join(parts...)
 }
 
+// quarantineDirName is the name of the directory within the root directory
+// that quarantined blobs are moved to. It is not a valid multibase string, so
+// it never collides with an encoded blob path.
+const quarantineDirName = ".quarantine"
+
 type FsBlobstore struct {
 	rootdir string
 	tmpdir  string
@@ -78,6 +82,12 @@ func (b *FsBlobstore) FileSystem() http.FileSystem {
 	return &fsDir{http.Dir(b.rootdir)}
 }
 
+// TempDir returns the directory blobs are written to before being moved into
+// the root directory.
+func (b *FsBlobstore) TempDir() string {
+	return b.tmpdir
+}
+
 func (b *FsBlobstore) Get(ctx context.Context, digest multihash.Multihash, opts ...GetOption) (Object, error) {
 	o := &options{}
 	for _, opt := range opts {
@@ -102,13 +112,10 @@ func (b *FsBlobstore) Get(ctx context.Context, digest multihash.Multihash, opts
 	return FileObject{name: n, size: inf.Size(), byteRange: o.byteRange}, nil
 }
 
-func (b *FsBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader) error {
-	info, err := multihash.Decode(digest)
+func (b *FsBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
+	vr, err := NewPutReader(body, digest, size, opts...)
 	if err != nil {
-		return fmt.Errorf("decoding digest: %w", err)
-	}
-	if info.Code != multihash.SHA2_256 {
-		return fmt.Errorf("unsupported digest: 0x%x", info.Code)
+		return err
 	}
 
 	tmpname := path.Join(b.tmpdir, encodePath(digest))
@@ -133,25 +140,14 @@ func (b *FsBlobstore) Put(ctx context.Context, digest multihash.Multihash, size
 		}
 	}()
 
-	hash := sha256.New()
-	tee := io.TeeReader(body, hash)
-
-	written, err := io.Copy(f, tee)
+	_, err = io.Copy(f, vr)
 	if err != nil {
+		if isVerificationError(err) {
+			return err
+		}
 		return fmt.Errorf("writing file: %w", err)
 	}
 
-	if written > int64(size) {
-		return ErrTooLarge
-	}
-	if written < int64(size) {
-		return ErrTooSmall
-	}
-
-	if !bytes.Equal(hash.Sum(nil), info.Digest) {
-		return ErrDataInconsistent
-	}
-
 	name := path.Join(b.rootdir, encodePath(digest))
 	err = os.MkdirAll(path.Dir(name), 0755)
 	if err != nil {
@@ -170,6 +166,170 @@ func (b *FsBlobstore) Put(ctx context.Context, digest multihash.Multihash, size
 	return nil
 }
 
+func (b *FsBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	name := path.Join(b.rootdir, encodePath(digest))
+	err := os.Remove(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("removing file: %w", err)
+	}
+
+	b.prune(name)
+	return nil
+}
+
+// List retrieves a page of blobs in the store. Quarantined blobs and files
+// that do not decode to a digest are skipped.
+func (b *FsBlobstore) List(ctx context.Context, opts ...ListOption) (ListPage, error) {
+	o, err := newListOptions(opts)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	var objects []ObjectInfo
+	more := false
+	err = filepath.WalkDir(b.rootdir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if name == b.rootdir {
+			return nil
+		}
+		rel, err := filepath.Rel(b.rootdir, name)
+		if err != nil {
+			return err
+		}
+		key := strings.ReplaceAll(rel, string(filepath.Separator), "")
+		if d.IsDir() {
+			if name == b.quarantineDir() {
+				return fs.SkipDir
+			}
+			// every blob in the directory is before the cursor
+			if key < o.cursor && !strings.HasPrefix(o.cursor, key) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if key <= o.cursor {
+			return nil
+		}
+		digest, err := digestutil.Parse(key)
+		if err != nil {
+			return nil
+		}
+		if len(objects) == o.limit {
+			more = true
+			return fs.SkipAll
+		}
+		inf, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // removed since the directory was read
+			}
+			return fmt.Errorf("stat file: %w", err)
+		}
+		objects = append(objects, ObjectInfo{Digest: digest, Size: inf.Size(), ModTime: inf.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return ListPage{}, fmt.Errorf("walking root directory: %w", err)
+	}
+
+	page := ListPage{Objects: objects}
+	if more {
+		page.Cursor = digestutil.Format(objects[len(objects)-1].Digest)
+	}
+	return page, nil
+}
+
+func (b *FsBlobstore) Stat(ctx context.Context, digest multihash.Multihash) (ObjectInfo, error) {
+	inf, err := os.Stat(path.Join(b.rootdir, encodePath(digest)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ObjectInfo{}, store.ErrNotFound
+		}
+		return ObjectInfo{}, fmt.Errorf("stat file: %w", err)
+	}
+	return ObjectInfo{Digest: digest, Size: inf.Size(), ModTime: inf.ModTime()}, nil
+}
+
+// Space returns the number of bytes in files within the root directory,
+// including quarantined blobs, and the space available on its filesystem.
+func (b *FsBlobstore) Space(ctx context.Context) (Space, error) {
+	var used uint64
+	err := filepath.WalkDir(b.rootdir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			return nil
+		}
+		inf, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // removed since the directory was read
+			}
+			return fmt.Errorf("stat file: %w", err)
+		}
+		used += uint64(inf.Size())
+		return nil
+	})
+	if err != nil {
+		return Space{}, fmt.Errorf("walking root directory: %w", err)
+	}
+	avail, err := availableSpace(b.rootdir)
+	if err != nil {
+		return Space{}, fmt.Errorf("getting available space: %w", err)
+	}
+	return Space{Used: used, Available: avail}, nil
+}
+
+// Quarantine moves the blob to a quarantine directory within the root
+// directory, from which it is not served.
+func (b *FsBlobstore) Quarantine(ctx context.Context, digest multihash.Multihash) error {
+	name := path.Join(b.rootdir, encodePath(digest))
+	if _, err := os.Stat(name); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return store.ErrNotFound
+		}
+		return fmt.Errorf("stat file: %w", err)
+	}
+
+	err := os.MkdirAll(b.quarantineDir(), 0755)
+	if err != nil {
+		return fmt.Errorf("creating quarantine directory: %w", err)
+	}
+	err = move(name, path.Join(b.quarantineDir(), digestutil.Format(digest)))
+	if err != nil {
+		return fmt.Errorf("moving file: %w", err)
+	}
+
+	b.prune(name)
+	return nil
+}
+
+func (b *FsBlobstore) quarantineDir() string {
+	return path.Join(b.rootdir, quarantineDirName)
+}
+
+// prune removes any intermediate directories of the passed file that are now
+// empty.
+func (b *FsBlobstore) prune(name string) {
+	for dir := path.Dir(name); dir != b.rootdir && strings.HasPrefix(dir, b.rootdir); dir = path.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
+
 func move(source, destination string) error {
 	err := os.Rename(source, destination)
 	if err != nil && strings.Contains(err.Error(), "invalid cross-device link") {
@@ -213,6 +373,10 @@ func moveCrossDevice(source, destination string) error {
 
 var _ Blobstore = (*FsBlobstore)(nil)
 var _ FileSystemer = (*FsBlobstore)(nil)
+var _ Lister = (*FsBlobstore)(nil)
+var _ Quarantiner = (*FsBlobstore)(nil)
+var _ TempDirer = (*FsBlobstore)(nil)
+var _ SpaceReporter = (*FsBlobstore)(nil)
 
 // NewFsBlobstore creates a [Blobstore] backed by the local filesystem.
 // The tmpdir parameter is optional, defaulting to [os.TempDir] + "blobs".
@@ -2,9 +2,14 @@ package blobstore
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/multiformats/go-multihash"
 )
@@ -49,6 +54,24 @@ func WithRange(byteRange Range) GetOption {
 	}
 }
 
+// PutOption is an option configuring byte storage in a blobstore.
+type PutOption func(cfg *putOptions) error
+
+type putOptions struct {
+	unverified bool
+}
+
+// WithoutVerification stores the bytes without checking that they hash to the
+// digest. The size is still checked. It is intended for blobstores that wrap
+// another and transform the bytes, having verified the original bytes
+// themselves.
+func WithoutVerification() PutOption {
+	return func(opts *putOptions) error {
+		opts.unverified = true
+		return nil
+	}
+}
+
 type Object interface {
 	// Size returns the total size of the object in bytes.
 	Size() int64
@@ -58,12 +81,15 @@ type Object interface {
 type Blobstore interface {
 	// Put stores the bytes to the store and ensures it hashes to the passed
 	// digest.
-	Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader) error
+	Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error
 	// Get retrieves the object identified by the passed digest. Returns nil and
 	// [ErrNotFound] if the object does not exist.
 	//
 	// Note: data is not hashed on read.
 	Get(ctx context.Context, digest multihash.Multihash, opts ...GetOption) (Object, error)
+	// Delete removes the object identified by the passed digest. It is not an
+	// error to delete an object that does not exist.
+	Delete(ctx context.Context, digest multihash.Multihash) error
 }
 
 // FileSystemer exposes the filesystem interface for reading blobs.
@@ -72,6 +98,211 @@ type FileSystemer interface {
 	FileSystem() http.FileSystem
 }
 
+// TempDirer exposes the local directory a blobstore stages data in before it
+// is stored.
+type TempDirer interface {
+	// TempDir returns the path of the directory.
+	TempDir() string
+}
+
+// Stager is implemented by blobstores that store blobs in more than one
+// place, so that data staged by callers can be kept with the blobs it will
+// become rather than in a single tmp directory.
+type Stager interface {
+	// StagingDirs returns every directory data may be staged in.
+	StagingDirs() []string
+	// StagingDir returns the directory to stage a blob of the passed size in.
+	StagingDir(size uint64) (string, error)
+}
+
+// StagingEncrypter is implemented by blobstores that encrypt blobs at rest,
+// so that data staged by callers can be encrypted too.
+type StagingEncrypter interface {
+	// StagingCipher returns a stream cipher for data staged for the blob,
+	// positioned at the passed offset. The IV must be [StagingIVSize] random
+	// bytes, chosen when staging of the blob starts.
+	StagingCipher(digest multihash.Multihash, iv []byte, offset uint64) (cipher.Stream, error)
+}
+
+// StagingIVSize is the size in bytes of the IV passed to
+// [StagingEncrypter.StagingCipher].
+const StagingIVSize = aes.BlockSize
+
+// StagingDirs returns every directory data for the passed blobstore may be
+// staged in.
+func StagingDirs(b Blobstore) []string {
+	if s, ok := b.(Stager); ok {
+		return s.StagingDirs()
+	}
+	return []string{tempDir(b)}
+}
+
+// StagingDir returns the directory to stage a blob of the passed size in for
+// the passed blobstore.
+func StagingDir(b Blobstore, size uint64) (string, error) {
+	if s, ok := b.(Stager); ok {
+		return s.StagingDir(size)
+	}
+	return tempDir(b), nil
+}
+
+// StagingEncrypterOf returns the [StagingEncrypter] for data staged for the
+// passed blobstore, looking through a [TieredBlobstore] to its hot tier, or
+// false if the blobstore does not encrypt blobs.
+func StagingEncrypterOf(b Blobstore) (StagingEncrypter, bool) {
+	switch b := b.(type) {
+	case StagingEncrypter:
+		return b, true
+	case *TieredBlobstore:
+		return StagingEncrypterOf(b.hot)
+	}
+	return nil, false
+}
+
+// tempDir returns the tmp directory of the passed blobstore if it has one, or
+// the default directory for temporary files otherwise.
+func tempDir(b Blobstore) string {
+	if td, ok := b.(TempDirer); ok {
+		return td.TempDir()
+	}
+	return os.TempDir()
+}
+
+// DefaultListLimit is the maximum number of objects returned in a page by
+// [Lister.List] when no limit is configured.
+const DefaultListLimit = 1000
+
+// ListOption is an option configuring enumeration of a blobstore.
+type ListOption func(cfg *listOptions) error
+
+type listOptions struct {
+	cursor string
+	limit  int
+}
+
+// WithCursor configures the position to list from. It is the cursor returned
+// in the previous [ListPage].
+func WithCursor(cursor string) ListOption {
+	return func(opts *listOptions) error {
+		opts.cursor = cursor
+		return nil
+	}
+}
+
+// WithLimit configures the maximum number of objects returned in a page.
+func WithLimit(limit int) ListOption {
+	return func(opts *listOptions) error {
+		if limit <= 0 {
+			return errors.New("list limit must be greater than zero")
+		}
+		opts.limit = limit
+		return nil
+	}
+}
+
+func newListOptions(opts []ListOption) (*listOptions, error) {
+	o := &listOptions{limit: DefaultListLimit}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// ObjectInfo describes an object held by a blobstore.
+type ObjectInfo struct {
+	// Digest is the hash of the object.
+	Digest multihash.Multihash
+	// Size is the size of the object in bytes.
+	Size int64
+	// ModTime is the time the object was last modified. It is the zero time if
+	// the store does not track modification times.
+	ModTime time.Time
+}
+
+// ListPage is a page of objects returned by [Lister.List].
+type ListPage struct {
+	// Objects are the objects in the page, ordered by the multibase encoding of
+	// their digest.
+	Objects []ObjectInfo
+	// Cursor is used to retrieve the next page with [WithCursor]. It is empty
+	// if there are no more objects.
+	Cursor string
+}
+
+// Lister enumerates the objects held by a blobstore.
+type Lister interface {
+	// List retrieves a page of objects in the store. Objects added or removed
+	// while paging may or may not be included.
+	List(ctx context.Context, opts ...ListOption) (ListPage, error)
+	// Stat retrieves information about the object identified by the passed
+	// digest without reading its body. Returns [ErrNotFound] if the object does
+	// not exist.
+	Stat(ctx context.Context, digest multihash.Multihash) (ObjectInfo, error)
+}
+
+// ListAll calls fn for every object in the store, paging through the results
+// of [Lister.List]. Iteration stops at the first error returned by fn.
+func ListAll(ctx context.Context, l Lister, fn func(ObjectInfo) error) error {
+	cursor := ""
+	for {
+		page, err := l.List(ctx, WithCursor(cursor))
+		if err != nil {
+			return err
+		}
+		for _, obj := range page.Objects {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+		if page.Cursor == "" {
+			return nil
+		}
+		cursor = page.Cursor
+	}
+}
+
+// Space is the amount of storage used by a blobstore and left available to
+// it.
+type Space struct {
+	// Used is the number of bytes the store occupies.
+	Used uint64
+	// Available is the number of bytes that can still be written to the store.
+	Available uint64
+}
+
+// SpaceReporter is implemented by blobstores with a finite amount of storage.
+// Stores that do not implement it are treated as unbounded.
+type SpaceReporter interface {
+	// Space returns the storage used by the store and left available to it.
+	// Returns [errors.ErrUnsupported] if the store wraps a store that does not
+	// report its space.
+	Space(ctx context.Context) (Space, error)
+}
+
+// DirSpace reports the space available on the filesystem containing a
+// directory. It is used for storage that blobs are written to outside of a
+// blobstore, such as the stash of a PDP server.
+type DirSpace string
+
+func (d DirSpace) Space(ctx context.Context) (Space, error) {
+	avail, err := availableSpace(string(d))
+	if err != nil {
+		return Space{}, fmt.Errorf("getting available space: %w", err)
+	}
+	return Space{Available: avail}, nil
+}
+
+// Quarantiner moves objects out of a blobstore without destroying them, so
+// that corrupt data is no longer served but remains available for inspection.
+type Quarantiner interface {
+	// Quarantine removes the object identified by the passed digest from the
+	// store, retaining the bytes elsewhere. Returns [ErrNotFound] if the object
+	// does not exist.
+	Quarantine(ctx context.Context, digest multihash.Multihash) error
+}
+
 type GetConfig interface {
 	ProcessOptions([]GetOption)
 	Range() Range
@@ -80,3 +311,23 @@ type GetConfig interface {
 func NewGetConfig() GetConfig {
 	return &options{}
 }
+
+// ListConfig exposes the configured list options to blobstore
+// implementations outside of this package.
+type ListConfig interface {
+	Cursor() string
+	Limit() int
+}
+
+func (o *listOptions) Cursor() string {
+	return o.cursor
+}
+
+func (o *listOptions) Limit() int {
+	return o.limit
+}
+
+// NewListConfig applies the passed options over the defaults.
+func NewListConfig(opts []ListOption) (ListConfig, error) {
+	return newListOptions(opts)
+}
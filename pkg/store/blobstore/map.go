@@ -3,12 +3,12 @@ package blobstore
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/multiformats/go-multihash"
@@ -28,16 +28,18 @@ func (o MapObject) Size() int64 {
 func (o MapObject) Body() io.Reader {
 	b := o.bytes
 	if o.byteRange.Offset > 0 {
-		b = b[o.byteRange.Offset:]
+		b = b[min(o.byteRange.Offset, uint64(len(b))):]
 	}
 	if o.byteRange.Length != nil {
-		b = b[0:*o.byteRange.Length]
+		b = b[0:min(*o.byteRange.Length, uint64(len(b)))]
 	}
 	return bytes.NewReader(b)
 }
 
 type MapBlobstore struct {
-	data map[string][]byte
+	data        map[string][]byte
+	modified    map[string]time.Time
+	quarantined map[string][]byte
 }
 
 func (mb *MapBlobstore) Get(ctx context.Context, digest multihash.Multihash, opts ...GetOption) (Object, error) {
@@ -56,37 +58,81 @@ func (mb *MapBlobstore) Get(ctx context.Context, digest multihash.Multihash, opt
 	return obj, nil
 }
 
-func (mb *MapBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader) error {
-	info, err := multihash.Decode(digest)
+func (mb *MapBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
+	vr, err := NewPutReader(body, digest, size, opts...)
 	if err != nil {
-		return fmt.Errorf("decoding digest: %w", err)
-	}
-	if info.Code != multihash.SHA2_256 {
-		return fmt.Errorf("unsupported digest: 0x%x", info.Code)
+		return err
 	}
 
-	b, err := io.ReadAll(body)
+	b, err := io.ReadAll(vr)
 	if err != nil {
+		if isVerificationError(err) {
+			return err
+		}
 		return fmt.Errorf("reading body: %w", err)
 	}
 
-	if len(b) > int(size) {
-		return ErrTooLarge
-	}
-	if len(b) < int(size) {
-		return ErrTooSmall
+	k := digestutil.Format(digest)
+	mb.data[k] = b
+	mb.modified[k] = time.Now()
+
+	return nil
+}
+
+func (mb *MapBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	k := digestutil.Format(digest)
+	delete(mb.data, k)
+	delete(mb.modified, k)
+	return nil
+}
+
+func (mb *MapBlobstore) List(ctx context.Context, opts ...ListOption) (ListPage, error) {
+	o, err := newListOptions(opts)
+	if err != nil {
+		return ListPage{}, err
 	}
 
-	hash := sha256.New()
-	hash.Write(b)
+	keys := make([]string, 0, len(mb.data))
+	for k := range mb.data {
+		if k > o.cursor {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
 
-	if !bytes.Equal(hash.Sum(nil), info.Digest) {
-		return ErrDataInconsistent
+	page := ListPage{}
+	if len(keys) > o.limit {
+		keys = keys[:o.limit]
+		page.Cursor = keys[len(keys)-1]
+	}
+	for _, k := range keys {
+		digest, err := digestutil.Parse(k)
+		if err != nil {
+			return ListPage{}, fmt.Errorf("parsing digest: %w", err)
+		}
+		page.Objects = append(page.Objects, ObjectInfo{Digest: digest, Size: int64(len(mb.data[k])), ModTime: mb.modified[k]})
 	}
+	return page, nil
+}
 
+func (mb *MapBlobstore) Stat(ctx context.Context, digest multihash.Multihash) (ObjectInfo, error) {
 	k := digestutil.Format(digest)
-	mb.data[k] = b
+	b, ok := mb.data[k]
+	if !ok {
+		return ObjectInfo{}, store.ErrNotFound
+	}
+	return ObjectInfo{Digest: digest, Size: int64(len(b)), ModTime: mb.modified[k]}, nil
+}
 
+func (mb *MapBlobstore) Quarantine(ctx context.Context, digest multihash.Multihash) error {
+	k := digestutil.Format(digest)
+	b, ok := mb.data[k]
+	if !ok {
+		return store.ErrNotFound
+	}
+	mb.quarantined[k] = b
+	delete(mb.data, k)
+	delete(mb.modified, k)
 	return nil
 }
 
@@ -95,11 +141,16 @@ func (mb *MapBlobstore) FileSystem() http.FileSystem {
 }
 
 var _ Blobstore = (*MapBlobstore)(nil)
+var _ Lister = (*MapBlobstore)(nil)
+var _ Quarantiner = (*MapBlobstore)(nil)
 
 // NewMapBlobstore creates a [Blobstore] backed by an in-memory map.
 func NewMapBlobstore() *MapBlobstore {
-	data := map[string][]byte{}
-	return &MapBlobstore{data}
+	return &MapBlobstore{
+		data:        map[string][]byte{},
+		modified:    map[string]time.Time{},
+		quarantined: map[string][]byte{},
+	}
 }
 
 type mapDir struct {
@@ -0,0 +1,381 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store"
+)
+
+// ErrInsufficientSpace is returned when no volume has enough space available
+// to store a blob.
+var ErrInsufficientSpace = errors.New("insufficient space")
+
+// drainingMarker is the file written to the root of a volume that is being
+// drained, so that draining continues to exclude it from placement after a
+// restart.
+const drainingMarker = "DRAINING"
+
+type volume struct {
+	path     string
+	store    *FsBlobstore
+	draining bool
+}
+
+// MultiFsBlobstore is a [Blobstore] that spans multiple filesystem volumes,
+// for example one per disk. Each new blob is placed on the volume with the
+// most available space, and reads find a blob on any volume.
+type MultiFsBlobstore struct {
+	mu        sync.RWMutex
+	volumes   []*volume
+	available func(path string) (uint64, error)
+}
+
+// NewMultiFsBlobstore creates a [Blobstore] spanning the passed volume paths.
+// Blobs are stored in a "blobs" directory within each volume, and uploads are
+// staged in a "tmp" directory on the same volume so they can be moved into
+// place without copying. Volumes that were being drained when the store was
+// last used remain excluded from placement.
+func NewMultiFsBlobstore(paths ...string) (*MultiFsBlobstore, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("at least one volume is required")
+	}
+	var volumes []*volume
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		if slices.ContainsFunc(volumes, func(v *volume) bool { return v.path == p }) {
+			return nil, fmt.Errorf("duplicate volume: %s", p)
+		}
+		s, err := NewFsBlobstore(filepath.Join(p, "blobs"), filepath.Join(p, "tmp"))
+		if err != nil {
+			return nil, fmt.Errorf("creating blobstore for volume %s: %w", p, err)
+		}
+		_, err = os.Stat(filepath.Join(p, drainingMarker))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("checking draining state of volume %s: %w", p, err)
+		}
+		volumes = append(volumes, &volume{path: p, store: s, draining: err == nil})
+	}
+	return &MultiFsBlobstore{volumes: volumes, available: availableSpace}, nil
+}
+
+func (m *MultiFsBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
+	// replace an existing copy in place rather than storing a second one,
+	// unless it is on a volume being drained
+	v, err := m.locate(ctx, digest)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if v != nil && !m.isDraining(v) {
+		return v.store.Put(ctx, digest, size, body, opts...)
+	}
+
+	dest, err := m.place(size)
+	if err != nil {
+		return err
+	}
+	err = dest.store.Put(ctx, digest, size, body, opts...)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		return v.store.Delete(ctx, digest)
+	}
+	return nil
+}
+
+func (m *MultiFsBlobstore) Get(ctx context.Context, digest multihash.Multihash, opts ...GetOption) (Object, error) {
+	for _, v := range m.snapshot() {
+		obj, err := v.store.Get(ctx, digest, opts...)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		return obj, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func (m *MultiFsBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	var errs error
+	for _, v := range m.snapshot() {
+		errs = errors.Join(errs, v.store.Delete(ctx, digest))
+	}
+	return errs
+}
+
+func (m *MultiFsBlobstore) Stat(ctx context.Context, digest multihash.Multihash) (ObjectInfo, error) {
+	v, err := m.locate(ctx, digest)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return v.store.Stat(ctx, digest)
+}
+
+// List retrieves a page of blobs across all volumes.
+func (m *MultiFsBlobstore) List(ctx context.Context, opts ...ListOption) (ListPage, error) {
+	o, err := newListOptions(opts)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	// the first page of each volume contains the first page overall
+	var objects []ObjectInfo
+	more := false
+	for _, v := range m.snapshot() {
+		page, err := v.store.List(ctx, WithCursor(o.cursor), WithLimit(o.limit))
+		if err != nil {
+			return ListPage{}, fmt.Errorf("listing volume %s: %w", v.path, err)
+		}
+		objects = append(objects, page.Objects...)
+		more = more || page.Cursor != ""
+	}
+
+	slices.SortFunc(objects, func(a, b ObjectInfo) int {
+		return compareDigests(a.Digest, b.Digest)
+	})
+	objects = slices.CompactFunc(objects, func(a, b ObjectInfo) bool {
+		return compareDigests(a.Digest, b.Digest) == 0
+	})
+
+	page := ListPage{Objects: objects}
+	if len(objects) > o.limit {
+		page.Objects = objects[:o.limit]
+		more = true
+	}
+	if more && len(page.Objects) > 0 {
+		page.Cursor = digestutil.Format(page.Objects[len(page.Objects)-1].Digest)
+	}
+	return page, nil
+}
+
+func (m *MultiFsBlobstore) Quarantine(ctx context.Context, digest multihash.Multihash) error {
+	v, err := m.locate(ctx, digest)
+	if err != nil {
+		return err
+	}
+	return v.store.Quarantine(ctx, digest)
+}
+
+// Space returns the storage used across every volume, and the space
+// available on volumes that are not being drained.
+func (m *MultiFsBlobstore) Space(ctx context.Context) (Space, error) {
+	var total Space
+	for _, v := range m.snapshot() {
+		sp, err := v.store.Space(ctx)
+		if err != nil {
+			return Space{}, fmt.Errorf("getting space for volume %s: %w", v.path, err)
+		}
+		total.Used += sp.Used
+		if !m.isDraining(v) {
+			total.Available += sp.Available
+		}
+	}
+	return total, nil
+}
+
+// TempDir returns the tmp directory of the first volume. Callers staging data
+// for a blob should use [MultiFsBlobstore.StagingDir] so that it is kept on the
+// volume the blob will be placed on.
+func (m *MultiFsBlobstore) TempDir() string {
+	return m.snapshot()[0].store.TempDir()
+}
+
+// StagingDirs returns the tmp directory of every volume.
+func (m *MultiFsBlobstore) StagingDirs() []string {
+	var dirs []string
+	for _, v := range m.snapshot() {
+		dirs = append(dirs, v.store.TempDir())
+	}
+	return dirs
+}
+
+// StagingDir returns the tmp directory of the volume a blob of the passed size
+// would be placed on.
+func (m *MultiFsBlobstore) StagingDir(size uint64) (string, error) {
+	v, err := m.place(size)
+	if err != nil {
+		return "", err
+	}
+	return v.store.TempDir(), nil
+}
+
+// FileSystem returns a filesystem interface for reading blobs from any volume.
+func (m *MultiFsBlobstore) FileSystem() http.FileSystem {
+	var dirs multiFsDir
+	for _, v := range m.snapshot() {
+		dirs = append(dirs, v.store.FileSystem())
+	}
+	return dirs
+}
+
+// Drain stops new blobs being placed on the volume at the passed path and
+// moves the blobs it holds to the other volumes. Once it returns without
+// error the volume is empty and may be removed from the configuration. It is
+// safe to call again if draining fails part way through. The draining state
+// is recorded on the volume, so it stays excluded from placement after a
+// restart until the volume is removed from the configuration.
+func (m *MultiFsBlobstore) Drain(ctx context.Context, path string) error {
+	path = filepath.Clean(path)
+	m.mu.Lock()
+	idx := slices.IndexFunc(m.volumes, func(v *volume) bool { return v.path == path })
+	if idx < 0 {
+		m.mu.Unlock()
+		return fmt.Errorf("unknown volume: %s", path)
+	}
+	src := m.volumes[idx]
+	m.mu.Unlock()
+
+	err := os.WriteFile(filepath.Join(path, drainingMarker), nil, 0644)
+	if err != nil {
+		return fmt.Errorf("marking volume %s as draining: %w", path, err)
+	}
+	m.mu.Lock()
+	src.draining = true
+	m.mu.Unlock()
+
+	// collect first so paging is not disturbed by removals
+	var objects []ObjectInfo
+	err = ListAll(ctx, src.store, func(obj ObjectInfo) error {
+		objects = append(objects, obj)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing volume %s: %w", path, err)
+	}
+
+	for _, obj := range objects {
+		err := m.move(ctx, src, obj)
+		if err != nil {
+			return fmt.Errorf("moving blob %s: %w", digestutil.Format(obj.Digest), err)
+		}
+	}
+	return nil
+}
+
+func (m *MultiFsBlobstore) move(ctx context.Context, src *volume, obj ObjectInfo) error {
+	dest, err := m.place(uint64(obj.Size))
+	if err != nil {
+		return err
+	}
+	o, err := src.store.Get(ctx, obj.Digest)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil // removed since it was listed
+		}
+		return err
+	}
+	// the bytes are moved as they are stored, which may not be what the digest
+	// hashes to, for example when the blobs are encrypted
+	body := o.Body()
+	err = dest.store.Put(ctx, obj.Digest, uint64(obj.Size), body, WithoutVerification())
+	// stop reading the source if the write did not consume it
+	if c, ok := body.(io.Closer); ok {
+		c.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("writing to volume %s: %w", dest.path, err)
+	}
+	return src.store.Delete(ctx, obj.Digest)
+}
+
+// locate finds the volume holding the blob, returning [store.ErrNotFound] if
+// none do.
+func (m *MultiFsBlobstore) locate(ctx context.Context, digest multihash.Multihash) (*volume, error) {
+	for _, v := range m.snapshot() {
+		_, err := v.store.Stat(ctx, digest)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+// place selects the volume with the most available space that is not being
+// drained.
+func (m *MultiFsBlobstore) place(size uint64) (*volume, error) {
+	var best *volume
+	var bestAvail uint64
+	var errs error
+	for _, v := range m.snapshot() {
+		if m.isDraining(v) {
+			continue
+		}
+		avail, err := m.available(v.path)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("getting available space for volume %s: %w", v.path, err))
+			continue
+		}
+		if best == nil || avail > bestAvail {
+			best, bestAvail = v, avail
+		}
+	}
+	if best == nil {
+		if errs != nil {
+			return nil, errs
+		}
+		return nil, errors.New("no volumes available for placement")
+	}
+	if bestAvail < size {
+		return nil, ErrInsufficientSpace
+	}
+	return best, nil
+}
+
+func (m *MultiFsBlobstore) snapshot() []*volume {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.volumes)
+}
+
+func (m *MultiFsBlobstore) isDraining(v *volume) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return v.draining
+}
+
+func compareDigests(a, b multihash.Multihash) int {
+	return strings.Compare(digestutil.Format(a), digestutil.Format(b))
+}
+
+var _ Blobstore = (*MultiFsBlobstore)(nil)
+var _ Lister = (*MultiFsBlobstore)(nil)
+var _ Quarantiner = (*MultiFsBlobstore)(nil)
+var _ FileSystemer = (*MultiFsBlobstore)(nil)
+var _ TempDirer = (*MultiFsBlobstore)(nil)
+var _ SpaceReporter = (*MultiFsBlobstore)(nil)
+var _ Stager = (*MultiFsBlobstore)(nil)
+
+// multiFsDir serves a file from the first filesystem that has it.
+type multiFsDir []http.FileSystem
+
+func (d multiFsDir) Open(name string) (http.File, error) {
+	for _, fsys := range d {
+		f, err := fsys.Open(name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		return f, nil
+	}
+	return nil, fs.ErrNotExist
+}
@@ -0,0 +1,215 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+)
+
+func TestMultiFsBlobstore(t *testing.T) {
+	t.Run("places blob on volume with most available space", func(t *testing.T) {
+		s, paths := newMultiFsBlobstore(t, 3)
+		space := map[string]uint64{paths[0]: 10, paths[1]: 1000, paths[2]: 100}
+		s.available = func(p string) (uint64, error) { return space[p], nil }
+
+		data, digest := randomBlob(t)
+		err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+		require.NoError(t, err)
+
+		requireOnVolume(t, s, digest, paths[1])
+
+		obj, err := s.Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+
+		f, err := s.FileSystem().Open(fmt.Sprintf("/%s", digestutil.Format(digest)))
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(f))(t))
+	})
+
+	t.Run("insufficient space", func(t *testing.T) {
+		s, _ := newMultiFsBlobstore(t, 2)
+		s.available = func(p string) (uint64, error) { return 5, nil }
+
+		data, digest := randomBlob(t)
+		err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+		require.ErrorIs(t, err, ErrInsufficientSpace)
+	})
+
+	t.Run("lists blobs across volumes", func(t *testing.T) {
+		s, paths := newMultiFsBlobstore(t, 2)
+		var expected []string
+		for i := range 6 {
+			// alternate placement between the volumes
+			target := paths[i%2]
+			s.available = func(p string) (uint64, error) {
+				if p == target {
+					return 1000, nil
+				}
+				return 100, nil
+			}
+			data, digest := randomBlob(t)
+			require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+			expected = append(expected, digestutil.Format(digest))
+		}
+
+		var actual []string
+		cursor := ""
+		for {
+			page, err := s.List(context.Background(), WithCursor(cursor), WithLimit(4))
+			require.NoError(t, err)
+			for _, obj := range page.Objects {
+				actual = append(actual, digestutil.Format(obj.Digest))
+			}
+			if page.Cursor == "" {
+				break
+			}
+			cursor = page.Cursor
+		}
+		require.ElementsMatch(t, expected, actual)
+		require.IsIncreasing(t, actual)
+	})
+
+	t.Run("drains volume", func(t *testing.T) {
+		s, paths := newMultiFsBlobstore(t, 2)
+		s.available = func(p string) (uint64, error) {
+			if p == paths[0] {
+				return 1000, nil
+			}
+			return 100, nil
+		}
+
+		var digests []multihash.Multihash
+		for range 3 {
+			data, digest := randomBlob(t)
+			require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+			requireOnVolume(t, s, digest, paths[0])
+			digests = append(digests, digest)
+		}
+
+		err := s.Drain(context.Background(), paths[0])
+		require.NoError(t, err)
+
+		for _, digest := range digests {
+			requireOnVolume(t, s, digest, paths[1])
+		}
+
+		// new blobs are not placed on a draining volume
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		requireOnVolume(t, s, digest, paths[1])
+
+		// draining is remembered after a restart
+		s, err = NewMultiFsBlobstore(paths...)
+		require.NoError(t, err)
+		s.available = func(p string) (uint64, error) { return 1000, nil }
+		data, digest = randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		requireOnVolume(t, s, digest, paths[1])
+	})
+
+	t.Run("drains encrypted blobs", func(t *testing.T) {
+		s, paths := newMultiFsBlobstore(t, 2)
+		s.available = func(p string) (uint64, error) {
+			if p == paths[0] {
+				return 1000, nil
+			}
+			return 100, nil
+		}
+		es := testutil.Must(NewEncryptedBlobstore(s, testutil.RandomBytes(t, EncryptionKeySize)))(t)
+
+		data, digest := randomBlob(t)
+		require.NoError(t, es.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		requireOnVolume(t, s, digest, paths[0])
+
+		require.NoError(t, s.Drain(context.Background(), paths[0]))
+		requireOnVolume(t, s, digest, paths[1])
+
+		obj, err := es.Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+	})
+
+	t.Run("does not rewrite blobs on a draining volume", func(t *testing.T) {
+		s, paths := newMultiFsBlobstore(t, 2)
+		s.available = func(p string) (uint64, error) {
+			if p == paths[0] {
+				return 1000, nil
+			}
+			return 100, nil
+		}
+
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		requireOnVolume(t, s, digest, paths[0])
+
+		s.volumes[0].draining = true
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		requireOnVolume(t, s, digest, paths[1])
+		_, err := s.volumes[0].store.Stat(context.Background(), digest)
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+
+	t.Run("stages blobs on the volume they will be placed on", func(t *testing.T) {
+		s, paths := newMultiFsBlobstore(t, 3)
+		space := map[string]uint64{paths[0]: 10, paths[1]: 1000, paths[2]: 100}
+		s.available = func(p string) (uint64, error) { return space[p], nil }
+
+		require.Len(t, s.StagingDirs(), 3)
+		dir, err := s.StagingDir(50)
+		require.NoError(t, err)
+		require.Equal(t, s.volumes[1].store.TempDir(), dir)
+
+		require.NoError(t, s.Drain(context.Background(), paths[1]))
+		dir, err = s.StagingDir(50)
+		require.NoError(t, err)
+		require.Equal(t, s.volumes[2].store.TempDir(), dir)
+
+		_, err = s.StagingDir(500)
+		require.ErrorIs(t, err, ErrInsufficientSpace)
+	})
+
+	t.Run("delete removes from all volumes", func(t *testing.T) {
+		s, _ := newMultiFsBlobstore(t, 2)
+		s.available = func(p string) (uint64, error) { return 1000, nil }
+
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		require.NoError(t, s.Delete(context.Background(), digest))
+
+		_, err := s.Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+	})
+}
+
+func newMultiFsBlobstore(t *testing.T, n int) (*MultiFsBlobstore, []string) {
+	var paths []string
+	for range n {
+		paths = append(paths, t.TempDir())
+	}
+	s, err := NewMultiFsBlobstore(paths...)
+	require.NoError(t, err)
+	return s, paths
+}
+
+func randomBlob(t *testing.T) ([]byte, multihash.Multihash) {
+	data := testutil.RandomBytes(t, 10)
+	digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+	return data, digest
+}
+
+func requireOnVolume(t *testing.T, s *MultiFsBlobstore, digest multihash.Multihash, path string) {
+	v, err := s.locate(context.Background(), digest)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Clean(path), v.path)
+}
@@ -0,0 +1,807 @@
+package blobstore
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store"
+)
+
+const (
+	// DefaultMaxSegmentSize is the default size at which a new segment file is
+	// started.
+	DefaultMaxSegmentSize = 1024 * 1024 * 1024
+	// DefaultCompactionThreshold is the default proportion of a segment that
+	// must be deleted data before it is compacted.
+	DefaultCompactionThreshold = 0.5
+
+	segmentExt = ".pack"
+	// maxInMemoryPut is the largest blob that is verified in memory before
+	// being appended to a segment. Larger blobs are staged on disk.
+	maxInMemoryPut = 4 * 1024 * 1024
+)
+
+// Compacter reclaims space occupied by deleted objects.
+type Compacter interface {
+	// Compact rewrites storage to reclaim space occupied by deleted objects.
+	Compact(ctx context.Context) error
+}
+
+// PackOption is an option configuring a [PackBlobstore].
+type PackOption func(cfg *packOptions) error
+
+type packOptions struct {
+	maxSegmentSize      uint64
+	compactionThreshold float64
+}
+
+// WithMaxSegmentSize configures the size at which a new segment file is
+// started. Blobs larger than this are stored in a segment of their own.
+func WithMaxSegmentSize(size uint64) PackOption {
+	return func(opts *packOptions) error {
+		if size == 0 {
+			return errors.New("max segment size must be greater than zero")
+		}
+		opts.maxSegmentSize = size
+		return nil
+	}
+}
+
+// WithCompactionThreshold configures the proportion (between 0 and 1) of a
+// segment that must be deleted data before it is compacted.
+func WithCompactionThreshold(threshold float64) PackOption {
+	return func(opts *packOptions) error {
+		if threshold <= 0 || threshold > 1 {
+			return errors.New("compaction threshold must be greater than 0 and at most 1")
+		}
+		opts.compactionThreshold = threshold
+		return nil
+	}
+}
+
+// packEntry is the location of a blob within a segment.
+type packEntry struct {
+	segment  uint64
+	offset   uint64
+	length   uint64
+	modified time.Time
+}
+
+func (e packEntry) encode() []byte {
+	var b []byte
+	b = binary.AppendUvarint(b, e.segment)
+	b = binary.AppendUvarint(b, e.offset)
+	b = binary.AppendUvarint(b, e.length)
+	b = binary.AppendVarint(b, e.modified.UnixNano())
+	return b
+}
+
+func decodePackEntry(b []byte) (packEntry, error) {
+	r := bytes.NewReader(b)
+	segment, err := binary.ReadUvarint(r)
+	if err != nil {
+		return packEntry{}, fmt.Errorf("reading segment: %w", err)
+	}
+	offset, err := binary.ReadUvarint(r)
+	if err != nil {
+		return packEntry{}, fmt.Errorf("reading offset: %w", err)
+	}
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return packEntry{}, fmt.Errorf("reading length: %w", err)
+	}
+	modified, err := binary.ReadVarint(r)
+	if err != nil {
+		return packEntry{}, fmt.Errorf("reading modification time: %w", err)
+	}
+	return packEntry{segment, offset, length, time.Unix(0, modified)}, nil
+}
+
+// segmentInfo tracks the size of a segment and how much of it is referenced by
+// the index.
+type segmentInfo struct {
+	size uint64
+	live uint64
+}
+
+// PackBlobstore is a [Blobstore] that appends blobs to large segment files
+// rather than storing each in a file of its own, and keeps an index of where
+// each blob is in a datastore. It is suited to storing very many small blobs.
+//
+// Deleting a blob only removes it from the index. The space it occupied is
+// reclaimed by [PackBlobstore.Compact].
+type PackBlobstore struct {
+	rootdir   string
+	tmpdir    string
+	index     datastore.Datastore
+	maxSize   uint64
+	threshold float64
+
+	mu       sync.RWMutex
+	active   uint64
+	last     uint64
+	segments map[uint64]*segmentInfo
+	// retired segments have been compacted, but are kept until the next
+	// compaction so that in progress reads can complete.
+	retired []uint64
+	// compacting serialises compactions, which copy data without holding mu.
+	compacting sync.Mutex
+}
+
+// NewPackBlobstore creates a [Blobstore] that stores segment files in the
+// passed directory, and the index of blob locations in the passed datastore.
+func NewPackBlobstore(rootdir string, index datastore.Datastore, opts ...PackOption) (*PackBlobstore, error) {
+	o := &packOptions{
+		maxSegmentSize:      DefaultMaxSegmentSize,
+		compactionThreshold: DefaultCompactionThreshold,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	tmpdir := filepath.Join(rootdir, "tmp")
+	err := os.MkdirAll(tmpdir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("root directory not writable: %w", err)
+	}
+
+	p := &PackBlobstore{
+		rootdir:   rootdir,
+		tmpdir:    tmpdir,
+		index:     index,
+		maxSize:   o.maxSegmentSize,
+		threshold: o.compactionThreshold,
+		segments:  map[uint64]*segmentInfo{},
+	}
+
+	err = p.load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// load discovers the segment files and the live data within them, removing
+// segments no longer referenced by the index.
+func (p *PackBlobstore) load(ctx context.Context) error {
+	dirents, err := os.ReadDir(p.rootdir)
+	if err != nil {
+		return fmt.Errorf("reading root directory: %w", err)
+	}
+	for _, d := range dirents {
+		id, ok := parseSegmentName(d.Name())
+		if !ok {
+			continue
+		}
+		inf, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("stat segment: %w", err)
+		}
+		p.segments[id] = &segmentInfo{size: uint64(inf.Size())}
+		p.active = max(p.active, id)
+	}
+
+	err = p.forEachEntry(ctx, func(_ string, e packEntry) error {
+		seg, ok := p.segments[e.segment]
+		if !ok {
+			return fmt.Errorf("index references missing segment %d", e.segment)
+		}
+		seg.live += e.length
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for id, seg := range p.segments {
+		if seg.live == 0 && id != p.active {
+			err := os.Remove(p.segmentPath(id))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("removing unreferenced segment: %w", err)
+			}
+			delete(p.segments, id)
+		}
+	}
+	p.last = p.active
+	if _, ok := p.segments[p.active]; !ok {
+		p.active = p.nextSegment()
+		p.segments[p.active] = &segmentInfo{}
+	}
+	return nil
+}
+
+func (p *PackBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
+	vr, err := NewPutReader(body, digest, size, opts...)
+	if err != nil {
+		return err
+	}
+
+	// verify the data before taking the write lock, so that slow uploads do
+	// not block other writes
+	var staged io.Reader
+	if size <= maxInMemoryPut {
+		b, err := io.ReadAll(vr)
+		if err != nil {
+			if isVerificationError(err) {
+				return err
+			}
+			return fmt.Errorf("reading body: %w", err)
+		}
+		staged = bytes.NewReader(b)
+	} else {
+		f, err := os.CreateTemp(p.tmpdir, "put-*")
+		if err != nil {
+			return fmt.Errorf("creating file: %w", err)
+		}
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+		_, err = io.Copy(f, vr)
+		if err != nil {
+			if isVerificationError(err) {
+				return err
+			}
+			return fmt.Errorf("writing file: %w", err)
+		}
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return fmt.Errorf("seeking file: %w", err)
+		}
+		staged = f
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// replacing a blob leaves its previous copy as garbage
+	prev, err := p.getEntry(ctx, digest)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	entry, err := p.append(staged, size)
+	if err != nil {
+		return err
+	}
+	err = p.index.Put(ctx, packKey(digest), entry.encode())
+	if err != nil {
+		return fmt.Errorf("writing index: %w", err)
+	}
+	p.segments[entry.segment].live += entry.length
+	if prev != nil {
+		p.segments[prev.segment].live -= prev.length
+	}
+	return nil
+}
+
+// append writes the data to the end of the active segment, starting a new
+// segment if it would exceed the maximum size. Must be called with the write
+// lock held.
+func (p *PackBlobstore) append(r io.Reader, size uint64) (packEntry, error) {
+	seg := p.segments[p.active]
+	if seg.size > 0 && seg.size+size > p.maxSize {
+		p.active = p.nextSegment()
+		seg = &segmentInfo{}
+		p.segments[p.active] = seg
+	}
+
+	f, err := os.OpenFile(p.segmentPath(p.active), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return packEntry{}, fmt.Errorf("opening segment: %w", err)
+	}
+	defer f.Close()
+
+	w := io.NewOffsetWriter(f, int64(seg.size))
+	written, err := io.Copy(w, r)
+	if err != nil || uint64(written) != size {
+		// discard the partial write
+		f.Truncate(int64(seg.size))
+		if err == nil {
+			err = fmt.Errorf("wrote %d of %d bytes", written, size)
+		}
+		return packEntry{}, fmt.Errorf("writing segment: %w", err)
+	}
+
+	entry := packEntry{segment: p.active, offset: seg.size, length: size, modified: time.Now()}
+	seg.size += size
+	return entry, nil
+}
+
+// nextSegment allocates the ID of a new segment. Must be called with the
+// write lock held.
+func (p *PackBlobstore) nextSegment() uint64 {
+	p.last++
+	return p.last
+}
+
+func (p *PackBlobstore) Get(ctx context.Context, digest multihash.Multihash, opts ...GetOption) (Object, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	p.mu.RLock()
+	entry, err := p.getEntry(ctx, digest)
+	p.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return PackObject{name: p.segmentPath(entry.segment), entry: *entry, byteRange: o.byteRange}, nil
+}
+
+func (p *PackBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, err := p.getEntry(ctx, digest)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	err = p.index.Delete(ctx, packKey(digest))
+	if err != nil {
+		return fmt.Errorf("deleting from index: %w", err)
+	}
+	p.segments[entry.segment].live -= entry.length
+	return nil
+}
+
+func (p *PackBlobstore) Stat(ctx context.Context, digest multihash.Multihash) (ObjectInfo, error) {
+	p.mu.RLock()
+	entry, err := p.getEntry(ctx, digest)
+	p.mu.RUnlock()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Digest: digest, Size: int64(entry.length), ModTime: entry.modified}, nil
+}
+
+func (p *PackBlobstore) List(ctx context.Context, opts ...ListOption) (ListPage, error) {
+	o, err := newListOptions(opts)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	q := query.Query{
+		Orders: []query.Order{query.OrderByKey{}},
+		// fetch one extra to determine if there are more results
+		Limit: o.limit + 1,
+	}
+	if o.cursor != "" {
+		q.Filters = []query.Filter{query.FilterKeyCompare{Op: query.GreaterThan, Key: datastore.NewKey(o.cursor).String()}}
+	}
+	results, err := p.index.Query(ctx, q)
+	if err != nil {
+		return ListPage{}, fmt.Errorf("querying index: %w", err)
+	}
+	defer results.Close()
+
+	page := ListPage{}
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return ListPage{}, fmt.Errorf("iterating index: %w", entry.Error)
+		}
+		if len(page.Objects) == o.limit {
+			page.Cursor = digestutil.Format(page.Objects[len(page.Objects)-1].Digest)
+			break
+		}
+		digest, err := digestutil.Parse(datastore.RawKey(entry.Key).BaseNamespace())
+		if err != nil {
+			return ListPage{}, fmt.Errorf("parsing digest: %w", err)
+		}
+		e, err := decodePackEntry(entry.Value)
+		if err != nil {
+			return ListPage{}, fmt.Errorf("decoding index entry: %w", err)
+		}
+		page.Objects = append(page.Objects, ObjectInfo{Digest: digest, Size: int64(e.length), ModTime: e.modified})
+	}
+	return page, nil
+}
+
+// Compact rewrites segments in which the proportion of deleted data exceeds the
+// compaction threshold, copying their remaining blobs to new segments.
+// Copying is done without blocking reads or writes, and a blob written or
+// deleted while it is being copied keeps its new state. Compacted segments
+// are removed by the following compaction, so that reads in progress can
+// complete.
+func (p *PackBlobstore) Compact(ctx context.Context) error {
+	p.compacting.Lock()
+	defer p.compacting.Unlock()
+
+	p.mu.Lock()
+	for _, id := range p.retired {
+		err := os.Remove(p.segmentPath(id))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			p.mu.Unlock()
+			return fmt.Errorf("removing compacted segment: %w", err)
+		}
+	}
+	p.retired = nil
+
+	candidates := map[uint64]bool{}
+	for id, seg := range p.segments {
+		if id == p.active || seg.size == 0 {
+			continue
+		}
+		if float64(seg.size-seg.live)/float64(seg.size) >= p.threshold {
+			candidates[id] = true
+		}
+	}
+	p.mu.Unlock()
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var live []movedEntry
+	err := p.forEachEntry(ctx, func(key string, e packEntry) error {
+		if candidates[e.segment] {
+			live = append(live, movedEntry{key: key, from: e})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(live, func(a, b movedEntry) int {
+		if a.from.segment != b.from.segment {
+			return cmp.Compare(a.from.segment, b.from.segment)
+		}
+		return cmp.Compare(a.from.offset, b.from.offset)
+	})
+
+	moved, targets, err := p.copyEntries(live)
+	if err != nil {
+		for id := range targets {
+			os.Remove(p.segmentPath(id))
+		}
+		return fmt.Errorf("copying live blobs: %w", err)
+	}
+	return p.swap(ctx, candidates, moved, targets)
+}
+
+// movedEntry is a blob being moved from one segment to another by compaction.
+type movedEntry struct {
+	key  string
+	from packEntry
+	to   packEntry
+}
+
+// copyEntries copies the blobs to new segments, which are not yet known to
+// readers or writers and so are written without holding the lock. It returns
+// the sizes of the segments written.
+func (p *PackBlobstore) copyEntries(entries []movedEntry) ([]movedEntry, map[uint64]uint64, error) {
+	targets := map[uint64]uint64{}
+	var dest *os.File
+	var destID, destSize uint64
+	defer func() {
+		if dest != nil {
+			dest.Close()
+		}
+	}()
+
+	var src *os.File
+	var srcID uint64
+	defer func() {
+		if src != nil {
+			src.Close()
+		}
+	}()
+
+	for i, e := range entries {
+		if src == nil || srcID != e.from.segment {
+			if src != nil {
+				src.Close()
+			}
+			f, err := os.Open(p.segmentPath(e.from.segment))
+			if err != nil {
+				return nil, targets, fmt.Errorf("opening segment: %w", err)
+			}
+			src, srcID = f, e.from.segment
+		}
+
+		if dest == nil || (destSize > 0 && destSize+e.from.length > p.maxSize) {
+			if dest != nil {
+				dest.Close()
+			}
+			p.mu.Lock()
+			destID = p.nextSegment()
+			p.mu.Unlock()
+			f, err := os.OpenFile(p.segmentPath(destID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return nil, targets, fmt.Errorf("creating segment: %w", err)
+			}
+			dest, destSize = f, 0
+			targets[destID] = 0
+		}
+
+		r := io.NewSectionReader(src, int64(e.from.offset), int64(e.from.length))
+		written, err := io.Copy(dest, r)
+		if err != nil {
+			return nil, targets, fmt.Errorf("writing segment: %w", err)
+		}
+		if uint64(written) != e.from.length {
+			return nil, targets, fmt.Errorf("wrote %d of %d bytes", written, e.from.length)
+		}
+		entries[i].to = packEntry{segment: destID, offset: destSize, length: e.from.length, modified: e.from.modified}
+		destSize += e.from.length
+		targets[destID] = destSize
+	}
+	return entries, targets, nil
+}
+
+// swap points the index at the copied blobs, skipping any written or deleted
+// since they were copied, and retires the compacted segments.
+func (p *PackBlobstore) swap(ctx context.Context, compacted map[uint64]bool, moved []movedEntry, targets map[uint64]uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, size := range targets {
+		p.segments[id] = &segmentInfo{size: size}
+	}
+	for _, m := range moved {
+		b, err := p.index.Get(ctx, datastore.NewKey(m.key))
+		if err != nil {
+			if errors.Is(err, datastore.ErrNotFound) {
+				continue
+			}
+			return fmt.Errorf("reading index: %w", err)
+		}
+		current, err := decodePackEntry(b)
+		if err != nil {
+			return fmt.Errorf("decoding index entry: %w", err)
+		}
+		if current.segment != m.from.segment || current.offset != m.from.offset {
+			continue
+		}
+		err = p.index.Put(ctx, datastore.NewKey(m.key), m.to.encode())
+		if err != nil {
+			return fmt.Errorf("writing index: %w", err)
+		}
+		p.segments[m.to.segment].live += m.to.length
+	}
+
+	for id := range compacted {
+		delete(p.segments, id)
+		p.retired = append(p.retired, id)
+	}
+	return nil
+}
+
+// Space returns the size of every segment, including bytes of deleted blobs
+// not yet reclaimed by compaction, and the space available on the filesystem
+// containing the root directory.
+func (p *PackBlobstore) Space(ctx context.Context) (Space, error) {
+	var used uint64
+	p.mu.RLock()
+	for _, seg := range p.segments {
+		used += seg.size
+	}
+	p.mu.RUnlock()
+	avail, err := availableSpace(p.rootdir)
+	if err != nil {
+		return Space{}, fmt.Errorf("getting available space: %w", err)
+	}
+	return Space{Used: used, Available: avail}, nil
+}
+
+// TempDir returns the directory large blobs are staged in before being
+// appended to a segment.
+func (p *PackBlobstore) TempDir() string {
+	return p.tmpdir
+}
+
+// FileSystem returns a filesystem interface for reading blobs, which supports
+// seeking and so serves HTTP range requests.
+func (p *PackBlobstore) FileSystem() http.FileSystem {
+	return &packDir{p}
+}
+
+func (p *PackBlobstore) getEntry(ctx context.Context, digest multihash.Multihash) (*packEntry, error) {
+	b, err := p.index.Get(ctx, packKey(digest))
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("reading index: %w", err)
+	}
+	e, err := decodePackEntry(b)
+	if err != nil {
+		return nil, fmt.Errorf("decoding index entry: %w", err)
+	}
+	return &e, nil
+}
+
+func (p *PackBlobstore) forEachEntry(ctx context.Context, fn func(key string, e packEntry) error) error {
+	results, err := p.index.Query(ctx, query.Query{})
+	if err != nil {
+		return fmt.Errorf("querying index: %w", err)
+	}
+	defer results.Close()
+
+	for r := range results.Next() {
+		if r.Error != nil {
+			return fmt.Errorf("iterating index: %w", r.Error)
+		}
+		e, err := decodePackEntry(r.Value)
+		if err != nil {
+			return fmt.Errorf("decoding index entry: %w", err)
+		}
+		err = fn(r.Key, e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PackBlobstore) segmentPath(id uint64) string {
+	return filepath.Join(p.rootdir, fmt.Sprintf("%016d%s", id, segmentExt))
+}
+
+func parseSegmentName(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, segmentExt) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+func packKey(digest multihash.Multihash) datastore.Key {
+	return datastore.NewKey(digestutil.Format(digest))
+}
+
+var _ Blobstore = (*PackBlobstore)(nil)
+var _ Lister = (*PackBlobstore)(nil)
+var _ FileSystemer = (*PackBlobstore)(nil)
+var _ Compacter = (*PackBlobstore)(nil)
+var _ TempDirer = (*PackBlobstore)(nil)
+var _ SpaceReporter = (*PackBlobstore)(nil)
+
+type PackObject struct {
+	name      string
+	entry     packEntry
+	byteRange Range
+}
+
+func (o PackObject) Size() int64 {
+	return int64(o.entry.length)
+}
+
+func (o PackObject) Body() io.Reader {
+	f, err := os.Open(o.name)
+	if err != nil {
+		r, w := io.Pipe()
+		w.CloseWithError(err)
+		return r
+	}
+
+	offset := o.entry.offset + o.byteRange.Offset
+	length := o.entry.length - min(o.byteRange.Offset, o.entry.length)
+	if o.byteRange.Length != nil {
+		length = min(length, *o.byteRange.Length)
+	}
+	return &packReader{r: io.NewSectionReader(f, int64(offset), int64(length)), f: f}
+}
+
+// packReader reads a blob from a segment file. The file is closed when the
+// reader is closed, or once it has been read to the end.
+type packReader struct {
+	r   io.Reader
+	f   *os.File
+	err error
+}
+
+func (c *packReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.r.Read(p)
+	if err != nil {
+		c.err = err
+		c.f.Close()
+	}
+	return n, err
+}
+
+func (c *packReader) Close() error {
+	if c.err != nil {
+		return nil
+	}
+	c.err = os.ErrClosed
+	return c.f.Close()
+}
+
+var _ io.ReadCloser = (*packReader)(nil)
+
+type packDir struct {
+	p *PackBlobstore
+}
+
+var _ http.FileSystem = (*packDir)(nil)
+
+func (d *packDir) Open(name string) (http.File, error) {
+	digest, err := digestutil.Parse(name[1:])
+	if err != nil {
+		return nil, fs.ErrNotExist
+	}
+	d.p.mu.RLock()
+	entry, err := d.p.getEntry(context.Background(), digest)
+	d.p.mu.RUnlock()
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	f, err := os.Open(d.p.segmentPath(entry.segment))
+	if err != nil {
+		return nil, err
+	}
+	return &packFile{
+		SectionReader: io.NewSectionReader(f, int64(entry.offset), int64(entry.length)),
+		f:             f,
+		info:          blobFileInfo{name: name[1:], size: int64(entry.length), modified: entry.modified},
+	}, nil
+}
+
+type packFile struct {
+	*io.SectionReader
+	f    *os.File
+	info fs.FileInfo
+}
+
+func (p *packFile) Close() error {
+	return p.f.Close()
+}
+
+func (p *packFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (p *packFile) Stat() (fs.FileInfo, error) {
+	return p.info, nil
+}
+
+var _ http.File = (*packFile)(nil)
+
+type blobFileInfo struct {
+	name     string
+	size     int64
+	modified time.Time
+}
+
+func (i blobFileInfo) Name() string       { return i.name }
+func (i blobFileInfo) Size() int64        { return i.size }
+func (i blobFileInfo) Mode() fs.FileMode  { return 0444 }
+func (i blobFileInfo) ModTime() time.Time { return i.modified }
+func (i blobFileInfo) IsDir() bool        { return false }
+func (i blobFileInfo) Sys() any           { return nil }
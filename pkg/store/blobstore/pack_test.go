@@ -0,0 +1,255 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+)
+
+func TestPackBlobstore(t *testing.T) {
+	t.Run("roundtrip", func(t *testing.T) {
+		s := testutil.Must(NewPackBlobstore(t.TempDir(), datastore.NewMapDatastore()))(t)
+
+		blobs := map[string][]byte{}
+		for range 10 {
+			data, digest := randomBlob(t)
+			err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+			require.NoError(t, err)
+			blobs[digestutil.Format(digest)] = data
+		}
+
+		for k, data := range blobs {
+			digest := testutil.Must(digestutil.Parse(k))(t)
+			obj, err := s.Get(context.Background(), digest)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(data)), obj.Size())
+			require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+		}
+	})
+
+	t.Run("ranged read", func(t *testing.T) {
+		s := testutil.Must(NewPackBlobstore(t.TempDir(), datastore.NewMapDatastore()))(t)
+
+		// surround the blob with others so reads past its bounds are detectable
+		for range 2 {
+			other, otherDigest := randomBlob(t)
+			err := s.Put(context.Background(), otherDigest, uint64(len(other)), bytes.NewReader(other))
+			require.NoError(t, err)
+		}
+		data, digest := randomBlob(t)
+		err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+		require.NoError(t, err)
+		other, otherDigest := randomBlob(t)
+		err = s.Put(context.Background(), otherDigest, uint64(len(other)), bytes.NewReader(other))
+		require.NoError(t, err)
+
+		length := uint64(4)
+		obj, err := s.Get(context.Background(), digest, WithRange(Range{Offset: 3, Length: &length}))
+		require.NoError(t, err)
+		require.Equal(t, data[3:7], testutil.Must(io.ReadAll(obj.Body()))(t))
+
+		obj, err = s.Get(context.Background(), digest, WithRange(Range{Offset: 5}))
+		require.NoError(t, err)
+		require.Equal(t, data[5:], testutil.Must(io.ReadAll(obj.Body()))(t))
+	})
+
+	t.Run("starts new segment at max size", func(t *testing.T) {
+		dir := t.TempDir()
+		s := testutil.Must(NewPackBlobstore(dir, datastore.NewMapDatastore(), WithMaxSegmentSize(25)))(t)
+
+		for range 5 {
+			data, digest := randomBlob(t)
+			err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+			require.NoError(t, err)
+		}
+		// 2 blobs of 10 bytes fit in each segment
+		require.Len(t, segmentFiles(t, dir), 3)
+	})
+
+	t.Run("compacts segments with deleted blobs", func(t *testing.T) {
+		dir := t.TempDir()
+		s := testutil.Must(NewPackBlobstore(dir, datastore.NewMapDatastore(), WithMaxSegmentSize(40)))(t)
+
+		var kept, deleted []multihash.Multihash
+		for i := range 8 {
+			data, digest := randomBlob(t)
+			err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+			require.NoError(t, err)
+			if i%4 == 0 {
+				kept = append(kept, digest)
+			} else {
+				deleted = append(deleted, digest)
+			}
+		}
+		files := segmentFiles(t, dir)
+		require.Len(t, files, 2)
+
+		for _, digest := range deleted {
+			require.NoError(t, s.Delete(context.Background(), digest))
+		}
+
+		err := s.Compact(context.Background())
+		require.NoError(t, err)
+		// compacted segments are kept until the following compaction, so that
+		// reads in progress can complete
+		require.FileExists(t, files[0])
+
+		err = s.Compact(context.Background())
+		require.NoError(t, err)
+		require.NoFileExists(t, files[0])
+
+		for _, digest := range kept {
+			obj, err := s.Get(context.Background(), digest)
+			require.NoError(t, err)
+			require.Len(t, testutil.Must(io.ReadAll(obj.Body()))(t), 10)
+		}
+		for _, digest := range deleted {
+			_, err := s.Get(context.Background(), digest)
+			require.Equal(t, store.ErrNotFound, err)
+		}
+	})
+
+	t.Run("keeps changes made while compacting", func(t *testing.T) {
+		dir := t.TempDir()
+		s := testutil.Must(NewPackBlobstore(dir, datastore.NewMapDatastore(), WithMaxSegmentSize(30)))(t)
+
+		var blobs [][]byte
+		var digests []multihash.Multihash
+		for range 4 {
+			data, digest := randomBlob(t)
+			require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+			blobs = append(blobs, data)
+			digests = append(digests, digest)
+		}
+
+		var live []movedEntry
+		err := s.forEachEntry(context.Background(), func(key string, e packEntry) error {
+			if e.segment == 1 {
+				live = append(live, movedEntry{key: key, from: e})
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, live, 3)
+		moved, targets, err := s.copyEntries(live)
+		require.NoError(t, err)
+
+		// delete one and rewrite another before the index is swapped
+		require.NoError(t, s.Delete(context.Background(), digests[0]))
+		require.NoError(t, s.Put(context.Background(), digests[1], uint64(len(blobs[1])), bytes.NewReader(blobs[1])))
+
+		require.NoError(t, s.swap(context.Background(), map[uint64]bool{1: true}, moved, targets))
+
+		_, err = s.Get(context.Background(), digests[0])
+		require.Equal(t, store.ErrNotFound, err)
+		entry := testutil.Must(s.getEntry(context.Background(), digests[1]))(t)
+		require.Equal(t, s.active, entry.segment)
+		entry = testutil.Must(s.getEntry(context.Background(), digests[2]))(t)
+		require.Contains(t, targets, entry.segment)
+		require.Equal(t, uint64(10), s.segments[entry.segment].live)
+
+		for i, digest := range digests[1:] {
+			obj, err := s.Get(context.Background(), digest)
+			require.NoError(t, err)
+			require.Equal(t, blobs[i+1], testutil.Must(io.ReadAll(obj.Body()))(t))
+		}
+	})
+
+	t.Run("closes segment file when body is closed", func(t *testing.T) {
+		s := testutil.Must(NewPackBlobstore(t.TempDir(), datastore.NewMapDatastore()))(t)
+
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		obj, err := s.Get(context.Background(), digest)
+		require.NoError(t, err)
+		body, ok := obj.Body().(io.ReadCloser)
+		require.True(t, ok)
+		_, err = body.Read(make([]byte, 1))
+		require.NoError(t, err)
+		require.NoError(t, body.Close())
+		_, err = body.Read(make([]byte, 1))
+		require.ErrorIs(t, err, os.ErrClosed)
+	})
+
+	t.Run("reopens existing segments", func(t *testing.T) {
+		dir := t.TempDir()
+		index := datastore.NewMapDatastore()
+		s := testutil.Must(NewPackBlobstore(dir, index, WithMaxSegmentSize(15)))(t)
+
+		data0, digest0 := randomBlob(t)
+		err := s.Put(context.Background(), digest0, uint64(len(data0)), bytes.NewReader(data0))
+		require.NoError(t, err)
+		data1, digest1 := randomBlob(t)
+		err = s.Put(context.Background(), digest1, uint64(len(data1)), bytes.NewReader(data1))
+		require.NoError(t, err)
+		require.NoError(t, s.Delete(context.Background(), digest0))
+
+		s = testutil.Must(NewPackBlobstore(dir, index, WithMaxSegmentSize(15)))(t)
+
+		// the segment holding only the deleted blob is removed
+		require.Len(t, segmentFiles(t, dir), 1)
+
+		data2, digest2 := randomBlob(t)
+		err = s.Put(context.Background(), digest2, uint64(len(data2)), bytes.NewReader(data2))
+		require.NoError(t, err)
+
+		for digest, data := range map[string][]byte{digestutil.Format(digest1): data1, digestutil.Format(digest2): data2} {
+			obj, err := s.Get(context.Background(), testutil.Must(digestutil.Parse(digest))(t))
+			require.NoError(t, err)
+			require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+		}
+	})
+
+	t.Run("serves HTTP range requests", func(t *testing.T) {
+		s := testutil.Must(NewPackBlobstore(t.TempDir(), datastore.NewMapDatastore()))(t)
+
+		other, otherDigest := randomBlob(t)
+		err := s.Put(context.Background(), otherDigest, uint64(len(other)), bytes.NewReader(other))
+		require.NoError(t, err)
+		data, digest := randomBlob(t)
+		err = s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+		require.NoError(t, err)
+
+		server := httptest.NewServer(http.FileServer(s.FileSystem()))
+		t.Cleanup(server.Close)
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", server.URL, digestutil.Format(digest)), nil)
+		require.NoError(t, err)
+		req.Header.Set("Range", "bytes=2-5")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusPartialContent, res.StatusCode)
+		require.Equal(t, data[2:6], testutil.Must(io.ReadAll(res.Body))(t))
+
+		_, err = s.FileSystem().Open("/" + digestutil.Format(testutil.RandomMultihash(t)))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	for _, d := range testutil.Must(os.ReadDir(dir))(t) {
+		if _, ok := parseSegmentName(d.Name()); ok {
+			files = append(files, filepath.Join(dir, d.Name()))
+		}
+	}
+	return files
+}
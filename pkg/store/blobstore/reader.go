@@ -0,0 +1,78 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/multiformats/go-multihash"
+)
+
+// ObjectReader reads an object from a blobstore from the current offset,
+// starting a new ranged read after each seek. It allows an object to be served
+// with [http.ServeContent] from any blobstore.
+type ObjectReader struct {
+	ctx    context.Context
+	blobs  Blobstore
+	digest multihash.Multihash
+	size   int64
+	offset int64
+	r      io.Reader
+}
+
+var _ io.ReadSeekCloser = (*ObjectReader)(nil)
+
+// NewObjectReader creates a reader for the object identified by the passed
+// digest, which has the passed size.
+func NewObjectReader(ctx context.Context, blobs Blobstore, digest multihash.Multihash, size int64) *ObjectReader {
+	return &ObjectReader{ctx: ctx, blobs: blobs, digest: digest, size: size}
+}
+
+func (o *ObjectReader) Read(p []byte) (int, error) {
+	if o.r == nil {
+		if o.offset >= o.size {
+			return 0, io.EOF
+		}
+		obj, err := o.blobs.Get(o.ctx, o.digest, WithRange(Range{Offset: uint64(o.offset)}))
+		if err != nil {
+			return 0, err
+		}
+		o.r = obj.Body()
+	}
+	n, err := o.r.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != o.offset {
+		o.closeBody()
+		o.offset = offset
+	}
+	return offset, nil
+}
+
+// Close closes the body of any read in progress.
+func (o *ObjectReader) Close() error {
+	o.closeBody()
+	return nil
+}
+
+func (o *ObjectReader) closeBody() {
+	if c, ok := o.r.(io.Closer); ok {
+		c.Close()
+	}
+	o.r = nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package blobstore
+
+import "errors"
+
+// availableSpace is not supported on this platform.
+func availableSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package blobstore
+
+import "syscall"
+
+// availableSpace returns the number of bytes available to unprivileged users
+// on the filesystem containing the passed path.
+func availableSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
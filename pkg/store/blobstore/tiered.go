@@ -0,0 +1,808 @@
+package blobstore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store"
+)
+
+var log = logging.Logger("blobstore")
+
+const (
+	// DefaultUploadConcurrency is the default number of blobs copied to the
+	// cold tier in parallel.
+	DefaultUploadConcurrency = 4
+	// DefaultUploadRetryInterval is the default time to wait before retrying a
+	// failed copy to the cold tier.
+	DefaultUploadRetryInterval = time.Minute
+)
+
+// TieredOption is an option configuring a [TieredBlobstore].
+type TieredOption func(cfg *tieredOptions) error
+
+type tieredOptions struct {
+	uploadConcurrency   int
+	uploadRetryInterval time.Duration
+}
+
+// WithUploadConcurrency configures the number of blobs copied to the cold
+// tier in parallel.
+func WithUploadConcurrency(n int) TieredOption {
+	return func(opts *tieredOptions) error {
+		if n <= 0 {
+			return errors.New("upload concurrency must be greater than zero")
+		}
+		opts.uploadConcurrency = n
+		return nil
+	}
+}
+
+// WithUploadRetryInterval configures the time to wait before retrying a
+// failed copy to the cold tier.
+func WithUploadRetryInterval(interval time.Duration) TieredOption {
+	return func(opts *tieredOptions) error {
+		if interval <= 0 {
+			return errors.New("upload retry interval must be greater than zero")
+		}
+		opts.uploadRetryInterval = interval
+		return nil
+	}
+}
+
+// cacheEntry is a blob held in the hot tier.
+type cacheEntry struct {
+	key  string
+	size uint64
+	// pinned entries have not yet been copied to the cold tier, and so must
+	// not be evicted.
+	pinned bool
+}
+
+// upload is an in progress copy of a blob to the cold tier.
+type upload struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// fetch is an in progress pull of a blob from the cold tier.
+type fetch struct {
+	done chan struct{}
+	err  error
+}
+
+// TieredBlobstore is a [Blobstore] that keeps a local hot tier in front of a
+// (typically remote) cold tier. Writes land in the hot tier and are copied to
+// the cold tier asynchronously. Reads are served from the hot tier when
+// present, and otherwise pulled through from the cold tier and cached. The
+// least recently used blobs are evicted from the hot tier to keep it within a
+// byte budget, once they have been copied to the cold tier.
+type TieredBlobstore struct {
+	hot     Blobstore
+	hotFS   http.FileSystem
+	cold    Blobstore
+	pending datastore.Datastore
+	budget  uint64
+	retry   time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List // front is most recently used
+	entries map[string]*list.Element
+	used    uint64
+	fetches map[string]*fetch
+	uploads map[string]*upload
+	// readers counts the open reads of each blob, which is not evicted from
+	// the hot tier until they are finished
+	readers map[string]int
+
+	queueMu sync.Mutex
+	queue   []multihash.Multihash
+	notify  chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewTieredBlobstore creates a [Blobstore] that caches up to budget bytes of
+// the cold tier in the hot tier. The hot tier must implement [Lister] and
+// [FileSystemer]. The pending datastore records blobs that have not yet been
+// copied to the cold tier, so that copying resumes after a restart. Blobs
+// that are pending are not evicted, so the hot tier may temporarily exceed
+// the budget if the cold tier is unavailable.
+//
+// Copying starts immediately; call [TieredBlobstore.Close] to stop it.
+func NewTieredBlobstore(hot Blobstore, cold Blobstore, pending datastore.Datastore, budget uint64, opts ...TieredOption) (*TieredBlobstore, error) {
+	o := &tieredOptions{
+		uploadConcurrency:   DefaultUploadConcurrency,
+		uploadRetryInterval: DefaultUploadRetryInterval,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	hotLister, ok := hot.(Lister)
+	if !ok {
+		return nil, errors.New("hot tier does not support enumerating blobs")
+	}
+	hotFS, ok := hot.(FileSystemer)
+	if !ok {
+		return nil, errors.New("hot tier does not support filesystem access")
+	}
+
+	t := &TieredBlobstore{
+		hot:     hot,
+		hotFS:   hotFS.FileSystem(),
+		cold:    cold,
+		pending: pending,
+		budget:  budget,
+		retry:   o.uploadRetryInterval,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+		fetches: map[string]*fetch{},
+		uploads: map[string]*upload{},
+		readers: map[string]int{},
+		notify:  make(chan struct{}, 1),
+	}
+
+	ctx := context.Background()
+	pendingKeys, err := t.listPending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// rebuild the cache, oldest first, so that recently written blobs are the
+	// last to be evicted
+	var objects []ObjectInfo
+	err = ListAll(ctx, hotLister, func(obj ObjectInfo) error {
+		objects = append(objects, obj)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing hot tier: %w", err)
+	}
+	for _, obj := range objects {
+		_, pinned := pendingKeys[digestutil.Format(obj.Digest)]
+		t.add(obj.Digest, uint64(obj.Size), pinned)
+	}
+	for _, digest := range pendingKeys {
+		t.enqueue(digest)
+	}
+	t.evict(ctx)
+
+	workerCtx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	for range o.uploadConcurrency {
+		t.wg.Add(1)
+		go t.uploader(workerCtx)
+	}
+	return t, nil
+}
+
+func (t *TieredBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
+	// record the blob as pending first, so that a crash after writing to the
+	// hot tier does not lose the copy to the cold tier
+	err := t.pending.Put(ctx, pendingKey(digest), []byte{})
+	if err != nil {
+		return fmt.Errorf("recording pending upload: %w", err)
+	}
+	err = t.hot.Put(ctx, digest, size, body, opts...)
+	if err != nil {
+		if derr := t.pending.Delete(ctx, pendingKey(digest)); derr != nil {
+			log.Errorw("removing pending upload", "blob", digestutil.Format(digest), "error", derr)
+		}
+		return err
+	}
+	t.add(digest, size, true)
+	t.enqueue(digest)
+	t.evict(ctx)
+	return nil
+}
+
+// Get retrieves the blob from the hot tier, pulling it through from the cold
+// tier if it is not cached. The blob is not evicted from the hot tier until
+// its body has been read to the end or closed.
+func (t *TieredBlobstore) Get(ctx context.Context, digest multihash.Multihash, opts ...GetOption) (Object, error) {
+	release := t.acquire(digest)
+	obj, err := t.get(ctx, digest, opts...)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &tieredObject{Object: obj, release: release}, nil
+}
+
+func (t *TieredBlobstore) get(ctx context.Context, digest multihash.Multihash, opts ...GetOption) (Object, error) {
+	obj, err := t.hot.Get(ctx, digest, opts...)
+	if err == nil {
+		t.touch(digest)
+		return obj, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	err = t.fetch(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	return t.hot.Get(ctx, digest, opts...)
+}
+
+// Delete removes the blob from both tiers. A copy to the cold tier that is
+// in progress is cancelled and waited for first, so that it cannot leave the
+// blob behind in the cold tier.
+func (t *TieredBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	t.remove(digest)
+	err := t.pending.Delete(ctx, pendingKey(digest))
+	if err != nil {
+		return fmt.Errorf("removing pending upload: %w", err)
+	}
+
+	t.mu.Lock()
+	u, ok := t.uploads[digestutil.Format(digest)]
+	t.mu.Unlock()
+	if ok {
+		u.cancel()
+		select {
+		case <-u.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	err = t.hot.Delete(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("deleting from hot tier: %w", err)
+	}
+	err = t.cold.Delete(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("deleting from cold tier: %w", err)
+	}
+	return nil
+}
+
+// Stat retrieves information about the blob from the hot tier, or the cold
+// tier if it is not cached and the cold tier implements [Lister].
+func (t *TieredBlobstore) Stat(ctx context.Context, digest multihash.Multihash) (ObjectInfo, error) {
+	info, err := t.hot.(Lister).Stat(ctx, digest)
+	if err == nil || !errors.Is(err, store.ErrNotFound) {
+		return info, err
+	}
+	cold, ok := t.cold.(Lister)
+	if !ok {
+		return ObjectInfo{}, store.ErrNotFound
+	}
+	return cold.Stat(ctx, digest)
+}
+
+// List retrieves a page of blobs across both tiers. Blobs that have been
+// evicted from the hot tier are only included if the cold tier implements
+// [Lister].
+func (t *TieredBlobstore) List(ctx context.Context, opts ...ListOption) (ListPage, error) {
+	o, err := newListOptions(opts)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	listers := []Lister{t.hot.(Lister)}
+	if cold, ok := t.cold.(Lister); ok {
+		listers = append(listers, cold)
+	}
+
+	// the first page of each tier contains the first page overall
+	var objects []ObjectInfo
+	more := false
+	for _, l := range listers {
+		page, err := l.List(ctx, WithCursor(o.cursor), WithLimit(o.limit))
+		if err != nil {
+			return ListPage{}, err
+		}
+		objects = append(objects, page.Objects...)
+		more = more || page.Cursor != ""
+	}
+
+	// prefer the hot tier's information for blobs held in both
+	slices.SortStableFunc(objects, func(a, b ObjectInfo) int {
+		return compareDigests(a.Digest, b.Digest)
+	})
+	objects = slices.CompactFunc(objects, func(a, b ObjectInfo) bool {
+		return compareDigests(a.Digest, b.Digest) == 0
+	})
+
+	page := ListPage{Objects: objects}
+	if len(objects) > o.limit {
+		page.Objects = objects[:o.limit]
+		more = true
+	}
+	if more && len(page.Objects) > 0 {
+		page.Cursor = digestutil.Format(page.Objects[len(page.Objects)-1].Digest)
+	}
+	return page, nil
+}
+
+// Space returns the storage used by the cold tier and the space available to
+// it, limited by the space the hot tier can free up for new writes. Returns
+// [errors.ErrUnsupported] if the cold tier does not report its space.
+func (t *TieredBlobstore) Space(ctx context.Context) (Space, error) {
+	cold, ok := t.cold.(SpaceReporter)
+	if !ok {
+		return Space{}, errors.ErrUnsupported
+	}
+	sp, err := cold.Space(ctx)
+	if err != nil {
+		return Space{}, fmt.Errorf("getting cold tier space: %w", err)
+	}
+	hot, ok := t.hot.(SpaceReporter)
+	if !ok {
+		return sp, nil
+	}
+	hotSp, err := hot.Space(ctx)
+	if err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			return sp, nil
+		}
+		return Space{}, fmt.Errorf("getting hot tier space: %w", err)
+	}
+	// blobs that have been copied to the cold tier can be evicted to make room
+	sp.Available = min(sp.Available, hotSp.Available+t.evictable())
+	return sp, nil
+}
+
+// Compact compacts the hot and cold tiers that implement [Compacter].
+func (t *TieredBlobstore) Compact(ctx context.Context) error {
+	var errs error
+	if c, ok := t.hot.(Compacter); ok {
+		if err := c.Compact(ctx); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("compacting hot tier: %w", err))
+		}
+	}
+	if c, ok := t.cold.(Compacter); ok {
+		if err := c.Compact(ctx); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("compacting cold tier: %w", err))
+		}
+	}
+	return errs
+}
+
+// TempDir returns the tmp directory of the hot tier, or the default directory
+// for temporary files if the hot tier does not have one.
+func (t *TieredBlobstore) TempDir() string {
+	return tempDir(t.hot)
+}
+
+// StagingDirs returns every directory the hot tier stages data in.
+func (t *TieredBlobstore) StagingDirs() []string {
+	return StagingDirs(t.hot)
+}
+
+// StagingDir returns the directory the hot tier would stage a blob of the
+// passed size in.
+func (t *TieredBlobstore) StagingDir(size uint64) (string, error) {
+	return StagingDir(t.hot, size)
+}
+
+// FileSystem returns a filesystem interface for reading blobs, pulling them
+// through from the cold tier if they are not cached.
+func (t *TieredBlobstore) FileSystem() http.FileSystem {
+	return &tieredDir{t}
+}
+
+// Close stops copying blobs to the cold tier, including scheduled retries.
+// Blobs not yet copied are copied when a new [TieredBlobstore] is created
+// with the same pending datastore.
+func (t *TieredBlobstore) Close(ctx context.Context) error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
+
+// fetch copies a blob from the cold tier to the hot tier. Concurrent fetches
+// for the same blob share a single copy.
+func (t *TieredBlobstore) fetch(ctx context.Context, digest multihash.Multihash) error {
+	k := digestutil.Format(digest)
+	t.mu.Lock()
+	if f, ok := t.fetches[k]; ok {
+		t.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f := &fetch{done: make(chan struct{})}
+	t.fetches[k] = f
+	t.mu.Unlock()
+
+	f.err = t.pull(ctx, digest)
+
+	t.mu.Lock()
+	delete(t.fetches, k)
+	t.mu.Unlock()
+	close(f.done)
+	return f.err
+}
+
+func (t *TieredBlobstore) pull(ctx context.Context, digest multihash.Multihash) error {
+	obj, err := t.cold.Get(ctx, digest)
+	if err != nil {
+		return err
+	}
+	err = t.hot.Put(ctx, digest, uint64(obj.Size()), obj.Body())
+	if err != nil {
+		return fmt.Errorf("caching blob: %w", err)
+	}
+	t.add(digest, uint64(obj.Size()), false)
+	t.evict(ctx)
+	return nil
+}
+
+func (t *TieredBlobstore) uploader(ctx context.Context) {
+	defer t.wg.Done()
+	for {
+		digest, ok := t.dequeue()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.notify:
+				continue
+			}
+		}
+		err := t.upload(ctx, digest)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorw("copying blob to cold tier", "blob", digestutil.Format(digest), "error", err)
+			t.wg.Add(1)
+			go t.retryUpload(ctx, digest)
+		}
+	}
+}
+
+// retryUpload queues the blob to be copied again after the retry interval,
+// unless the context is cancelled first.
+func (t *TieredBlobstore) retryUpload(ctx context.Context, digest multihash.Multihash) {
+	defer t.wg.Done()
+	timer := time.NewTimer(t.retry)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+		t.enqueue(digest)
+	}
+}
+
+// upload copies a blob to the cold tier. It is registered while it runs so
+// that a concurrent [TieredBlobstore.Delete] can cancel it. Only one copy of
+// a blob runs at a time.
+func (t *TieredBlobstore) upload(ctx context.Context, digest multihash.Multihash) error {
+	k := digestutil.Format(digest)
+	uctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	u := &upload{cancel: cancel, done: make(chan struct{})}
+	t.mu.Lock()
+	if _, ok := t.uploads[k]; ok {
+		t.mu.Unlock()
+		return nil
+	}
+	t.uploads[k] = u
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.uploads, k)
+		t.mu.Unlock()
+		close(u.done)
+	}()
+
+	err := t.copyToCold(uctx, digest)
+	if err != nil && uctx.Err() != nil && ctx.Err() == nil {
+		// cancelled by a delete, so there is nothing left to copy
+		return nil
+	}
+	return err
+}
+
+func (t *TieredBlobstore) copyToCold(ctx context.Context, digest multihash.Multihash) error {
+	// a delete removes the pending record before cancelling uploads, so a
+	// blob that is no longer pending must not be copied
+	has, err := t.pending.Has(ctx, pendingKey(digest))
+	if err != nil {
+		return fmt.Errorf("checking pending upload: %w", err)
+	}
+	if !has {
+		return nil
+	}
+	obj, err := t.hot.Get(ctx, digest)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			// deleted before it was copied
+			return t.pending.Delete(ctx, pendingKey(digest))
+		}
+		return fmt.Errorf("reading from hot tier: %w", err)
+	}
+	err = t.cold.Put(ctx, digest, uint64(obj.Size()), obj.Body())
+	if err != nil {
+		return fmt.Errorf("writing to cold tier: %w", err)
+	}
+	err = t.pending.Delete(ctx, pendingKey(digest))
+	if err != nil {
+		return fmt.Errorf("removing pending upload: %w", err)
+	}
+	t.unpin(digest)
+	t.evict(ctx)
+	return nil
+}
+
+func (t *TieredBlobstore) enqueue(digest multihash.Multihash) {
+	t.queueMu.Lock()
+	t.queue = append(t.queue, digest)
+	t.queueMu.Unlock()
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (t *TieredBlobstore) dequeue() (multihash.Multihash, bool) {
+	t.queueMu.Lock()
+	defer t.queueMu.Unlock()
+	if len(t.queue) == 0 {
+		return nil, false
+	}
+	digest := t.queue[0]
+	t.queue = t.queue[1:]
+	if len(t.queue) > 0 {
+		// wake another uploader for the remaining items
+		select {
+		case t.notify <- struct{}{}:
+		default:
+		}
+	}
+	return digest, true
+}
+
+func (t *TieredBlobstore) listPending(ctx context.Context) (map[string]multihash.Multihash, error) {
+	results, err := t.pending.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("querying pending uploads: %w", err)
+	}
+	defer results.Close()
+
+	pending := map[string]multihash.Multihash{}
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, fmt.Errorf("iterating pending uploads: %w", entry.Error)
+		}
+		k := datastore.RawKey(entry.Key).BaseNamespace()
+		digest, err := digestutil.Parse(k)
+		if err != nil {
+			return nil, fmt.Errorf("parsing pending upload digest: %w", err)
+		}
+		pending[k] = digest
+	}
+	return pending, nil
+}
+
+// add records a blob as the most recently used in the hot tier.
+func (t *TieredBlobstore) add(digest multihash.Multihash, size uint64, pinned bool) {
+	k := digestutil.Format(digest)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if el, ok := t.entries[k]; ok {
+		e := el.Value.(*cacheEntry)
+		e.pinned = e.pinned || pinned
+		t.lru.MoveToFront(el)
+		return
+	}
+	t.entries[k] = t.lru.PushFront(&cacheEntry{key: k, size: size, pinned: pinned})
+	t.used += size
+}
+
+func (t *TieredBlobstore) touch(digest multihash.Multihash) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if el, ok := t.entries[digestutil.Format(digest)]; ok {
+		t.lru.MoveToFront(el)
+	}
+}
+
+func (t *TieredBlobstore) unpin(digest multihash.Multihash) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if el, ok := t.entries[digestutil.Format(digest)]; ok {
+		el.Value.(*cacheEntry).pinned = false
+	}
+}
+
+// acquire prevents the blob from being evicted from the hot tier while it is
+// read. The returned function releases it, and may be called more than once.
+func (t *TieredBlobstore) acquire(digest multihash.Multihash) func() {
+	k := digestutil.Format(digest)
+	t.mu.Lock()
+	t.readers[k]++
+	t.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.readers[k]--
+			if t.readers[k] == 0 {
+				delete(t.readers, k)
+			}
+		})
+	}
+}
+
+// evictable returns the number of bytes in the hot tier that have been copied
+// to the cold tier.
+func (t *TieredBlobstore) evictable() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var n uint64
+	for el := t.lru.Front(); el != nil; el = el.Next() {
+		if e := el.Value.(*cacheEntry); !e.pinned {
+			n += e.size
+		}
+	}
+	return n
+}
+
+func (t *TieredBlobstore) remove(digest multihash.Multihash) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := digestutil.Format(digest)
+	if el, ok := t.entries[k]; ok {
+		t.used -= el.Value.(*cacheEntry).size
+		t.lru.Remove(el)
+		delete(t.entries, k)
+	}
+}
+
+// evict removes the least recently used blobs that have been copied to the
+// cold tier from the hot tier, until it is within budget. Blobs that are being
+// read are skipped. The most recently used blob is never evicted, so that a
+// blob larger than the budget can still be served.
+func (t *TieredBlobstore) evict(ctx context.Context) {
+	t.mu.Lock()
+	var victims []*cacheEntry
+	for el := t.lru.Back(); el != nil && el != t.lru.Front() && t.used > t.budget; {
+		prev := el.Prev()
+		e := el.Value.(*cacheEntry)
+		if !e.pinned && t.readers[e.key] == 0 {
+			victims = append(victims, e)
+			t.used -= e.size
+			t.lru.Remove(el)
+			delete(t.entries, e.key)
+		}
+		el = prev
+	}
+	t.mu.Unlock()
+
+	for _, e := range victims {
+		digest, err := digestutil.Parse(e.key)
+		if err != nil {
+			continue
+		}
+		err = t.hot.Delete(ctx, digest)
+		if err != nil {
+			log.Errorw("evicting blob from hot tier", "blob", e.key, "error", err)
+		}
+	}
+}
+
+func pendingKey(digest multihash.Multihash) datastore.Key {
+	return datastore.NewKey(digestutil.Format(digest))
+}
+
+var _ Blobstore = (*TieredBlobstore)(nil)
+var _ FileSystemer = (*TieredBlobstore)(nil)
+var _ TempDirer = (*TieredBlobstore)(nil)
+var _ Stager = (*TieredBlobstore)(nil)
+var _ Compacter = (*TieredBlobstore)(nil)
+var _ Lister = (*TieredBlobstore)(nil)
+var _ SpaceReporter = (*TieredBlobstore)(nil)
+
+type tieredDir struct {
+	t *TieredBlobstore
+}
+
+var _ http.FileSystem = (*tieredDir)(nil)
+
+// Open opens the blob in the hot tier, pulling it through from the cold tier
+// if it is not cached. The blob is not evicted from the hot tier until the
+// file is closed.
+func (d *tieredDir) Open(name string) (http.File, error) {
+	digest, err := digestutil.Parse(strings.TrimPrefix(name, "/"))
+	if err != nil {
+		return d.t.hotFS.Open(name)
+	}
+	release := d.t.acquire(digest)
+	f, err := d.open(name, digest)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &tieredFile{File: f, release: release}, nil
+}
+
+func (d *tieredDir) open(name string, digest multihash.Multihash) (http.File, error) {
+	f, err := d.t.hotFS.Open(name)
+	if err == nil {
+		d.t.touch(digest)
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	err = d.t.fetch(context.Background(), digest)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	return d.t.hotFS.Open(name)
+}
+
+// tieredFile releases the blob for eviction when it is closed.
+type tieredFile struct {
+	http.File
+	release func()
+}
+
+func (f *tieredFile) Close() error {
+	err := f.File.Close()
+	f.release()
+	return err
+}
+
+// tieredObject releases the blob for eviction when its body has been read to
+// the end or closed.
+type tieredObject struct {
+	Object
+	release func()
+}
+
+func (o *tieredObject) Body() io.Reader {
+	return &tieredBody{r: o.Object.Body(), release: o.release}
+}
+
+type tieredBody struct {
+	r       io.Reader
+	release func()
+}
+
+func (b *tieredBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *tieredBody) Close() error {
+	var err error
+	if c, ok := b.r.(io.Closer); ok {
+		err = c.Close()
+	}
+	b.release()
+	return err
+}
@@ -0,0 +1,366 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+)
+
+func TestTieredBlobstore(t *testing.T) {
+	t.Run("copies writes to cold tier", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s := newTieredBlobstore(t, hot, cold, pending, 1000)
+
+		data, digest := randomBlob(t)
+		err := s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data))
+		require.NoError(t, err)
+
+		// served from the hot tier immediately
+		_, err = hot.Get(context.Background(), digest)
+		require.NoError(t, err)
+
+		requireEventuallyInStore(t, cold, digest)
+		require.Eventually(t, func() bool {
+			has, err := pending.Has(context.Background(), pendingKey(digest))
+			require.NoError(t, err)
+			return !has
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("pulls through from cold tier", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s := newTieredBlobstore(t, hot, cold, pending, 1000)
+
+		data, digest := randomBlob(t)
+		require.NoError(t, cold.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		obj, err := s.Get(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(obj.Body()))(t))
+
+		// now cached in the hot tier
+		_, err = hot.Get(context.Background(), digest)
+		require.NoError(t, err)
+	})
+
+	t.Run("pulls through on filesystem access", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s := newTieredBlobstore(t, hot, cold, pending, 1000)
+
+		data, digest := randomBlob(t)
+		require.NoError(t, cold.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+
+		f, err := s.FileSystem().Open(fmt.Sprintf("/%s", digestutil.Format(digest)))
+		require.NoError(t, err)
+		require.Equal(t, data, testutil.Must(io.ReadAll(f))(t))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s := newTieredBlobstore(t, hot, cold, pending, 1000)
+
+		_, digest := randomBlob(t)
+		_, err := s.Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		// room for two 10 byte blobs
+		s := newTieredBlobstore(t, hot, cold, pending, 25)
+
+		var digests []multihash.Multihash
+		for range 3 {
+			data, digest := randomBlob(t)
+			require.NoError(t, cold.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+			digests = append(digests, digest)
+		}
+
+		readBlob(t, s, digests[0])
+		readBlob(t, s, digests[1])
+		// use the first again so the second is least recently used
+		readBlob(t, s, digests[0])
+		readBlob(t, s, digests[2])
+
+		_, err := hot.Get(context.Background(), digests[0])
+		require.NoError(t, err)
+		_, err = hot.Get(context.Background(), digests[1])
+		require.Equal(t, store.ErrNotFound, err)
+		_, err = hot.Get(context.Background(), digests[2])
+		require.NoError(t, err)
+	})
+
+	t.Run("does not evict blobs being read", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		// room for one 10 byte blob
+		s := newTieredBlobstore(t, hot, cold, pending, 15)
+
+		var blobs [][]byte
+		var digests []multihash.Multihash
+		for range 3 {
+			data, digest := randomBlob(t)
+			require.NoError(t, cold.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+			blobs = append(blobs, data)
+			digests = append(digests, digest)
+		}
+
+		obj, err := s.Get(context.Background(), digests[0])
+		require.NoError(t, err)
+		readBlob(t, s, digests[1])
+
+		// the body of the first is opened after it would have been evicted
+		body, err := io.ReadAll(obj.Body())
+		require.NoError(t, err)
+		require.Equal(t, blobs[0], body)
+
+		// and it is evicted once it has been read
+		readBlob(t, s, digests[2])
+		_, err = hot.Get(context.Background(), digests[0])
+		require.Equal(t, store.ErrNotFound, err)
+	})
+
+	t.Run("does not evict files being served", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s := newTieredBlobstore(t, hot, cold, pending, 15)
+
+		var digests []multihash.Multihash
+		for range 3 {
+			data, digest := randomBlob(t)
+			require.NoError(t, cold.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+			digests = append(digests, digest)
+		}
+
+		f, err := s.FileSystem().Open("/" + digestutil.Format(digests[0]))
+		require.NoError(t, err)
+		readBlob(t, s, digests[1])
+		_, err = hot.Get(context.Background(), digests[0])
+		require.NoError(t, err)
+
+		require.NoError(t, f.Close())
+		readBlob(t, s, digests[2])
+		_, err = hot.Get(context.Background(), digests[0])
+		require.Equal(t, store.ErrNotFound, err)
+	})
+
+	t.Run("does not evict before copy to cold tier", func(t *testing.T) {
+		hot, _, pending := newTiers(t)
+		cold := &failingBlobstore{NewMapBlobstore()}
+		s := newTieredBlobstore(t, hot, cold, pending, 15)
+
+		var digests []multihash.Multihash
+		for range 3 {
+			data, digest := randomBlob(t)
+			require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+			digests = append(digests, digest)
+		}
+
+		for _, digest := range digests {
+			_, err := hot.Get(context.Background(), digest)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("resumes copying after restart", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s, err := NewTieredBlobstore(hot, &failingBlobstore{cold}, pending, 1000)
+		require.NoError(t, err)
+
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		require.NoError(t, s.Close(context.Background()))
+
+		newTieredBlobstore(t, hot, cold, pending, 1000)
+		requireEventuallyInStore(t, cold, digest)
+	})
+
+	t.Run("delete removes from both tiers", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s := newTieredBlobstore(t, hot, cold, pending, 1000)
+
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		requireEventuallyInStore(t, cold, digest)
+
+		require.NoError(t, s.Delete(context.Background(), digest))
+
+		_, err := s.Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+	})
+
+	t.Run("delete cancels copy in progress", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		blocking := &blockingBlobstore{Blobstore: cold, started: make(chan struct{})}
+		s := newTieredBlobstore(t, hot, blocking, pending, 1000)
+
+		data, digest := randomBlob(t)
+		require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		<-blocking.started
+
+		require.NoError(t, s.Delete(context.Background(), digest))
+
+		_, err := cold.Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+		_, err = s.Get(context.Background(), digest)
+		require.Equal(t, store.ErrNotFound, err)
+	})
+
+	t.Run("stages through the hot tier", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s := newTieredBlobstore(t, hot, cold, pending, 1000)
+		require.Equal(t, []string{hot.TempDir()}, StagingDirs(s))
+		_, ok := StagingEncrypterOf(s)
+		require.False(t, ok)
+
+		encrypted := testutil.Must(NewEncryptedBlobstore(hot, testutil.RandomBytes(t, EncryptionKeySize)))(t)
+		s = newTieredBlobstore(t, encrypted, cold, dssync.MutexWrap(datastore.NewMapDatastore()), 1000)
+		require.Equal(t, []string{hot.TempDir()}, StagingDirs(s))
+		enc, ok := StagingEncrypterOf(s)
+		require.True(t, ok)
+		require.Same(t, encrypted, enc)
+	})
+
+	t.Run("lists blobs in both tiers", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s := newTieredBlobstore(t, hot, cold, pending, 15)
+
+		var want []string
+		for range 3 {
+			data, digest := randomBlob(t)
+			require.NoError(t, s.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+			requireEventuallyInStore(t, cold, digest)
+			want = append(want, digestutil.Format(digest))
+		}
+		// and one that is only in the hot tier
+		data, digest := randomBlob(t)
+		require.NoError(t, hot.Put(context.Background(), digest, uint64(len(data)), bytes.NewReader(data)))
+		want = append(want, digestutil.Format(digest))
+
+		var got []string
+		page, err := s.List(context.Background(), WithLimit(1))
+		require.NoError(t, err)
+		for {
+			for _, obj := range page.Objects {
+				require.Equal(t, int64(10), obj.Size)
+				got = append(got, digestutil.Format(obj.Digest))
+			}
+			if page.Cursor == "" {
+				break
+			}
+			page, err = s.List(context.Background(), WithCursor(page.Cursor), WithLimit(1))
+			require.NoError(t, err)
+		}
+		require.ElementsMatch(t, want, got)
+		require.IsIncreasing(t, got)
+	})
+
+	t.Run("reports the space of the cold tier", func(t *testing.T) {
+		hot, cold, pending := newTiers(t)
+		s := newTieredBlobstore(t, hot, cold, pending, 1000)
+		_, err := s.Space(context.Background())
+		require.ErrorIs(t, err, errors.ErrUnsupported)
+
+		reporting := &spaceBlobstore{Blobstore: cold, space: Space{Used: 100, Available: 200}}
+		s = newTieredBlobstore(t, NewMapBlobstore(), reporting, dssync.MutexWrap(datastore.NewMapDatastore()), 1000)
+		sp, err := s.Space(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, Space{Used: 100, Available: 200}, sp)
+	})
+
+	t.Run("compacts both tiers", func(t *testing.T) {
+		hot := &compactingBlobstore{MapBlobstore: NewMapBlobstore()}
+		cold := &compactingBlobstore{MapBlobstore: NewMapBlobstore()}
+		s := newTieredBlobstore(t, hot, cold, dssync.MutexWrap(datastore.NewMapDatastore()), 1000)
+		require.NoError(t, s.Compact(context.Background()))
+		require.Equal(t, 1, hot.compactions)
+		require.Equal(t, 1, cold.compactions)
+	})
+}
+
+func newTiers(t *testing.T) (*FsBlobstore, *DsBlobstore, datastore.Datastore) {
+	hot, err := NewFsBlobstore(t.TempDir(), t.TempDir())
+	require.NoError(t, err)
+	cold := NewDsBlobstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	return hot, cold, dssync.MutexWrap(datastore.NewMapDatastore())
+}
+
+func newTieredBlobstore(t *testing.T, hot Blobstore, cold Blobstore, pending datastore.Datastore, budget uint64) *TieredBlobstore {
+	s, err := NewTieredBlobstore(hot, cold, pending, budget, WithUploadRetryInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+func requireEventuallyInStore(t *testing.T, s Blobstore, digest multihash.Multihash) {
+	require.Eventually(t, func() bool {
+		_, err := s.Get(context.Background(), digest)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+// failingBlobstore fails all writes.
+type failingBlobstore struct {
+	Blobstore
+}
+
+func (f *failingBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
+	return fmt.Errorf("unavailable")
+}
+
+// blockingBlobstore blocks writes until they are cancelled, and then
+// completes them anyway, as a slow remote store might.
+type blockingBlobstore struct {
+	Blobstore
+	started chan struct{}
+}
+
+func (b *blockingBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
+	close(b.started)
+	<-ctx.Done()
+	err := b.Blobstore.Put(context.Background(), digest, size, body, opts...)
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func readBlob(t *testing.T, s Blobstore, digest multihash.Multihash) []byte {
+	obj, err := s.Get(context.Background(), digest)
+	require.NoError(t, err)
+	data, err := io.ReadAll(obj.Body())
+	require.NoError(t, err)
+	return data
+}
+
+// spaceBlobstore reports a fixed amount of space.
+type spaceBlobstore struct {
+	Blobstore
+	space Space
+}
+
+func (s *spaceBlobstore) Space(ctx context.Context) (Space, error) {
+	return s.space, nil
+}
+
+// compactingBlobstore counts the times it is compacted.
+type compactingBlobstore struct {
+	*MapBlobstore
+	compactions int
+}
+
+func (c *compactingBlobstore) Compact(ctx context.Context) error {
+	c.compactions++
+	return nil
+}
@@ -41,7 +41,7 @@ func (d *TODO_DsBlobstore) Get(ctx context.Context, digest multihash.Multihash,
 	return obj, nil
 }
 
-func (d *TODO_DsBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader) error {
+func (d *TODO_DsBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
 	b, err := io.ReadAll(body)
 	if err != nil {
 		return fmt.Errorf("reading body: %w", err)
@@ -64,6 +64,17 @@ func (d *TODO_DsBlobstore) Put(ctx context.Context, digest multihash.Multihash,
 	return nil
 }
 
+// Delete implements Blobstore.
+func (d *TODO_DsBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	k := digestutil.Format(digest)
+	key := datastore.NewKey(k)
+	err := d.data.Delete(ctx, key)
+	if err != nil {
+		return fmt.Errorf("deleting blob: %w", err)
+	}
+	return nil
+}
+
 func (d *TODO_DsBlobstore) FileSystem() http.FileSystem {
 	return &dsDir{d.data}
 }
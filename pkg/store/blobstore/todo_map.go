@@ -32,7 +32,7 @@ func (mb *TODOMapBlobstore) Get(ctx context.Context, digest multihash.Multihash,
 	return obj, nil
 }
 
-func (mb *TODOMapBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader) error {
+func (mb *TODOMapBlobstore) Put(ctx context.Context, digest multihash.Multihash, size uint64, body io.Reader, opts ...PutOption) error {
 	b, err := io.ReadAll(body)
 	if err != nil {
 		return fmt.Errorf("reading body: %w", err)
@@ -51,6 +51,11 @@ func (mb *TODOMapBlobstore) Put(ctx context.Context, digest multihash.Multihash,
 	return nil
 }
 
+func (mb *TODOMapBlobstore) Delete(ctx context.Context, digest multihash.Multihash) error {
+	delete(mb.data, digestutil.Format(digest))
+	return nil
+}
+
 func (mb *TODOMapBlobstore) FileSystem() http.FileSystem {
 	return &mapDir{mb.data}
 }
@@ -0,0 +1,119 @@
+package blobstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/multiformats/go-multihash"
+	mhcore "github.com/multiformats/go-multihash/core"
+)
+
+type verifyingReader struct {
+	r        io.Reader
+	hasher   hash.Hash
+	expected []byte
+	size     uint64
+	total    uint64
+	verified bool
+	err      error
+}
+
+// NewVerifyingReader wraps the passed reader so that reading fails if the
+// data is not exactly size bytes or does not hash to the passed digest. Any
+// hash function registered with go-multihash may be used.
+//
+// The check is performed before the final bytes are returned, so a consumer
+// that stops at the first error never receives all of the data when it is
+// inconsistent. Errors are [ErrTooLarge], [ErrTooSmall] and
+// [ErrDataInconsistent].
+func NewVerifyingReader(r io.Reader, digest multihash.Multihash, size uint64) (io.Reader, error) {
+	info, err := multihash.Decode(digest)
+	if err != nil {
+		return nil, fmt.Errorf("decoding digest: %w", err)
+	}
+	hasher, err := mhcore.GetVariableHasher(info.Code, info.Length)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported digest: 0x%x", info.Code)
+	}
+	return &verifyingReader{r: r, hasher: hasher, expected: info.Digest, size: size}, nil
+}
+
+// NewPutReader wraps the body passed to [Blobstore.Put] so that reading fails
+// if the data is inconsistent with the digest and size, as
+// [NewVerifyingReader] does. If verification is disabled with
+// [WithoutVerification] only the size is checked.
+func NewPutReader(body io.Reader, digest multihash.Multihash, size uint64, opts ...PutOption) (io.Reader, error) {
+	o := &putOptions{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if o.unverified {
+		return &verifyingReader{r: body, size: size}, nil
+	}
+	return NewVerifyingReader(body, digest, size)
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+
+	n, err := v.r.Read(p)
+	if n > 0 {
+		if v.hasher != nil {
+			v.hasher.Write(p[:n])
+		}
+		v.total += uint64(n)
+		if v.total > v.size {
+			v.err = ErrTooLarge
+			return 0, v.err
+		}
+		if v.total == v.size {
+			if verr := v.verify(); verr != nil {
+				return 0, verr
+			}
+		}
+	}
+	if err == io.EOF {
+		if v.total < v.size {
+			v.err = ErrTooSmall
+			return 0, v.err
+		}
+		// zero length data never reaches the check above
+		if verr := v.verify(); verr != nil {
+			return 0, verr
+		}
+	}
+	return n, err
+}
+
+func (v *verifyingReader) verify() error {
+	if v.verified {
+		return nil
+	}
+	v.verified = true
+	if v.hasher == nil {
+		return nil
+	}
+	sum := v.hasher.Sum(nil)
+	if len(sum) > len(v.expected) {
+		// truncated digest
+		sum = sum[:len(v.expected)]
+	}
+	if !bytes.Equal(sum, v.expected) {
+		v.err = ErrDataInconsistent
+		return v.err
+	}
+	return nil
+}
+
+// isVerificationError determines if the passed error was returned by a reader
+// created by [NewVerifyingReader] because the data failed verification.
+func isVerificationError(err error) bool {
+	return errors.Is(err, ErrTooLarge) || errors.Is(err, ErrTooSmall) || errors.Is(err, ErrDataInconsistent)
+}
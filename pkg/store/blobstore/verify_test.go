@@ -0,0 +1,98 @@
+package blobstore
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/testutil"
+)
+
+func TestVerifyingReader(t *testing.T) {
+	codes := map[string]uint64{
+		"sha2-256": multihash.SHA2_256,
+		"sha2-512": multihash.SHA2_512,
+		"blake3":   multihash.BLAKE3,
+	}
+
+	for name, code := range codes {
+		t.Run("consistent "+name, func(t *testing.T) {
+			data := testutil.RandomBytes(t, 100)
+			digest := testutil.Must(multihash.Sum(data, code, -1))(t)
+
+			vr, err := NewVerifyingReader(bytes.NewReader(data), digest, uint64(len(data)))
+			require.NoError(t, err)
+
+			b, err := io.ReadAll(vr)
+			require.NoError(t, err)
+			require.Equal(t, data, b)
+		})
+
+		t.Run("inconsistent "+name, func(t *testing.T) {
+			data := testutil.RandomBytes(t, 100)
+			digest := testutil.Must(multihash.Sum(data, code, -1))(t)
+			baddata := testutil.RandomBytes(t, 100)
+
+			vr, err := NewVerifyingReader(bytes.NewReader(baddata), digest, uint64(len(baddata)))
+			require.NoError(t, err)
+
+			b, err := io.ReadAll(vr)
+			require.Equal(t, ErrDataInconsistent, err)
+			// the final bytes are withheld
+			require.Less(t, len(b), len(baddata))
+		})
+	}
+
+	t.Run("truncated digest", func(t *testing.T) {
+		data := testutil.RandomBytes(t, 100)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, 20))(t)
+
+		vr, err := NewVerifyingReader(bytes.NewReader(data), digest, uint64(len(data)))
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(vr)
+		require.NoError(t, err)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		digest := testutil.Must(multihash.Sum(nil, multihash.SHA2_256, -1))(t)
+
+		vr, err := NewVerifyingReader(bytes.NewReader(nil), digest, 0)
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(vr)
+		require.NoError(t, err)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		data := testutil.RandomBytes(t, 100)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+		vr, err := NewVerifyingReader(bytes.NewReader(data), digest, 50)
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(vr)
+		require.Equal(t, ErrTooLarge, err)
+	})
+
+	t.Run("too small", func(t *testing.T) {
+		data := testutil.RandomBytes(t, 100)
+		digest := testutil.Must(multihash.Sum(data, multihash.SHA2_256, -1))(t)
+
+		vr, err := NewVerifyingReader(bytes.NewReader(data), digest, 200)
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(vr)
+		require.Equal(t, ErrTooSmall, err)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		digest := testutil.Must(multihash.Encode([]byte{1, 2, 3}, 0x300000))(t)
+
+		_, err := NewVerifyingReader(bytes.NewReader(nil), digest, 0)
+		require.ErrorContains(t, err, "unsupported digest")
+	})
+}
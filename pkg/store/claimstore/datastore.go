@@ -0,0 +1,250 @@
+package claimstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/ucan"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/delegationstore"
+)
+
+const (
+	contentIndexPrefix = "contentIndex/"
+	expiryIndexPrefix  = "expiryIndex/"
+)
+
+// indexedKey is written to the content index once all claims in the store
+// have been indexed. It changes when more kinds of claim are indexed, so that
+// existing stores are indexed again.
+var indexedKey = datastore.NewKey("indexed-equals")
+
+// DsClaimStore is a [ClaimStore] backed by an IPFS datastore that also indexes
+// location and equals claims by the content they refer to, and location claims
+// by when they expire.
+type DsClaimStore struct {
+	delegationstore.DelegationStore
+	data   datastore.Datastore
+	index  datastore.Datastore
+	expiry datastore.Datastore
+}
+
+func (d *DsClaimStore) Put(ctx context.Context, claim delegation.Delegation) error {
+	err := d.DelegationStore.Put(ctx, claim)
+	if err != nil {
+		return err
+	}
+	return d.indexClaim(ctx, claim)
+}
+
+func (d *DsClaimStore) Delete(ctx context.Context, root ucan.Link) error {
+	claim, err := d.DelegationStore.Get(ctx, root)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	digest, ok := claimContent(claim)
+	if ok {
+		err = d.index.Delete(ctx, contentIndexKey(digest, root))
+		if err != nil {
+			return fmt.Errorf("removing claim from content index: %w", err)
+		}
+		if exp := claim.Expiration(); exp != nil && isLocation(claim) {
+			err = d.expiry.Delete(ctx, expiryIndexKey(*exp, root))
+			if err != nil {
+				return fmt.Errorf("removing claim from expiry index: %w", err)
+			}
+		}
+	}
+	return d.DelegationStore.Delete(ctx, root)
+}
+
+func (d *DsClaimStore) ListByContent(ctx context.Context, digest multihash.Multihash) ([]ucan.Link, error) {
+	pfx := digestutil.Format(digest) + "/"
+	results, err := d.index.Query(ctx, query.Query{Prefix: pfx, KeysOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("querying content index: %w", err)
+	}
+
+	var links []ucan.Link
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, fmt.Errorf("iterating query results: %w", entry.Error)
+		}
+		c, err := cid.Parse(datastore.NewKey(entry.Key).BaseNamespace())
+		if err != nil {
+			return nil, fmt.Errorf("parsing claim CID: %w", err)
+		}
+		links = append(links, cidlink.Link{Cid: c})
+	}
+	return links, nil
+}
+
+func (d *DsClaimStore) ListExpiring(ctx context.Context, before int) ([]ucan.Link, error) {
+	results, err := d.expiry.Query(ctx, query.Query{KeysOnly: true, Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return nil, fmt.Errorf("querying expiry index: %w", err)
+	}
+	defer results.Close()
+
+	var links []ucan.Link
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, fmt.Errorf("iterating query results: %w", entry.Error)
+		}
+		parts := datastore.NewKey(entry.Key).Namespaces()
+		if len(parts) != 2 {
+			continue
+		}
+		exp, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing claim expiration: %w", err)
+		}
+		// keys are ordered by expiration
+		if exp > before {
+			break
+		}
+		c, err := cid.Parse(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("parsing claim CID: %w", err)
+		}
+		links = append(links, cidlink.Link{Cid: c})
+	}
+	return links, nil
+}
+
+func (d *DsClaimStore) indexClaim(ctx context.Context, claim delegation.Delegation) error {
+	digest, ok := claimContent(claim)
+	if !ok {
+		return nil
+	}
+	err := d.index.Put(ctx, contentIndexKey(digest, claim.Link()), []byte{})
+	if err != nil {
+		return fmt.Errorf("adding claim to content index: %w", err)
+	}
+	if exp := claim.Expiration(); exp != nil && isLocation(claim) {
+		err = d.expiry.Put(ctx, expiryIndexKey(*exp, claim.Link()), []byte{})
+		if err != nil {
+			return fmt.Errorf("adding claim to expiry index: %w", err)
+		}
+	}
+	return nil
+}
+
+// reindex adds all existing location and equals claims in the store to the
+// content index. It only runs once, since subsequent writes are indexed on put.
+func (d *DsClaimStore) reindex(ctx context.Context) error {
+	indexed, err := d.index.Has(ctx, indexedKey)
+	if err != nil {
+		return fmt.Errorf("checking content index: %w", err)
+	}
+	if indexed {
+		return nil
+	}
+
+	results, err := d.data.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return fmt.Errorf("querying datastore: %w", err)
+	}
+	defer results.Close()
+
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return fmt.Errorf("iterating query results: %w", entry.Error)
+		}
+		if strings.HasPrefix(entry.Key, "/"+contentIndexPrefix) || strings.HasPrefix(entry.Key, "/"+expiryIndexPrefix) {
+			continue
+		}
+		c, err := cid.Parse(strings.TrimPrefix(entry.Key, "/"))
+		if err != nil {
+			continue
+		}
+		claim, err := d.DelegationStore.Get(ctx, cidlink.Link{Cid: c})
+		if err != nil {
+			return fmt.Errorf("getting claim: %s: %w", c, err)
+		}
+		err = d.indexClaim(ctx, claim)
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.index.Put(ctx, indexedKey, []byte{})
+}
+
+var _ ClaimStore = (*DsClaimStore)(nil)
+var _ ContentLister = (*DsClaimStore)(nil)
+var _ ExpiryLister = (*DsClaimStore)(nil)
+
+// NewDsClaimStore creates a [ClaimStore] backed by an IPFS datastore. Existing
+// location and equals claims in the datastore are indexed on first use.
+func NewDsClaimStore(ds datastore.Datastore) (*DsClaimStore, error) {
+	dlgs, err := delegationstore.NewDsDelegationStore(ds)
+	if err != nil {
+		return nil, err
+	}
+	s := &DsClaimStore{
+		DelegationStore: dlgs,
+		data:            ds,
+		index:           namespace.Wrap(ds, datastore.NewKey(contentIndexPrefix)),
+		expiry:          namespace.Wrap(ds, datastore.NewKey(expiryIndexPrefix)),
+	}
+	err = s.reindex(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("indexing claims: %w", err)
+	}
+	return s, nil
+}
+
+func contentIndexKey(digest multihash.Multihash, claim ucan.Link) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%s/%s", digestutil.Format(digest), claim.String()))
+}
+
+// expiryIndexKey zero pads the expiration so that keys sort by it.
+func expiryIndexKey(exp int, claim ucan.Link) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%020d/%s", exp, claim.String()))
+}
+
+func isLocation(claim delegation.Delegation) bool {
+	caps := claim.Capabilities()
+	return len(caps) > 0 && caps[0].Can() == assert.LocationAbility
+}
+
+// claimContent returns the digest of the content a location or equals claim
+// is made for.
+func claimContent(claim delegation.Delegation) (multihash.Multihash, bool) {
+	caps := claim.Capabilities()
+	if len(caps) == 0 {
+		return nil, false
+	}
+	switch caps[0].Can() {
+	case assert.LocationAbility:
+		nb, err := assert.LocationCaveatsReader.Read(caps[0].Nb())
+		if err != nil {
+			return nil, false
+		}
+		return nb.Content.Hash(), true
+	case assert.EqualsAbility:
+		nb, err := assert.EqualsCaveatsReader.Read(caps[0].Nb())
+		if err != nil {
+			return nil, false
+		}
+		return nb.Content.Hash(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,195 @@
+package claimstore
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/internal/testutil"
+	piristore "github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/delegationstore"
+)
+
+func TestDsClaimStore(t *testing.T) {
+	t.Run("list by content", func(t *testing.T) {
+		store, err := NewDsClaimStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		digest := testutil.RandomMultihash(t)
+		claim := randomLocationClaim(t, digest)
+
+		err = store.Put(context.Background(), claim)
+		require.NoError(t, err)
+
+		links, err := store.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{claim.Link()}, links)
+
+		links, err = store.ListByContent(context.Background(), testutil.RandomMultihash(t))
+		require.NoError(t, err)
+		require.Empty(t, links)
+	})
+
+	t.Run("lists equals claims by content", func(t *testing.T) {
+		store, err := NewDsClaimStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		digest := testutil.RandomMultihash(t)
+		location := randomLocationClaim(t, digest)
+		equals := randomEqualsClaim(t, digest)
+		require.NoError(t, store.Put(context.Background(), location))
+		require.NoError(t, store.Put(context.Background(), equals))
+
+		links, err := store.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []ucan.Link{location.Link(), equals.Link()}, links)
+
+		require.NoError(t, store.Delete(context.Background(), equals.Link()))
+		links, err = store.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{location.Link()}, links)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		store, err := NewDsClaimStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		digest := testutil.RandomMultihash(t)
+		claim := randomLocationClaim(t, digest)
+
+		err = store.Put(context.Background(), claim)
+		require.NoError(t, err)
+
+		err = store.Delete(context.Background(), claim.Link())
+		require.NoError(t, err)
+
+		_, err = store.Get(context.Background(), claim.Link())
+		require.ErrorIs(t, err, piristore.ErrNotFound)
+
+		links, err := store.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.Empty(t, links)
+
+		// deleting a non-existent claim is not an error
+		err = store.Delete(context.Background(), claim.Link())
+		require.NoError(t, err)
+	})
+
+	t.Run("list expiring", func(t *testing.T) {
+		store, err := NewDsClaimStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		later := randomLocationClaim(t, testutil.RandomMultihash(t), delegation.WithExpiration(2000))
+		sooner := randomLocationClaim(t, testutil.RandomMultihash(t), delegation.WithExpiration(1000))
+		never := randomLocationClaim(t, testutil.RandomMultihash(t))
+		for _, claim := range []delegation.Delegation{later, sooner, never} {
+			err = store.Put(context.Background(), claim)
+			require.NoError(t, err)
+		}
+
+		links, err := store.ListExpiring(context.Background(), 1500)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{sooner.Link()}, links)
+
+		links, err = store.ListExpiring(context.Background(), 2000)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{sooner.Link(), later.Link()}, links)
+
+		err = store.Delete(context.Background(), sooner.Link())
+		require.NoError(t, err)
+
+		links, err = store.ListExpiring(context.Background(), 2000)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{later.Link()}, links)
+	})
+
+	t.Run("indexes existing claims", func(t *testing.T) {
+		ds := datastore.NewMapDatastore()
+		dlgs, err := delegationstore.NewDsDelegationStore(ds)
+		require.NoError(t, err)
+
+		digest := testutil.RandomMultihash(t)
+		claim := randomLocationClaim(t, digest)
+		equals := randomEqualsClaim(t, digest)
+
+		err = dlgs.Put(context.Background(), claim)
+		require.NoError(t, err)
+		err = dlgs.Put(context.Background(), equals)
+		require.NoError(t, err)
+
+		store, err := NewDsClaimStore(ds)
+		require.NoError(t, err)
+
+		links, err := store.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []ucan.Link{claim.Link(), equals.Link()}, links)
+	})
+
+	t.Run("indexes equals claims in a store indexed before they were", func(t *testing.T) {
+		ds := datastore.NewMapDatastore()
+		dlgs, err := delegationstore.NewDsDelegationStore(ds)
+		require.NoError(t, err)
+
+		digest := testutil.RandomMultihash(t)
+		equals := randomEqualsClaim(t, digest)
+		require.NoError(t, dlgs.Put(context.Background(), equals))
+		// marker written by earlier versions once location claims were indexed
+		require.NoError(t, ds.Put(context.Background(), datastore.NewKey(contentIndexPrefix+"indexed"), []byte{}))
+
+		store, err := NewDsClaimStore(ds)
+		require.NoError(t, err)
+
+		links, err := store.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{equals.Link()}, links)
+	})
+}
+
+// randomEqualsClaim creates an equals claim for the digest that does not
+// expire.
+func randomEqualsClaim(t *testing.T, digest multihash.Multihash) delegation.Delegation {
+	signer := testutil.RandomSigner(t)
+	claim, err := assert.Equals.Delegate(
+		signer,
+		testutil.RandomDID(t),
+		signer.DID().String(),
+		assert.EqualsCaveats{
+			Content: types.FromHash(digest),
+			Equals:  testutil.RandomCID(t),
+		},
+		delegation.WithNoExpiration(),
+	)
+	require.NoError(t, err)
+	return claim
+}
+
+// randomLocationClaim creates a location claim for the digest that does not
+// expire, unless options are passed.
+func randomLocationClaim(t *testing.T, digest multihash.Multihash, opts ...delegation.Option) delegation.Delegation {
+	if len(opts) == 0 {
+		opts = []delegation.Option{delegation.WithNoExpiration()}
+	}
+	signer := testutil.RandomSigner(t)
+	space := testutil.RandomDID(t)
+	claim, err := assert.Location.Delegate(
+		signer,
+		space,
+		signer.DID().String(),
+		assert.LocationCaveats{
+			Space:    space,
+			Content:  types.FromHash(digest),
+			Location: []url.URL{testutil.RandomLocalURL(t)},
+		},
+		opts...,
+	)
+	require.NoError(t, err)
+	return claim
+}
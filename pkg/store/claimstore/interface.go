@@ -1,9 +1,30 @@
 package claimstore
 
 import (
+	"context"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-ucanto/ucan"
+
 	"github.com/storacha/piri/pkg/store/delegationstore"
 )
 
 type ClaimStore interface {
 	delegationstore.DelegationStore
 }
+
+// ContentLister is implemented by claim stores that are able to find the
+// location and equals claims made for a given piece of content.
+type ContentLister interface {
+	// ListByContent retrieves the CIDs of location and equals claims for the
+	// passed content digest.
+	ListByContent(context.Context, multihash.Multihash) ([]ucan.Link, error)
+}
+
+// ExpiryLister is implemented by claim stores that are able to find the
+// location claims that expire by a given time.
+type ExpiryLister interface {
+	// ListExpiring retrieves the CIDs of location claims that expire at or
+	// before the passed UNIX time. Claims without an expiration are not listed.
+	ListExpiring(ctx context.Context, before int) ([]ucan.Link, error)
+}
@@ -0,0 +1,193 @@
+package claimstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/assert"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/ucan"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store/delegationstore"
+)
+
+// locationClaimRecord is a row in the location_claims table, indexing a
+// location claim in the delegations table by the content and space it refers
+// to, and by when it expires. Expiration is zero for claims that do not
+// expire.
+type locationClaimRecord struct {
+	Claim      string `gorm:"primaryKey;column:claim"`
+	Content    string `gorm:"not null;index;column:content"`
+	Space      string `gorm:"not null;index;column:space"`
+	Expiration int    `gorm:"not null;default:0;index;column:expiration"`
+}
+
+func (locationClaimRecord) TableName() string {
+	return "location_claims"
+}
+
+// equalsClaimRecord is a row in the equals_claims table, indexing an equals
+// claim in the delegations table by the content it refers to.
+type equalsClaimRecord struct {
+	Claim   string `gorm:"primaryKey;column:claim"`
+	Content string `gorm:"not null;index;column:content"`
+}
+
+func (equalsClaimRecord) TableName() string {
+	return "equals_claims"
+}
+
+// SQLClaimStore is a [ClaimStore] backed by a SQL database, such as SQLite or
+// PostgreSQL, that also indexes location and equals claims by the content they
+// refer to.
+type SQLClaimStore struct {
+	*delegationstore.SQLDelegationStore
+	db *gorm.DB
+}
+
+func (s *SQLClaimStore) Put(ctx context.Context, claim delegation.Delegation) error {
+	err := s.SQLDelegationStore.Put(ctx, claim)
+	if err != nil {
+		return err
+	}
+
+	caps := claim.Capabilities()
+	if len(caps) == 0 {
+		return nil
+	}
+	switch caps[0].Can() {
+	case assert.LocationAbility:
+		return s.indexLocation(ctx, claim)
+	case assert.EqualsAbility:
+		return s.indexEquals(ctx, claim)
+	}
+	return nil
+}
+
+func (s *SQLClaimStore) indexLocation(ctx context.Context, claim delegation.Delegation) error {
+	nb, rerr := assert.LocationCaveatsReader.Read(claim.Capabilities()[0].Nb())
+	if rerr != nil {
+		return nil
+	}
+	var exp int
+	if claim.Expiration() != nil {
+		exp = *claim.Expiration()
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&locationClaimRecord{
+		Claim:      claim.Link().String(),
+		Content:    digestutil.Format(nb.Content.Hash()),
+		Space:      nb.Space.String(),
+		Expiration: exp,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("adding claim to content index: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLClaimStore) indexEquals(ctx context.Context, claim delegation.Delegation) error {
+	nb, rerr := assert.EqualsCaveatsReader.Read(claim.Capabilities()[0].Nb())
+	if rerr != nil {
+		return nil
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&equalsClaimRecord{
+		Claim:   claim.Link().String(),
+		Content: digestutil.Format(nb.Content.Hash()),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("adding claim to content index: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLClaimStore) Delete(ctx context.Context, root ucan.Link) error {
+	err := s.db.WithContext(ctx).Where("claim = ?", root.String()).Delete(&locationClaimRecord{}).Error
+	if err != nil {
+		return fmt.Errorf("removing claim from content index: %w", err)
+	}
+	err = s.db.WithContext(ctx).Where("claim = ?", root.String()).Delete(&equalsClaimRecord{}).Error
+	if err != nil {
+		return fmt.Errorf("removing claim from content index: %w", err)
+	}
+	return s.SQLDelegationStore.Delete(ctx, root)
+}
+
+func (s *SQLClaimStore) ListByContent(ctx context.Context, digest multihash.Multihash) ([]ucan.Link, error) {
+	var locations []locationClaimRecord
+	err := s.db.WithContext(ctx).Where("content = ?", digestutil.Format(digest)).Find(&locations).Error
+	if err != nil {
+		return nil, fmt.Errorf("querying content index: %w", err)
+	}
+	var equals []equalsClaimRecord
+	err = s.db.WithContext(ctx).Where("content = ?", digestutil.Format(digest)).Find(&equals).Error
+	if err != nil {
+		return nil, fmt.Errorf("querying content index: %w", err)
+	}
+
+	links := make([]ucan.Link, 0, len(locations)+len(equals))
+	for _, r := range locations {
+		c, err := cid.Parse(r.Claim)
+		if err != nil {
+			return nil, fmt.Errorf("parsing claim CID: %w", err)
+		}
+		links = append(links, cidlink.Link{Cid: c})
+	}
+	for _, r := range equals {
+		c, err := cid.Parse(r.Claim)
+		if err != nil {
+			return nil, fmt.Errorf("parsing claim CID: %w", err)
+		}
+		links = append(links, cidlink.Link{Cid: c})
+	}
+	return links, nil
+}
+
+func (s *SQLClaimStore) ListExpiring(ctx context.Context, before int) ([]ucan.Link, error) {
+	var records []locationClaimRecord
+	err := s.db.WithContext(ctx).
+		Where("expiration > 0 AND expiration <= ?", before).
+		Order("expiration").
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("querying expiry index: %w", err)
+	}
+
+	links := make([]ucan.Link, 0, len(records))
+	for _, r := range records {
+		c, err := cid.Parse(r.Claim)
+		if err != nil {
+			return nil, fmt.Errorf("parsing claim CID: %w", err)
+		}
+		links = append(links, cidlink.Link{Cid: c})
+	}
+	return links, nil
+}
+
+var _ ClaimStore = (*SQLClaimStore)(nil)
+var _ ContentLister = (*SQLClaimStore)(nil)
+var _ ExpiryLister = (*SQLClaimStore)(nil)
+
+// NewSQLClaimStore creates a [ClaimStore] backed by a SQL database, creating
+// or migrating the delegations, location_claims and equals_claims tables as
+// necessary.
+func NewSQLClaimStore(db *gorm.DB) (*SQLClaimStore, error) {
+	dlgs, err := delegationstore.NewSQLDelegationStore(db)
+	if err != nil {
+		return nil, err
+	}
+	err = db.AutoMigrate(&locationClaimRecord{})
+	if err != nil {
+		return nil, fmt.Errorf("migrating location claims table: %w", err)
+	}
+	err = db.AutoMigrate(&equalsClaimRecord{})
+	if err != nil {
+		return nil, fmt.Errorf("migrating equals claims table: %w", err)
+	}
+	return &SQLClaimStore{SQLDelegationStore: dlgs, db: db}, nil
+}
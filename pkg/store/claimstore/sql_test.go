@@ -0,0 +1,113 @@
+package claimstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/database/gormdb"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+)
+
+func TestSQLClaimStore(t *testing.T) {
+	newStore := func(t *testing.T) *SQLClaimStore {
+		db, err := gormdb.New(filepath.Join(t.TempDir(), "claims.db"))
+		require.NoError(t, err)
+		s, err := NewSQLClaimStore(db)
+		require.NoError(t, err)
+		return s
+	}
+
+	t.Run("list by content", func(t *testing.T) {
+		s := newStore(t)
+		digest := testutil.RandomMultihash(t)
+		claim := randomLocationClaim(t, digest)
+
+		err := s.Put(context.Background(), claim)
+		require.NoError(t, err)
+
+		res, err := s.Get(context.Background(), claim.Link())
+		require.NoError(t, err)
+		testutil.RequireEqualDelegation(t, claim, res)
+
+		links, err := s.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{claim.Link()}, links)
+
+		links, err = s.ListByContent(context.Background(), testutil.RandomMultihash(t))
+		require.NoError(t, err)
+		require.Empty(t, links)
+	})
+
+	t.Run("lists equals claims by content", func(t *testing.T) {
+		s := newStore(t)
+		digest := testutil.RandomMultihash(t)
+		location := randomLocationClaim(t, digest)
+		equals := randomEqualsClaim(t, digest)
+		require.NoError(t, s.Put(context.Background(), location))
+		require.NoError(t, s.Put(context.Background(), equals))
+
+		links, err := s.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []ucan.Link{location.Link(), equals.Link()}, links)
+
+		require.NoError(t, s.Delete(context.Background(), equals.Link()))
+		links, err = s.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{location.Link()}, links)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		s := newStore(t)
+		digest := testutil.RandomMultihash(t)
+		claim := randomLocationClaim(t, digest)
+
+		err := s.Put(context.Background(), claim)
+		require.NoError(t, err)
+
+		err = s.Delete(context.Background(), claim.Link())
+		require.NoError(t, err)
+
+		_, err = s.Get(context.Background(), claim.Link())
+		require.ErrorIs(t, err, store.ErrNotFound)
+
+		links, err := s.ListByContent(context.Background(), digest)
+		require.NoError(t, err)
+		require.Empty(t, links)
+
+		// deleting a non-existent claim is not an error
+		err = s.Delete(context.Background(), claim.Link())
+		require.NoError(t, err)
+	})
+
+	t.Run("list expiring", func(t *testing.T) {
+		s := newStore(t)
+		later := randomLocationClaim(t, testutil.RandomMultihash(t), delegation.WithExpiration(2000))
+		sooner := randomLocationClaim(t, testutil.RandomMultihash(t), delegation.WithExpiration(1000))
+		never := randomLocationClaim(t, testutil.RandomMultihash(t))
+		for _, claim := range []delegation.Delegation{later, sooner, never} {
+			err := s.Put(context.Background(), claim)
+			require.NoError(t, err)
+		}
+
+		links, err := s.ListExpiring(context.Background(), 1500)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{sooner.Link()}, links)
+
+		links, err = s.ListExpiring(context.Background(), 2000)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{sooner.Link(), later.Link()}, links)
+
+		err = s.Delete(context.Background(), sooner.Link())
+		require.NoError(t, err)
+
+		links, err = s.ListExpiring(context.Background(), 2000)
+		require.NoError(t, err)
+		require.Equal(t, []ucan.Link{later.Link()}, links)
+	})
+}
@@ -1,11 +1,38 @@
 package delegationstore
 
 import (
+	"context"
+	"errors"
+	"io"
+
 	"github.com/ipfs/go-datastore"
 	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+
+	piristore "github.com/storacha/piri/pkg/store"
 )
 
 // NewDsDelegationStore creates a [DelegationStore] backed by an IPFS datastore.
 func NewDsDelegationStore(ds datastore.Datastore) (DelegationStore, error) {
-	return NewDelegationStore(store.SimpleStoreFromDatastore(ds))
+	return NewDelegationStore(&dsStore{store.SimpleStoreFromDatastore(ds), ds})
 }
+
+// dsStore adds removals to the simple datastore adapter, and reports missing
+// keys with [piristore.ErrNotFound] like the other stores do.
+type dsStore struct {
+	store.Store
+	ds datastore.Datastore
+}
+
+func (d *dsStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := d.Store.Get(ctx, key)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, piristore.ErrNotFound
+	}
+	return r, err
+}
+
+func (d *dsStore) Delete(ctx context.Context, key string) error {
+	return d.ds.Delete(ctx, datastore.NewKey(key))
+}
+
+var _ DeletableStore = (*dsStore)(nil)
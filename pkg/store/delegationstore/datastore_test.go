@@ -9,6 +9,7 @@ import (
 	"github.com/storacha/go-ucanto/core/result/ok"
 	"github.com/storacha/go-ucanto/ucan"
 	"github.com/storacha/piri/pkg/internal/testutil"
+	piristore "github.com/storacha/piri/pkg/store"
 	"github.com/stretchr/testify/require"
 )
 
@@ -33,4 +34,12 @@ func TestDsDelegationStore(t *testing.T) {
 		require.NoError(t, err)
 		testutil.RequireEqualDelegation(t, dlg, res)
 	})
+
+	t.Run("not found", func(t *testing.T) {
+		store, err := NewDsDelegationStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		_, err = store.Get(context.Background(), testutil.RandomCID(t))
+		require.ErrorIs(t, err, piristore.ErrNotFound)
+	})
 }
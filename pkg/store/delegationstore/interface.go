@@ -13,4 +13,7 @@ type DelegationStore interface {
 	Get(context.Context, ucan.Link) (delegation.Delegation, error)
 	// Put adds or replaces a delegation in the store.
 	Put(context.Context, delegation.Delegation) error
+	// Delete removes a delegation from the store by it's root CID. It is not an
+	// error to delete a delegation that does not exist.
+	Delete(context.Context, ucan.Link) error
 }
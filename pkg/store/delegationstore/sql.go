@@ -0,0 +1,99 @@
+package delegationstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/ucan"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/storacha/piri/pkg/store"
+)
+
+// delegationRecord is a row in the delegations table. The archived delegation
+// is stored alongside the fields most useful for querying.
+type delegationRecord struct {
+	Root       string    `gorm:"primaryKey;column:root"`
+	Issuer     string    `gorm:"not null;index;column:issuer"`
+	Audience   string    `gorm:"not null;index;column:audience"`
+	Ability    string    `gorm:"not null;index;column:ability;comment:Ability of the first capability"`
+	Expiration *int64    `gorm:"index;column:expiration;comment:Seconds since unix epoch, null if the delegation does not expire"`
+	Data       []byte    `gorm:"not null;column:data;comment:CAR archive of the delegation"`
+	CreatedAt  time.Time `gorm:"not null;index;column:created_at"`
+}
+
+func (delegationRecord) TableName() string {
+	return "delegations"
+}
+
+// SQLDelegationStore is a [DelegationStore] backed by a SQL database, such as
+// SQLite or PostgreSQL.
+type SQLDelegationStore struct {
+	db *gorm.DB
+}
+
+func (s *SQLDelegationStore) Get(ctx context.Context, root ucan.Link) (delegation.Delegation, error) {
+	var record delegationRecord
+	err := s.db.WithContext(ctx).Where("root = ?", root.String()).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("getting delegation %s: %w", root, store.ErrNotFound)
+		}
+		return nil, fmt.Errorf("getting delegation %s: %w", root, err)
+	}
+	dlg, err := delegation.Extract(record.Data)
+	if err != nil {
+		return nil, fmt.Errorf("extracting delegation: %w", err)
+	}
+	return dlg, nil
+}
+
+func (s *SQLDelegationStore) Put(ctx context.Context, dlg delegation.Delegation) error {
+	b, err := io.ReadAll(dlg.Archive())
+	if err != nil {
+		return fmt.Errorf("archiving delegation: %w", err)
+	}
+	record := delegationRecord{
+		Root:     dlg.Link().String(),
+		Issuer:   dlg.Issuer().DID().String(),
+		Audience: dlg.Audience().DID().String(),
+		Data:     b,
+	}
+	if caps := dlg.Capabilities(); len(caps) > 0 {
+		record.Ability = caps[0].Can()
+	}
+	if exp := dlg.Expiration(); exp != nil {
+		e := int64(*exp)
+		record.Expiration = &e
+	}
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("writing delegation: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLDelegationStore) Delete(ctx context.Context, root ucan.Link) error {
+	err := s.db.WithContext(ctx).Where("root = ?", root.String()).Delete(&delegationRecord{}).Error
+	if err != nil {
+		return fmt.Errorf("deleting delegation: %w", err)
+	}
+	return nil
+}
+
+var _ DelegationStore = (*SQLDelegationStore)(nil)
+
+// NewSQLDelegationStore creates a [DelegationStore] backed by a SQL database,
+// creating or migrating the delegations table as necessary.
+func NewSQLDelegationStore(db *gorm.DB) (*SQLDelegationStore, error) {
+	err := db.AutoMigrate(&delegationRecord{})
+	if err != nil {
+		return nil, fmt.Errorf("migrating delegations table: %w", err)
+	}
+	return &SQLDelegationStore{db}, nil
+}
@@ -0,0 +1,52 @@
+package delegationstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/core/result/ok"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/database/gormdb"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+)
+
+func TestSQLDelegationStore(t *testing.T) {
+	db, err := gormdb.New(filepath.Join(t.TempDir(), "delegations.db"))
+	require.NoError(t, err)
+	s, err := NewSQLDelegationStore(db)
+	require.NoError(t, err)
+
+	dlg, err := delegation.Delegate(
+		testutil.RandomSigner(t),
+		testutil.RandomDID(t),
+		[]ucan.Capability[ok.Unit]{
+			ucan.NewCapability("test/test", testutil.RandomDID(t).String(), ok.Unit{}),
+		},
+	)
+	require.NoError(t, err)
+
+	t.Run("roundtrip", func(t *testing.T) {
+		err = s.Put(context.Background(), dlg)
+		require.NoError(t, err)
+		// putting again is not an error
+		err = s.Put(context.Background(), dlg)
+		require.NoError(t, err)
+
+		res, err := s.Get(context.Background(), dlg.Link())
+		require.NoError(t, err)
+		testutil.RequireEqualDelegation(t, dlg, res)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		err = s.Delete(context.Background(), dlg.Link())
+		require.NoError(t, err)
+
+		_, err = s.Get(context.Background(), dlg.Link())
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+}
@@ -3,6 +3,7 @@ package delegationstore
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
@@ -11,6 +12,16 @@ import (
 	"github.com/storacha/go-ucanto/ucan"
 )
 
+// DeletableStore is a [store.Store] that also allows items to be removed.
+type DeletableStore interface {
+	store.Store
+	Delete(ctx context.Context, key string) error
+}
+
+// ErrDeleteNotSupported is returned when deleting from a delegation store
+// whose underlying store does not support removals.
+var ErrDeleteNotSupported = errors.New("delete not supported by underlying store")
+
 type delegationStore struct {
 	data store.Store
 }
@@ -46,6 +57,18 @@ func (d *delegationStore) Get(ctx context.Context, root ucan.Link) (delegation.D
 	return dlg, nil
 }
 
+func (d *delegationStore) Delete(ctx context.Context, root ucan.Link) error {
+	ds, ok := d.data.(DeletableStore)
+	if !ok {
+		return ErrDeleteNotSupported
+	}
+	err := ds.Delete(ctx, root.String())
+	if err != nil {
+		return fmt.Errorf("deleting from datastore: %w", err)
+	}
+	return nil
+}
+
 // NewDelegationStore creates a [DelegationStore] backed by a simple store interface
 func NewDelegationStore(store store.Store) (DelegationStore, error) {
 	return &delegationStore{store}, nil
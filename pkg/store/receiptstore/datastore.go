@@ -2,6 +2,7 @@ package receiptstore
 
 import (
 	"context"
+	"errors"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
@@ -9,6 +10,8 @@ import (
 	"github.com/ipld/go-ipld-prime/datamodel"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/storacha/go-libstoracha/ipnipublisher/store"
+
+	piristore "github.com/storacha/piri/pkg/store"
 )
 
 const receiptsPrefix = "receipts/"
@@ -29,6 +32,9 @@ type dsRanLinkIndex struct {
 func (d *dsRanLinkIndex) Get(ctx context.Context, ran datamodel.Link) (datamodel.Link, error) {
 	data, err := d.ds.Get(ctx, datastore.NewKey(ran.String()))
 	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return nil, piristore.ErrNotFound
+		}
 		return nil, err
 	}
 	c, err := cid.Cast(data)
@@ -7,6 +7,7 @@ import (
 	"io"
 
 	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/schema"
 	"github.com/storacha/go-libstoracha/ipnipublisher/store"
 	"github.com/storacha/go-ucanto/core/car"
 	"github.com/storacha/go-ucanto/core/dag/blockstore"
@@ -15,6 +16,25 @@ import (
 	"github.com/storacha/go-ucanto/ucan"
 )
 
+// anyResultSchema describes the result of a receipt whose success and error
+// types are not known. It differs from the schema provided by go-ucanto only in
+// naming the error field so that it binds to the error of the result model,
+// which allows failure receipts to be decoded.
+var anyResultSchema = []byte(`
+type Result struct {
+	ok optional Any
+	err optional Any (rename "error")
+}
+`)
+
+var anyReceiptType = func() schema.Type {
+	typ, err := rdm.NewReceiptModelType(anyResultSchema)
+	if err != nil {
+		panic(fmt.Errorf("loading receipt schema: %w", err))
+	}
+	return typ
+}()
+
 type RanLinkIndex interface {
 	Put(ctx context.Context, ran datamodel.Link, lnk datamodel.Link) error
 	Get(ctx context.Context, ran datamodel.Link) (datamodel.Link, error)
@@ -45,7 +65,7 @@ func (rs *receiptStore) Put(ctx context.Context, rcpt receipt.AnyReceipt) error
 	return nil
 }
 
-func (rs *receiptStore) getFromReader(r io.Reader) (receipt.AnyReceipt, error) {
+func decodeReceipt(r io.Reader) (receipt.AnyReceipt, error) {
 	roots, blocks, err := car.Decode(r)
 	if err != nil {
 		return nil, fmt.Errorf("decoding car file: %w", err)
@@ -54,7 +74,7 @@ func (rs *receiptStore) getFromReader(r io.Reader) (receipt.AnyReceipt, error) {
 	if err != nil {
 		return nil, fmt.Errorf("setting up block reader: %w", err)
 	}
-	rcpt, err := receipt.NewReceipt[datamodel.Node, datamodel.Node](roots[0], br, rdm.TypeSystem().TypeByName("Receipt"))
+	rcpt, err := receipt.NewReceipt[datamodel.Node, datamodel.Node](roots[0], br, anyReceiptType)
 	if err != nil {
 		return nil, fmt.Errorf("decoding receipt: %w", err)
 	}
@@ -68,7 +88,7 @@ func (rs *receiptStore) Get(ctx context.Context, root ucan.Link) (receipt.AnyRec
 		return nil, fmt.Errorf("getting from store: %w", err)
 	}
 	defer r.Close()
-	return rs.getFromReader(r)
+	return decodeReceipt(r)
 }
 
 func (rs *receiptStore) GetByRan(ctx context.Context, ran datamodel.Link) (receipt.AnyReceipt, error) {
@@ -81,7 +101,7 @@ func (rs *receiptStore) GetByRan(ctx context.Context, ran datamodel.Link) (recei
 		return nil, fmt.Errorf("getting from store: %w", err)
 	}
 	defer r.Close()
-	return rs.getFromReader(r)
+	return decodeReceipt(r)
 }
 
 var _ ReceiptStore = (*receiptStore)(nil)
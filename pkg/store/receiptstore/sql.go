@@ -0,0 +1,105 @@
+package receiptstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/storacha/go-ucanto/core/car"
+	"github.com/storacha/go-ucanto/core/receipt"
+	"github.com/storacha/go-ucanto/core/result"
+	"github.com/storacha/go-ucanto/ucan"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/storacha/piri/pkg/store"
+)
+
+// receiptRecord is a row in the receipts table. The archived receipt is
+// stored alongside the fields most useful for querying.
+type receiptRecord struct {
+	Root      string    `gorm:"primaryKey;column:root"`
+	Ran       string    `gorm:"not null;index;column:ran;comment:CID of the invocation the receipt is for"`
+	Issuer    string    `gorm:"column:issuer"`
+	Ability   string    `gorm:"index;column:ability;comment:Ability invoked, empty if the invocation is not included"`
+	Ok        bool      `gorm:"not null;column:ok;comment:Whether the invocation succeeded"`
+	Data      []byte    `gorm:"not null;column:data;comment:CAR archive of the receipt"`
+	CreatedAt time.Time `gorm:"not null;index;column:created_at"`
+}
+
+func (receiptRecord) TableName() string {
+	return "receipts"
+}
+
+// SQLReceiptStore is a [ReceiptStore] backed by a SQL database, such as SQLite
+// or PostgreSQL.
+type SQLReceiptStore struct {
+	db *gorm.DB
+}
+
+func (s *SQLReceiptStore) Get(ctx context.Context, root ucan.Link) (receipt.AnyReceipt, error) {
+	return s.get(ctx, "root = ?", root)
+}
+
+func (s *SQLReceiptStore) GetByRan(ctx context.Context, ran ucan.Link) (receipt.AnyReceipt, error) {
+	return s.get(ctx, "ran = ?", ran)
+}
+
+func (s *SQLReceiptStore) get(ctx context.Context, query string, link ucan.Link) (receipt.AnyReceipt, error) {
+	var record receiptRecord
+	// the most recent receipt wins if an invocation was executed more than once
+	err := s.db.WithContext(ctx).Where(query, link.String()).Order("created_at DESC").First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("getting receipt %s: %w", link, store.ErrNotFound)
+		}
+		return nil, fmt.Errorf("getting receipt %s: %w", link, err)
+	}
+	return decodeReceipt(bytes.NewReader(record.Data))
+}
+
+func (s *SQLReceiptStore) Put(ctx context.Context, rcpt receipt.AnyReceipt) error {
+	b, err := io.ReadAll(car.Encode([]datamodel.Link{rcpt.Root().Link()}, rcpt.Blocks()))
+	if err != nil {
+		return fmt.Errorf("archiving receipt: %w", err)
+	}
+
+	record := receiptRecord{
+		Root: rcpt.Root().Link().String(),
+		Ran:  rcpt.Ran().Link().String(),
+		Ok: result.MatchResultR1(rcpt.Out(), func(datamodel.Node) bool {
+			return true
+		}, func(datamodel.Node) bool {
+			return false
+		}),
+		Data: b,
+	}
+	if iss := rcpt.Issuer(); iss != nil {
+		record.Issuer = iss.DID().String()
+	}
+	if caps := rcpt.Ran().Capabilities(); len(caps) > 0 {
+		record.Ability = caps[0].Can()
+	}
+
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("writing receipt: %w", err)
+	}
+	return nil
+}
+
+var _ ReceiptStore = (*SQLReceiptStore)(nil)
+
+// NewSQLReceiptStore creates a [ReceiptStore] backed by a SQL database,
+// creating or migrating the receipts table as necessary.
+func NewSQLReceiptStore(db *gorm.DB) (*SQLReceiptStore, error) {
+	err := db.AutoMigrate(&receiptRecord{})
+	if err != nil {
+		return nil, fmt.Errorf("migrating receipts table: %w", err)
+	}
+	return &SQLReceiptStore{db}, nil
+}
@@ -0,0 +1,91 @@
+package receiptstore
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/storacha/go-ucanto/core/invocation"
+	"github.com/storacha/go-ucanto/core/invocation/ran"
+	"github.com/storacha/go-ucanto/core/ipld"
+	"github.com/storacha/go-ucanto/core/receipt"
+	"github.com/storacha/go-ucanto/core/result"
+	"github.com/storacha/go-ucanto/core/result/failure"
+	"github.com/storacha/go-ucanto/core/result/ok"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+
+	"github.com/storacha/piri/pkg/database/gormdb"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+)
+
+func TestSQLReceiptStore(t *testing.T) {
+	db, err := gormdb.New(filepath.Join(t.TempDir(), "receipts.db"))
+	require.NoError(t, err)
+	s, err := NewSQLReceiptStore(db)
+	require.NoError(t, err)
+
+	issuer := testutil.RandomSigner(t)
+	inv, err := invocation.Invoke(
+		issuer,
+		testutil.RandomDID(t),
+		ucan.NewCapability("test/test", issuer.DID().String(), ok.Unit{}),
+	)
+	require.NoError(t, err)
+	rcpt, err := receipt.Issue(issuer, result.Ok[ok.Unit, ipld.Builder](ok.Unit{}), ran.FromInvocation(inv))
+	require.NoError(t, err)
+
+	err = s.Put(context.Background(), rcpt)
+	require.NoError(t, err)
+	// putting again is not an error
+	err = s.Put(context.Background(), rcpt)
+	require.NoError(t, err)
+
+	t.Run("get", func(t *testing.T) {
+		res, err := s.Get(context.Background(), rcpt.Root().Link())
+		require.NoError(t, err)
+		require.Equal(t, rcpt.Root().Link(), res.Root().Link())
+		require.Equal(t, inv.Link(), res.Ran().Link())
+	})
+
+	t.Run("get by ran", func(t *testing.T) {
+		res, err := s.GetByRan(context.Background(), inv.Link())
+		require.NoError(t, err)
+		require.Equal(t, rcpt.Root().Link(), res.Root().Link())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := s.GetByRan(context.Background(), testutil.RandomCID(t))
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+
+	t.Run("failure receipt", func(t *testing.T) {
+		inv, err := invocation.Invoke(
+			issuer,
+			testutil.RandomDID(t),
+			ucan.NewCapability("test/fail", issuer.DID().String(), ok.Unit{}),
+		)
+		require.NoError(t, err)
+		fail := result.Error[ok.Unit, ipld.Builder](failure.FromError(errors.New("boom")))
+		rcpt, err := receipt.Issue(issuer, fail, ran.FromInvocation(inv))
+		require.NoError(t, err)
+
+		err = s.Put(context.Background(), rcpt)
+		require.NoError(t, err)
+
+		res, err := s.GetByRan(context.Background(), inv.Link())
+		require.NoError(t, err)
+		require.Equal(t, rcpt.Root().Link(), res.Root().Link())
+		_, x := result.Unwrap(res.Out())
+		require.NotNil(t, x)
+	})
+
+	t.Run("queryable", func(t *testing.T) {
+		var n int64
+		err := db.Table("receipts").Where("ability = ? AND ok", "test/test").Count(&n).Error
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+	})
+}
@@ -0,0 +1,79 @@
+package scrubstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/scrubstore/scrub"
+)
+
+type DsScrubStore struct {
+	data datastore.Datastore
+}
+
+func (d *DsScrubStore) Get(ctx context.Context, digest multihash.Multihash) (scrub.Result, error) {
+	b, err := d.data.Get(ctx, encodeKey(digest))
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return scrub.Result{}, store.ErrNotFound
+		}
+		return scrub.Result{}, fmt.Errorf("getting from datastore: %w", err)
+	}
+	r, err := scrub.Decode(b, dagcbor.Decode)
+	if err != nil {
+		return scrub.Result{}, fmt.Errorf("decoding data: %w", err)
+	}
+	return r, nil
+}
+
+func (d *DsScrubStore) Put(ctx context.Context, result scrub.Result) error {
+	b, err := scrub.Encode(result, dagcbor.Encode)
+	if err != nil {
+		return fmt.Errorf("encoding data: %w", err)
+	}
+	err = d.data.Put(ctx, encodeKey(result.Digest), b)
+	if err != nil {
+		return fmt.Errorf("writing to datastore: %w", err)
+	}
+	return nil
+}
+
+func (d *DsScrubStore) List(ctx context.Context, status scrub.Status) ([]scrub.Result, error) {
+	results, err := d.data.Query(ctx, query.Query{})
+	if err != nil {
+		return nil, fmt.Errorf("querying datastore: %w", err)
+	}
+
+	var list []scrub.Result
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, fmt.Errorf("iterating query results: %w", entry.Error)
+		}
+		r, err := scrub.Decode(entry.Value, dagcbor.Decode)
+		if err != nil {
+			return nil, fmt.Errorf("decoding data: %w", err)
+		}
+		if r.Status == status {
+			list = append(list, r)
+		}
+	}
+	return list, nil
+}
+
+var _ ScrubStore = (*DsScrubStore)(nil)
+
+// NewDsScrubStore creates a [ScrubStore] backed by an IPFS datastore.
+func NewDsScrubStore(ds datastore.Datastore) (*DsScrubStore, error) {
+	return &DsScrubStore{ds}, nil
+}
+
+func encodeKey(digest multihash.Multihash) datastore.Key {
+	return datastore.NewKey(digestutil.Format(digest))
+}
@@ -0,0 +1,67 @@
+package scrubstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store"
+	"github.com/storacha/piri/pkg/store/scrubstore/scrub"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDsScrubStore(t *testing.T) {
+	t.Run("roundtrip", func(t *testing.T) {
+		s, err := NewDsScrubStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		result := scrub.Result{
+			Digest:      testutil.RandomMultihash(t),
+			Size:        138,
+			Status:      scrub.StatusCorrupt,
+			Checked:     uint64(time.Now().Unix()),
+			Quarantined: true,
+			Message:     "data consistency check failed",
+		}
+
+		err = s.Put(context.Background(), result)
+		require.NoError(t, err)
+
+		r, err := s.Get(context.Background(), result.Digest)
+		require.NoError(t, err)
+		require.Equal(t, result, r)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s, err := NewDsScrubStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		_, err = s.Get(context.Background(), testutil.RandomMultihash(t))
+		require.ErrorIs(t, err, store.ErrNotFound)
+	})
+
+	t.Run("list by status", func(t *testing.T) {
+		s, err := NewDsScrubStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		ok := scrub.Result{Digest: testutil.RandomMultihash(t), Status: scrub.StatusOK}
+		corrupt := scrub.Result{Digest: testutil.RandomMultihash(t), Status: scrub.StatusCorrupt}
+		require.NoError(t, s.Put(context.Background(), ok))
+		require.NoError(t, s.Put(context.Background(), corrupt))
+
+		results, err := s.List(context.Background(), scrub.StatusCorrupt)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, corrupt, results[0])
+
+		// a subsequent check replaces the previous result
+		corrupt.Status = scrub.StatusOK
+		require.NoError(t, s.Put(context.Background(), corrupt))
+
+		results, err = s.List(context.Background(), scrub.StatusCorrupt)
+		require.NoError(t, err)
+		require.Empty(t, results)
+	})
+}
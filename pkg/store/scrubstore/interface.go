@@ -0,0 +1,20 @@
+package scrubstore
+
+import (
+	"context"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/piri/pkg/store/scrubstore/scrub"
+)
+
+// ScrubStore records the outcome of integrity checks performed on stored
+// blobs.
+type ScrubStore interface {
+	// Get retrieves the most recent result for the blob identified by the passed
+	// digest. Returns [store.ErrNotFound] if the blob has not been checked.
+	Get(context.Context, multihash.Multihash) (scrub.Result, error)
+	// Put adds or replaces the result for a blob.
+	Put(context.Context, scrub.Result) error
+	// List retrieves the most recent results that have the passed status.
+	List(context.Context, scrub.Status) ([]scrub.Result, error)
+}
@@ -0,0 +1,105 @@
+package scrub
+
+import (
+	"bytes"
+	// for go:embed
+	_ "embed"
+	"fmt"
+
+	ipldprime "github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-libstoracha/capabilities/types"
+	"github.com/storacha/go-ucanto/core/ipld"
+)
+
+//go:embed result.ipldsch
+var resultSchema []byte
+
+var resultTS *schema.TypeSystem
+
+func init() {
+	ts, err := ipldprime.LoadSchemaBytes(resultSchema)
+	if err != nil {
+		panic(fmt.Errorf("loading scrub result schema: %w", err))
+	}
+	resultTS = ts
+}
+
+func ResultType() schema.Type {
+	return resultTS.TypeByName("Result")
+}
+
+// Status is the outcome of checking a blob.
+type Status = string
+
+const (
+	// StatusOK indicates the blob hashed to its digest.
+	StatusOK Status = "ok"
+	// StatusCorrupt indicates the blob did not hash to its digest, or was
+	// truncated.
+	StatusCorrupt Status = "corrupt"
+	// StatusError indicates the blob could not be read for a reason that does
+	// not show it is corrupt, such as an I/O error. It should be checked again.
+	StatusError Status = "error"
+)
+
+type Result struct {
+	// Digest is the hash the blob is expected to have.
+	Digest multihash.Multihash
+	// Size is the number of bytes read from the store.
+	Size uint64
+	// Status is the outcome of the check.
+	Status Status
+	// Checked is the time (in seconds since unix epoch) the blob was checked.
+	Checked uint64
+	// Quarantined indicates the blob was moved out of the store.
+	Quarantined bool
+	// Message describes why the blob is corrupt or could not be checked. It is
+	// empty for blobs that are OK.
+	Message string
+}
+
+func (r Result) ToIPLD() (datamodel.Node, error) {
+	return ipld.WrapWithRecovery(&r, ResultType(), types.Converters...)
+}
+
+func Encode(result Result, enc codec.Encoder) ([]byte, error) {
+	n, err := result.ToIPLD()
+	if err != nil {
+		return nil, fmt.Errorf("encoding to IPLD: %w", err)
+	}
+
+	if enc == nil {
+		enc = dagcbor.Encode
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	err = enc(n, buf)
+	if err != nil {
+		return nil, fmt.Errorf("encoding to data format: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func Decode(data []byte, dec codec.Decoder) (Result, error) {
+	if dec == nil {
+		dec = dagcbor.Decode
+	}
+
+	nb := bindnode.Prototype((*Result)(nil), ResultType(), types.Converters...).NewBuilder()
+
+	err := dec(nb, bytes.NewBuffer(data))
+	if err != nil {
+		return Result{}, fmt.Errorf("decoding from data format: %w", err)
+	}
+
+	nd := nb.Build()
+	r := bindnode.Unwrap(nd).(*Result)
+	return *r, nil
+}
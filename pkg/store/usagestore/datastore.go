@@ -0,0 +1,217 @@
+package usagestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/piri/pkg/internal/digestutil"
+	"github.com/storacha/piri/pkg/store/usagestore/usage"
+)
+
+var totalKey = datastore.NewKey("total")
+
+// DsUsageStore keeps the usage of every blob in every space, and running
+// totals for each space and the node, so that usage can be read without
+// summing the blobs.
+type DsUsageStore struct {
+	data  datastore.Batching
+	quota Quota
+	// mu serializes updates, which read and then write several records.
+	mu sync.Mutex
+}
+
+func (d *DsUsageStore) Allocate(ctx context.Context, space did.DID, digest multihash.Multihash, size uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.get(ctx, blobKey(space, digest))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, datastore.ErrNotFound) {
+		return err
+	}
+
+	su, err := d.getOrZero(ctx, spaceKey(space))
+	if err != nil {
+		return err
+	}
+	if d.quota.Space > 0 && su.Allocated+size > d.quota.Space {
+		return QuotaExceededError{Space: space, Used: su.Allocated, Requested: size, Limit: d.quota.Space}
+	}
+	total, err := d.getOrZero(ctx, totalKey)
+	if err != nil {
+		return err
+	}
+	if d.quota.Node > 0 && total.Allocated+size > d.quota.Node {
+		return QuotaExceededError{Used: total.Allocated, Requested: size, Limit: d.quota.Node}
+	}
+
+	su.Allocated += size
+	total.Allocated += size
+	return d.put(ctx, map[datastore.Key]usage.Usage{
+		blobKey(space, digest): {Allocated: size},
+		spaceKey(space):        su,
+		totalKey:               total,
+	})
+}
+
+func (d *DsUsageStore) Receive(ctx context.Context, space did.DID, digest multihash.Multihash) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bu, err := d.get(ctx, blobKey(space, digest))
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if bu.Received == bu.Allocated {
+		return nil
+	}
+
+	su, err := d.getOrZero(ctx, spaceKey(space))
+	if err != nil {
+		return err
+	}
+	total, err := d.getOrZero(ctx, totalKey)
+	if err != nil {
+		return err
+	}
+
+	n := bu.Allocated - bu.Received
+	bu.Received = bu.Allocated
+	su.Received += n
+	total.Received += n
+	return d.put(ctx, map[datastore.Key]usage.Usage{
+		blobKey(space, digest): bu,
+		spaceKey(space):        su,
+		totalKey:               total,
+	})
+}
+
+func (d *DsUsageStore) Release(ctx context.Context, space did.DID, digest multihash.Multihash) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bu, err := d.get(ctx, blobKey(space, digest))
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	su, err := d.getOrZero(ctx, spaceKey(space))
+	if err != nil {
+		return err
+	}
+	total, err := d.getOrZero(ctx, totalKey)
+	if err != nil {
+		return err
+	}
+
+	su = subtract(su, bu)
+	total = subtract(total, bu)
+	return d.put(ctx, map[datastore.Key]usage.Usage{spaceKey(space): su, totalKey: total}, blobKey(space, digest))
+}
+
+func (d *DsUsageStore) Get(ctx context.Context, space did.DID) (usage.Usage, error) {
+	return d.getOrZero(ctx, spaceKey(space))
+}
+
+func (d *DsUsageStore) Total(ctx context.Context) (usage.Usage, error) {
+	return d.getOrZero(ctx, totalKey)
+}
+
+func (d *DsUsageStore) Quota() Quota {
+	return d.quota
+}
+
+func (d *DsUsageStore) get(ctx context.Context, k datastore.Key) (usage.Usage, error) {
+	b, err := d.data.Get(ctx, k)
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return usage.Usage{}, err
+		}
+		return usage.Usage{}, fmt.Errorf("getting from datastore: %w", err)
+	}
+	u, err := usage.Decode(b, dagcbor.Decode)
+	if err != nil {
+		return usage.Usage{}, fmt.Errorf("decoding data: %w", err)
+	}
+	return u, nil
+}
+
+func (d *DsUsageStore) getOrZero(ctx context.Context, k datastore.Key) (usage.Usage, error) {
+	u, err := d.get(ctx, k)
+	if err != nil && !errors.Is(err, datastore.ErrNotFound) {
+		return usage.Usage{}, err
+	}
+	return u, nil
+}
+
+// put writes the records and removes the deleted keys in a single batch, so
+// that the totals never disagree with the blobs they are made up of.
+func (d *DsUsageStore) put(ctx context.Context, records map[datastore.Key]usage.Usage, deleted ...datastore.Key) error {
+	batch, err := d.data.Batch(ctx)
+	if err != nil {
+		return fmt.Errorf("creating batch: %w", err)
+	}
+	for k, u := range records {
+		b, err := usage.Encode(u, dagcbor.Encode)
+		if err != nil {
+			return fmt.Errorf("encoding data: %w", err)
+		}
+		err = batch.Put(ctx, k, b)
+		if err != nil {
+			return fmt.Errorf("writing to batch: %w", err)
+		}
+	}
+	for _, k := range deleted {
+		err = batch.Delete(ctx, k)
+		if err != nil {
+			return fmt.Errorf("deleting in batch: %w", err)
+		}
+	}
+	err = batch.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("writing to datastore: %w", err)
+	}
+	return nil
+}
+
+var _ UsageStore = (*DsUsageStore)(nil)
+
+// NewDsUsageStore creates a [UsageStore] backed by an IPFS datastore. Each
+// update is written in a single batch.
+func NewDsUsageStore(ds datastore.Batching, opts ...Option) (*DsUsageStore, error) {
+	d := &DsUsageStore{data: ds}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d, nil
+}
+
+func spaceKey(space did.DID) datastore.Key {
+	return datastore.NewKey("space").ChildString(space.String())
+}
+
+func blobKey(space did.DID, digest multihash.Multihash) datastore.Key {
+	return datastore.NewKey("blob").ChildString(space.String()).ChildString(digestutil.Format(digest))
+}
+
+// subtract removes the usage of a blob from a running total, clamping at zero
+// so that a total can never wrap around.
+func subtract(total usage.Usage, blob usage.Usage) usage.Usage {
+	total.Allocated -= min(total.Allocated, blob.Allocated)
+	total.Received -= min(total.Received, blob.Received)
+	return total
+}
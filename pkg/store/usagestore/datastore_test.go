@@ -0,0 +1,115 @@
+package usagestore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/storacha/piri/pkg/internal/testutil"
+	"github.com/storacha/piri/pkg/store/usagestore/usage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDsUsageStore(t *testing.T) {
+	t.Run("allocate, receive and release", func(t *testing.T) {
+		s, err := NewDsUsageStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		space := testutil.RandomDID(t)
+		blob0, blob1 := testutil.RandomMultihash(t), testutil.RandomMultihash(t)
+
+		require.NoError(t, s.Allocate(ctx, space, blob0, 100))
+		require.NoError(t, s.Allocate(ctx, space, blob1, 50))
+		// allocating again is not counted twice
+		require.NoError(t, s.Allocate(ctx, space, blob0, 100))
+
+		u, err := s.Get(ctx, space)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{Allocated: 150}, u)
+
+		require.NoError(t, s.Receive(ctx, space, blob0))
+		require.NoError(t, s.Receive(ctx, space, blob0))
+
+		u, err = s.Get(ctx, space)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{Allocated: 150, Received: 100}, u)
+
+		require.NoError(t, s.Release(ctx, space, blob0))
+		require.NoError(t, s.Release(ctx, space, blob0))
+
+		u, err = s.Get(ctx, space)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{Allocated: 50}, u)
+
+		// receiving a blob that is not allocated has no effect
+		require.NoError(t, s.Receive(ctx, space, blob0))
+		u, err = s.Get(ctx, space)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{Allocated: 50}, u)
+	})
+
+	t.Run("totals across spaces", func(t *testing.T) {
+		s, err := NewDsUsageStore(datastore.NewMapDatastore())
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		space0, space1 := testutil.RandomDID(t), testutil.RandomDID(t)
+		blob := testutil.RandomMultihash(t)
+
+		require.NoError(t, s.Allocate(ctx, space0, blob, 100))
+		require.NoError(t, s.Allocate(ctx, space1, blob, 100))
+		require.NoError(t, s.Receive(ctx, space0, blob))
+
+		total, err := s.Total(ctx)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{Allocated: 200, Received: 100}, total)
+
+		u, err := s.Get(ctx, testutil.RandomDID(t))
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{}, u)
+	})
+
+	t.Run("space quota", func(t *testing.T) {
+		s, err := NewDsUsageStore(datastore.NewMapDatastore(), WithSpaceQuota(100))
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		space := testutil.RandomDID(t)
+		blob := testutil.RandomMultihash(t)
+
+		require.NoError(t, s.Allocate(ctx, space, blob, 60))
+		// already allocated, so the quota is not checked
+		require.NoError(t, s.Allocate(ctx, space, blob, 60))
+
+		err = s.Allocate(ctx, space, testutil.RandomMultihash(t), 41)
+		var qerr QuotaExceededError
+		require.ErrorAs(t, err, &qerr)
+		require.Equal(t, "SpaceQuotaExceeded", qerr.Name())
+		require.Equal(t, QuotaExceededError{Space: space, Used: 60, Requested: 41, Limit: 100}, qerr)
+
+		require.NoError(t, s.Allocate(ctx, space, testutil.RandomMultihash(t), 40))
+		// other spaces have their own quota
+		require.NoError(t, s.Allocate(ctx, testutil.RandomDID(t), testutil.RandomMultihash(t), 100))
+	})
+
+	t.Run("node quota", func(t *testing.T) {
+		s, err := NewDsUsageStore(datastore.NewMapDatastore(), WithNodeQuota(100))
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		require.NoError(t, s.Allocate(ctx, testutil.RandomDID(t), testutil.RandomMultihash(t), 60))
+
+		space := testutil.RandomDID(t)
+		blob := testutil.RandomMultihash(t)
+		err = s.Allocate(ctx, space, blob, 60)
+		var qerr QuotaExceededError
+		require.ErrorAs(t, err, &qerr)
+		require.Equal(t, "NodeQuotaExceeded", qerr.Name())
+		require.Equal(t, uint64(60), qerr.Used)
+
+		u, err := s.Get(ctx, space)
+		require.NoError(t, err)
+		require.Equal(t, usage.Usage{}, u)
+	})
+}
@@ -0,0 +1,35 @@
+package usagestore
+
+import (
+	"fmt"
+
+	"github.com/storacha/go-ucanto/did"
+)
+
+// QuotaExceededError is returned when an allocation would take the bytes
+// allocated by a space, or by the node as a whole, over the configured quota.
+type QuotaExceededError struct {
+	// Space is the space that made the allocation. It is undefined when the
+	// node quota was exceeded.
+	Space did.DID
+	// Used is the number of bytes already allocated.
+	Used uint64
+	// Requested is the number of bytes that were requested.
+	Requested uint64
+	// Limit is the quota that would be exceeded.
+	Limit uint64
+}
+
+func (qe QuotaExceededError) Name() string {
+	if qe.Space == did.Undef {
+		return "NodeQuotaExceeded"
+	}
+	return "SpaceQuotaExceeded"
+}
+
+func (qe QuotaExceededError) Error() string {
+	if qe.Space == did.Undef {
+		return fmt.Sprintf("allocating %d bytes exceeds node quota of %d bytes (%d bytes used)", qe.Requested, qe.Limit, qe.Used)
+	}
+	return fmt.Sprintf("allocating %d bytes exceeds quota of %d bytes for space %s (%d bytes used)", qe.Requested, qe.Limit, qe.Space, qe.Used)
+}
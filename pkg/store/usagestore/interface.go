@@ -0,0 +1,35 @@
+package usagestore
+
+import (
+	"context"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/piri/pkg/store/usagestore/usage"
+)
+
+// UsageStore is a ledger of the bytes allocated and received by each space.
+// Bytes are counted once per blob per space, however many times the blob is
+// allocated in the space.
+type UsageStore interface {
+	// Allocate records that size bytes were allocated for the blob in the
+	// space. It returns a [QuotaExceededError] if recording the allocation
+	// would exceed the space or node quota. It is not an error to allocate a
+	// blob that is already allocated in the space, and the quota is not checked
+	// in that case.
+	Allocate(ctx context.Context, space did.DID, digest multihash.Multihash, size uint64) error
+	// Receive records that the bytes allocated for the blob in the space were
+	// received. It has no effect if the blob is not allocated in the space, or
+	// was already received.
+	Receive(ctx context.Context, space did.DID, digest multihash.Multihash) error
+	// Release removes the bytes allocated for the blob in the space. It has no
+	// effect if the blob is not allocated in the space.
+	Release(ctx context.Context, space did.DID, digest multihash.Multihash) error
+	// Get retrieves the usage of a space. Spaces that have never allocated a
+	// blob have zero usage.
+	Get(ctx context.Context, space did.DID) (usage.Usage, error)
+	// Total retrieves the usage summed across every space.
+	Total(ctx context.Context) (usage.Usage, error)
+	// Quota returns the limits enforced when allocating.
+	Quota() Quota
+}
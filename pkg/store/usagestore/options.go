@@ -0,0 +1,28 @@
+package usagestore
+
+// Quota limits the number of bytes that can be allocated. A limit of zero
+// means unlimited.
+type Quota struct {
+	// Space is the maximum number of bytes each space may allocate.
+	Space uint64
+	// Node is the maximum number of bytes that may be allocated across every
+	// space.
+	Node uint64
+}
+
+type Option func(*DsUsageStore)
+
+// WithSpaceQuota limits the number of bytes each space may allocate.
+func WithSpaceQuota(limit uint64) Option {
+	return func(d *DsUsageStore) {
+		d.quota.Space = limit
+	}
+}
+
+// WithNodeQuota limits the number of bytes that may be allocated across every
+// space.
+func WithNodeQuota(limit uint64) Option {
+	return func(d *DsUsageStore) {
+		d.quota.Node = limit
+	}
+}
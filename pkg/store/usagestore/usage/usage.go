@@ -0,0 +1,82 @@
+package usage
+
+import (
+	"bytes"
+	// for go:embed
+	_ "embed"
+	"fmt"
+
+	ipldprime "github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/storacha/go-ucanto/core/ipld"
+)
+
+//go:embed usage.ipldsch
+var usageSchema []byte
+
+var usageTS *schema.TypeSystem
+
+func init() {
+	ts, err := ipldprime.LoadSchemaBytes(usageSchema)
+	if err != nil {
+		panic(fmt.Errorf("loading usage schema: %w", err))
+	}
+	usageTS = ts
+}
+
+func UsageType() schema.Type {
+	return usageTS.TypeByName("Usage")
+}
+
+// Usage is the number of bytes used by a blob, a space or the whole node.
+type Usage struct {
+	// Allocated is the number of bytes allocated.
+	Allocated uint64
+	// Received is the number of allocated bytes that have been received and
+	// accepted.
+	Received uint64
+}
+
+func (u Usage) ToIPLD() (datamodel.Node, error) {
+	return ipld.WrapWithRecovery(&u, UsageType())
+}
+
+func Encode(usage Usage, enc codec.Encoder) ([]byte, error) {
+	n, err := usage.ToIPLD()
+	if err != nil {
+		return nil, fmt.Errorf("encoding to IPLD: %w", err)
+	}
+
+	if enc == nil {
+		enc = dagcbor.Encode
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	err = enc(n, buf)
+	if err != nil {
+		return nil, fmt.Errorf("encoding to data format: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func Decode(data []byte, dec codec.Decoder) (Usage, error) {
+	if dec == nil {
+		dec = dagcbor.Decode
+	}
+
+	nb := bindnode.Prototype((*Usage)(nil), UsageType()).NewBuilder()
+
+	err := dec(nb, bytes.NewBuffer(data))
+	if err != nil {
+		return Usage{}, fmt.Errorf("decoding from data format: %w", err)
+	}
+
+	nd := nb.Build()
+	u := bindnode.Unwrap(nd).(*Usage)
+	return *u, nil
+}